@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// hostScannedMsg carries the result of a manually added host's scan
+type hostScannedMsg struct {
+	device scanner.Device
+	err    error
+}
+
+// addHostPrompt is shown in the help box while an address is typed
+func (m *Model) addHostPrompt() string {
+	return fmt.Sprintf("Add host: %s█  • Enter Scan • Esc Cancel", m.hostInput)
+}
+
+// updateAddHost handles keys while the add host prompt is open
+func (m *Model) updateAddHost(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.addingHost = false
+		return m, m.shutdown()
+	case "esc":
+		m.addingHost = false
+	case "backspace":
+		if len(m.hostInput) > 0 {
+			m.hostInput = m.hostInput[:len(m.hostInput)-1]
+		}
+	case "enter":
+		ip := net.ParseIP(m.hostInput).To4()
+		if ip == nil {
+			m.addingHost = false
+			m.setStatus(fmt.Sprintf("Invalid IPv4 address %q", m.hostInput))
+			return m, m.clearStatusAfter(2 * time.Second)
+		}
+		m.addingHost = false
+		m.setStatus(fmt.Sprintf("Scanning %s...", ip))
+		return m, m.scanHost(ip.String())
+	default:
+		if matched, _ := regexp.MatchString(`^[0-9.]$`, msg.String()); matched && len(m.hostInput) < len("255.255.255.255") {
+			m.hostInput += msg.String()
+		}
+	}
+	return m, nil
+}
+
+// scanHost probes a single address with a scanner of its own, so it can
+// run alongside a sweep. The host may sit outside the scanned subnet, so
+// the OS picks the source address unless -source-ip is set.
+func (m *Model) scanHost(ip string) tea.Cmd {
+	opts := newScannerOptions()
+	opts.Debug = false // Keep the sweep's report file
+
+	return func() tea.Msg {
+		log.Printf("Manually scanning %s", ip)
+		opts.Gateway = discoverGateway()
+		s := scanner.NewScannerWithOptions(opts)
+		defer s.Close()
+		device, err := s.ScanHost(ip)
+		return hostScannedMsg{device: device, err: err}
+	}
+}
+
+// addHost inserts a manually scanned device into the results, whether or not
+// it answered, and selects it
+func (m *Model) addHost(msg hostScannedMsg) tea.Cmd {
+	if msg.err != nil {
+		m.setStatus(fmt.Sprintf("Add host failed: %v", msg.err))
+		return m.clearStatusAfter(3 * time.Second)
+	}
+
+	device := msg.device
+	device.AddNote(scanner.NoteAddedManually)
+	m.deviceMutex.Lock()
+	device.CarrySeen(m.history[device.IPAddress])
+	m.devices[device.IPAddress] = device
+	m.deviceMutex.Unlock()
+	m.scanSelectedIP = device.IPAddress
+
+	if webServer != nil {
+		webServer.UpdateDevices(m.devices)
+	}
+
+	m.setStatus(fmt.Sprintf("Added %s (%s)", device.IPAddress, device.Status))
+	return m.clearStatusAfter(3 * time.Second)
+}
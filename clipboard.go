@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// errNoClipboard is returned when no system clipboard is reachable, e.g. over SSH
+var errNoClipboard = errors.New("no clipboard available")
+
+// clipboardMsg reports the outcome of a clipboard copy
+type clipboardMsg struct {
+	label string
+	err   error
+}
+
+// clearStatusMsg clears the transient status message, unless another has
+// been set since the one seq numbers
+type clearStatusMsg struct {
+	seq int
+}
+
+// setStatus shows text as the transient status message
+func (m *Model) setStatus(text string) {
+	m.statusMessage = text
+	m.statusSeq++
+}
+
+// clearStatusAfter schedules the current status message to be cleared
+func (m *Model) clearStatusAfter(d time.Duration) tea.Cmd {
+	seq := m.statusSeq
+	return tea.Tick(d, func(t time.Time) tea.Msg {
+		return clearStatusMsg{seq: seq}
+	})
+}
+
+// copyToClipboard places text on the system clipboard using the platform's
+// clipboard utility
+func copyToClipboard(text string) error {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case "windows":
+		candidates = [][]string{{"clip"}}
+	default:
+		// Without a display server there is no clipboard to talk to
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return errNoClipboard
+		}
+		candidates = [][]string{
+			{"wl-copy"},
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+	}
+
+	for _, candidate := range candidates {
+		path, err := exec.LookPath(candidate[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, candidate[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errNoClipboard
+}
+
+// copyCmd copies text to the clipboard in the background
+func copyCmd(text, label string) tea.Cmd {
+	return func() tea.Msg {
+		return clipboardMsg{label: label, err: copyToClipboard(text)}
+	}
+}
+
+// formatDeviceRecord renders every known field of a device as plain text
+func formatDeviceRecord(device scanner.Device) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "IP Address: %s\n", device.IPAddress)
+	if len(device.AllIPs) > 1 {
+		fmt.Fprintf(&b, "All IPs: %s\n", strings.Join(device.AllIPs, ", "))
+	}
+	if len(device.Hostname) > 0 {
+		fmt.Fprintf(&b, "Hostname: %s\n", strings.Join(device.Hostname, ", "))
+	}
+	if device.MACAddress != "" {
+		fmt.Fprintf(&b, "MAC Address: %s\n", device.MACAddress)
+	}
+	if device.Vendor != "" {
+		fmt.Fprintf(&b, "Vendor: %s\n", device.Vendor)
+	}
+	if device.DeviceType != "" {
+		fmt.Fprintf(&b, "Device Type: %s\n", device.DeviceType)
+	}
+	if device.Role != "" {
+		fmt.Fprintf(&b, "Role: %s\n", device.Role)
+	}
+	if device.Version != "" {
+		fmt.Fprintf(&b, "Version: %s\n", device.Version)
+	}
+	if device.Domain != "" {
+		fmt.Fprintf(&b, "Domain: %s\n", device.Domain)
+	}
+	if device.MDNSName != "" {
+		fmt.Fprintf(&b, "mDNS Name: %s\n", device.MDNSName)
+	}
+	fmt.Fprintf(&b, "Status: %s\n", device.Status)
+	if !device.FirstSeen.IsZero() {
+		fmt.Fprintf(&b, "First Seen: %s\n", device.FirstSeen.Format(time.RFC3339))
+		fmt.Fprintf(&b, "Last Seen: %s\n", device.LastSeen.Format(time.RFC3339))
+	}
+	if len(device.OpenPorts) > 0 {
+		fmt.Fprintf(&b, "Open Ports: %s\n", formatPortList(device.OpenPorts))
+	}
+	if len(device.ClosedPorts) > 0 {
+		fmt.Fprintf(&b, "Closed Ports: %s\n", formatPortList(device.ClosedPorts))
+	}
+	if len(device.FilteredPorts) > 0 {
+		fmt.Fprintf(&b, "Filtered Ports: %s\n", formatPortList(device.FilteredPorts))
+	}
+	for _, port := range device.WebPorts() {
+		fmt.Fprintf(&b, "Web %s: %s\n", scanner.FormatPort(port), device.Web[port])
+	}
+	if device.CaptivePortal {
+		fmt.Fprintf(&b, "Captive Portal: yes\n")
+	}
+	if device.VNC != nil {
+		fmt.Fprintf(&b, "VNC: %s\n", device.VNC)
+	}
+	if device.Printer != nil {
+		fmt.Fprintf(&b, "Printer: %s\n", device.Printer)
+	}
+	for _, port := range device.BannerPorts() {
+		fmt.Fprintf(&b, "Banner %s: %s\n", scanner.FormatPort(port), device.Banners[port])
+	}
+	if device.AnonymousFTP {
+		fmt.Fprintf(&b, "Anonymous FTP: allowed\n")
+	}
+	for _, port := range device.CertificatePorts() {
+		fmt.Fprintf(&b, "Certificate %s: %s\n", scanner.FormatPort(port), device.Certificates[port])
+	}
+	if len(device.MDNSServices) > 0 {
+		services := make([]string, 0, len(device.MDNSServices))
+		for k, v := range device.MDNSServices {
+			services = append(services, fmt.Sprintf("%s: %s", k, v))
+		}
+		sort.Strings(services)
+		fmt.Fprintf(&b, "mDNS Services: %s\n", strings.Join(services, "; "))
+	}
+	if len(device.Notes) > 0 {
+		fmt.Fprintf(&b, "Notes: %s\n", strings.Join(device.Notes, "; "))
+	}
+	return b.String()
+}
+
+// formatPortList formats ports with their service names, e.g. "22 (SSH), 80 (HTTP)"
+func formatPortList(ports []int) string {
+	names := make([]string, 0, len(ports))
+	for _, port := range ports {
+		names = append(names, scanner.FormatPort(port))
+	}
+	return strings.Join(names, ", ")
+}
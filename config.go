@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds defaults loaded from a -config file. Every setting mirrors the
+// long command line flag of the same name, and a flag given on the command
+// line always wins over the file. Unset fields keep the built-in defaults.
+type Config struct {
+	// Scanning
+	Workers       *int    `json:"workers,omitempty" yaml:"workers,omitempty"`
+	Resolvers     *int    `json:"resolvers,omitempty" yaml:"resolvers,omitempty"`
+	MaxSockets    *int    `json:"max_sockets,omitempty" yaml:"max_sockets,omitempty"`
+	Retries       *int    `json:"retries,omitempty" yaml:"retries,omitempty"`
+	ResultsBuffer *int    `json:"results_buffer,omitempty" yaml:"results_buffer,omitempty"`
+	Intensity     *string `json:"intensity,omitempty" yaml:"intensity,omitempty"`
+	ConnectOnly   *bool   `json:"connect_only,omitempty" yaml:"connect_only,omitempty"`
+	Ports         []int   `json:"ports,omitempty" yaml:"ports,omitempty"`
+	TLSPorts      []int   `json:"tls_ports,omitempty" yaml:"tls_ports,omitempty"`
+	TLSSNI        *string `json:"tls_sni,omitempty" yaml:"tls_sni,omitempty"`
+	PortProfile   *string `json:"port_profile,omitempty" yaml:"port_profile,omitempty"`
+	MaxHosts      *int    `json:"max_hosts,omitempty" yaml:"max_hosts,omitempty"`
+	MaxResults    *int    `json:"max_results,omitempty" yaml:"max_results,omitempty"`
+	Range         *string `json:"range,omitempty" yaml:"range,omitempty"`
+	Targets       *string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Interval      *string `json:"interval,omitempty" yaml:"interval,omitempty"` // Duration, e.g. "10m"
+	Timeout       *string `json:"timeout,omitempty" yaml:"timeout,omitempty"`   // Duration, e.g. "5m"
+	MergeMAC      *bool   `json:"merge_mac,omitempty" yaml:"merge_mac,omitempty"`
+	Redact        *bool   `json:"redact,omitempty" yaml:"redact,omitempty"`
+	Append        *bool   `json:"append,omitempty" yaml:"append,omitempty"`
+	Graph         *string `json:"graph,omitempty" yaml:"graph,omitempty"`
+	Columns       *string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Out           *string `json:"out,omitempty" yaml:"out,omitempty"`
+	OnComplete    *string `json:"on_complete,omitempty" yaml:"on_complete,omitempty"`
+	Stats         *string `json:"stats,omitempty" yaml:"stats,omitempty"`
+	Control       *string `json:"control,omitempty" yaml:"control,omitempty"`
+	Filtered      *bool   `json:"filtered,omitempty" yaml:"filtered,omitempty"`
+	SourceIP      *string `json:"source_ip,omitempty" yaml:"source_ip,omitempty"`
+	SkipOffline   *bool   `json:"skip_offline,omitempty" yaml:"skip_offline,omitempty"`
+	SkipSelf      *bool   `json:"skip_self,omitempty" yaml:"skip_self,omitempty"`
+	Adaptive      *bool   `json:"adaptive,omitempty" yaml:"adaptive,omitempty"`
+	Randomize     *bool   `json:"randomize,omitempty" yaml:"randomize,omitempty"`
+	Passive       *bool   `json:"passive,omitempty" yaml:"passive,omitempty"`
+	Listen        *string `json:"listen,omitempty" yaml:"listen,omitempty"` // Duration, e.g. "2m"
+	Sniff         *bool   `json:"sniff,omitempty" yaml:"sniff,omitempty"`
+	ARP           *bool   `json:"arp,omitempty" yaml:"arp,omitempty"`
+	RemoteMAC     *bool   `json:"remote_mac,omitempty" yaml:"remote_mac,omitempty"`
+	Explain       *bool   `json:"explain,omitempty" yaml:"explain,omitempty"`
+	SOCKS5        *string `json:"socks5,omitempty" yaml:"socks5,omitempty"`
+	FTPAnonymous  *bool   `json:"ftp_anonymous,omitempty" yaml:"ftp_anonymous,omitempty"`
+	Notify        *string `json:"notify,omitempty" yaml:"notify,omitempty"` // "done" or "found"
+	GatewayFirst  *bool   `json:"gateway_first,omitempty" yaml:"gateway_first,omitempty"`
+	UserAgent     *string `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	PreferMDNS    *bool   `json:"prefer_mdns,omitempty" yaml:"prefer_mdns,omitempty"`
+
+	// Filters applied to results
+	OnlyPorts      []int   `json:"only_ports,omitempty" yaml:"only_ports,omitempty"`
+	OnlyVendor     *string `json:"only_vendor,omitempty" yaml:"only_vendor,omitempty"`
+	OnlyNoHostname *bool   `json:"only_no_hostname,omitempty" yaml:"only_no_hostname,omitempty"`
+
+	// Web interface
+	Web     *bool   `json:"web,omitempty" yaml:"web,omitempty"`
+	WebPort *int    `json:"port,omitempty" yaml:"port,omitempty"`
+	WebBind *string `json:"web_bind,omitempty" yaml:"web_bind,omitempty"`
+
+	// Logging and telemetry
+	Debug       *bool   `json:"debug,omitempty" yaml:"debug,omitempty"`
+	DebugLog    *string `json:"debug_log,omitempty" yaml:"debug_log,omitempty"`
+	Report      *string `json:"report,omitempty" yaml:"report,omitempty"`
+	NoTelemetry *bool   `json:"no_telemetry,omitempty" yaml:"no_telemetry,omitempty"`
+}
+
+// loadConfig reads a JSON or YAML config file, chosen by its extension
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&cfg)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// flagValues returns the config as flag name to value, for the settings the
+// file sets
+func (c *Config) flagValues() map[string]string {
+	values := make(map[string]string)
+	setInt := func(name string, v *int) {
+		if v != nil {
+			values[name] = strconv.Itoa(*v)
+		}
+	}
+	setBool := func(name string, v *bool) {
+		if v != nil {
+			values[name] = strconv.FormatBool(*v)
+		}
+	}
+	setString := func(name string, v *string) {
+		if v != nil {
+			values[name] = *v
+		}
+	}
+	setPorts := func(name string, v []int) {
+		if len(v) > 0 {
+			ports := make([]string, len(v))
+			for i, port := range v {
+				ports[i] = strconv.Itoa(port)
+			}
+			values[name] = strings.Join(ports, ",")
+		}
+	}
+
+	setInt("workers", c.Workers)
+	setInt("resolvers", c.Resolvers)
+	setInt("max-sockets", c.MaxSockets)
+	setInt("retries", c.Retries)
+	setInt("results-buffer", c.ResultsBuffer)
+	setString("intensity", c.Intensity)
+	setBool("connect-only", c.ConnectOnly)
+	setPorts("ports", c.Ports)
+	setPorts("tls-ports", c.TLSPorts)
+	setString("tls-sni", c.TLSSNI)
+	setString("port-profile", c.PortProfile)
+	setInt("max-hosts", c.MaxHosts)
+	setInt("max-results", c.MaxResults)
+	setString("range", c.Range)
+	setString("targets", c.Targets)
+	setString("interval", c.Interval)
+	setString("timeout", c.Timeout)
+	setBool("merge-mac", c.MergeMAC)
+	setBool("redact", c.Redact)
+	setBool("append", c.Append)
+	setString("graph", c.Graph)
+	setString("columns", c.Columns)
+	setString("out", c.Out)
+	setString("on-complete", c.OnComplete)
+	setString("stats", c.Stats)
+	setString("control", c.Control)
+	setBool("filtered", c.Filtered)
+	setString("source-ip", c.SourceIP)
+	setBool("skip-offline", c.SkipOffline)
+	setBool("skip-self", c.SkipSelf)
+	setBool("adaptive", c.Adaptive)
+	setBool("randomize", c.Randomize)
+	setBool("passive", c.Passive)
+	setString("listen", c.Listen)
+	setBool("sniff", c.Sniff)
+	setBool("arp", c.ARP)
+	setBool("remote-mac", c.RemoteMAC)
+	setBool("explain", c.Explain)
+	setString("socks5", c.SOCKS5)
+	setBool("ftp-anon", c.FTPAnonymous)
+	setString("notify", c.Notify)
+	setBool("gateway-first", c.GatewayFirst)
+	setString("user-agent", c.UserAgent)
+	setBool("prefer-mdns", c.PreferMDNS)
+	setPorts("only-ports", c.OnlyPorts)
+	setString("only-vendor", c.OnlyVendor)
+	setBool("only-no-hostname", c.OnlyNoHostname)
+	setBool("web", c.Web)
+	setInt("port", c.WebPort)
+	setString("web-bind", c.WebBind)
+	setBool("debug", c.Debug)
+	setString("debug-log", c.DebugLog)
+	setString("report", c.Report)
+	setBool("no-telemetry", c.NoTelemetry)
+	return values
+}
+
+// flagAliases maps shorthand flags to the long flag they share a value with
+var flagAliases = map[string]string{
+	"d":        "debug",
+	"w":        "web",
+	"p":        "port",
+	"web-port": "port",
+	"q":        "quiet",
+	"v":        "version",
+}
+
+// explicitFlags returns the long names of the flags given on the command line
+func explicitFlags() map[string]bool {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if long, ok := flagAliases[name]; ok {
+			name = long
+		}
+		explicit[name] = true
+	})
+	// A port list and a port profile are one setting
+	if explicit["ports"] || explicit["port-profile"] {
+		explicit["ports"], explicit["port-profile"] = true, true
+	}
+	return explicit
+}
+
+// applyDefaults sets each flag in values that is not already in explicit,
+// then marks it explicit so lower-precedence sources leave it alone. source
+// names where the values came from for error messages.
+func applyDefaults(values map[string]string, explicit map[string]bool, source string) error {
+	for name, value := range values {
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s: invalid %s %q: %w", source, name, value, err)
+		}
+		explicit[name] = true
+	}
+	return nil
+}
+
+// envPrefix starts the environment variables that mirror the long flags,
+// e.g. NETVENTORY_WORKERS for -workers and NETVENTORY_NO_TELEMETRY for
+// -no-telemetry
+const envPrefix = "NETVENTORY_"
+
+// envAliases are environment variable names that read better in container
+// manifests than the flag they set
+var envAliases = map[string]string{
+	envPrefix + "WEB_PORT": "port",
+}
+
+// envSkip lists flags that make no sense to set from the environment
+var envSkip = map[string]bool{
+	"version":    true,
+	"update-oui": true,
+	"oui-sha256": true,
+}
+
+// envValues returns the flag values set through NETVENTORY_* variables
+func envValues() map[string]string {
+	values := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, short := flagAliases[f.Name]; short || envSkip[f.Name] {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			values[f.Name] = value
+		}
+	})
+	for name, flagName := range envAliases {
+		if value, ok := os.LookupEnv(name); ok {
+			if _, set := values[flagName]; !set {
+				values[flagName] = value
+			}
+		}
+	}
+	return values
+}
+
+// parsePortList parses a comma-separated list of TCP ports
+func parsePortList(list string) ([]int, error) {
+	var ports []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %q", list)
+	}
+	return ports, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ramborogers/netventory/export"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// controlReplyTimeout bounds how long a control command waits for the TUI,
+// which stops answering once it has quit
+const controlReplyTimeout = 5 * time.Second
+
+// controlMsg carries a command read from the control socket into the update
+// loop, so it changes the model the same way a key press would
+type controlMsg struct {
+	command string
+	arg     string
+	reply   chan interface{}
+}
+
+// controlError is the reply to a command that failed
+type controlError struct {
+	Error string `json:"error"`
+}
+
+// controlOK is the reply to a scan or stop command that took effect
+type controlOK struct {
+	OK    bool   `json:"ok"`
+	Range string `json:"range,omitempty"`
+}
+
+// controlStatus is the reply to the status command
+type controlStatus struct {
+	Scanning   bool   `json:"scanning"`
+	Range      string `json:"range,omitempty"`
+	Started    string `json:"started,omitempty"`
+	Scanned    int32  `json:"scanned"`
+	Total      int32  `json:"total"`
+	Discovered int32  `json:"discovered"`
+	Truncated  int64  `json:"truncated,omitempty"` // Devices dropped past --max-results
+	Aborted    string `json:"aborted,omitempty"`   // Why the last scan was aborted, if it was
+}
+
+// controlResults is the reply to the results command
+type controlResults struct {
+	SchemaVersion int              `json:"schema_version"` // Version of the device objects, as in JSON exports
+	Devices       []scanner.Device `json:"devices"`
+}
+
+// listenControl listens on the Unix socket at path, replacing a socket left
+// behind by an earlier run. Only the current user may connect: the socket is
+// made in a directory only they can enter and moved into place once its
+// mode is set, so no one else can connect in between.
+func listenControl(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".netventory-control-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "socket")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The listener would remove the private path it was made at, so the
+	// socket moved into place is removed by controlListener instead
+	ln.SetUnlinkOnClose(false)
+	if err := os.Chmod(private, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(private, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return controlListener{ln, path}, nil
+}
+
+// controlListener removes the control socket at path when it is closed
+type controlListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l controlListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// serveControl accepts control connections until ln is closed. Each line a
+// client sends is one command, answered by one line of JSON:
+//
+//	scan <cidr>  start scanning cidr
+//	stop         stop the running scan
+//	status       progress of the current or last scan
+//	results      the devices found, as listed in the results table
+func serveControl(ln net.Listener, p *tea.Program) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Control socket stopped: %v", err)
+			}
+			return
+		}
+		go handleControlConn(conn, p)
+	}
+}
+
+// handleControlConn answers the commands sent on one connection until the
+// client hangs up
+func handleControlConn(conn net.Conn, p *tea.Program) {
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	encoder.SetEscapeHTML(false)
+	lines := bufio.NewScanner(conn)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		msg := controlMsg{command: strings.ToLower(fields[0]), reply: make(chan interface{}, 1)}
+		if len(fields) > 1 {
+			msg.arg = fields[1]
+		}
+		log.Printf("Control command: %s", lines.Text())
+
+		var reply interface{}
+		p.Send(msg)
+		select {
+		case reply = <-msg.reply:
+		case <-time.After(controlReplyTimeout):
+			reply = controlError{Error: "netventory is not responding"}
+		}
+		if err := encoder.Encode(reply); err != nil {
+			log.Printf("Error writing control reply: %v", err)
+			return
+		}
+	}
+}
+
+// handleControl runs a control command against the model and sends its reply
+func (m *Model) handleControl(msg controlMsg) tea.Cmd {
+	switch msg.command {
+	case "scan":
+		return m.controlScan(msg)
+	case "stop":
+		if !m.scanningActive || m.scanner == nil {
+			msg.reply <- controlError{Error: "no scan is running"}
+			return nil
+		}
+		m.scanner.Stop()
+		m.scanningActive = false
+		m.currentScreen = screenResults
+		msg.reply <- controlOK{OK: true, Range: m.scanInfo.Range}
+	case "status":
+		status := controlStatus{
+			Scanning:   m.scanningActive,
+			Range:      m.scanInfo.Range,
+			Scanned:    m.scannedCount,
+			Total:      m.totalIPs,
+			Discovered: m.discoveredCount,
+		}
+		if m.scanner != nil {
+			status.Truncated = m.scanner.Stats().Truncated
+		}
+		if !m.scanStartTime.IsZero() {
+			status.Started = m.scanStartTime.Format(time.RFC3339)
+		}
+		if m.scanErr != nil {
+			status.Aborted = m.scanErr.Error()
+		}
+		msg.reply <- status
+	case "results":
+		devices := m.visibleDevices()
+		results := controlResults{
+			SchemaVersion: export.SchemaVersion,
+			Devices:       make([]scanner.Device, 0, len(devices)),
+		}
+		for _, ip := range export.SortedIPs(devices) {
+			results.Devices = append(results.Devices, devices[ip])
+		}
+		msg.reply <- results
+	default:
+		msg.reply <- controlError{Error: fmt.Sprintf("unknown command %q (want scan <cidr>, stop, status or results)", msg.command)}
+	}
+	return nil
+}
+
+// controlScan starts a scan of msg.arg as if it had been confirmed on the
+// confirm screen. Ranges over --max-hosts are refused rather than confirmed.
+func (m *Model) controlScan(msg controlMsg) tea.Cmd {
+	_, ipNet, err := net.ParseCIDR(msg.arg)
+	if err != nil {
+		msg.reply <- controlError{Error: fmt.Sprintf("invalid range %q", msg.arg)}
+		return nil
+	}
+	cidr := ipNet.String() // Scan the network an address with a prefix is in
+	if m.scanningActive {
+		msg.reply <- controlError{Error: "a scan is already running; stop it first"}
+		return nil
+	}
+	if err := newScannerOptions().CheckHosts(cidr, scanner.CountIPs(ipNet)); err != nil {
+		msg.reply <- controlError{Error: err.Error()}
+		return nil
+	}
+
+	// Send probes from the primary interface unless one was chosen by hand
+	if (m.currentScreen == screenWelcome || m.currentScreen == screenInterfaces) && len(m.interfaces) > 0 {
+		m.selectedIndex = primaryInterfaceIndex(m.interfaces)
+	}
+	m.proposedRange = cidr
+	m.editingRange = false
+	m.confirmingLarge = false
+	m.quickRange = ""
+	m.showingDetails = false
+	m.currentScreen = screenScanning
+	m.scanningActive = true
+	msg.reply <- controlOK{OK: true, Range: cidr}
+	return tea.Batch(
+		m.scanNetwork(cidr),
+		tick(),
+	)
+}
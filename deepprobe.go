@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// deepProbedMsg carries the result of a deep probe of a listed device
+type deepProbedMsg struct {
+	device scanner.Device
+	err    error
+}
+
+// deepProbe investigates ip with a scanner of its own, so it can run
+// alongside a sweep: the deep port set, every hostname resolver and longer
+// timeouts, for a host the sweep couldn't identify
+func (m *Model) deepProbe(ip string) tea.Cmd {
+	opts := newScannerOptions().Deep()
+	opts.Debug = false // Keep the sweep's report file
+
+	return func() tea.Msg {
+		log.Printf("Deep probing %s", ip)
+		opts.Gateway = discoverGateway()
+		s := scanner.NewScannerWithOptions(opts)
+		defer s.Close()
+		device, err := s.ScanHost(ip)
+		return deepProbedMsg{device: device, err: err}
+	}
+}
+
+// applyDeepProbe replaces the listed device with what the deep probe found,
+// keeping what the sweep learned that the probe didn't. A host that no
+// longer answers is left as the sweep found it.
+func (m *Model) applyDeepProbe(msg deepProbedMsg) tea.Cmd {
+	device := msg.device
+	switch {
+	case msg.err != nil:
+		m.setStatus(fmt.Sprintf("Deep probe failed: %v", msg.err))
+		return m.clearStatusAfter(3 * time.Second)
+	case device.Status != "Up":
+		m.setStatus(fmt.Sprintf("Deep probe of %s got no answer", device.IPAddress))
+		return m.clearStatusAfter(3 * time.Second)
+	}
+
+	m.deviceMutex.Lock()
+	if previous, ok := m.devices[device.IPAddress]; ok {
+		device.Merge(previous)
+	}
+	device.AddNote(scanner.NoteDeepProbed)
+	m.devices[device.IPAddress] = device
+	devices := maps.Clone(m.devices)
+	m.deviceMutex.Unlock()
+	if m.showingDetails && m.deviceDetailsView.GetDevice().IPAddress == device.IPAddress {
+		m.deviceDetailsView.SetDevice(device)
+	}
+
+	if webServer != nil {
+		webServer.UpdateDevices(devices)
+	}
+
+	if device.IsMystery() {
+		m.setStatus(fmt.Sprintf("Deep probe of %s found no name or MAC address", device.IPAddress))
+	} else {
+		m.setStatus(fmt.Sprintf("Deep probe of %s done", device.IPAddress))
+	}
+	return m.clearStatusAfter(3 * time.Second)
+}
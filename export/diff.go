@@ -0,0 +1,68 @@
+package export
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// Diff lists how the devices found by one scan differ from the previous one
+type Diff struct {
+	Added   []string `json:"added"`   // IPs found now but not before
+	Removed []string `json:"removed"` // IPs found before but not now
+	Changed []string `json:"changed"` // IPs whose MAC, hostname or open ports changed
+}
+
+// Empty reports whether the two scans found the same devices
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String summarizes the diff, e.g. "+2 new, -1 gone, 1 changed"
+func (d Diff) String() string {
+	return fmt.Sprintf("+%d new, -%d gone, %d changed", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+// DiffDevices compares the devices of two scans, with IPs in sorted order
+func DiffDevices(previous, current map[string]scanner.Device) Diff {
+	var diff Diff
+	for _, ip := range SortedIPs(current) {
+		before, ok := previous[ip]
+		if !ok {
+			diff.Added = append(diff.Added, ip)
+			continue
+		}
+		after := current[ip]
+		if before.MACAddress != after.MACAddress ||
+			!slices.Equal(before.Hostname, after.Hostname) ||
+			!samePorts(before.OpenPorts, after.OpenPorts) {
+			diff.Changed = append(diff.Changed, ip)
+		}
+	}
+	for _, ip := range SortedIPs(previous) {
+		if _, ok := current[ip]; !ok {
+			diff.Removed = append(diff.Removed, ip)
+		}
+	}
+	return diff
+}
+
+// RecordSeen adds the devices found up in devices to history, which keeps
+// the devices of earlier scans so a rescan can carry their first-seen times
+// forward with Device.CarrySeen
+func RecordSeen(history, devices map[string]scanner.Device) {
+	for ip, device := range devices {
+		if device.Status == "Up" {
+			history[ip] = device
+		}
+	}
+}
+
+// samePorts compares port lists regardless of the order they were found in
+func samePorts(a, b []int) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,197 @@
+// Package export formats scan results for saving and sharing
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// CompareIPs compares two IP addresses for sorting
+func CompareIPs(a, b string) int {
+	aOctets := strings.Split(a, ".")
+	bOctets := strings.Split(b, ".")
+
+	for i := 0; i < 4 && i < len(aOctets) && i < len(bOctets); i++ {
+		aNum, _ := strconv.Atoi(aOctets[i])
+		bNum, _ := strconv.Atoi(bOctets[i])
+		if aNum != bNum {
+			return aNum - bNum
+		}
+	}
+	return 0
+}
+
+// SortedIPs returns the keys of devices ordered by IP address
+func SortedIPs(devices map[string]scanner.Device) []string {
+	ips := make([]string, 0, len(devices))
+	for ip := range devices {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return CompareIPs(ips[i], ips[j]) < 0
+	})
+	return ips
+}
+
+// WriteCSV writes devices as CSV, preceded by a header with the version,
+// date and the scan parameters in info
+func WriteCSV(w io.Writer, devices map[string]scanner.Device, info ScanInfo) error {
+	writer := csv.NewWriter(w)
+
+	// Write header with version, timestamp and scan parameters
+	info.Command = info.command("csv")
+	for _, row := range info.csvRows() {
+		writer.Write(row)
+	}
+	writer.Write([]string{}) // Empty line
+
+	// Write CSV headers
+	writer.Write([]string{
+		"IP Address",
+		"Hostname",
+		"MAC Address",
+		"Open Ports",
+		"mDNS Name",
+		"mDNS Services",
+		"Notes",
+		"Closed Ports",
+		"Filtered Ports",
+		"Domain",
+		"First Seen",
+		"Last Seen",
+		"Role",
+	})
+
+	// Write device data sorted by IP for consistent output
+	for _, ip := range SortedIPs(devices) {
+		device := devices[ip]
+		// Format mDNS services
+		var mdnsServices string
+		if len(device.MDNSServices) > 0 {
+			services := make([]string, 0, len(device.MDNSServices))
+			for k, v := range device.MDNSServices {
+				services = append(services, fmt.Sprintf("%s: %s", k, v))
+			}
+			mdnsServices = strings.Join(services, "; ")
+		}
+
+		writer.Write([]string{
+			device.IPAddress,
+			strings.Join(device.Hostname, ", "),
+			device.MACAddress,
+			joinServices(device.OpenPorts, ", "),
+			device.MDNSName,
+			mdnsServices,
+			strings.Join(device.Notes, "; "),
+			joinPorts(device.ClosedPorts, ", "),
+			joinPorts(device.FilteredPorts, ", "),
+			device.Domain,
+			formatSeen(device.FirstSeen),
+			formatSeen(device.LastSeen),
+			device.Role,
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatSeen formats a first or last seen time for CSV, empty for devices
+// never found up
+func formatSeen(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// SchemaVersion is the version of the JSON export format. It only changes
+// when a field is renamed or removed or its meaning changes; new fields
+// can appear without a bump.
+const SchemaVersion = 1
+
+// Envelope wraps every JSON export so consumers can check the format
+// before reading the devices
+type Envelope struct {
+	SchemaVersion     int              `json:"schema_version"`
+	GeneratedAt       time.Time        `json:"generated_at"`
+	NetventoryVersion string           `json:"netventory_version"`
+	Scan              *ScanInfo        `json:"scan,omitempty"`
+	Devices           []scanner.Device `json:"devices"`
+}
+
+// WriteJSON writes devices, sorted by IP, as an indented JSON Envelope
+// carrying the scan parameters in info
+func WriteJSON(w io.Writer, devices map[string]scanner.Device, info ScanInfo) error {
+	envelope := Envelope{
+		SchemaVersion:     SchemaVersion,
+		GeneratedAt:       time.Now().UTC(),
+		NetventoryVersion: info.Version,
+		Devices:           make([]scanner.Device, 0, len(devices)),
+	}
+	if info.Range != "" {
+		info.Command = info.command("json")
+		envelope.Scan = &info
+	}
+	for _, ip := range SortedIPs(devices) {
+		envelope.Devices = append(envelope.Devices, devices[ip])
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(envelope)
+}
+
+// WriteTable writes devices as aligned plain-text columns
+func WriteTable(w io.Writer, devices map[string]scanner.Device) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "IP ADDRESS\tHOSTNAME\tMAC ADDRESS\tVENDOR\tOPEN PORTS")
+	for _, ip := range SortedIPs(devices) {
+		device := devices[ip]
+		hostname := orNA(strings.Join(device.Hostname, ", "))
+		if device.Role != "" {
+			hostname = fmt.Sprintf("[%s] %s", device.Role, hostname)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			device.IPAddress,
+			hostname,
+			orNA(device.MACAddress),
+			orNA(device.Vendor),
+			orNA(joinServices(device.OpenPorts, ", ")))
+	}
+	return tw.Flush()
+}
+
+// joinPorts formats ports as a separated list
+func joinPorts(ports []int, sep string) string {
+	parts := make([]string, 0, len(ports))
+	for _, port := range ports {
+		parts = append(parts, strconv.Itoa(port))
+	}
+	return strings.Join(parts, sep)
+}
+
+// joinServices formats ports with their service names, e.g. "22 (SSH), 80 (HTTP)"
+func joinServices(ports []int, sep string) string {
+	parts := make([]string, 0, len(ports))
+	for _, port := range ports {
+		parts = append(parts, scanner.FormatPort(port))
+	}
+	return strings.Join(parts, sep)
+}
+
+// orNA substitutes "N/A" for empty values in text output
+func orNA(s string) string {
+	if s == "" {
+		return "N/A"
+	}
+	return s
+}
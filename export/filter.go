@@ -0,0 +1,60 @@
+package export
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// Filter keeps only the devices matching every criterion set, for targeted
+// audits such as finding every SMB server or every unnamed host. The zero
+// Filter keeps everything.
+type Filter struct {
+	Ports      []int  // Keep devices with any of these ports open
+	Vendor     string // Keep devices whose MAC vendor contains this, ignoring case
+	NoHostname bool   // Keep devices with no hostname or mDNS name
+}
+
+// Active reports whether the filter sets any criterion
+func (f Filter) Active() bool {
+	return len(f.Ports) > 0 || f.Vendor != "" || f.NoHostname
+}
+
+// Match reports whether device meets every criterion. Devices that are not
+// up never match an active filter.
+func (f Filter) Match(device scanner.Device) bool {
+	if !f.Active() {
+		return true
+	}
+	if device.Status != "Up" {
+		return false
+	}
+	if len(f.Ports) > 0 && !slices.ContainsFunc(device.OpenPorts, func(port int) bool {
+		return slices.Contains(f.Ports, port)
+	}) {
+		return false
+	}
+	if f.Vendor != "" && !strings.Contains(strings.ToLower(device.Vendor), strings.ToLower(f.Vendor)) {
+		return false
+	}
+	if f.NoHostname && (len(device.Hostname) > 0 || device.MDNSName != "") {
+		return false
+	}
+	return true
+}
+
+// Apply returns the devices that match f. An inactive filter returns devices
+// itself rather than a copy.
+func (f Filter) Apply(devices map[string]scanner.Device) map[string]scanner.Device {
+	if !f.Active() {
+		return devices
+	}
+	matched := make(map[string]scanner.Device)
+	for ip, device := range devices {
+		if f.Match(device) {
+			matched[ip] = device
+		}
+	}
+	return matched
+}
@@ -0,0 +1,180 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// Graph formats written by WriteGraph
+const (
+	GraphDOT  = "dot"  // Graphviz DOT
+	GraphJSON = "json" // Nodes and edges as JSON, e.g. for D3 or Cytoscape
+)
+
+// Node colors by device type; other types get one of typePalette
+var typeColors = map[string]string{
+	"":                           "#e0e0e0",
+	"Apple":                      "#b3cde3",
+	"Possible Apple":             "#dbe6f0",
+	scanner.TypePrinter:          "#ccebc5",
+	scanner.TypePossiblePrinter:  "#e5f5e0",
+	scanner.TypeDomainController: "#decbe4",
+	scanner.TypeProxmox:          "#fed9a6",
+	scanner.TypeESXi:             "#fed9a6",
+	scanner.TypeVCenter:          "#fed9a6",
+}
+
+var typePalette = []string{"#fbb4ae", "#ffffcc", "#e5d8bd", "#fddaec", "#b3e2cd", "#cbd5e8", "#f4cae4"}
+
+// hubColor fills the gateway, or the network standing in for it
+const hubColor = "#ffd92f"
+
+// GraphNode is a device, or the network when no gateway was found
+type GraphNode struct {
+	ID       string `json:"id"`
+	Label    string `json:"label"`
+	IP       string `json:"ip,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Vendor   string `json:"vendor,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Color    string `json:"color"`
+}
+
+// GraphEdge connects a device to the hub
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Graph is a star of the devices around the gateway: the data a scan has,
+// short of real topology
+type Graph struct {
+	Network string      `json:"network,omitempty"`
+	Hub     string      `json:"hub"` // ID of the gateway or network node
+	Nodes   []GraphNode `json:"nodes"`
+	Edges   []GraphEdge `json:"edges"`
+}
+
+// BuildGraph connects every device to the detected gateway, or to a node
+// for network when the gateway wasn't among them. Node IDs are assigned in
+// address order rather than taken from the addresses, which may be masked.
+func BuildGraph(devices map[string]scanner.Device, network string) Graph {
+	graph := Graph{Network: network, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for i, ip := range SortedIPs(devices) {
+		device := devices[ip]
+		node := GraphNode{
+			ID:     fmt.Sprintf("n%d", i+1),
+			Label:  device.IPAddress,
+			IP:     device.IPAddress,
+			Vendor: device.Vendor,
+			Type:   device.DeviceType,
+			Role:   device.Role,
+			Color:  typeColor(device.DeviceType),
+		}
+		if len(device.Hostname) > 0 {
+			node.Hostname = device.Hostname[0]
+			node.Label = node.Hostname
+		}
+		if device.Role == scanner.RoleGateway && graph.Hub == "" {
+			graph.Hub = node.ID
+			node.Color = hubColor
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	if graph.Hub == "" {
+		label := network
+		if label == "" {
+			label = "Network"
+		}
+		graph.Hub = "network"
+		graph.Nodes = append([]GraphNode{{ID: graph.Hub, Label: label, Color: hubColor}}, graph.Nodes...)
+	}
+	for _, node := range graph.Nodes {
+		if node.ID != graph.Hub {
+			graph.Edges = append(graph.Edges, GraphEdge{Source: graph.Hub, Target: node.ID})
+		}
+	}
+	return graph
+}
+
+// typeColor returns the fill color for deviceType, the same for a type
+// every time
+func typeColor(deviceType string) string {
+	if color, ok := typeColors[deviceType]; ok {
+		return color
+	}
+	h := fnv.New32a()
+	h.Write([]byte(deviceType))
+	return typePalette[h.Sum32()%uint32(len(typePalette))]
+}
+
+// WriteGraph writes graph to w in format, GraphDOT or GraphJSON
+func WriteGraph(w io.Writer, graph Graph, format string) error {
+	switch format {
+	case GraphDOT:
+		return writeDOT(w, graph)
+	case GraphJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(graph)
+	default:
+		return fmt.Errorf("unknown graph format %q (want %s or %s)", format, GraphDOT, GraphJSON)
+	}
+}
+
+// writeDOT writes graph as an undirected Graphviz graph laid out radially
+// around the hub, e.g. for dot -Ktwopi -Tsvg
+func writeDOT(w io.Writer, graph Graph) error {
+	var b strings.Builder
+	if graph.Network != "" {
+		fmt.Fprintf(&b, "// netventory scan of %s\n", graph.Network)
+	}
+	b.WriteString("graph netventory {\n")
+	fmt.Fprintf(&b, "\tlayout=twopi;\n\troot=%s;\n\toverlap=false;\n", dotQuote(graph.Hub))
+	b.WriteString("\tnode [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\", fontsize=10];\n\n")
+	for _, node := range graph.Nodes {
+		lines := []string{node.Label}
+		if node.IP != "" && node.IP != node.Label {
+			lines = append(lines, node.IP)
+		}
+		for _, extra := range []string{node.Role, node.Type, node.Vendor} {
+			if extra != "" {
+				lines = append(lines, extra)
+			}
+		}
+		for i, line := range lines {
+			lines[i] = dotEscape(line)
+		}
+		shape := ""
+		if node.ID == graph.Hub {
+			shape = ", shape=doubleoctagon"
+		}
+		fmt.Fprintf(&b, "\t%s [label=\"%s\", fillcolor=%s%s];\n",
+			dotQuote(node.ID), strings.Join(lines, `\n`), dotQuote(node.Color), shape)
+	}
+	if len(graph.Edges) > 0 {
+		b.WriteString("\n")
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "\t%s -- %s;\n", dotQuote(edge.Source), dotQuote(edge.Target))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote returns s as a quoted DOT ID
+func dotQuote(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+// dotEscape escapes s for use inside a quoted DOT string
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "\r", "").Replace(s)
+}
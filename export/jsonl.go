@@ -0,0 +1,102 @@
+package export
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// jsonlSyncInterval bounds how much a crash can lose: the file is synced to
+// disk at most this long after a device is written
+const jsonlSyncInterval = 2 * time.Second
+
+// JSONLWriter appends devices to a file as they are found, one JSON object
+// per line, so a long scan keeps what it found if it is killed. A device
+// written twice, e.g. after a late hostname, supersedes its earlier line. It
+// is safe for concurrent use, and a nil *JSONLWriter discards everything.
+type JSONLWriter struct {
+	mu       sync.Mutex
+	file     *os.File
+	encoder  *json.Encoder
+	lastSync time.Time
+	dirty    bool
+	timer    *time.Timer
+}
+
+// OpenJSONL opens path for appending, creating it if needed
+func OpenJSONL(path string) (*JSONLWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLWriter{file: f, encoder: json.NewEncoder(f), lastSync: time.Now()}, nil
+}
+
+// Write appends device as one line. The line reaches the OS immediately and
+// the disk within jsonlSyncInterval.
+func (w *JSONLWriter) Write(device scanner.Device) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	if err := w.encoder.Encode(device); err != nil {
+		return err
+	}
+	w.dirty = true
+	if time.Since(w.lastSync) >= jsonlSyncInterval {
+		return w.sync()
+	}
+	// Sync the tail of a burst even if nothing else is written
+	if w.timer == nil {
+		w.timer = time.AfterFunc(jsonlSyncInterval, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.timer = nil
+			if w.file != nil {
+				w.sync()
+			}
+		})
+	}
+	return nil
+}
+
+// sync flushes pending lines to disk. The caller must hold mu.
+func (w *JSONLWriter) sync() error {
+	w.lastSync = time.Now()
+	if !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.file.Sync()
+}
+
+// Close syncs and closes the file
+func (w *JSONLWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	syncErr := w.sync()
+	err := w.file.Close()
+	w.file = nil
+	if syncErr != nil {
+		return syncErr
+	}
+	return err
+}
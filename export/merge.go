@@ -0,0 +1,81 @@
+package export
+
+import (
+	"slices"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// MergeByMAC collapses devices that share a MAC address, such as multi-homed
+// hosts or hosts found in overlapping ranges, into one device keyed by its
+// lowest IP. The merged device lists every address in AllIPs and combines
+// the hostnames and open ports of its members. Devices without a MAC are
+// left as they are.
+func MergeByMAC(devices map[string]scanner.Device) map[string]scanner.Device {
+	merged := make(map[string]scanner.Device, len(devices))
+	primary := make(map[string]string) // MAC to the key of its merged device
+
+	for _, ip := range SortedIPs(devices) {
+		device := devices[ip]
+		if device.MACAddress == "" {
+			merged[ip] = device
+			continue
+		}
+
+		key, seen := primary[device.MACAddress]
+		if !seen {
+			primary[device.MACAddress] = ip
+			merged[ip] = device
+			continue
+		}
+
+		combined := merged[key]
+		if len(combined.AllIPs) == 0 {
+			// First merge: copy the slices so the input devices are untouched
+			combined.AllIPs = []string{combined.IPAddress}
+			combined.Hostname = slices.Clone(combined.Hostname)
+			combined.OpenPorts = slices.Clone(combined.OpenPorts)
+		}
+		combined.AllIPs = append(combined.AllIPs, device.IPAddress)
+		combined.Hostname = appendMissing(combined.Hostname, device.Hostname...)
+		for _, port := range device.OpenPorts {
+			if !slices.Contains(combined.OpenPorts, port) {
+				combined.OpenPorts = append(combined.OpenPorts, port)
+			}
+		}
+		if combined.MDNSName == "" {
+			combined.MDNSName = device.MDNSName
+		}
+		if combined.Role == "" {
+			combined.Role = device.Role
+		}
+		if combined.VNC == nil {
+			combined.VNC = device.VNC
+		}
+		if combined.Printer == nil {
+			combined.Printer = device.Printer
+		}
+		if combined.Banners == nil {
+			combined.Banners = device.Banners
+		}
+		combined.AnonymousFTP = combined.AnonymousFTP || device.AnonymousFTP
+		if !device.FirstSeen.IsZero() && (combined.FirstSeen.IsZero() || device.FirstSeen.Before(combined.FirstSeen)) {
+			combined.FirstSeen = device.FirstSeen
+		}
+		if device.LastSeen.After(combined.LastSeen) {
+			combined.LastSeen = device.LastSeen
+		}
+		merged[key] = combined
+	}
+	return merged
+}
+
+// appendMissing appends the values not already in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,169 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// ScanInfo records how a set of results was produced, so an export can be
+// audited and the scan repeated
+type ScanInfo struct {
+	Version     string    `json:"-"` // Carried by Envelope.NetventoryVersion
+	Range       string    `json:"range"`
+	Targets     string    `json:"targets,omitempty"` // File the addresses were read from, "-" for stdin
+	Workers     int       `json:"workers"`
+	Intensity   string    `json:"intensity"`
+	Ports       []int     `json:"ports"`
+	Retries     int       `json:"retries"`
+	ConnectOnly bool      `json:"connect_only"`
+	Timeout     string    `json:"timeout,omitempty"` // Overall scan limit, empty for none
+	Started     time.Time `json:"started"`
+	Host        string    `json:"host"`    // Hostname of the machine that ran the scan
+	Command     string    `json:"command"` // Rendered by the writer, for the format it writes
+
+	flags []string // Flags for the options set beyond those recorded above
+}
+
+// NewScanInfo describes a scan of cidr with opts and workers started at
+// started. timeout is the overall scan limit, 0 for none.
+func NewScanInfo(version, cidr string, opts scanner.Options, workers int, timeout time.Duration, started time.Time) ScanInfo {
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = scanner.DefaultPorts
+	}
+	host, _ := os.Hostname()
+
+	info := ScanInfo{
+		Version:     strings.TrimPrefix(version, "v"),
+		Range:       cidr,
+		Workers:     workers,
+		Intensity:   opts.Intensity.String(),
+		Ports:       ports,
+		Retries:     opts.Retries,
+		ConnectOnly: opts.ConnectOnly,
+		Started:     started,
+		Host:        host,
+		flags:       optionFlags(opts),
+	}
+	if timeout > 0 {
+		info.Timeout = timeout.String()
+	}
+	return info
+}
+
+// SetTargets records that the scanned addresses were read from a -targets
+// file, "-" for stdin, so the repeat command reads them from there too
+func (info *ScanInfo) SetTargets(source string) {
+	info.Targets = source
+}
+
+// optionFlags returns the flags for the options in opts that change what a
+// scan finds and that ScanInfo has no field for. Addresses and names, such
+// as -source-ip, -socks5 and -tls-sni, are left out so they don't end up in
+// a shared export.
+func optionFlags(opts scanner.Options) []string {
+	var flags []string
+	if len(opts.TLSPorts) > 0 {
+		flags = append(flags, "--tls-ports", joinPorts(opts.TLSPorts, ","))
+	}
+	if opts.MaxResults > 0 {
+		flags = append(flags, "--max-results", fmt.Sprint(opts.MaxResults))
+	}
+	if !opts.SkipSelf {
+		flags = append(flags, "--skip-self=false") // On by default
+	}
+	if opts.Passive {
+		flags = append(flags, "--passive")
+		if opts.Listen > 0 {
+			flags = append(flags, "--listen", opts.Listen.String())
+		}
+	}
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.Force, "--force"},
+		{opts.RecordFiltered, "--filtered"},
+		{opts.SkipOffline, "--skip-offline"},
+		{opts.Adaptive, "--adaptive"},
+		{opts.Randomize, "--randomize"},
+		{opts.GatewayFirst, "--gateway-first"},
+		{opts.Sniff, "--sniff"},
+		{opts.ARPScan, "--arp"},
+		{opts.RemoteMAC, "--remote-mac"},
+		{opts.PreferMDNS, "--prefer-mdns"},
+		{opts.FTPAnonymous, "--ftp-anon"},
+		{opts.Explain, "--explain"},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	return flags
+}
+
+// command returns a netventory command line that repeats the scan and
+// prints the results as format
+func (info ScanInfo) command(format string) string {
+	args := []string{"netventory", "-o", format}
+	switch {
+	case info.Targets != "":
+		args = append(args, "--targets", info.Targets)
+	case info.Range != "":
+		args = append(args, "--range", info.Range)
+	}
+	args = append(args,
+		"--workers", fmt.Sprint(info.Workers),
+		"--intensity", info.Intensity,
+		"--ports", joinPorts(info.Ports, ","))
+	if info.Retries > 0 {
+		args = append(args, "--retries", fmt.Sprint(info.Retries))
+	}
+	if info.ConnectOnly {
+		args = append(args, "--connect-only")
+	}
+	if info.Timeout != "" {
+		args = append(args, "--timeout", info.Timeout)
+	}
+	args = append(args, info.flags...)
+	return strings.Join(args, " ")
+}
+
+// csvRows returns the metadata rows written above the CSV column headers
+func (info ScanInfo) csvRows() [][]string {
+	rows := [][]string{
+		{"NetVentory v" + info.Version},
+		{"https://github.com/RamboRogers/netventory"},
+		{"Scan Date:", time.Now().Format("2006-01-02 15:04:05")},
+	}
+	if info.Range == "" {
+		return rows
+	}
+	rows = append(rows,
+		[]string{"Scan Started:", info.Started.Format("2006-01-02 15:04:05")},
+		[]string{"Range:", info.Range},
+	)
+	if info.Targets != "" {
+		rows = append(rows, []string{"Targets:", info.Targets})
+	}
+	rows = append(rows,
+		[]string{"Workers:", fmt.Sprint(info.Workers)},
+		[]string{"Intensity:", info.Intensity},
+		[]string{"Ports:", joinPorts(info.Ports, " ")},
+		[]string{"Retries:", fmt.Sprint(info.Retries)},
+	)
+	if info.ConnectOnly {
+		rows = append(rows, []string{"Connect Only:", "true"})
+	}
+	if info.Timeout != "" {
+		rows = append(rows, []string{"Timeout:", info.Timeout})
+	}
+	return append(rows,
+		[]string{"Host:", info.Host},
+		[]string{"Command:", info.Command},
+	)
+}
@@ -0,0 +1,249 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// redactedName replaces a hostname found in free text such as a banner
+const redactedName = "[redacted]"
+
+// ipv4Pattern finds IPv4 addresses in free text such as notes and banners
+var ipv4Pattern = regexp.MustCompile(`\b(\d{1,3}\.\d{1,3}\.\d{1,3}\.)\d{1,3}\b`)
+
+// Redactor anonymizes devices for sharing outside the network they were
+// found on: the last octet of every IPv4 address and the interface ID of
+// every IPv6 one is masked, MAC addresses are replaced by a keyed hash and
+// hostnames are stripped. Ports, vendors, device types and the like are kept
+// for analysis. A MAC hashes the same way for the life of the Redactor, so
+// devices still match up across exports, but not across runs. A nil
+// *Redactor leaves everything as it is.
+type Redactor struct {
+	key []byte
+}
+
+// NewRedactor returns a Redactor with a fresh random MAC hashing key
+func NewRedactor() (*Redactor, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generating redaction key: %w", err)
+	}
+	return &Redactor{key: key}, nil
+}
+
+// Devices returns redacted copies of devices, still keyed by their real
+// addresses so they sort and stay distinct as before
+func (r *Redactor) Devices(devices map[string]scanner.Device) map[string]scanner.Device {
+	if r == nil {
+		return devices
+	}
+	redacted := make(map[string]scanner.Device, len(devices))
+	for ip, device := range devices {
+		redacted[ip] = r.Device(device)
+	}
+	return redacted
+}
+
+// Device returns a redacted copy of device. Names the device gave for itself
+// are also taken out of its notes, banners and redirects.
+func (r *Redactor) Device(device scanner.Device) scanner.Device {
+	if r == nil {
+		return device
+	}
+	names := namesPattern(deviceNames(device))
+	text := func(s string) string {
+		if names != nil {
+			s = names.ReplaceAllLiteralString(s, redactedName)
+		}
+		return maskIPsIn(s)
+	}
+
+	device.IPAddress = MaskIP(device.IPAddress)
+	if len(device.AllIPs) > 0 {
+		allIPs := make([]string, len(device.AllIPs))
+		for i, ip := range device.AllIPs {
+			allIPs[i] = MaskIP(ip)
+		}
+		device.AllIPs = allIPs
+	}
+	if device.MACAddress != "" {
+		device.MACAddress = r.hashMAC(device.MACAddress)
+	}
+	device.Hostname = nil
+	device.MDNSName = ""
+	device.Domain = ""
+	device.Provenance = nil // Sources quote the names and banners they came from
+	if len(device.MDNSServices) > 0 {
+		// Keep which services are advertised, not the instance names
+		services := make(map[string]string, len(device.MDNSServices))
+		for service := range device.MDNSServices {
+			services[service] = ""
+		}
+		device.MDNSServices = services
+	}
+	if len(device.Notes) > 0 {
+		notes := make([]string, len(device.Notes))
+		for i, note := range device.Notes {
+			notes[i] = text(note)
+		}
+		device.Notes = notes
+	}
+	if len(device.Certificates) > 0 {
+		certificates := make(map[int]scanner.Certificate, len(device.Certificates))
+		for port, cert := range device.Certificates {
+			cert.Subject = ""
+			cert.DNSNames = nil
+			cert.Issuer = "" // The subject again, or a private CA named after the organization
+			certificates[port] = cert
+		}
+		device.Certificates = certificates
+	}
+	if len(device.Web) > 0 {
+		web := make(map[int]scanner.WebResponse, len(device.Web))
+		for port, page := range device.Web {
+			page.Location = text(page.Location)
+			web[port] = page
+		}
+		device.Web = web
+	}
+	if device.VNC != nil {
+		vnc := *device.VNC
+		vnc.Desktop = ""
+		device.VNC = &vnc
+	}
+	if len(device.Banners) > 0 {
+		banners := make(map[int]string, len(device.Banners))
+		for port, banner := range device.Banners {
+			banners[port] = text(banner)
+		}
+		device.Banners = banners
+	}
+	return device
+}
+
+// ScanInfo returns info without the scanning machine's name and with the
+// range masked like the device addresses
+func (r *Redactor) ScanInfo(info ScanInfo) ScanInfo {
+	if r == nil {
+		return info
+	}
+	info.Host = ""
+	info.Range = r.Range(info.Range)
+	return info
+}
+
+// Range returns cidr with its addresses masked like the device addresses
+func (r *Redactor) Range(cidr string) string {
+	if r == nil {
+		return cidr
+	}
+	return maskIPsIn(cidr)
+}
+
+// Tag returns a stand-in for ip in a live view such as the web UI: the
+// masked address followed by a keyed hash of the real one, e.g.
+// 192.168.1.x#3fa2c1, so devices on one subnet stay apart without their
+// addresses showing
+func (r *Redactor) Tag(ip string) string {
+	if r == nil {
+		return ip
+	}
+	h := hmac.New(sha256.New, r.key)
+	h.Write([]byte("ip " + ip))
+	return MaskIP(ip) + "#" + hex.EncodeToString(h.Sum(nil)[:3])
+}
+
+// hashMAC replaces mac with the first six bytes of its keyed hash, written as
+// a locally administered unicast MAC so it still reads as an address
+func (r *Redactor) hashMAC(mac string) string {
+	mac = strings.ToLower(mac)
+	if hw, err := net.ParseMAC(mac); err == nil {
+		mac = hw.String()
+	}
+	h := hmac.New(sha256.New, r.key)
+	h.Write([]byte(mac))
+	sum := h.Sum(nil)[:6]
+	sum[0] = sum[0]&^0x01 | 0x02
+	return net.HardwareAddr(sum).String()
+}
+
+// MaskIP hides the host part of ip: the last octet of an IPv4 address,
+// 192.168.1.x, or the interface ID of an IPv6 one, 2001:db8:1:2::x. Text
+// that isn't an address has any IPv4 addresses in it masked.
+func MaskIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return maskIPsIn(ip)
+	case parsed.To4() != nil:
+		v4 := parsed.To4()
+		return fmt.Sprintf("%d.%d.%d.x", v4[0], v4[1], v4[2])
+	default:
+		prefix := make(net.IP, net.IPv6len)
+		copy(prefix, parsed[:8])
+		return strings.TrimSuffix(prefix.String(), "::") + "::x"
+	}
+}
+
+// maskIPsIn masks the last octet of every IPv4 address in s
+func maskIPsIn(s string) string {
+	return ipv4Pattern.ReplaceAllString(s, "${1}x")
+}
+
+// deviceNames returns the names device goes by, longest first so that a
+// fully qualified name is replaced before the short name inside it
+func deviceNames(device scanner.Device) []string {
+	var names []string
+	add := func(name string) {
+		name = strings.TrimPrefix(strings.TrimSuffix(strings.TrimSpace(name), "."), "*.")
+		if len(name) > 1 {
+			names = append(names, name)
+		}
+	}
+	for _, name := range device.Hostname {
+		add(name)
+		if short, _, ok := strings.Cut(name, "."); ok {
+			add(short)
+		}
+	}
+	add(device.MDNSName)
+	add(strings.TrimSuffix(device.MDNSName, ".local"))
+	add(device.Domain)
+	for _, cert := range device.Certificates {
+		add(cert.Subject)
+		for _, name := range cert.DNSNames {
+			add(name)
+		}
+	}
+	if device.VNC != nil {
+		add(device.VNC.Desktop)
+	}
+	for _, instance := range device.MDNSServices {
+		add(instance)
+	}
+	slices.SortStableFunc(names, func(a, b string) int { return len(b) - len(a) })
+	return names
+}
+
+// namesPattern returns one expression matching any of names as a word,
+// ignoring case, or nil for no names. Alternatives are tried in order, so
+// names sorted longest first replace a fully qualified name whole.
+func namesPattern(names []string) *regexp.Regexp {
+	if len(names) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
@@ -0,0 +1,96 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// templateFuncs are the helpers available to output templates. index is
+// replaced with a forgiving version so that templates like
+// {{index .Hostname 0}} print nothing for devices without a hostname.
+var templateFuncs = template.FuncMap{
+	"index":    safeIndex,
+	"join":     strings.Join,
+	"ports":    func(ports []int) string { return joinPorts(ports, ",") },
+	"services": func(ports []int) string { return joinServices(ports, ", ") },
+	"service":  scanner.ServiceName,
+	"hostname": func(d scanner.Device) string {
+		if len(d.Hostname) > 0 {
+			return d.Hostname[0]
+		}
+		return d.MDNSName
+	},
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return fallback
+		}
+		return value
+	},
+}
+
+// ParseTemplate parses a per-device output template
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("device").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// WriteTemplate executes tmpl once per device in IP order, ending each
+// result with a newline if the template did not print one
+func WriteTemplate(w io.Writer, devices map[string]scanner.Device, tmpl *template.Template) error {
+	for _, ip := range SortedIPs(devices) {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, devices[ip]); err != nil {
+			return fmt.Errorf("template failed for %s: %w", ip, err)
+		}
+		out := buf.String()
+		if !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		if _, err := io.WriteString(w, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeIndex is like the built-in index but returns an empty string instead
+// of failing when an index is out of range or a key is missing
+func safeIndex(item interface{}, keys ...interface{}) interface{} {
+	v := reflect.ValueOf(item)
+	for _, key := range keys {
+		if !v.IsValid() {
+			return ""
+		}
+		k := reflect.ValueOf(key)
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array, reflect.String:
+			if !k.CanInt() {
+				return ""
+			}
+			i := int(k.Int())
+			if i < 0 || i >= v.Len() {
+				return ""
+			}
+			v = v.Index(i)
+		case reflect.Map:
+			if !k.IsValid() || !k.Type().AssignableTo(v.Type().Key()) {
+				return ""
+			}
+			v = v.MapIndex(k)
+		default:
+			return ""
+		}
+	}
+	if !v.IsValid() {
+		return ""
+	}
+	return v.Interface()
+}
@@ -6,18 +6,19 @@ require (
 	github.com/charmbracelet/bubbles v0.16.1
 	github.com/charmbracelet/bubbletea v0.24.2
 	github.com/charmbracelet/lipgloss v0.9.1
+	github.com/google/gopacket v1.1.19
 	github.com/jackpal/gateway v1.0.16
 )
 
 require (
 	github.com/geoffgarside/ber v1.1.0 // indirect
-	github.com/hirochachacha/go-smb2 v1.1.0 // indirect
 	golang.org/x/crypto v0.31.0 // indirect
 )
 
 require (
 	github.com/gorilla/websocket v1.5.3
-	golang.org/x/net v0.33.0 // indirect
+	github.com/hirochachacha/go-smb2 v1.1.0
+	golang.org/x/net v0.33.0
 )
 
 require (
@@ -29,7 +30,7 @@ require (
 	github.com/mattn/go-isatty v0.0.18 // indirect
 	github.com/mattn/go-localereader v0.0.1 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect; indirectt
-	github.com/miekg/dns v1.1.41 // indirect
+	github.com/miekg/dns v1.1.41
 	github.com/muesli/ansi v0.0.0-20211018074035-2e021307bc4b // indirect
 	github.com/muesli/cancelreader v0.2.2 // indirect
 	github.com/muesli/reflow v0.3.0 // indirect
@@ -40,7 +41,7 @@ require (
 	github.com/stretchr/testify v1.9.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/term v0.27.0 // indirect
+	golang.org/x/term v0.27.0
 	golang.org/x/text v0.21.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
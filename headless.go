@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/ramborogers/netventory/export"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// Output formats supported by headless mode
+const (
+	outputJSON     = "json"
+	outputCSV      = "csv"
+	outputTable    = "table"
+	outputTemplate = "tmpl"
+)
+
+// Headless exit codes, so automation can tell an empty network from a failure
+const (
+	exitOK        = 0 // Scan completed and found at least one device
+	exitError     = 1 // Fatal error, nothing was scanned
+	exitNoDevices = 2 // Scan completed but found nothing, possibly a probe failure
+	exitStopped   = 3 // Scan was interrupted or hit -timeout; partial results were written
+)
+
+// headlessConfig holds the settings for a scan run without the TUI
+type headlessConfig struct {
+	format   string
+	template string
+	cidr     string
+	targets  *scanner.Targets // Addresses from -targets, scanned instead of cidr
+	source   string           // Where targets were read from, for the repeat command
+	quiet    bool             // Suppress progress on stderr, leaving only results and errors
+	timeout  time.Duration    // Stop the scan after this long, 0 for no limit
+	interval time.Duration    // Rescan this often until interrupted, 0 to scan once
+	mergeMAC bool             // Collapse devices sharing a MAC into one entry
+	append   bool             // Report the devices of earlier interval scans too, merged with new results
+	graph    string           // Print a graph in this format, export.GraphDOT or GraphJSON, instead of format
+	filter   export.Filter    // Report only the devices matching this
+	resolve  string           // JSON export whose hostnames are resolved again instead of scanning
+}
+
+// runHeadless scans cfg.targets or cfg.cidr, or the primary interface's
+// network when neither is set, and writes the discovered devices to stdout
+// in cfg.format, repeating every cfg.interval if set. It returns the process
+// exit code; any error means exitError.
+func runHeadless(cfg headlessConfig) (int, error) {
+	var tmpl *template.Template
+	switch cfg.format {
+	case outputJSON, outputCSV, outputTable:
+	case outputTemplate:
+		if cfg.template == "" {
+			return exitError, fmt.Errorf("-o %s requires a template via -tmpl", outputTemplate)
+		}
+		var err error
+		if tmpl, err = export.ParseTemplate(cfg.template); err != nil {
+			return exitError, err
+		}
+	default:
+		return exitError, fmt.Errorf("unknown output format %q (want json, csv, table or tmpl)", cfg.format)
+	}
+	switch cfg.graph {
+	case "", export.GraphDOT, export.GraphJSON:
+	default:
+		return exitError, fmt.Errorf("unknown graph format %q (want %s or %s)", cfg.graph, export.GraphDOT, export.GraphJSON)
+	}
+	if cfg.resolve != "" {
+		return resolveFile(cfg.resolve, cfg, tmpl)
+	}
+
+	progress := io.Writer(os.Stderr)
+	if cfg.quiet {
+		progress = io.Discard
+	}
+
+	targets := cfg.targets
+	if targets == nil {
+		cidr := cfg.cidr
+		if cidr == "" {
+			var err error
+			if cidr, err = defaultScanRange(); err != nil {
+				return exitError, err
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return exitError, fmt.Errorf("invalid range %q: %w", cidr, err)
+		}
+		if network := ipNet.String(); network != cidr {
+			fmt.Fprintf(progress, "Range %s has host bits set, scanning the network %s\n", cidr, network)
+		}
+		targets = scanner.NewTargets(ipNet)
+	}
+	cidr := targets.String()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	// With an interval, keep rescanning and reporting until interrupted.
+	// history holds the devices found up by every scan so far, to carry
+	// their first-seen times forward.
+	var previous map[string]scanner.Device
+	history := make(map[string]scanner.Device)
+	// With -append, every device found so far, this scan's results merged in
+	found := make(map[string]scanner.Device)
+	for {
+		switch {
+		case passiveScan:
+			fmt.Fprintf(progress, "Listening passively for hosts in %s for %v...\n", targets, passiveListen)
+		case cfg.targets != nil:
+			fmt.Fprintf(progress, "Scanning %d addresses from %s with %d workers...\n", targets.Count(), cfg.source, workerCount)
+		default:
+			fmt.Fprintf(progress, "Scanning %s with %d workers...\n", cidr, workerCount)
+		}
+		start := time.Now()
+		devices, stopped, err := collectDevices(targets, cfg.timeout, history, interrupt)
+		aborted := errors.Is(err, scanner.ErrNetworkUnavailable)
+		if aborted {
+			// Keep what was found before the network went away
+			fmt.Fprintf(os.Stderr, "Error: scan aborted: %v\n", err)
+			stopped = true
+		} else if err != nil {
+			return exitError, err
+		}
+		export.RecordSeen(history, devices)
+		if cfg.append {
+			for ip, device := range devices {
+				device.Merge(found[ip])
+				found[ip] = device
+			}
+			devices = maps.Clone(found)
+		}
+		if cfg.mergeMAC {
+			devices = export.MergeByMAC(devices)
+		}
+		devices = cfg.filter.Apply(devices)
+		alerts.complete(len(devices), stopped, err)
+		if stopped {
+			fmt.Fprintf(progress, "Scan stopped after %s, found %d devices\n", time.Since(start).Round(time.Second), len(devices))
+		} else {
+			fmt.Fprintf(progress, "Found %d devices in %s\n", len(devices), time.Since(start).Round(time.Second))
+		}
+		if previous != nil {
+			writeDiff(progress, export.DiffDevices(previous, devices))
+		}
+		previous = devices
+
+		info := export.NewScanInfo(version, cidr, newScannerOptions(), workerCount, cfg.timeout, start)
+		if cfg.targets != nil {
+			info.SetTargets(cfg.source)
+		}
+		if cfg.graph != "" {
+			err = writeGraph(os.Stdout, devices, cfg.graph, info)
+		} else {
+			err = writeDevices(os.Stdout, devices, cfg.format, tmpl, info)
+		}
+		if err != nil {
+			return exitError, err
+		}
+
+		status := "complete"
+		switch {
+		case aborted:
+			status = "aborted"
+		case stopped:
+			status = "stopped"
+		}
+		if err := runCompletionHook(devices, info, status); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+
+		code := exitOK
+		switch {
+		case stopped:
+			return exitStopped, nil
+		case len(devices) == 0:
+			code = exitNoDevices
+		}
+		if cfg.interval <= 0 {
+			return code, nil
+		}
+
+		fmt.Fprintf(progress, "Next scan at %s\n", time.Now().Add(cfg.interval).Format("15:04:05"))
+		select {
+		case <-time.After(cfg.interval):
+		case <-interrupt:
+			return code, nil
+		}
+	}
+}
+
+// writeScanStats writes report as JSON to the --stats file, replacing the
+// previous scan's, or to stderr for "-"
+func writeScanStats(report scanner.ScanReport) error {
+	if statsPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if statsPath == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	return os.WriteFile(statsPath, data, 0644)
+}
+
+// writeDiff reports the devices that appeared, disappeared or changed
+// since the previous scan
+func writeDiff(w io.Writer, diff export.Diff) {
+	fmt.Fprintf(w, "Changes since previous scan: %s\n", diff)
+	for _, ip := range diff.Added {
+		fmt.Fprintf(w, "  + %s\n", ip)
+	}
+	for _, ip := range diff.Removed {
+		fmt.Fprintf(w, "  - %s\n", ip)
+	}
+	for _, ip := range diff.Changed {
+		fmt.Fprintf(w, "  ~ %s\n", ip)
+	}
+}
+
+// defaultScanRange returns the primary interface's preferred subnet
+func defaultScanRange() (string, error) {
+	interfaces, err := getNetworkInterfaces()
+	if err != nil {
+		return "", fmt.Errorf("could not list network interfaces: %w", err)
+	}
+	if len(interfaces) == 0 {
+		return "", fmt.Errorf("no usable network interfaces found, specify one with -range")
+	}
+	iface := interfaces[primaryInterfaceIndex(interfaces)]
+	if len(iface.Subnets) > 0 {
+		return iface.Subnets[primarySubnetIndex(iface)], nil
+	}
+	return calculateNetworkRange(iface.IPAddress, iface.CIDR), nil
+}
+
+// readTargets reads the -targets list from path, or stdin for "-"
+func readTargets(path string) (*scanner.Targets, error) {
+	if path == "-" {
+		return scanner.ParseTargets(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	targets, err := scanner.ParseTargets(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return targets, nil
+}
+
+// collectDevices runs a scan of targets to completion and returns every
+// device found, with first-seen times carried over from the same devices in
+// history. A signal on interrupt or the timeout stops the scan early, in
+// which case stopped is true and the devices found so far are returned. If
+// the scanner aborted the scan, the devices come with its error.
+func collectDevices(targets *scanner.Targets, timeout time.Duration, history map[string]scanner.Device, interrupt <-chan os.Signal) (devices map[string]scanner.Device, stopped bool, err error) {
+	opts := newScannerOptions()
+	opts.Gateway = discoverGateway()
+	s := scanner.NewScannerWithOptions(opts)
+	defer s.Close()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	if err := s.ScanTargets(targets, workerCount); err != nil {
+		return nil, false, err
+	}
+
+	devices = make(map[string]scanner.Device)
+	store := func(device scanner.Device) {
+		device.CarrySeen(history[device.IPAddress])
+		devices[device.IPAddress] = device
+		writeResult(device)
+		alerts.found(device)
+	}
+	resultsChan, doneChan := s.GetResults()
+	for {
+		select {
+		case device := <-resultsChan:
+			store(device)
+		case <-interrupt:
+			if !stopped {
+				stopped = true
+				s.Stop()
+			}
+		case <-deadline:
+			if !stopped {
+				stopped = true
+				s.Stop()
+			}
+		case <-doneChan:
+			if truncated := s.Stats().Truncated; truncated > 0 {
+				fmt.Fprintf(os.Stderr, "Warning: results truncated at %d devices; %d more were found but not kept\n", maxResults, truncated)
+			}
+			if err := writeScanStats(s.ScanStats()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: cannot write --stats report: %v\n", err)
+			}
+			// Pick up results sent just before the done signal
+			for {
+				select {
+				case device := <-resultsChan:
+					store(device)
+				default:
+					return devices, stopped, s.Err()
+				}
+			}
+		}
+	}
+}
+
+// writeDevices writes devices to w in the given output format, anonymized
+// with --redact. info describes the scan in the CSV and JSON headers.
+func writeDevices(w io.Writer, devices map[string]scanner.Device, format string, tmpl *template.Template, info export.ScanInfo) error {
+	devices, info = redactor.Devices(devices), redactor.ScanInfo(info)
+	switch format {
+	case outputJSON:
+		return export.WriteJSON(w, devices, info)
+	case outputCSV:
+		return export.WriteCSV(w, devices, info)
+	case outputTemplate:
+		return export.WriteTemplate(w, devices, tmpl)
+	default:
+		return export.WriteTable(w, devices)
+	}
+}
+
+// writeGraph writes devices to w as a graph in format, anonymized with
+// --redact
+func writeGraph(w io.Writer, devices map[string]scanner.Device, format string, info export.ScanInfo) error {
+	graph := export.BuildGraph(redactor.Devices(devices), redactor.ScanInfo(info).Range)
+	return export.WriteGraph(w, graph, format)
+}
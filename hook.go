@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/ramborogers/netventory/export"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// hookTimeout bounds an --on-complete command, so a hung script can't hold
+// up the next scheduled scan or the exit forever
+const hookTimeout = 10 * time.Minute
+
+// hookEnvPrefix starts the variables passed to an --on-complete command.
+// They stay out of the NETVENTORY_ names read as flags, so a hook that runs
+// netventory doesn't inherit the scan's range or append to its --out file.
+const hookEnvPrefix = "NETVENTORY_HOOK_"
+
+// runCompletionHook runs the --on-complete command, if any, after a scan
+// ends with status "complete", "stopped" or "aborted". The results, as the
+// JSON export, are piped to its stdin and written to a temporary file named
+// by NETVENTORY_HOOK_RESULTS, which is removed once the command exits. Its
+// output goes to stderr, leaving stdout to the results.
+func runCompletionHook(devices map[string]scanner.Device, info export.ScanInfo, status string) error {
+	if onComplete == "" {
+		return nil
+	}
+	var results bytes.Buffer
+	if err := export.WriteJSON(&results, redactor.Devices(devices), redactor.ScanInfo(info)); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp("", "netventory-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(results.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", onComplete)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", onComplete)
+	}
+	cmd.Stdin = &results
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		hookEnvPrefix+"RESULTS="+file.Name(),
+		hookEnvPrefix+"STATUS="+status,
+		hookEnvPrefix+"RANGE="+redactor.ScanInfo(info).Range,
+		hookEnvPrefix+"DEVICES="+strconv.Itoa(len(devices)),
+		hookEnvPrefix+"OUT="+resultsPath,
+	)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("--on-complete command: %w", err)
+	}
+	return nil
+}
@@ -6,29 +6,34 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"math"
 	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/jackpal/gateway"
+	"github.com/ramborogers/netventory/export"
 	"github.com/ramborogers/netventory/scanner"
 	"github.com/ramborogers/netventory/telemetry"
 	"github.com/ramborogers/netventory/views"
 	"github.com/ramborogers/netventory/web"
+	"golang.org/x/term"
 )
 
 const (
-	version         = "0.4.0n"
-	debug           = false // Default debug setting, can be overridden by --debug flag
-	authTokenLength = 50
+	version = "0.4.0n"
+	debug   = false // Default debug setting, can be overridden by --debug flag
 )
 
 //go:embed private.txt
@@ -37,6 +42,51 @@ var privateConfig string
 var (
 	workerCount     = 50   // Default worker count, can be overridden by --workers flag
 	webPort         = 7331 // Default web interface port
+	debugEnabled    = debug
+	reportPath      = ""          // Report file path, empty derives one from the scan range and time
+	debugLogPath    = "debug.log" // Debug log path, can be overridden by --debug-log flag
+	resolverLimit   = 0           // Max concurrent protocol resolutions, 0 for no limit
+	maxSockets      = 0           // Max connections open at once, 0 for a share of the open file limit
+	retryCount      = 0           // Extra passes over down hosts, can be overridden by --retries flag
+	resultsBuffer   = scanner.DefaultResultsBuffer
+	scanIntensity   = scanner.IntensityNormal // Hostname resolution effort, can be overridden by --intensity flag
+	connectOnly     = false                   // Probe only common TCP ports, can be enabled by --connect-only flag
+	scanPorts       []int                     // TCP ports to probe, empty for scanner.DefaultPorts
+	tlsPorts        []int                     // Open ports to read TLS certificates from, empty for scanner.DefaultTLSPorts
+	tlsServerName   string                    // SNI sent when reading certificates, can be set by --tls-sni flag
+	userAgent       = "netventory/" + version // User-Agent of HTTP probes, can be overridden by --user-agent flag
+	preferMDNS      = false                   // List mDNS names before generated DNS names, can be enabled by --prefer-mdns flag
+	maxHosts        = scanner.DefaultMaxHosts // Largest range scanned without confirmation, can be overridden by --max-hosts flag
+	forceScan       = false                   // Scan ranges over maxHosts without asking, can be enabled by --force flag
+	maxResults      = 0                       // Live devices kept per scan, 0 for no cap, can be set by --max-results flag
+	recordFiltered  = false                   // Keep timed-out ports on live hosts, can be enabled by --filtered flag
+	sourceIP        net.IP                    // Address probes are sent from, nil for the selected interface or OS choice
+	gatewayFirst    = false                   // Probe the gateway and edge hosts before the sweep, can be enabled by --gateway-first flag
+	skipOffline     = false                   // Don't keep down hosts in memory, can be enabled by --skip-offline flag
+	adaptive        = false                   // AIMD concurrency control, can be enabled by --adaptive flag
+	randomizeOrder  = false                   // Probe the range in random order, can be enabled by --randomize flag
+	skipSelf        = true                    // List this machine without probing it, can be disabled by --skip-self=false
+	passiveScan     = false                   // Send no probes, only read the neighbor table, can be enabled by --passive flag
+	passiveListen   time.Duration             // How long a passive scan listens for mDNS/SSDP announcements, set by --listen flag
+	sniffTraffic    = false                   // Capture ARP/DHCP/mDNS/NetBIOS broadcasts during the scan, can be enabled by --sniff flag
+	arpScan         = false                   // Sweep on-link addresses with ARP before probing, can be enabled by --arp flag
+	remoteMAC       = false                   // Look up MACs of routed hosts too, can be enabled by --remote-mac flag
+	explainFields   = false                   // Record which signal set each device field, can be enabled by --explain flag
+	socksProxy      string                    // SOCKS5 proxy TCP probes go through, empty to connect directly; set by --socks5 flag
+	ftpAnonymous    = false                   // Try anonymous FTP logins, can be enabled by --ftp-anon flag
+	scanInterval    time.Duration             // Periodic rescan interval in web mode, 0 to disable
+	scanRange       string                    // Range for scheduled web scans, empty for the primary subnet
+	authToken       string                    // Web interface token, empty to generate one at startup
+	webBind         string                    // Web interface listen address, empty for all interfaces
+	resultsOut      *export.JSONLWriter       // Incremental results file from --out, nil when not set
+	resultsPath     string                    // Path of the --out file, passed to the --on-complete command
+	onComplete      string                    // Command run after each headless or web scan, set by --on-complete flag
+	statsPath       string                    // File each scan's timing report is written to, - for stderr outside the TUI; set by --stats flag
+	controlPath     string                    // Unix socket the TUI takes scripted commands on, empty to disable
+	deviceFilter    export.Filter             // Devices shown and exported, set by the --only-* flags
+	tableColumns    []views.Column            // TUI device table columns, set by --columns flag
+	redactor        *export.Redactor          // Anonymizes exports, set by --redact, nil when off
+	appendResults   = false                   // Keep earlier scans' devices on rescan, can be enabled by --append flag
 	webServer       *web.Server
 	telemetryClient *telemetry.Client
 )
@@ -76,8 +126,8 @@ func parsePrivateConfig() (server, token string, err error) {
 	return server, token, nil
 }
 
-func init() {
-	// Initialize telemetry client in background
+// startTelemetry initializes the telemetry client in the background
+func startTelemetry() {
 	go func() {
 		server, token, err := parsePrivateConfig()
 		if err != nil {
@@ -98,18 +148,94 @@ func init() {
 			telemetryClient = nil // Disable telemetry on error
 		}
 	}()
+}
 
+func init() {
 	// Parse command line flags
 	debugFlag := flag.Bool("debug", debug, "Enable debug mode (generates debug.log and report.log)")
 	flag.BoolVar(debugFlag, "d", debug, "") // Shorthand
 
 	workers := flag.Int("workers", workerCount, "Number of concurrent scanning workers")
 
+	resolvers := flag.Int("resolvers", resolverLimit, "Max concurrent AFP/SMB/RDP/mDNS resolutions (0 = no limit)")
+
+	maxSocketsFlag := flag.Int("max-sockets", maxSockets, "Max connections open at once across all workers (0 = 3/4 of the open file limit, negative for no limit)")
+
+	retries := flag.Int("retries", retryCount, "Re-probe down hosts this many times with longer timeouts")
+
+	bufferFlag := flag.Int("results-buffer", resultsBuffer, "Capacity of the scan results channel")
+
+	intensityFlag := flag.String("intensity", scanIntensity.String(), "Hostname resolution effort: low (DNS only), normal or high")
+
+	connectOnlyFlag := flag.Bool("connect-only", connectOnly, "Only connect to common TCP ports, skipping Apple service ports and MAC retries")
+
+	portProfileFlag := flag.String("port-profile", "", "Probe a curated port set: "+strings.Join(scanner.PortProfileNames(), ", "))
+
+	portsFlag := flag.String("ports", "", "Comma-separated TCP ports to probe, overriding -port-profile")
+	tlsPortsFlag := flag.String("tls-ports", "", "Comma-separated open ports to read TLS certificates from (default: 443,8443,5986,636)")
+	tlsSNIFlag := flag.String("tls-sni", "", "Server name (SNI) sent when reading TLS certificates (default: none)")
+
+	maxHostsFlag := flag.Int("max-hosts", maxHosts, "Refuse larger ranges unless confirmed or --force is given (negative for no limit)")
+	forceFlag := flag.Bool("force", forceScan, "Scan ranges larger than --max-hosts")
+	maxResultsFlag := flag.Int("max-results", maxResults, "Keep at most this many devices per scan, counting but dropping the rest (0 = no cap)")
+	filteredFlag := flag.Bool("filtered", recordFiltered, "Record ports that time out (filtered) as well as closed ones")
+	sourceFlag := flag.String("source-ip", "", "Send probes from this local address (default: the selected interface in the TUI)")
+	skipOfflineFlag := flag.Bool("skip-offline", skipOffline, "Keep only reachable hosts in memory, saving space on large ranges")
+	adaptiveFlag := flag.Bool("adaptive", adaptive, "Adjust concurrency to the link: grow while probes answer, halve when timeouts rise")
+	skipSelfFlag := flag.Bool("skip-self", skipSelf, "Don't probe this machine's own addresses in the range, listing it from its interfaces instead")
+	randomizeFlag := flag.Bool("randomize", randomizeOrder, "Probe addresses in random order instead of ascending")
+	passiveFlag := flag.Bool("passive", passiveScan, "Send no probes: list hosts from the ARP/neighbor table and, with -listen, mDNS/SSDP announcements")
+	listenFlag := flag.Duration("listen", 0, "How long -passive listens for mDNS and SSDP announcements, e.g. 2m (0 = neighbor table only)")
+	notifyFlag := flag.String("notify", "", "Alert with a desktop notification or bell: done (scan complete) or found (each device passing the --only-* filters)")
+	sniffFlag := flag.Bool("sniff", sniffTraffic, "Capture ARP, DHCP, mDNS and NetBIOS broadcasts during the scan and add their senders (needs root)")
+	arpFlag := flag.Bool("arp", arpScan, "Find on-link hosts with broadcast ARP requests and probe only those that answer (needs root; falls back to TCP)")
+	socks5Flag := flag.String("socks5", "", "Send every TCP probe through this SOCKS5 proxy, host:port or user:password@host:port; ARP, MAC lookups and UDP probes are off")
+	explainFlag := flag.Bool("explain", explainFields, "Record which signal set each device's name, type, MAC and vendor, shown under \"How we know\" in the details view and in JSON exports")
+	remoteMACFlag := flag.Bool("remote-mac", remoteMAC, "Look up the MAC of hosts beyond the local subnets too, e.g. behind proxy ARP (default: skipped)")
+	ftpAnonFlag := flag.Bool("ftp-anon", ftpAnonymous, "Try an anonymous login on FTP servers and flag those that accept it (default: banner only)")
+	gatewayFirstFlag := flag.Bool("gateway-first", gatewayFirst, "Probe the gateway and the first and last hosts (.1/.254) before the sweep")
+	preferMDNSFlag := flag.Bool("prefer-mdns", preferMDNS, "Name hosts by their mDNS name when reverse DNS only gives a generated one, e.g. 192-168-1-5.isp.net")
+	onlyPortsFlag := flag.String("only-ports", "", "Report only devices with any of these comma-separated ports open")
+	onlyVendorFlag := flag.String("only-vendor", "", "Report only devices whose MAC vendor contains this text, e.g. apple")
+	onlyNoHostnameFlag := flag.Bool("only-no-hostname", false, "Report only devices without a hostname, e.g. to hunt rogue devices")
+	columnsFlag := flag.String("columns", views.DefaultColumns, "TUI device table columns, each with an optional width, e.g. ip,hostname:30,mac,vendor (available: "+strings.Join(views.ColumnNames(), ", ")+")")
+	userAgentFlag := flag.String("user-agent", userAgent, "User-Agent sent by HTTP probes, so targets can attribute the scan (\"\" sends none)")
+
+	reportFlag := flag.String("report", reportPath, "Report file path in debug mode (default: report-<range>-<time>.log)")
+	debugLogFlag := flag.String("debug-log", debugLogPath, "Debug log file path in debug mode")
+
 	webFlag := flag.Bool("web", false, "Enable web interface mode")
 	flag.BoolVar(webFlag, "w", false, "") // Shorthand
 
 	portFlag := flag.Int("port", webPort, "Web interface port")
 	flag.IntVar(portFlag, "p", webPort, "") // Shorthand
+	flag.IntVar(portFlag, "web-port", webPort, "")
+	bindFlag := flag.String("web-bind", "", "Web interface listen address, e.g. 127.0.0.1 (default: all interfaces)")
+	authTokenFlag := flag.String("auth-token", "", "Web interface token (default: random; prefer NETVENTORY_AUTH_TOKEN)")
+
+	outputFlag := flag.String("o", "", "Scan without the TUI and print results as json, csv, table or tmpl")
+	tmplFlag := flag.String("tmpl", "", "Go template executed per device with -o tmpl")
+	rangeFlag := flag.String("range", "", "Range to scan with -o or -interval (default: primary interface subnet)")
+	targetsFlag := flag.String("targets", "", "Scan the CIDRs, addresses and ranges listed one per line in this file (- for stdin); implies -o table")
+	controlFlag := flag.String("control", "", "Take scan, stop, status and results commands on this Unix socket while the TUI runs")
+	outFlag := flag.String("out", "", "Append each device to this JSON Lines file as it is found, e.g. results.jsonl")
+	onCompleteFlag := flag.String("on-complete", "", "Run this shell command after each headless or web scan, with the JSON results on stdin and in $NETVENTORY_HOOK_RESULTS, and $NETVENTORY_HOOK_STATUS, _RANGE, _DEVICES and _OUT set")
+	statsFlag := flag.String("stats", "", "Write a JSON report of where each scan's time went to this file (- for stderr, headless or web)")
+	mergeFlag := flag.Bool("merge-mac", false, "Merge devices sharing a MAC address into one entry with -o")
+	graphFlag := flag.String("graph", "", "Scan without the TUI and print the results as a graph around the gateway: dot (Graphviz) or json (nodes and edges)")
+	appendFlag := flag.Bool("append", false, "Keep the devices of earlier scans on rescan, merging new results into them, e.g. to scan subnets one by one")
+	redactFlag := flag.Bool("redact", false, "Anonymize exports for sharing: mask the last octet of IPs, hash MACs and strip hostnames")
+	intervalFlag := flag.Duration("interval", 0, "Rescan every interval in web or headless mode, e.g. 10m")
+	timeoutFlag := flag.Duration("timeout", 0, "Stop a headless scan after this long, e.g. 5m (0 = no limit)")
+	quietFlag := flag.Bool("quiet", false, "Print only results (headless, implies -o table if -o is not set)")
+	flag.BoolVar(quietFlag, "q", false, "") // Shorthand
+
+	resolveFlag := flag.String("resolve", "", "Resolve the hostnames of the devices in a JSON export again, without rescanning, and print them with -o (default json)")
+	updateOUIFlag := flag.Bool("update-oui", false, "Download the latest IEEE OUI vendor database and exit")
+	ouiSHAFlag := flag.String("oui-sha256", "", "Expected SHA-256 of the OUI download for -update-oui")
+
+	configFlag := flag.String("config", "", "Load defaults from a JSON or YAML file; flags override it")
+	noTelemetryFlag := flag.Bool("no-telemetry", false, "Disable anonymous usage telemetry")
 
 	versionFlag := flag.Bool("version", false, "Display version information")
 	flag.BoolVar(versionFlag, "v", false, "") // Shorthand
@@ -121,15 +247,94 @@ func init() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fmt.Fprintf(os.Stderr, "  -d, --debug     Enable debug mode (generates debug.log and report.log)\n")
+		fmt.Fprintf(os.Stderr, "      --report    Report file path (default: report-<range>-<time>.log)\n")
+		fmt.Fprintf(os.Stderr, "      --debug-log Debug log file path (default: debug.log)\n")
 		fmt.Fprintf(os.Stderr, "  -w, --web       Enable web interface mode\n")
-		fmt.Fprintf(os.Stderr, "  -p, --port      Web interface port (default: 7331)\n")
+		fmt.Fprintf(os.Stderr, "  -p, --port, --web-port Web interface port (default: 7331)\n")
+		fmt.Fprintf(os.Stderr, "      --web-bind  Web interface listen address, e.g. 127.0.0.1 (default: all interfaces)\n")
+		fmt.Fprintf(os.Stderr, "      --auth-token Web interface token (default: random; prefer NETVENTORY_AUTH_TOKEN)\n")
+		fmt.Fprintf(os.Stderr, "  -o              Scan without the TUI and print results as json, csv, table or tmpl\n")
+		fmt.Fprintf(os.Stderr, "      --tmpl      Go template executed per device with -o tmpl\n")
+		fmt.Fprintf(os.Stderr, "      --range     Range to scan with -o or --interval (default: primary interface subnet)\n")
+		fmt.Fprintf(os.Stderr, "      --targets   Scan the CIDRs, addresses and ranges listed one per line in a file (- for stdin); implies -o table\n")
+		fmt.Fprintf(os.Stderr, "      --out       Append each device to this JSON Lines file as it is found, e.g. results.jsonl\n")
+		fmt.Fprintf(os.Stderr, "      --on-complete Run a shell command after each headless or web scan, with the JSON results on stdin and in $NETVENTORY_HOOK_RESULTS, and $NETVENTORY_HOOK_STATUS, _RANGE, _DEVICES and _OUT set\n")
+		fmt.Fprintf(os.Stderr, "      --stats     Write a JSON report of where each scan's time went to this file (- for stderr, headless or web)\n")
+		fmt.Fprintf(os.Stderr, "      --control   Take scan, stop, status and results commands on this Unix socket while the TUI runs\n")
+		fmt.Fprintf(os.Stderr, "      --merge-mac Merge devices sharing a MAC address into one entry with -o\n")
+		fmt.Fprintf(os.Stderr, "      --graph     Print the results as a graph around the gateway instead: dot (Graphviz) or json (nodes and edges)\n")
+		fmt.Fprintf(os.Stderr, "      --append    Keep earlier scans' devices on rescan, merging new results into them\n")
+		fmt.Fprintf(os.Stderr, "      --redact    Anonymize -o, --out, CSV exports and the web UI and API: mask the last octet of IPs, hash MACs, strip hostnames\n")
+		fmt.Fprintf(os.Stderr, "      --interval  Rescan every interval in web or headless mode, e.g. 10m\n")
+		fmt.Fprintf(os.Stderr, "      --timeout   Stop a headless scan after this long, e.g. 5m (default: no limit)\n")
+		fmt.Fprintf(os.Stderr, "  -q, --quiet     Print only results: no TUI, logs or progress (implies -o table)\n")
+		fmt.Fprintf(os.Stderr, "      --update-oui Download the latest IEEE OUI vendor database and exit\n")
+		fmt.Fprintf(os.Stderr, "      --oui-sha256 Expected SHA-256 of the OUI download for --update-oui\n")
+		fmt.Fprintf(os.Stderr, "      --resolve   Resolve hostnames in a JSON export again without rescanning; prints it with -o (default: json)\n")
 		fmt.Fprintf(os.Stderr, "  -v, --version   Display version information\n")
+		fmt.Fprintf(os.Stderr, "      --config    Load defaults from a JSON or YAML file; flags override it\n")
+		fmt.Fprintf(os.Stderr, "      --no-telemetry Disable anonymous usage telemetry\n")
 		fmt.Fprintf(os.Stderr, "      --workers   Number of concurrent scanning workers (default: 50)\n")
+		fmt.Fprintf(os.Stderr, "      --resolvers Max concurrent AFP/SMB/RDP/mDNS resolutions (default: 0, no limit)\n")
+		fmt.Fprintf(os.Stderr, "      --max-sockets Max connections open at once across all workers (default: %d, 3/4 of the open file limit)\n", scanner.DefaultMaxSockets())
+		fmt.Fprintf(os.Stderr, "      --retries   Re-probe down hosts N times with longer timeouts (default: 0)\n")
+		fmt.Fprintf(os.Stderr, "      --results-buffer Capacity of the scan results channel (default: 100)\n")
+		fmt.Fprintf(os.Stderr, "      --intensity Hostname resolution effort: low (DNS only), normal or high (default: normal)\n")
+		fmt.Fprintf(os.Stderr, "      --connect-only Minimal footprint: common TCP ports only, no Apple ports or MAC retries\n")
+		fmt.Fprintf(os.Stderr, "      --port-profile Probe a curated port set: %s\n", strings.Join(scanner.PortProfileNames(), ", "))
+		fmt.Fprintf(os.Stderr, "      --ports     Comma-separated TCP ports to probe, overriding --port-profile\n")
+		fmt.Fprintf(os.Stderr, "      --tls-ports Open ports to read TLS certificates from for hostnames (default: 443,8443,5986,636)\n")
+		fmt.Fprintf(os.Stderr, "      --tls-sni   Server name (SNI) sent when reading TLS certificates (default: none)\n")
+		fmt.Fprintf(os.Stderr, "      --max-hosts Largest range scanned without confirmation (default: %d, negative for no limit)\n", scanner.DefaultMaxHosts)
+		fmt.Fprintf(os.Stderr, "      --force     Scan ranges larger than --max-hosts\n")
+		fmt.Fprintf(os.Stderr, "      --max-results Keep at most this many devices per scan, counting but dropping the rest (default: 0, no cap)\n")
+		fmt.Fprintf(os.Stderr, "      --filtered  Record ports that time out (filtered) as well as closed ones\n")
+		fmt.Fprintf(os.Stderr, "      --source-ip Send probes from this local address (default: the selected interface in the TUI)\n")
+		fmt.Fprintf(os.Stderr, "      --skip-offline Keep only reachable hosts in memory, saving space on large ranges\n")
+		fmt.Fprintf(os.Stderr, "      --adaptive  Adjust concurrency to the link: grow while probes answer, halve when timeouts rise\n")
+		fmt.Fprintf(os.Stderr, "      --skip-self Don't probe this machine's own addresses, list it from its interfaces (default: true)\n")
+		fmt.Fprintf(os.Stderr, "      --randomize Probe addresses in random order instead of ascending\n")
+		fmt.Fprintf(os.Stderr, "      --passive   Send no probes: list hosts from the ARP/neighbor table and, with --listen, announcements\n")
+		fmt.Fprintf(os.Stderr, "      --listen    How long --passive listens for mDNS and SSDP announcements, e.g. 2m (default: 0, table only)\n")
+		fmt.Fprintf(os.Stderr, "      --sniff     Capture ARP, DHCP, mDNS and NetBIOS broadcasts during the scan (needs root)\n")
+		fmt.Fprintf(os.Stderr, "      --arp       Find on-link hosts by ARP and probe only those that answer (needs root)\n")
+		fmt.Fprintf(os.Stderr, "      --socks5    Send every TCP probe through a SOCKS5 proxy, host:port or user:password@host:port; ARP, MAC and UDP probes are off\n")
+		fmt.Fprintf(os.Stderr, "      --explain   Record which signal set each device's name, type, MAC and vendor, for the details view and JSON exports\n")
+		fmt.Fprintf(os.Stderr, "      --remote-mac Look up the MAC of hosts beyond the local subnets too (default: skipped)\n")
+		fmt.Fprintf(os.Stderr, "      --ftp-anon  Try an anonymous login on FTP servers and flag those that accept it (default: banner only)\n")
+		fmt.Fprintf(os.Stderr, "      --notify    Desktop notification, or a bell without one: done (scan complete) or found (each new device matching --only-*)\n")
+		fmt.Fprintf(os.Stderr, "      --gateway-first Probe the gateway and the first and last hosts (.1/.254) before the sweep\n")
+		fmt.Fprintf(os.Stderr, "      --prefer-mdns Name hosts by mDNS when reverse DNS only gives a generated name\n")
+		fmt.Fprintf(os.Stderr, "      --only-ports Report only devices with any of these comma-separated ports open\n")
+		fmt.Fprintf(os.Stderr, "      --only-vendor Report only devices whose MAC vendor contains this text, e.g. apple\n")
+		fmt.Fprintf(os.Stderr, "      --only-no-hostname Report only devices without a hostname, e.g. to hunt rogue devices\n")
+		fmt.Fprintf(os.Stderr, "      --columns   TUI device table columns with optional widths, e.g. ip,hostname:30,mac,vendor (default: %s)\n", views.DefaultColumns)
+		fmt.Fprintf(os.Stderr, "                  Available: %s\n", strings.Join(views.ColumnNames(), ", "))
+		fmt.Fprintf(os.Stderr, "      --user-agent User-Agent sent by HTTP probes (default: netventory/%s, \"\" for none)\n", version)
 		os.Exit(1)
 	}
 
 	flag.Parse()
 
+	// NETVENTORY_* variables fill in whatever the command line left out,
+	// and a config file fills in whatever both left out
+	explicit := explicitFlags()
+	if err := applyDefaults(envValues(), explicit, "environment"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *configFlag != "" {
+		cfg, err := loadConfig(*configFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := applyDefaults(cfg.flagValues(), explicit, *configFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Handle version flag first
 	if *versionFlag {
 		fmt.Printf("netventory %s\n", version)
@@ -137,6 +342,19 @@ func init() {
 		os.Exit(0)
 	}
 
+	if *updateOUIFlag {
+		path := scanner.DefaultOUIPath()
+		fmt.Printf("Downloading %s...\n", scanner.OUISourceURL)
+		count, sum, err := scanner.UpdateOUIDatabase(scanner.OUISourceURL, path, *ouiSHAFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating OUI database: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %d vendors to %s\n", count, path)
+		fmt.Printf("Download SHA-256: %s (pass it to --oui-sha256 to install the same list elsewhere)\n", sum)
+		os.Exit(0)
+	}
+
 	// Show help if any non-flag arguments are provided
 	if flag.NArg() > 0 {
 		fmt.Fprintf(os.Stderr, "Error: unexpected argument '%s'\n\n", flag.Arg(0))
@@ -145,10 +363,19 @@ func init() {
 
 	// Update global settings from flags
 	if *debugFlag {
+		debugEnabled = true
+		reportPath = *reportFlag
+		debugLogPath = *debugLogFlag
+
 		// Set up logging to file if debug is enabled
-		f, err := os.OpenFile("debug.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if dir := filepath.Dir(debugLogPath); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Fatalf("error creating debug log directory %s: %v", dir, err)
+			}
+		}
+		f, err := os.OpenFile(debugLogPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		if err != nil {
-			log.Fatalf("error opening debug.log: %v", err)
+			log.Fatalf("error opening %s: %v", debugLogPath, err)
 		}
 		log.SetOutput(f)
 	} else {
@@ -160,11 +387,224 @@ func init() {
 		workerCount = *workers
 	}
 
+	if *resolvers > 0 {
+		resolverLimit = *resolvers
+	}
+
+	maxSockets = *maxSocketsFlag
+
+	if *retries > 0 {
+		retryCount = *retries
+	}
+
+	if *bufferFlag > 0 {
+		resultsBuffer = *bufferFlag
+	}
+
+	intensity, err := scanner.ParseIntensity(*intensityFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		flag.Usage()
+	}
+	scanIntensity = intensity
+	connectOnly = *connectOnlyFlag
+	maxHosts = *maxHostsFlag
+	forceScan = *forceFlag
+	if *maxResultsFlag > 0 {
+		maxResults = *maxResultsFlag
+	}
+	recordFiltered = *filteredFlag
+	gatewayFirst = *gatewayFirstFlag
+	userAgent = *userAgentFlag
+	preferMDNS = *preferMDNSFlag
+	randomizeOrder = *randomizeFlag
+	passiveScan = *passiveFlag
+	passiveListen = *listenFlag
+	sniffTraffic = *sniffFlag
+	arpScan = *arpFlag
+	remoteMAC = *remoteMACFlag
+	ftpAnonymous = *ftpAnonFlag
+	explainFields = *explainFlag
+	adaptive = *adaptiveFlag
+	skipOffline = *skipOfflineFlag
+	skipSelf = *skipSelfFlag
+
+	if *sourceFlag != "" {
+		ip := net.ParseIP(*sourceFlag)
+		if ip == nil || !isLocalIP(ip) {
+			fmt.Fprintf(os.Stderr, "Error: --source-ip %s is not an address of this machine\n\n", *sourceFlag)
+			flag.Usage()
+		}
+		sourceIP = ip
+	}
+
+	if *socks5Flag != "" {
+		socksProxy = *socks5Flag
+		if err := newScannerOptions().CheckProxy(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --socks5: %v\n", err)
+			os.Exit(exitError)
+		}
+		if arpScan || sniffTraffic {
+			fmt.Fprintln(os.Stderr, "Warning: --arp and --sniff need direct access to the network and are off with --socks5")
+		}
+	}
+
+	if *portProfileFlag != "" {
+		ports, err := scanner.PortProfile(*portProfileFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			flag.Usage()
+		}
+		scanPorts = ports
+	}
+	if *portsFlag != "" {
+		ports, err := parsePortList(*portsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			flag.Usage()
+		}
+		scanPorts = ports
+	}
+	if *tlsPortsFlag != "" {
+		ports, err := parsePortList(*tlsPortsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --tls-ports: %v\n\n", err)
+			flag.Usage()
+		}
+		tlsPorts = ports
+	}
+	tlsServerName = *tlsSNIFlag
+	if *onlyPortsFlag != "" {
+		ports, err := parsePortList(*onlyPortsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --only-ports: %v\n\n", err)
+			flag.Usage()
+		}
+		deviceFilter.Ports = ports
+	}
+	deviceFilter.Vendor = *onlyVendorFlag
+	if tableColumns, err = views.ParseColumns(*columnsFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --columns: %v\n\n", err)
+		flag.Usage()
+	}
+	deviceFilter.NoHostname = *onlyNoHostnameFlag
+	if *notifyFlag != "" {
+		n, err := newNotifier(*notifyFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			flag.Usage()
+		}
+		alerts = n
+	}
+	if *redactFlag {
+		r, err := export.NewRedactor()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitError)
+		}
+		redactor = r
+	}
+
+	if !*noTelemetryFlag {
+		startTelemetry()
+	}
+
+	if *outFlag != "" {
+		out, err := export.OpenJSONL(*outFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot open --out file: %v\n", err)
+			os.Exit(exitError)
+		}
+		resultsOut = out
+		resultsPath = *outFlag
+	}
+	onComplete = *onCompleteFlag
+	statsPath = *statsFlag
+	controlPath = *controlFlag
+	appendResults = *appendFlag
+
+	// Quiet mode is headless; logging is already discarded unless -d
+	// sends it to the debug log file. A target list is scanned headless
+	// too, since it may have come in on the TUI's stdin.
+	if (*quietFlag || *targetsFlag != "") && *outputFlag == "" {
+		*outputFlag = outputTable
+	}
+	if *graphFlag != "" && *outputFlag == "" {
+		// Headless too; the graph is printed instead of the table
+		*outputFlag = outputTable
+	}
+	if *resolveFlag != "" && *outputFlag == "" {
+		*outputFlag = outputJSON
+	}
+
+	// The TUI can't take over a pipe or file, so e.g. netventory | tee log.txt
+	// gets the headless table instead
+	if *outputFlag == "" && !*webFlag && !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "Output is not a terminal, printing results as a table (use -o to choose a format)")
+		*outputFlag = outputTable
+	}
+
+	var targets *scanner.Targets
+	if *targetsFlag != "" {
+		if *rangeFlag != "" {
+			fmt.Fprintf(os.Stderr, "Error: --targets and --range cannot be used together\n\n")
+			flag.Usage()
+		}
+		var err error
+		if targets, err = readTargets(*targetsFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --targets: %v\n", err)
+			os.Exit(exitError)
+		}
+	}
+
+	if *outputFlag != "" {
+		code, err := runHeadless(headlessConfig{
+			format:   *outputFlag,
+			template: *tmplFlag,
+			cidr:     *rangeFlag,
+			targets:  targets,
+			source:   *targetsFlag,
+			quiet:    *quietFlag,
+			timeout:  *timeoutFlag,
+			interval: *intervalFlag,
+			mergeMAC: *mergeFlag,
+			append:   appendResults,
+			graph:    *graphFlag,
+			filter:   deviceFilter,
+			resolve:  *resolveFlag,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if err := resultsOut.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing --out file: %v\n", err)
+		}
+		os.Exit(code)
+	}
+
 	if *webFlag {
 		webPort = *portFlag
+		authToken = *authTokenFlag
+		webBind = *bindFlag
+		scanInterval = *intervalFlag
+		scanRange = *rangeFlag
 		startWebInterface()
-		// Wait indefinitely while web server runs
-		select {}
+
+		// Serve until interrupted, then flush what the --out file buffered
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		<-interrupt
+		if err := resultsOut.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing --out file: %v\n", err)
+			os.Exit(exitError)
+		}
+		os.Exit(exitOK)
+	}
+
+	// The TUI owns the terminal, so its timing reports need a file
+	if statsPath == "-" {
+		fmt.Fprintf(os.Stderr, "Error: --stats - writes to stderr, which the TUI draws on; give it a file\n")
+		os.Exit(exitError)
 	}
 }
 
@@ -176,44 +616,144 @@ func startWebInterface() {
 	fmt.Printf("\033[92mnetventory %s - Network Discovery Tool\033[0m\n", version)
 	fmt.Printf("\033[94mhttps://github.com/RamboRogers/netventory\033[0m\n\n")
 
-	// Generate auth token
-	authToken := generateAuthToken(authTokenLength)
-
 	// Get all network interfaces
 	interfaces, err := getNetworkInterfaces()
 	if err != nil {
 		log.Printf("Warning: Could not get network interfaces: %v", err)
 	}
 
+	// An empty token makes the server generate one
 	server, err := web.NewServer(webPort, authToken, fmt.Sprintf("v%s", version))
 	if err != nil {
 		log.Fatalf("Failed to create web server: %v", err)
 	}
+	token := server.AuthToken()
+	server.SetScanOptions(newScannerOptions(), workerCount)
+	server.SetBindAddress(webBind)
+	server.SetResultsOut(resultsOut)
+	server.SetFilter(deviceFilter)
+	server.SetRedactor(redactor)
+	server.SetAppend(appendResults)
+	if statsPath != "" {
+		server.SetOnStats(func(report scanner.ScanReport) {
+			if err := writeScanStats(report); err != nil {
+				log.Printf("Error: cannot write --stats report: %v", err)
+			}
+		})
+	}
+	if onComplete != "" {
+		server.SetOnComplete(func(devices map[string]scanner.Device, info export.ScanInfo, state web.ScanState) {
+			if err := runCompletionHook(devices, info, string(state)); err != nil {
+				log.Printf("Error: %v", err)
+			}
+		})
+	}
 
 	// Start web server in a goroutine
 	go func() {
-		fmt.Printf("\033[92mWeb interface available at:\033[0m\n")
-		fmt.Printf("  \033[94mhttp://localhost:%d?auth=%s\033[0m	\n", webPort, authToken)
-
-		// Print URLs for all network interfaces
-		for _, iface := range interfaces {
-			if iface.IPAddress != "" && !strings.HasPrefix(iface.IPAddress, "127.") {
-				fmt.Printf("  \033[94mhttp://%s:%d?auth=%s\033[0m\n", iface.IPAddress, webPort, authToken)
+		fmt.Fprintf(os.Stderr, "\033[92mWeb interface available at:\033[0m\n")
+		if webBind != "" && webBind != "0.0.0.0" && webBind != "::" {
+			fmt.Fprintf(os.Stderr, "  \033[94mhttp://%s?auth=%s\033[0m\n", net.JoinHostPort(webBind, strconv.Itoa(webPort)), token)
+		} else {
+			fmt.Fprintf(os.Stderr, "  \033[94mhttp://localhost:%d?auth=%s\033[0m\n", webPort, token)
+
+			// Print URLs for all network interfaces
+			for _, iface := range interfaces {
+				if iface.IPAddress != "" && !strings.HasPrefix(iface.IPAddress, "127.") {
+					fmt.Fprintf(os.Stderr, "  \033[94mhttp://%s:%d?auth=%s\033[0m\n", iface.IPAddress, webPort, token)
+				}
 			}
 		}
-		fmt.Println("\nAuthentication token required in URL: ?auth=<token>")
-		fmt.Println("Token will be valid until program restart")
-		fmt.Println()
+		fmt.Fprintln(os.Stderr, "\nAuthentication token required in URL: ?auth=<token>")
+		if authToken == "" {
+			fmt.Fprintln(os.Stderr, "Token will be valid until program restart")
+		}
+		fmt.Fprintln(os.Stderr)
 
 		if err := server.Start(); err != nil {
 			log.Fatalf("Web server error: %v", err)
 		}
 	}()
 
+	// Start periodic rescans if requested
+	if scanInterval > 0 {
+		cidr := scanRange
+		if cidr == "" {
+			if cidr, err = defaultScanRange(); err != nil {
+				log.Fatalf("Cannot schedule scans: %v", err)
+			}
+		}
+		if network, err := scanner.NormalizeCIDR(cidr); err == nil {
+			cidr = network
+		}
+		fmt.Printf("Scanning %s every %s\n\n", cidr, scanInterval)
+		server.StartSchedule(cidr, scanInterval)
+	}
+
 	// Store server reference for updates
 	webServer = server
 }
 
+// newScannerOptions builds scanner options from the command line settings
+func newScannerOptions() scanner.Options {
+	return scanner.Options{
+		Debug:               debugEnabled,
+		ReportPath:          reportPath,
+		ResolverConcurrency: resolverLimit,
+		MaxSockets:          maxSockets,
+		Retries:             retryCount,
+		ResultsBuffer:       resultsBuffer,
+		Intensity:           scanIntensity,
+		ConnectOnly:         connectOnly,
+		Ports:               scanPorts,
+		TLSPorts:            tlsPorts,
+		TLSServerName:       tlsServerName,
+		UserAgent:           userAgent,
+		PreferMDNS:          preferMDNS,
+		MaxHosts:            maxHosts,
+		Force:               forceScan,
+		MaxResults:          maxResults,
+		RecordFiltered:      recordFiltered,
+		SourceIP:            sourceIP,
+		SkipOffline:         skipOffline,
+		SkipSelf:            skipSelf,
+		Adaptive:            adaptive,
+		Randomize:           randomizeOrder,
+		GatewayFirst:        gatewayFirst,
+		Passive:             passiveScan,
+		Listen:              passiveListen,
+		Sniff:               sniffTraffic,
+		ARPScan:             arpScan,
+		RemoteMAC:           remoteMAC,
+		Explain:             explainFields,
+		SOCKS5:              socksProxy,
+		FTPAnonymous:        ftpAnonymous,
+	}
+}
+
+// writeResult appends device to the --out file, if any and if it passes the
+// --only-* filter
+func writeResult(device scanner.Device) {
+	if !deviceFilter.Match(device) {
+		return
+	}
+	if err := resultsOut.Write(redactor.Device(device)); err != nil {
+		log.Printf("Error writing %s to --out file: %v", device.IPAddress, err)
+	}
+}
+
+// discoverGateway returns the default gateway, labeled in the results and
+// probed first with --gateway-first, or nil when none is found. It asks the
+// OS, so it's called once as a scan starts rather than by newScannerOptions.
+func discoverGateway() net.IP {
+	ip, err := gateway.DiscoverGateway()
+	if err != nil {
+		log.Printf("Could not discover the gateway: %v", err)
+		return nil
+	}
+	return ip
+}
+
 // Model represents the application state
 type Model struct {
 	currentScreen     string
@@ -224,20 +764,36 @@ type Model struct {
 	height            int
 	frame             int
 	proposedRange     string
+	subnetIndex       int
 	editingRange      bool
 	cursorPos         int
 	devices           map[string]scanner.Device
+	history           map[string]scanner.Device // Devices found by earlier scans, for first-seen times
 	scanningActive    bool
 	currentIP         string
-	scanSelectedIndex int
+	scanSelectedIP    string
 	showingDetails    bool
+	statusMessage     string
+	statusSeq         int    // Counts status messages set, so a timer clears only its own
+	addingHost        bool   // The add host prompt is open
+	resolving         bool   // Hostnames are being resolved again
+	hostInput         string // Address typed at the add host prompt
 	activeScans       map[string]bool
 	deviceMutex       sync.RWMutex
-	tableOffset       int
+	groupBySubnet     bool
+	collapsedGroups   map[string]bool // Subnets whose devices are folded under their header
+	mergeByMAC        bool
+	quitting          bool
+	showWorkers       bool
+	confirmingLarge   bool   // Range is over the host limit; enter again to scan it
+	forcedRange       string // Range the user chose to scan despite the host limit
+	quickRange        string // Range started with Q, scanned with the quick profile
 	totalIPs          int32
 	scannedCount      int32
 	discoveredCount   int32
 	scanStartTime     time.Time
+	scanInfo          export.ScanInfo // Parameters of the current scan, for exports
+	scanErr           error           // Why the last scan was aborted, if it was
 	workerStats       map[int]*scanner.WorkerStatus
 	statsLock         sync.RWMutex
 	scanner           *scanner.Scanner
@@ -249,6 +805,9 @@ type Model struct {
 	deviceDetailsView *views.DeviceDetailsView
 }
 
+// tablePageSize is the number of result rows shown per page
+const tablePageSize = 10
+
 // Add constants for screen states
 const (
 	screenWelcome    = "welcome"
@@ -263,6 +822,7 @@ type interfacesMsg []views.Interface
 type errMsg struct{ error }
 type deviceMsg struct {
 	done bool
+	err  error // Why the scan was aborted, nil if it finished or was stopped
 }
 
 // Add DeviceUpdate type definition near other types at the top
@@ -297,19 +857,6 @@ func welcomeTimer() tea.Cmd {
 	})
 }
 
-// generateAuthToken creates a cryptographically secure random token
-func generateAuthToken(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	if _, err := rand.Read(b); err != nil {
-		log.Fatalf("Failed to generate secure token: %v", err)
-	}
-	for i := range b {
-		b[i] = charset[int(b[i])%len(charset)]
-	}
-	return string(b)
-}
-
 // Update initialModel to start the welcome timer
 func initialModel() *Model {
 	styles := views.NewStyles()
@@ -317,11 +864,12 @@ func initialModel() *Model {
 	m := &Model{
 		currentScreen:     screenWelcome,
 		devices:           make(map[string]scanner.Device),
+		history:           make(map[string]scanner.Device),
 		activeScans:       make(map[string]bool),
 		workerStats:       make(map[int]*scanner.WorkerStatus),
 		selectedIndex:     0,
-		scanSelectedIndex: 0,
-		tableOffset:       0,
+		scanSelectedIP:    "",
+		collapsedGroups:   make(map[string]bool),
 		showingDetails:    false,
 		editingRange:      false,
 		cursorPos:         0,
@@ -376,7 +924,10 @@ func (m *Model) readScanResultCmd() tea.Cmd {
 			log.Printf("Scan complete - closing scanner")
 			m.scanner.Close() // Close the scanner and its report file
 			m.scanningActive = false
-			return deviceMsg{done: true}
+			if err := writeScanStats(m.scanner.ScanStats()); err != nil {
+				log.Printf("Error: cannot write --stats report: %v", err)
+			}
+			return deviceMsg{done: true, err: m.scanner.Err()}
 
 		default:
 			// No update available, check again soon
@@ -393,31 +944,47 @@ func (m *Model) scanNetwork(cidr string) tea.Cmd {
 		log.Printf("CIDR Range: %s", cidr)
 
 		// Create new scanner instance
-		m.scanner = scanner.NewScanner(debug)
-		if m.scanner == nil {
-			return errMsg{fmt.Errorf("failed to create scanner")}
+		opts := newScannerOptions()
+		if cidr == m.forcedRange {
+			opts.Force = true
+		}
+		if cidr == m.quickRange {
+			opts = opts.Quick()
+			log.Printf("Quick scan: probing ports %v with reverse DNS only", opts.Ports)
 		}
+		// Probe from the chosen interface so a multi-homed host doesn't send
+		// the scan out of another one
+		if opts.SourceIP == nil && len(m.interfaces) > 0 {
+			opts.SourceIP = interfaceSourceIP(m.interfaces[m.selectedIndex], cidr)
+			if opts.SourceIP != nil {
+				log.Printf("Sending probes from %s", opts.SourceIP)
+			}
+		}
+		opts.Gateway = discoverGateway()
+		m.scanner = scanner.NewScannerWithOptions(opts)
 
-		// Reset scan state
+		// Reset scan state, or with --append keep the devices found so far
+		// for this scan's results to merge into
 		m.deviceMutex.Lock()
-		m.devices = make(map[string]scanner.Device)
+		export.RecordSeen(m.history, m.devices)
+		if !appendResults {
+			m.devices = make(map[string]scanner.Device)
+		}
+		found := int32(len(deviceFilter.Apply(m.devices)))
 		m.deviceMutex.Unlock()
+		m.scanSelectedIP = ""
 
 		// Reset worker stats
 		m.statsLock.Lock()
 		m.workerStats = make(map[int]*scanner.WorkerStatus)
 		m.statsLock.Unlock()
 
-		// Parse CIDR to get total IPs for progress tracking
-		_, ipNet, err := net.ParseCIDR(cidr)
-		if err != nil {
-			return errMsg{err}
-		}
-		ips := scanner.GetAllIPs(ipNet)
-		atomic.StoreInt32(&m.totalIPs, int32(len(ips)))
+		atomic.StoreInt32(&m.totalIPs, 0)
 		atomic.StoreInt32(&m.scannedCount, 0)
-		atomic.StoreInt32(&m.discoveredCount, 0)
+		atomic.StoreInt32(&m.discoveredCount, found)
 		m.scanStartTime = time.Now()
+		m.scanInfo = export.NewScanInfo(version, cidr, opts, workerCount, 0, m.scanStartTime)
+		m.scanErr = nil
 		m.scanningActive = true
 
 		// Set scan start time in the scanning view
@@ -428,6 +995,9 @@ func (m *Model) scanNetwork(cidr string) tea.Cmd {
 			return errMsg{err}
 		}
 
+		// Take the total from the scanner so progress can't disagree with it
+		atomic.StoreInt32(&m.totalIPs, m.scanner.Stats().Total)
+
 		// Return both commands
 		return tea.Batch(
 			m.readScanResultCmd(),
@@ -483,52 +1053,201 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case errMsg:
 		m.err = msg
 		return m, nil
+	case clipboardMsg:
+		if msg.err != nil {
+			m.setStatus(fmt.Sprintf("Clipboard unavailable: %v", msg.err))
+		} else {
+			m.setStatus(fmt.Sprintf("Copied %s", msg.label))
+		}
+		return m, m.clearStatusAfter(2 * time.Second)
+	case clearStatusMsg:
+		if msg.seq == m.statusSeq {
+			m.statusMessage = ""
+		}
+		return m, nil
+	case hostScannedMsg:
+		return m, m.addHost(msg)
+	case deepProbedMsg:
+		return m, m.applyDeepProbe(msg)
+	case namesResolvedMsg:
+		return m, m.applyResolvedNames(msg)
+	case controlMsg:
+		return m, m.handleControl(msg)
 	case tea.KeyMsg:
+		if m.addingHost {
+			return m.updateAddHost(msg)
+		}
+		if msg.String() != "enter" {
+			m.confirmingLarge = false
+		}
 		switch msg.String() {
 		case "ctrl+c":
-			return m, tea.Quit
+			if m.quitting {
+				return m, tea.Quit // Second ctrl+c: don't wait for the scan to wind down
+			}
+			return m, m.shutdown()
 		case "q":
 			if !m.showingDetails && (m.currentScreen == screenScanning || m.currentScreen == screenResults) {
-				return m, tea.Quit
+				return m, m.shutdown()
+			}
+		case "c", "C":
+			if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				device, ok := m.scanningView.GetSelectedDevice()
+				if m.showingDetails {
+					device, ok = m.deviceDetailsView.GetDevice(), true
+				}
+				if !ok {
+					return m, nil
+				}
+				if msg.String() == "C" {
+					return m, copyCmd(formatDeviceRecord(device), "device record for "+device.IPAddress)
+				}
+				return m, copyCmd(device.IPAddress, device.IPAddress)
+			}
+		case "x":
+			if !m.showingDetails && (m.currentScreen == screenScanning || m.currentScreen == screenResults) {
+				var buf strings.Builder
+				devices := m.visibleDevices()
+				err := export.WriteCSV(&buf, redactor.Devices(devices), redactor.ScanInfo(m.scanInfo))
+				count := len(devices)
+				if err != nil {
+					return m, func() tea.Msg { return clipboardMsg{err: err} }
+				}
+				return m, copyCmd(buf.String(), fmt.Sprintf("%d devices as CSV", count))
+			}
+		case "Q":
+			// Quick scan: primary interface's /24 with the quick profile,
+			// skipping the confirm screen
+			if (m.currentScreen == screenWelcome || m.currentScreen == screenInterfaces) && len(m.interfaces) > 0 {
+				m.selectedIndex = primaryInterfaceIndex(m.interfaces)
+				selected := m.interfaces[m.selectedIndex]
+				m.proposedRange = calculateNetworkRange(selected.IPAddress, "/24")
+				m.quickRange = m.proposedRange
+				m.currentScreen = screenScanning
+				m.scanningActive = true
+				return m, tea.Batch(
+					m.scanNetwork(m.proposedRange),
+					tick(),
+				)
+			}
+		case "m":
+			if !m.showingDetails && (m.currentScreen == screenScanning || m.currentScreen == screenResults) {
+				m.mergeByMAC = !m.mergeByMAC
+				if m.mergeByMAC {
+					m.setStatus("Merging devices that share a MAC address")
+				} else {
+					m.setStatus("Showing one row per IP address")
+				}
+				return m, m.clearStatusAfter(2 * time.Second)
+			}
+		case "a":
+			if !m.showingDetails && (m.currentScreen == screenScanning || m.currentScreen == screenResults) {
+				m.addingHost = true
+				m.hostInput = ""
+			}
+		case "d":
+			if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				device, ok := m.scanningView.GetSelectedDevice()
+				if m.showingDetails {
+					device, ok = m.deviceDetailsView.GetDevice(), true
+				}
+				if !ok || device.Status != "Up" {
+					return m, nil
+				}
+				m.setStatus(fmt.Sprintf("Deep probing %s...", device.IPAddress))
+				return m, m.deepProbe(device.IPAddress)
+			}
+		case "n":
+			if !m.showingDetails && m.currentScreen == screenResults && !m.resolving {
+				m.resolving = true
+				m.setStatus("Resolving hostnames again...")
+				return m, m.resolveNames()
+			}
+		case "w":
+			if !m.showingDetails && (m.currentScreen == screenScanning || m.currentScreen == screenResults) {
+				m.showWorkers = !m.showWorkers
+			}
+		case "K":
+			// Skip the host the picked worker is stuck on, not the whole scan
+			if m.showWorkers && !m.showingDetails && m.currentScreen == screenScanning && m.scanningActive && m.scanner != nil {
+				id, ok := m.scanningView.SelectedWorker()
+				if !ok {
+					return m, nil
+				}
+				if ip, ok := m.scanner.SkipWorker(id); ok {
+					m.setStatus(fmt.Sprintf("Skipping %s on worker #%d", ip, id))
+				} else {
+					m.setStatus(fmt.Sprintf("Worker #%d isn't probing a host", id))
+				}
+				return m, m.clearStatusAfter(2 * time.Second)
+			}
+		case "g":
+			if !m.showingDetails && (m.currentScreen == screenScanning || m.currentScreen == screenResults) {
+				m.groupBySubnet = !m.groupBySubnet
+				m.moveSelection(0) // Off a header that is gone, or onto one
 			}
 		case "e":
 			if m.currentScreen == screenConfirm {
 				m.editingRange = true
 			}
-		case "up", "k":
-			if m.currentScreen == screenScanning || m.currentScreen == screenResults {
-				if m.scanSelectedIndex > 0 {
-					m.scanSelectedIndex--
-					if m.scanSelectedIndex < m.tableOffset {
-						m.tableOffset = m.scanSelectedIndex
+		case "tab", "shift+tab":
+			if m.showWorkers && !m.showingDetails && m.currentScreen == screenScanning {
+				if msg.String() == "tab" {
+					m.scanningView.SelectWorker(1)
+				} else {
+					m.scanningView.SelectWorker(-1)
+				}
+			} else if m.currentScreen == screenConfirm && !m.editingRange {
+				subnets := m.interfaces[m.selectedIndex].Subnets
+				if len(subnets) > 1 {
+					if msg.String() == "tab" {
+						m.subnetIndex = (m.subnetIndex + 1) % len(subnets)
+					} else {
+						m.subnetIndex = (m.subnetIndex + len(subnets) - 1) % len(subnets)
 					}
+					m.proposedRange = subnets[m.subnetIndex]
+					m.cursorPos = len(m.proposedRange)
 				}
+			}
+		case "up", "k":
+			if m.showingDetails {
+				m.deviceDetailsView.Scroll(-1)
+			} else if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				m.moveSelection(-1)
 			} else if m.selectedIndex > 0 {
 				m.selectedIndex--
 			}
 		case "down", "j":
-			if m.currentScreen == screenScanning || m.currentScreen == screenResults {
-				deviceCount := len(m.devices)
-				if m.scanSelectedIndex < deviceCount-1 {
-					m.scanSelectedIndex++
-					if m.scanSelectedIndex >= m.tableOffset+10 {
-						m.tableOffset = m.scanSelectedIndex - 9
-					}
-				}
+			if m.showingDetails {
+				m.deviceDetailsView.Scroll(1)
+			} else if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				m.moveSelection(1)
 			} else if m.selectedIndex < len(m.interfaces)-1 {
 				m.selectedIndex++
 			}
 		case "pgup":
-			if m.currentScreen == screenScanning || m.currentScreen == screenResults {
-				m.tableOffset = max(0, m.tableOffset-10)
-				m.scanSelectedIndex = max(m.scanSelectedIndex-10, m.tableOffset)
+			if m.showingDetails {
+				m.deviceDetailsView.ScrollPage(-1)
+			} else if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				m.moveSelection(-tablePageSize)
 			}
 		case "pgdown":
-			if m.currentScreen == screenScanning || m.currentScreen == screenResults {
-				deviceCount := len(m.devices)
-				maxOffset := max(0, deviceCount-10)
-				m.tableOffset = min(maxOffset, m.tableOffset+10)
-				m.scanSelectedIndex = min(m.scanSelectedIndex+10, deviceCount-1)
+			if m.showingDetails {
+				m.deviceDetailsView.ScrollPage(1)
+			} else if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				m.moveSelection(tablePageSize)
+			}
+		case "home":
+			if m.showingDetails {
+				m.deviceDetailsView.Scroll(-math.MaxInt32)
+			} else if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				m.moveSelection(-len(m.visibleDevices()))
+			}
+		case "end":
+			if m.showingDetails {
+				m.deviceDetailsView.Scroll(math.MaxInt32)
+			} else if m.currentScreen == screenScanning || m.currentScreen == screenResults {
+				m.moveSelection(len(m.visibleDevices()))
 			}
 		case "s":
 			if m.currentScreen == screenScanning && m.scanningActive {
@@ -553,14 +1272,28 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if len(m.interfaces) > 0 {
 					selected := m.interfaces[m.selectedIndex]
 					m.proposedRange = calculateNetworkRange(selected.IPAddress, selected.CIDR)
+					m.subnetIndex = primarySubnetIndex(selected)
+					if len(selected.Subnets) > 0 {
+						m.proposedRange = selected.Subnets[m.subnetIndex]
+					}
 					m.currentScreen = screenConfirm
 					m.editingRange = false
 					m.cursorPos = len(m.proposedRange)
 				}
 			case screenConfirm:
+				m.normalizeRange()
 				if m.editingRange {
 					m.editingRange = false
 				} else {
+					if m.overHostLimit(m.proposedRange) {
+						if !m.confirmingLarge {
+							m.confirmingLarge = true
+							return m, nil
+						}
+						m.forcedRange = m.proposedRange
+					}
+					m.confirmingLarge = false
+					m.quickRange = ""
 					m.currentScreen = screenScanning
 					m.scanningActive = true
 					return m, tea.Batch(
@@ -569,7 +1302,10 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					)
 				}
 			case screenScanning, screenResults:
-				if device, ok := m.scanningView.GetSelectedDevice(); ok {
+				if group, ok := m.scanningView.SelectedGroup(); ok {
+					m.collapsedGroups[group] = !m.collapsedGroups[group]
+					m.scanSelectedIP = views.GroupKey(group)
+				} else if device, ok := m.scanningView.GetSelectedDevice(); ok {
 					m.showingDetails = !m.showingDetails
 					if m.showingDetails {
 						m.deviceDetailsView.SetDevice(device)
@@ -580,6 +1316,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "esc":
 			if m.currentScreen == screenConfirm {
 				if m.editingRange {
+					m.normalizeRange()
 					m.editingRange = false
 				} else {
 					m.currentScreen = screenInterfaces
@@ -612,10 +1349,26 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	case scanUpdateMsg:
 		if msg.device.IPAddress != "" {
+			// A device is sent again when a late hostname arrives, which
+			// may change whether it passes the --only-* filter, so it is
+			// counted while it passes
 			m.deviceMutex.Lock()
+			msg.device.CarrySeen(m.history[msg.device.IPAddress])
+			previous, seen := m.devices[msg.device.IPAddress]
+			if seen && appendResults {
+				msg.device.Merge(previous)
+			}
 			m.devices[msg.device.IPAddress] = msg.device
 			m.deviceMutex.Unlock()
-			atomic.AddInt32(&m.discoveredCount, 1)
+			if match := deviceFilter.Match(msg.device); match != (seen && deviceFilter.Match(previous)) {
+				if match {
+					atomic.AddInt32(&m.discoveredCount, 1)
+				} else {
+					atomic.AddInt32(&m.discoveredCount, -1)
+				}
+			}
+			writeResult(msg.device)
+			alerts.found(msg.device)
 
 			// Update web interface if enabled
 			if webServer != nil {
@@ -671,14 +1424,26 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.done {
 			m.scanningActive = false
 			m.currentScreen = screenResults
+			m.scanErr = msg.err
 
 			// Notify web interface if enabled
 			if webServer != nil {
-				webServer.BroadcastUpdate(map[string]interface{}{
+				update := map[string]interface{}{
 					"type": "scan_complete",
-				})
+				}
+				if msg.err != nil {
+					update["error"] = msg.err.Error()
+				}
+				webServer.BroadcastUpdate(update)
 			}
 
+			if alerts != nil {
+				count, err := len(m.visibleDevices()), msg.err
+				return m, func() tea.Msg {
+					alerts.complete(count, false, err)
+					return nil
+				}
+			}
 			return m, nil
 		}
 		return m, nil
@@ -713,6 +1478,107 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// selectedDeviceIndex returns the row of the selection within the rows it
+// moves over, the devices sorted by IP and with grouping the subnet headers,
+// along with the keys of those rows
+func (m *Model) selectedDeviceIndex() (int, []string) {
+	ips := views.SelectionKeys(export.SortedIPs(m.visibleDevices()), m.groupBySubnet, m.collapsedGroups)
+
+	for i, ip := range ips {
+		if ip == m.scanSelectedIP {
+			return i, ips
+		}
+	}
+	return 0, ips
+}
+
+// shutdownDrainTimeout bounds how long quitting waits for in-flight probes
+const shutdownDrainTimeout = 3 * time.Second
+
+// shutdown stops any running scan and closes its report before quitting, so
+// a partial report still gets its footer. The wait is bounded; pressing
+// ctrl+c again quits immediately.
+func (m *Model) shutdown() tea.Cmd {
+	s := m.scanner
+	if s == nil {
+		return tea.Quit
+	}
+
+	m.quitting = true
+	m.setStatus("Stopping scan... press ctrl+c again to quit now")
+	return func() tea.Msg {
+		s.Stop()
+		if !s.Wait(shutdownDrainTimeout) {
+			log.Printf("Scan did not finish within %s, quitting anyway", shutdownDrainTimeout)
+		}
+		s.Close()
+		return tea.Quit()
+	}
+}
+
+// truncatedAt returns the --max-results cap if the current scan has dropped
+// devices past it, 0 otherwise
+func (m *Model) truncatedAt() int {
+	if m.scanner == nil || m.scanner.Stats().Truncated == 0 {
+		return 0
+	}
+	return maxResults
+}
+
+// normalizeRange rewrites the proposed range in its network form, so that
+// 192.168.1.50/24 is confirmed and scanned as 192.168.1.0/24
+func (m *Model) normalizeRange() {
+	if network, err := scanner.NormalizeCIDR(m.proposedRange); err == nil && network != m.proposedRange {
+		m.proposedRange = network
+		m.cursorPos = len(network)
+	}
+}
+
+// overHostLimit reports whether scanning cidr needs the user's confirmation
+func (m *Model) overHostLimit(cidr string) bool {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	return newScannerOptions().CheckHosts(cidr, scanner.CountIPs(ipNet)) != nil
+}
+
+// visibleDevices returns a snapshot of the devices as listed in the results
+// table: one per IP, or merged by MAC address when that is toggled on
+func (m *Model) visibleDevices() map[string]scanner.Device {
+	m.deviceMutex.RLock()
+	defer m.deviceMutex.RUnlock()
+	if m.mergeByMAC {
+		return deviceFilter.Apply(export.MergeByMAC(m.devices))
+	}
+	devices := make(map[string]scanner.Device, len(m.devices))
+	for ip, device := range m.devices {
+		if deviceFilter.Match(device) {
+			devices[ip] = device
+		}
+	}
+	return devices
+}
+
+// moveSelection moves the results selection by delta rows, clamped to the
+// device list. The scanning view scrolls to keep the selection visible.
+func (m *Model) moveSelection(delta int) {
+	index, ips := m.selectedDeviceIndex()
+	if len(ips) == 0 {
+		return
+	}
+	m.selectDeviceAt(ips, index+delta)
+}
+
+// selectDeviceAt selects the row at index of the selection keys
+func (m *Model) selectDeviceAt(ips []string, index int) {
+	if len(ips) == 0 {
+		m.scanSelectedIP = ""
+		return
+	}
+	m.scanSelectedIP = ips[max(0, min(index, len(ips)-1))]
+}
+
 // Add helper functions
 func max(a, b int) int {
 	if a > b {
@@ -752,6 +1618,7 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 	}
 
 	var networkInterfaces []views.Interface
+	byName := make(map[string]int) // Interface name to index in networkInterfaces
 	for _, iface := range ifaces {
 		// Handle interface flags based on OS
 		isUp := iface.Flags&net.FlagUp != 0
@@ -776,6 +1643,25 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 				continue
 			}
 
+			// Get subnet mask in CIDR notation
+			ones, _ := ipNet.Mask.Size()
+			cidr := fmt.Sprintf("/%d", ones)
+			subnet := calculateNetworkRange(ipNet.IP.String(), cidr)
+
+			// Group additional addresses under the interface already listed
+			if idx, ok := byName[iface.Name]; ok {
+				existing := &networkInterfaces[idx]
+				existing.Subnets = append(existing.Subnets, subnet)
+				// Prefer the first routable address as the primary one
+				if isLinkLocal(existing.IPAddress) && !ipNet.IP.IsLinkLocalUnicast() {
+					existing.IPAddress = ipNet.IP.String()
+					existing.SubnetMask = ipNet.Mask.String()
+					existing.CIDR = cidr
+					existing.Gateway = interfaceGateway(gatewayIP, ipNet)
+				}
+				continue
+			}
+
 			// Get display name
 			displayName := iface.Name
 			if runtime.GOOS == "windows" {
@@ -784,16 +1670,12 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 				}
 			}
 
-			// Determine gateway for this interface
-			gateway := "Not detected"
-			if gatewayIP != nil && ipNet.Contains(gatewayIP) {
-				gateway = gatewayIP.String()
+			var vendor string
+			if len(iface.HardwareAddr) > 0 {
+				vendor = scanner.LookupVendor(iface.HardwareAddr.String())
 			}
 
-			// Get subnet mask in CIDR notation
-			ones, _ := ipNet.Mask.Size()
-			cidr := fmt.Sprintf("/%d", ones)
-
+			byName[iface.Name] = len(networkInterfaces)
 			networkInterfaces = append(networkInterfaces, views.Interface{
 				Name:         iface.Name,
 				FriendlyName: displayName,
@@ -801,9 +1683,11 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 				SubnetMask:   ipNet.Mask.String(),
 				CIDR:         cidr,
 				MACAddress:   iface.HardwareAddr.String(),
-				Gateway:      gateway,
+				Vendor:       vendor,
+				Gateway:      interfaceGateway(gatewayIP, ipNet),
 				IsUp:         isUp,
 				Priority:     getPriority(displayName), // Use display name for priority
+				Subnets:      []string{subnet},
 			})
 		}
 	}
@@ -816,6 +1700,88 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 	return networkInterfaces, nil
 }
 
+// interfaceGateway returns the default gateway if it belongs to ipNet
+func interfaceGateway(gatewayIP net.IP, ipNet *net.IPNet) string {
+	if gatewayIP != nil && ipNet.Contains(gatewayIP) {
+		return gatewayIP.String()
+	}
+	return "Not detected"
+}
+
+// isLinkLocal reports whether ip is a link-local (non-routable) address
+func isLinkLocal(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLinkLocalUnicast()
+}
+
+// interfaceSourceIP returns the address of iface to scan cidr from: the one
+// whose subnet overlaps cidr. It returns nil when cidr isn't on the
+// interface, e.g. a routed or VPN range, so routing picks the way out.
+func interfaceSourceIP(iface views.Interface, cidr string) net.IP {
+	_, target, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil
+	}
+	sys, err := net.InterfaceByName(iface.Name)
+	if err != nil {
+		return nil
+	}
+	addrs, err := sys.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil &&
+			(target.Contains(ipNet.IP) || ipNet.Contains(target.IP)) {
+			return ipNet.IP
+		}
+	}
+	return nil
+}
+
+// isLocalIP reports whether ip is assigned to one of this machine's interfaces
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// primaryInterfaceIndex returns the index of the interface most likely to be
+// the machine's main network: up, routable and holding the default gateway
+func primaryInterfaceIndex(interfaces []views.Interface) int {
+	fallback := -1
+	for i, iface := range interfaces {
+		if !iface.IsUp || isLinkLocal(iface.IPAddress) {
+			continue
+		}
+		if iface.Gateway != "Not detected" {
+			return i
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+	}
+	return max(fallback, 0)
+}
+
+// primarySubnetIndex returns the index of the first routable subnet of iface
+func primarySubnetIndex(iface views.Interface) int {
+	for i, subnet := range iface.Subnets {
+		ip, _, err := net.ParseCIDR(subnet)
+		if err == nil && !ip.IsLinkLocalUnicast() {
+			return i
+		}
+	}
+	return 0
+}
+
 func getWindowsFriendlyName(interfaceName string) string {
 	if runtime.GOOS != "windows" {
 		return interfaceName
@@ -852,6 +1818,7 @@ func (m *Model) View() string {
 	case screenScanning, screenResults:
 		if m.showingDetails {
 			m.deviceDetailsView.SetDimensions(m.width, m.height)
+			m.deviceDetailsView.SetStatusMessage(m.statusMessage)
 			return m.deviceDetailsView.Render()
 		}
 		return m.renderScanningView()
@@ -877,22 +1844,41 @@ func (m *Model) renderConfirmView() string {
 	m.confirmView.SetDimensions(m.width, m.height)
 	m.confirmView.SetInterface(m.interfaces[m.selectedIndex])
 	m.confirmView.SetRange(m.proposedRange)
+	m.confirmView.SetSubnetIndex(m.subnetIndex)
 	m.confirmView.SetEditing(m.editingRange)
 	m.confirmView.SetCursor(m.cursorPos)
+	limit := maxHosts
+	if limit == 0 {
+		limit = scanner.DefaultMaxHosts
+	}
+	if forceScan || limit < 0 {
+		limit = 0
+	}
+	m.confirmView.SetHostLimit(limit, m.confirmingLarge)
 	return m.confirmView.Render()
 }
 
 func (m *Model) renderScanningView() string {
 	m.scanningView.SetDimensions(m.width, m.height)
-	m.scanningView.SetDevices(m.devices)
-	m.scanningView.SetSelectedIndex(m.scanSelectedIndex)
-	m.scanningView.SetTableOffset(m.tableOffset)
+	m.scanningView.SetDevices(m.visibleDevices())
+	m.scanningView.SetSelectedIP(m.scanSelectedIP)
+	m.scanningView.SetGrouped(m.groupBySubnet)
+	m.scanningView.SetCollapsed(m.collapsedGroups)
+	m.scanningView.SetColumns(tableColumns)
+	m.scanningView.SetShowWorkers(m.showWorkers)
 	m.scanningView.SetShowingDetails(m.showingDetails)
 	m.scanningView.SetScanningActive(m.scanningActive)
 	m.scanningView.SetCurrentIP(m.currentIP)
 	m.scanningView.SetProgress(m.scannedCount, m.totalIPs, m.discoveredCount)
 	m.scanningView.SetScanStartTime(m.scanStartTime)
 	m.scanningView.SetWorkerStats(m.workerStats)
+	m.scanningView.SetScanError(m.scanErr)
+	m.scanningView.SetTruncated(m.truncatedAt())
+	if m.addingHost {
+		m.scanningView.SetStatusMessage(m.addHostPrompt())
+	} else {
+		m.scanningView.SetStatusMessage(m.statusMessage)
+	}
 	return m.scanningView.Render()
 }
 
@@ -902,6 +1888,7 @@ func main() {
 		if telemetryClient != nil {
 			telemetryClient.Stop()
 		}
+		resultsOut.Close()
 	}()
 
 	p := tea.NewProgram(
@@ -909,6 +1896,16 @@ func main() {
 		tea.WithAltScreen(), // Use alternate screen buffer
 	)
 
+	if controlPath != "" {
+		ln, err := listenControl(controlPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot listen on --control socket: %v\n", err)
+			os.Exit(exitError)
+		}
+		defer ln.Close()
+		go serveControl(ln, p)
+	}
+
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error running program: %v", err)
 		os.Exit(1)
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramborogers/netventory/scanner"
+	"golang.org/x/term"
+)
+
+// --notify modes
+const (
+	notifyDone  = "done"  // When a scan completes
+	notifyFound = "found" // As each device passing the --only-* filter is found, and when a scan completes
+)
+
+// notifyBatch is how long found devices are gathered into one notification,
+// so a busy network doesn't pop up one per host
+const notifyBatch = 3 * time.Second
+
+// errNoNotifier is returned when no desktop notification can be shown, e.g.
+// over SSH
+var errNoNotifier = errors.New("no desktop notifications available")
+
+// notifier alerts the user to scan events with a desktop notification where
+// one can be shown and a terminal bell otherwise
+type notifier struct {
+	mode string
+
+	mu       sync.Mutex
+	notified map[string]bool // Devices already announced, across rescans
+	pending  []string        // Devices found since the last notification
+	timer    *time.Timer     // Flushes pending, nil when nothing is
+}
+
+// alerts is the notifier for --notify, nil when it is off
+var alerts *notifier
+
+// newNotifier returns a notifier for mode, or an error naming the modes
+func newNotifier(mode string) (*notifier, error) {
+	if mode != notifyDone && mode != notifyFound {
+		return nil, fmt.Errorf("invalid --notify %q, use %s or %s", mode, notifyDone, notifyFound)
+	}
+	return &notifier{mode: mode, notified: make(map[string]bool)}, nil
+}
+
+// found announces device if it is new and passes the --only-* filter. A
+// device sent again with a late hostname is not announced twice.
+func (n *notifier) found(device scanner.Device) {
+	if n == nil || n.mode != notifyFound || !deviceFilter.Match(device) {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.notified[device.IPAddress] {
+		return
+	}
+	n.notified[device.IPAddress] = true
+	n.pending = append(n.pending, describeForNotification(device))
+	if n.timer == nil {
+		n.timer = time.AfterFunc(notifyBatch, n.flush)
+	}
+}
+
+// flush sends the devices found since the last notification
+func (n *notifier) flush() {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending = nil
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+	n.mu.Unlock()
+
+	switch len(pending) {
+	case 0:
+	case 1:
+		alert("netventory: device found", pending[0])
+	default:
+		alert(fmt.Sprintf("netventory: %d devices found", len(pending)), strings.Join(pending, "\n"))
+	}
+}
+
+// complete announces the end of a scan that found count devices, after any
+// devices still waiting to be announced. stopped is true for a scan stopped
+// early and err is why it was aborted, if it was.
+func (n *notifier) complete(count int, stopped bool, err error) {
+	if n == nil {
+		return
+	}
+	n.flush()
+	switch {
+	case err != nil:
+		alert("netventory: scan aborted", fmt.Sprintf("%v; found %d devices", err, count))
+	case stopped:
+		alert("netventory: scan stopped", fmt.Sprintf("Found %d devices", count))
+	default:
+		alert("netventory: scan complete", fmt.Sprintf("Found %d devices", count))
+	}
+}
+
+// describeForNotification names a device by its address and, if known, its
+// hostname and vendor
+func describeForNotification(device scanner.Device) string {
+	text := device.IPAddress
+	if len(device.Hostname) > 0 {
+		text += " " + device.Hostname[0]
+	} else if device.MDNSName != "" {
+		text += " " + device.MDNSName
+	}
+	if device.Vendor != "" {
+		text += " (" + device.Vendor + ")"
+	}
+	return text
+}
+
+// alert shows a desktop notification, falling back to a terminal bell when
+// there is no way to show one
+func alert(title, message string) {
+	err := showNotification(title, message)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, errNoNotifier) {
+		log.Printf("Desktop notification failed: %v", err)
+	}
+	// A bell in a redirected log would only be noise
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+}
+
+// showNotification shows a desktop notification with the platform's tool.
+// The text is passed in the environment on macOS and Windows so that no
+// quoting is needed to keep it out of the script.
+func showNotification(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e",
+			`display notification (system attribute "NETVENTORY_MESSAGE") with title (system attribute "NETVENTORY_TITLE")`)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToast)
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return errNoNotifier
+		}
+		cmd = exec.Command("notify-send", "--app-name=netventory", title, message)
+	}
+	if _, err := exec.LookPath(cmd.Args[0]); err != nil {
+		return errNoNotifier
+	}
+	cmd.Env = append(os.Environ(), "NETVENTORY_TITLE="+title, "NETVENTORY_MESSAGE="+message)
+	return cmd.Run()
+}
+
+// windowsToast shows $env:NETVENTORY_TITLE and $env:NETVENTORY_MESSAGE as a
+// toast notification. Toasts need a registered app ID, so PowerShell's is
+// borrowed.
+const windowsToast = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:NETVENTORY_TITLE)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode($env:NETVENTORY_MESSAGE)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe').Show($toast)
+`
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ramborogers/netventory/export"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// namesResolvedMsg carries the devices whose hostname resolution was re-run
+type namesResolvedMsg struct {
+	devices []scanner.Device
+}
+
+// resolveNames re-runs hostname resolution on the listed devices with a
+// scanner of its own, without probing them again
+func (m *Model) resolveNames() tea.Cmd {
+	m.deviceMutex.RLock()
+	devices := make([]scanner.Device, 0, len(m.devices))
+	for _, device := range m.devices {
+		devices = append(devices, device)
+	}
+	m.deviceMutex.RUnlock()
+
+	opts := newScannerOptions()
+	opts.Debug = false // Keep the sweep's report file
+	return func() tea.Msg {
+		log.Printf("Re-resolving hostnames of %d devices", len(devices))
+		s := scanner.NewScannerWithOptions(opts)
+		defer s.Close()
+		return namesResolvedMsg{devices: s.Resolve(devices, workerCount)}
+	}
+}
+
+// applyResolvedNames updates the names of the devices still listed and
+// reports how many changed
+func (m *Model) applyResolvedNames(msg namesResolvedMsg) tea.Cmd {
+	m.resolving = false
+	if m.scanningActive {
+		// A rescan replaced the devices these were resolved from
+		return nil
+	}
+	changed := 0
+	m.deviceMutex.Lock()
+	for _, device := range msg.devices {
+		current, ok := m.devices[device.IPAddress]
+		if !ok || !current.SetNames(device) {
+			continue
+		}
+		m.devices[device.IPAddress] = current
+		writeResult(current)
+		changed++
+	}
+	devices := maps.Clone(m.devices)
+	m.deviceMutex.Unlock()
+
+	if changed > 0 && webServer != nil {
+		webServer.UpdateDevices(devices)
+	}
+	m.setStatus(fmt.Sprintf("Resolved names again: %d of %d devices changed", changed, len(msg.devices)))
+	return m.clearStatusAfter(3 * time.Second)
+}
+
+// resolveFile re-runs hostname resolution on the devices of the JSON export
+// at path and writes them to stdout in cfg.format, as a scan would have
+func resolveFile(path string, cfg headlessConfig, tmpl *template.Template) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return exitError, err
+	}
+	defer f.Close()
+	var envelope export.Envelope
+	if err := json.NewDecoder(f).Decode(&envelope); err != nil {
+		return exitError, fmt.Errorf("%s: %w", path, err)
+	}
+	if envelope.SchemaVersion > export.SchemaVersion {
+		return exitError, fmt.Errorf("%s: schema version %d is newer than this netventory reads (%d)", path, envelope.SchemaVersion, export.SchemaVersion)
+	}
+
+	progress := io.Writer(os.Stderr)
+	if cfg.quiet {
+		progress = io.Discard
+	}
+	fmt.Fprintf(progress, "Resolving hostnames of %d devices from %s...\n", len(envelope.Devices), path)
+	start := time.Now()
+	s := scanner.NewScannerWithOptions(newScannerOptions())
+	defer s.Close()
+	resolved := s.Resolve(envelope.Devices, workerCount)
+
+	devices := make(map[string]scanner.Device, len(resolved))
+	changed := 0
+	for i, device := range resolved {
+		if original := envelope.Devices[i]; original.SetNames(device) {
+			changed++
+		}
+		devices[device.IPAddress] = device
+	}
+	if cfg.mergeMAC {
+		devices = export.MergeByMAC(devices)
+	}
+	devices = cfg.filter.Apply(devices)
+	fmt.Fprintf(progress, "Names of %d devices changed in %s\n", changed, time.Since(start).Round(time.Second))
+
+	var info export.ScanInfo
+	if envelope.Scan != nil {
+		info = *envelope.Scan
+	}
+	info.Version = strings.TrimPrefix(version, "v")
+	if err := writeDevices(os.Stdout, devices, cfg.format, tmpl, info); err != nil {
+		return exitError, err
+	}
+	if len(devices) == 0 {
+		return exitNoDevices, nil
+	}
+	return exitOK, nil
+}
@@ -0,0 +1,242 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// frameWriter is a frameSource that can also put frames on the wire
+type frameWriter interface {
+	WriteFrame(frame []byte) error
+}
+
+// ARP sweep pacing: requests go out in bursts so a large link doesn't
+// overrun the socket buffer, each address is asked arpPasses times, and
+// answers are awaited for arpReplyWait after each pass
+const (
+	arpBurst     = 64
+	arpBurstGap  = 2 * time.Millisecond
+	arpPasses    = 2
+	arpReplyWait = time.Second
+)
+
+// arpProxyMin is how many addresses one MAC must answer for, and at least
+// half of those that answered, for the sweep to be put down to a proxy ARP
+// responder rather than the hosts
+const arpProxyMin = 8
+
+// arpResult is what an ARP sweep heard on the link it covered
+type arpResult struct {
+	network *net.IPNet
+	macs    map[string]string // MAC of each address that answered
+}
+
+// reply returns the MAC ip answered the sweep with, or "" when it stayed
+// silent, and whether the sweep covered ip at all. Addresses beyond the
+// swept link are left to the TCP probes.
+func (r *arpResult) reply(ip net.IP) (string, bool) {
+	if r == nil || !r.network.Contains(ip) {
+		return "", false
+	}
+	return r.macs[ip.String()], true
+}
+
+// proxyARP returns the MAC that answered for most of the link, if one did:
+// a router or firewall replying for addresses that may have no host at all
+func (r *arpResult) proxyARP() string {
+	counts := make(map[string]int)
+	for _, mac := range r.macs {
+		counts[mac]++
+	}
+	for mac, n := range counts {
+		if n >= arpProxyMin && n*2 >= len(r.macs) {
+			return mac
+		}
+	}
+	return ""
+}
+
+// sweepARP broadcasts an ARP request for every target on the link of the
+// source address, or of the first target, and collects the replies. It
+// returns nil when the range isn't on a local link, no raw socket can be
+// opened, the replies couldn't all be read or a proxy ARP responder answered
+// for the link, and the scan probes every address over TCP instead.
+func (s *Scanner) sweepARP(targets *Targets) *arpResult {
+	link, local, network, err := arpLink(s.opts.SourceIP, targets)
+	var source frameSource
+	if err == nil {
+		source, err = openFrameSource(link.Name)
+	}
+	var writer frameWriter
+	if err == nil {
+		if writer, _ = source.(frameWriter); writer == nil {
+			source.Close()
+			err = errors.New("this capture can't send frames")
+		}
+	}
+	if err != nil {
+		log.Printf("ARP scan unavailable, probing over TCP: %v", err)
+		s.report("\nARP scan unavailable, probing over TCP: %v\n", err)
+		return nil
+	}
+	defer source.Close()
+
+	result := &arpResult{network: network, macs: make(map[string]string)}
+	var mu sync.Mutex
+	answered := func(ip net.IP) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return result.macs[ip.String()] != ""
+	}
+
+	// Replies are read while the requests go out; any ARP sender on the
+	// link counts, since a host asking for someone is up as well
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var readErr error // Set by the reader, read once it is done
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			frame, err := source.ReadFrame()
+			if err != nil {
+				readErr = err
+				return
+			}
+			if len(frame) < 14 || binary.BigEndian.Uint16(frame[12:14]) != etherTypeARP {
+				continue
+			}
+			if o, ok := decodeFrame(frame); ok && network.Contains(net.ParseIP(o.ip)) {
+				mu.Lock()
+				result.macs[o.ip] = o.mac
+				mu.Unlock()
+			}
+		}
+	}()
+
+	log.Printf("ARP sweep of %s on %s", network, link.Name)
+	s.report("\nARP sweep of %s on %s\n", network, link.Name)
+	asked := 0
+	for pass := 0; pass < arpPasses && !s.stopped(); pass++ {
+		sent := 0
+		targets.iterate(func(ip net.IP) bool {
+			if !network.Contains(ip) || ip.Equal(local) || answered(ip) {
+				return true
+			}
+			if err = writer.WriteFrame(arpRequest(link.HardwareAddr, local, ip)); err != nil {
+				return false
+			}
+			if pass == 0 {
+				asked++
+			}
+			if sent++; sent%arpBurst == 0 {
+				time.Sleep(arpBurstGap)
+			}
+			return !s.stopped()
+		})
+		if err != nil {
+			break
+		}
+		select {
+		case <-s.stopping():
+		case <-time.After(arpReplyWait):
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// Silent addresses are taken as down without a probe, so a sweep whose
+	// replies weren't all heard can't be trusted
+	if err == nil && readErr != nil {
+		err = fmt.Errorf("reading replies: %v", readErr)
+	}
+	if err != nil {
+		log.Printf("ARP scan failed, probing over TCP: %v", err)
+		s.report("ARP scan failed, probing over TCP: %v\n", err)
+		return nil
+	}
+	log.Printf("ARP sweep: %d of %d addresses answered", len(result.macs), asked)
+	s.report("ARP sweep: %d of %d addresses answered\n", len(result.macs), asked)
+	if mac := result.proxyARP(); mac != "" {
+		log.Printf("ARP sweep: %s answered for most of %s, likely proxy ARP; probing over TCP", mac, network)
+		s.report("ARP sweep answered by proxy ARP (%s), probing over TCP\n", mac)
+		return nil
+	}
+	return result
+}
+
+// arpLink finds the Ethernet interface on the same network as the source
+// address, or the first target, and returns it with its IPv4 address and
+// that network
+func arpLink(source net.IP, targets *Targets) (*net.Interface, net.IP, *net.IPNet, error) {
+	var first net.IP
+	targets.iterate(func(ip net.IP) bool {
+		first = dup(ip)
+		return false
+	})
+	if first == nil || first.To4() == nil {
+		return nil, nil, nil, errors.New("ARP covers IPv4 targets only")
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i := range interfaces {
+		iface := &interfaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			network, ok := addr.(*net.IPNet)
+			if !ok || network.IP.To4() == nil || !network.Contains(first) {
+				continue
+			}
+			if source != nil && !network.IP.Equal(source) {
+				continue
+			}
+			return iface, network.IP.To4(), &net.IPNet{IP: network.IP.Mask(network.Mask), Mask: network.Mask}, nil
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("%s is not on a local Ethernet link", first)
+}
+
+// arpRequest builds a broadcast who-has frame for target from the
+// interface with address hw and IPv4 address local
+func arpRequest(hw net.HardwareAddr, local, target net.IP) []byte {
+	eth := layers.Ethernet{
+		SrcMAC:       hw,
+		DstMAC:       layers.EthernetBroadcast,
+		EthernetType: layers.EthernetTypeARP,
+	}
+	arp := layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   hw,
+		SourceProtAddress: local.To4(),
+		DstHwAddress:      make([]byte, 6),
+		DstProtAddress:    target.To4(),
+	}
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, &eth, &arp)
+	return buf.Bytes()
+}
@@ -0,0 +1,38 @@
+package scanner
+
+import "slices"
+
+// deepTimeoutScale stretches the port probe timeouts of a deep probe, for
+// hosts behind slow links or rate-limiting firewalls
+const deepTimeoutScale = 3
+
+// IsMystery reports whether the device answers probes but nothing names it:
+// no hostname, mDNS name or MAC address, as with a host behind a router
+// whose every name lookup failed. Such hosts are worth a deep probe.
+func (d Device) IsMystery() bool {
+	return d.Status == "Up" && len(d.Hostname) == 0 && d.MDNSName == "" && d.MACAddress == ""
+}
+
+// Deep returns o set up to investigate a single host with ScanHost, on a
+// Scanner of its own: the DeepPorts on top of the configured ones, every
+// hostname resolver tried on it whatever its ports (IntensityHigh), every
+// handshake, longer probe timeouts and a retry pass if it doesn't answer at
+// first
+func (o Options) Deep() Options {
+	ports := slices.Clone(o.ports())
+	for _, port := range DeepPorts {
+		if !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	o.Ports = ports
+	o.Intensity = IntensityHigh
+	o.ConnectOnly = false
+	o.PreferMDNS = true
+	o.TimeoutScale = max(o.TimeoutScale, deepTimeoutScale)
+	o.Retries = max(o.Retries, 1)
+	o.ARPScan = false
+	o.Sniff = false
+	o.Passive = false
+	return o
+}
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// portFTP is the FTP control port
+const portFTP = 21
+
+// bannerMaxLength caps a banner kept on a device; anything longer is
+// almost certainly not a product name
+const bannerMaxLength = 256
+
+// BannerPorts returns the ports d has a banner recorded for, in ascending
+// order
+func (d Device) BannerPorts() []int {
+	ports := make([]int, 0, len(d.Banners))
+	for port := range d.Banners {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// setBanner records the greeting a service sent on port, its lines joined
+// into one of at most bannerMaxLength
+func (d *Device) setBanner(port int, banner string) {
+	banner = strings.Join(strings.Fields(banner), " ")
+	if banner == "" {
+		return
+	}
+	if len(banner) > bannerMaxLength {
+		banner = banner[:bannerMaxLength]
+	}
+	if d.Banners == nil {
+		d.Banners = make(map[int]string)
+	}
+	d.Banners[port] = banner
+}
+
+// probeFTP reads the welcome banner of a device with the FTP port open into
+// device.Banners and, with Options.FTPAnonymous, records whether anonymous
+// logins are accepted
+func (s *Scanner) probeFTP(device *Device) {
+	if !contains(device.OpenPorts, portFTP) {
+		return
+	}
+	release := s.acquireResolver()
+	start := time.Now()
+	banner, anonymous, err := getFTPBanner(device.IPAddress, s.opts.SourceIP, s.opts.Intensity.resolverTimeoutScale(), s.opts.FTPAnonymous)
+	release()
+	s.timing().resolved(PhaseFTP, start, err == nil)
+	if err != nil {
+		log.Printf("FTP banner from %s unavailable: %v", device.IPAddress, err)
+		device.addNote("FTP banner unavailable: %v", err)
+		return
+	}
+	log.Printf("FTP banner from %s: %q (anonymous login: %v)", device.IPAddress, banner, anonymous)
+	device.setBanner(portFTP, banner)
+	device.AnonymousFTP = anonymous
+}
+
+// getFTPBanner reads the 220 welcome message of the FTP server at ip and,
+// for tryAnonymous, tries to log in as anonymous and reports whether the
+// server let it in. The session ends with QUIT either way; nothing is
+// listed or transferred.
+func getFTPBanner(ip string, source net.IP, timeoutScale int, tryAnonymous bool) (string, bool, error) {
+	timeout := time.Second * 2 * time.Duration(timeoutScale)
+	conn, err := dial(dialer("tcp", source, timeout), "tcp", net.JoinHostPort(ip, strconv.Itoa(portFTP)))
+	if err != nil {
+		return "", false, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout * 2))
+
+	text := textproto.NewConn(conn)
+	_, banner, err := text.ReadResponse(220)
+	if err != nil {
+		return "", false, fmt.Errorf("reading welcome: %v", err)
+	}
+	defer text.Cmd("QUIT")
+	if !tryAnonymous {
+		return banner, false, nil
+	}
+
+	code, err := ftpCommand(text, "USER anonymous")
+	if err != nil {
+		return banner, false, nil
+	}
+	if code == 331 {
+		code, err = ftpCommand(text, "PASS anonymous@")
+		if err != nil {
+			return banner, false, nil
+		}
+	}
+	return banner, code == 230, nil
+}
+
+// ftpCommand sends a command and returns the code of the reply
+func ftpCommand(text *textproto.Conn, command string) (int, error) {
+	if _, err := text.Cmd("%s", command); err != nil {
+		return 0, err
+	}
+	code, _, err := text.ReadResponse(0)
+	return code, err
+}
@@ -0,0 +1,195 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Device types assigned by hypervisor detection
+const (
+	TypeProxmox = "Proxmox VE"
+	TypeESXi    = "VMware ESXi"
+	TypeVCenter = "VMware vCenter"
+)
+
+// IsHypervisor reports whether the device was identified as a hypervisor or
+// virtualization manager
+func (d Device) IsHypervisor() bool {
+	switch d.DeviceType {
+	case TypeProxmox, TypeESXi, TypeVCenter:
+		return true
+	}
+	return false
+}
+
+var (
+	// The Proxmox login page loads its UI script with the manager version
+	proxmoxVersionRe = regexp.MustCompile(`pvemanagerlib\.js\?ver=([0-9][0-9A-Za-z.\-]*)`)
+	vimAPITypeRe     = regexp.MustCompile(`<apiType>([^<]+)</apiType>`)
+	vimVersionRe     = regexp.MustCompile(`<version>([^<]+)</version>`)
+	vimBuildRe       = regexp.MustCompile(`<build>([^<]+)</build>`)
+)
+
+// vimServiceContentRequest asks a vSphere endpoint to describe itself; it is
+// answered without logging in
+const vimServiceContentRequest = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:vim25="urn:vim25">
+<soapenv:Body><vim25:RetrieveServiceContent><vim25:_this type="ServiceInstance">ServiceInstance</vim25:_this></vim25:RetrieveServiceContent></soapenv:Body>
+</soapenv:Envelope>`
+
+// detectHypervisor identifies Proxmox VE on port 8006 and VMware ESXi or
+// vCenter on port 443, returning the device type and version if it finds one.
+// Its requests carry userAgent.
+func detectHypervisor(ip string, openPorts []int, userAgent string, timeoutScale int) (string, string) {
+	scale := time.Duration(timeoutScale)
+	client := &http.Client{
+		Timeout: time.Second * 3 * scale,
+		Transport: userAgentTransport{
+			base: &http.Transport{
+				DialContext:       limitedDial(&net.Dialer{}),
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+			userAgent: userAgent,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	if contains(openPorts, 8006) {
+		if version, ok := probeProxmox(client, ip); ok {
+			log.Printf("Detected Proxmox VE %s at %s", version, ip)
+			return TypeProxmox, version
+		}
+	}
+
+	if contains(openPorts, 443) && looksLikeVMware(ip, timeoutScale) {
+		deviceType, version := probeVSphere(client, ip)
+		log.Printf("Detected %s %s at %s", deviceType, version, ip)
+		return deviceType, version
+	}
+
+	return "", ""
+}
+
+// userAgentTransport sets the User-Agent of every request it sends. An empty
+// userAgent suppresses the header instead of sending Go's default.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// probeProxmox fetches the web UI on port 8006 and checks for the Proxmox API
+// daemon or login page
+func probeProxmox(client *http.Client, ip string) (string, bool) {
+	resp, err := client.Get("https://" + net.JoinHostPort(ip, "8006") + "/")
+	if err != nil {
+		log.Printf("Proxmox probe of %s failed: %v", ip, err)
+		return "", false
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if !strings.HasPrefix(resp.Header.Get("Server"), "pve-api-daemon") &&
+		!strings.Contains(string(body), "Proxmox Virtual Environment") {
+		return "", false
+	}
+	if match := proxmoxVersionRe.FindSubmatch(body); match != nil {
+		return string(match[1]), true
+	}
+	return "", true
+}
+
+// looksLikeVMware checks the certificate on port 443 and the ESXi
+// authentication daemon banner on port 902 for VMware markers
+func looksLikeVMware(ip string, timeoutScale int) bool {
+	scale := time.Duration(timeoutScale)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2*scale)
+	conn, err := dialTLS(ctx, &net.Dialer{}, net.JoinHostPort(ip, "443"), &tls.Config{InsecureSkipVerify: true})
+	cancel()
+	if err == nil {
+		certs := conn.ConnectionState().PeerCertificates
+		conn.Close()
+		if len(certs) > 0 && isVMwareCert(certs[0]) {
+			return true
+		}
+	}
+
+	// ESXi answers on 902 with "220 VMware Authentication Daemon Version ..."
+	banner, err := dial(&net.Dialer{Timeout: time.Second * 1 * scale}, "tcp", net.JoinHostPort(ip, "902"))
+	if err != nil {
+		return false
+	}
+	defer banner.Close()
+	banner.SetReadDeadline(time.Now().Add(time.Second * 2 * scale))
+	line, _ := bufio.NewReader(banner).ReadString('\n')
+	return strings.Contains(line, "VMware Authentication Daemon")
+}
+
+// isVMwareCert matches the default ESXi certificate and certificates issued by
+// the vCenter certificate authority
+func isVMwareCert(cert *x509.Certificate) bool {
+	fields := []string{cert.Subject.CommonName, cert.Issuer.CommonName}
+	fields = append(fields, cert.Subject.Organization...)
+	fields = append(fields, cert.Subject.OrganizationalUnit...)
+	fields = append(fields, cert.Issuer.Organization...)
+	fields = append(fields, cert.Issuer.OrganizationalUnit...)
+	for _, field := range fields {
+		lower := strings.ToLower(field)
+		if strings.Contains(lower, "vmware") || strings.Contains(lower, "vcenter") || strings.Contains(lower, "esx") {
+			return true
+		}
+	}
+	return false
+}
+
+// probeVSphere asks the vSphere SDK endpoint whether it is a host agent (ESXi)
+// or vCenter, and for its version. It falls back to ESXi with no version when
+// the endpoint does not answer.
+func probeVSphere(client *http.Client, ip string) (string, string) {
+	req, err := http.NewRequest(http.MethodPost, "https://"+net.JoinHostPort(ip, "443")+"/sdk",
+		strings.NewReader(vimServiceContentRequest))
+	if err != nil {
+		return TypeESXi, ""
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", "urn:vim25/6.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("vSphere probe of %s failed: %v", ip, err)
+		return TypeESXi, ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	deviceType := TypeESXi
+	if match := vimAPITypeRe.FindSubmatch(body); match != nil && string(match[1]) == "VirtualCenter" {
+		deviceType = TypeVCenter
+	}
+	version := ""
+	if match := vimVersionRe.FindSubmatch(body); match != nil {
+		version = string(match[1])
+		if build := vimBuildRe.FindSubmatch(body); build != nil {
+			version += " build " + string(build[1])
+		}
+	}
+	return deviceType, version
+}
@@ -0,0 +1,338 @@
+package scanner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeDomainController is the device type of Active Directory domain
+// controllers
+const TypeDomainController = "Domain Controller"
+
+const (
+	portKerberos = 88
+	portLDAP     = 389
+	portLDAPS    = 636
+	portGC       = 3268 // Global Catalog
+	portGCS      = 3269 // Global Catalog over TLS
+)
+
+// ldapMaxMessage caps the size of an LDAP response read from a host
+const ldapMaxMessage = 64 * 1024
+
+// rootDSEAttributes are the rootDSE attributes asked for; every one is
+// readable anonymously on Active Directory and most other LDAP servers
+var rootDSEAttributes = []string{
+	"defaultNamingContext",
+	"dnsHostName",
+	"domainControllerFunctionality",
+}
+
+// looksLikeDomainController reports whether openPorts has Kerberos together
+// with LDAP or the Global Catalog, the signature of a domain controller
+func looksLikeDomainController(openPorts []int) bool {
+	if !contains(openPorts, portKerberos) {
+		return false
+	}
+	for _, port := range []int{portLDAP, portLDAPS, portGC, portGCS} {
+		if contains(openPorts, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// identifyDirectory marks domain controllers by their open ports and reads
+// the rootDSE of hosts with plain LDAP or Global Catalog open, filling in
+// device.Domain. It returns the host's DNS name from the rootDSE, if any.
+func (s *Scanner) identifyDirectory(device *Device, query bool) string {
+	if looksLikeDomainController(device.OpenPorts) {
+		device.DeviceType = TypeDomainController
+		device.explain(FieldDeviceType, "Open Kerberos and LDAP or Global Catalog ports")
+	}
+	if !query {
+		return ""
+	}
+
+	port := portLDAP
+	if !contains(device.OpenPorts, port) {
+		port = portGC
+		if !contains(device.OpenPorts, port) {
+			return ""
+		}
+	}
+
+	release := s.acquireResolver()
+	start := time.Now()
+	attrs, err := queryRootDSE(device.IPAddress, port, s.opts.SourceIP, s.opts.Intensity.resolverTimeoutScale())
+	release()
+	s.timing().resolved(PhaseLDAP, start, err == nil)
+	if err != nil {
+		log.Printf("LDAP rootDSE query to %s:%d failed: %v", device.IPAddress, port, err)
+		s.warn(device, "LDAP rootDSE query failed: %v", err)
+		return ""
+	}
+
+	device.Domain = domainFromDN(firstValue(attrs["defaultnamingcontext"]))
+	if device.Domain != "" {
+		device.explain(FieldDomain, "defaultNamingContext in the LDAP rootDSE")
+	}
+	if len(attrs["domaincontrollerfunctionality"]) > 0 {
+		// Only Active Directory domain controllers publish this
+		device.DeviceType = TypeDomainController
+		device.explain(FieldDeviceType, "domainControllerFunctionality in the LDAP rootDSE")
+	}
+	hostname := strings.TrimSuffix(firstValue(attrs["dnshostname"]), ".")
+	log.Printf("LDAP rootDSE for %s: domain %q, host %q", device.IPAddress, device.Domain, hostname)
+	return hostname
+}
+
+// domainFromDN turns a naming context such as DC=corp,DC=example,DC=com
+// into the DNS domain corp.example.com
+func domainFromDN(dn string) string {
+	var labels []string
+	for _, rdn := range strings.Split(dn, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(rdn), "=")
+		if ok && strings.EqualFold(key, "DC") {
+			labels = append(labels, value)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// firstValue returns the first value, or "" for none
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// queryRootDSE binds anonymously to the LDAP server at ip and port and
+// returns the rootDSE attributes, keyed by lowercased name
+func queryRootDSE(ip string, port int, source net.IP, timeoutScale int) (map[string][]string, error) {
+	timeout := time.Second * 2 * time.Duration(timeoutScale)
+	conn, err := dial(dialer("tcp", source, timeout), "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(rootDSERequest()); err != nil {
+		return nil, fmt.Errorf("sending search: %v", err)
+	}
+
+	attrs := make(map[string][]string)
+	reader := bufio.NewReader(conn)
+	for {
+		tag, message, err := readBER(reader)
+		if err != nil {
+			return nil, fmt.Errorf("reading response: %v", err)
+		}
+		if tag != berSequence {
+			return nil, fmt.Errorf("unexpected LDAP message tag 0x%02x", tag)
+		}
+		// Skip the message ID to reach the protocol operation
+		if _, _, message, err = parseBER(message); err != nil {
+			return nil, err
+		}
+		tag, op, _, err := parseBER(message)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case ldapSearchResultEntry:
+			if err := parseSearchEntry(op, attrs); err != nil {
+				return nil, err
+			}
+		case ldapSearchResultDone:
+			if code := ldapResultCode(op); code != 0 {
+				return nil, fmt.Errorf("search failed with LDAP result code %d", code)
+			}
+			if len(attrs) == 0 {
+				return nil, errors.New("empty rootDSE")
+			}
+			return attrs, nil
+		}
+	}
+}
+
+// BER tags used by the rootDSE search
+const (
+	berInteger            = 0x02
+	berOctetString        = 0x04
+	berBoolean            = 0x01
+	berEnumerated         = 0x0a
+	berSequence           = 0x30
+	ldapSearchRequest     = 0x63 // [APPLICATION 3], constructed
+	ldapSearchResultEntry = 0x64 // [APPLICATION 4], constructed
+	ldapSearchResultDone  = 0x65 // [APPLICATION 5], constructed
+	ldapFilterPresent     = 0x87 // [7], primitive
+)
+
+// rootDSERequest encodes a base-scope search of the empty DN for
+// rootDSEAttributes, with the filter (objectClass=*)
+func rootDSERequest() []byte {
+	attributes := make([][]byte, len(rootDSEAttributes))
+	for i, name := range rootDSEAttributes {
+		attributes[i] = encodeBER(berOctetString, []byte(name))
+	}
+	search := encodeBER(ldapSearchRequest,
+		encodeBER(berOctetString, nil),      // baseObject: the rootDSE
+		encodeBER(berEnumerated, []byte{0}), // scope: baseObject
+		encodeBER(berEnumerated, []byte{0}), // derefAliases: never
+		encodeBER(berInteger, []byte{0}),    // sizeLimit: none
+		encodeBER(berInteger, []byte{0}),    // timeLimit: none
+		encodeBER(berBoolean, []byte{0}),    // typesOnly: false
+		encodeBER(ldapFilterPresent, []byte("objectClass")),
+		encodeBER(berSequence, attributes...),
+	)
+	return encodeBER(berSequence, encodeBER(berInteger, []byte{1}), search)
+}
+
+// parseSearchEntry adds the attributes of a SearchResultEntry to attrs
+func parseSearchEntry(entry []byte, attrs map[string][]string) error {
+	// Skip the entry's DN
+	_, _, rest, err := parseBER(entry)
+	if err != nil {
+		return err
+	}
+	_, list, _, err := parseBER(rest)
+	if err != nil {
+		return err
+	}
+	for len(list) > 0 {
+		var attr []byte
+		if _, attr, list, err = parseBER(list); err != nil {
+			return err
+		}
+		_, name, values, err := parseBER(attr)
+		if err != nil {
+			return err
+		}
+		if _, values, _, err = parseBER(values); err != nil {
+			return err
+		}
+		key := strings.ToLower(string(name))
+		for len(values) > 0 {
+			var value []byte
+			if _, value, values, err = parseBER(values); err != nil {
+				return err
+			}
+			attrs[key] = append(attrs[key], string(value))
+		}
+	}
+	return nil
+}
+
+// ldapResultCode returns the result code of an LDAPResult, or -1 if it
+// can't be parsed
+func ldapResultCode(result []byte) int {
+	tag, code, _, err := parseBER(result)
+	if err != nil || tag != berEnumerated || len(code) == 0 {
+		return -1
+	}
+	value := 0
+	for _, b := range code {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+// encodeBER encodes a TLV with the definite length form
+func encodeBER(tag byte, contents ...[]byte) []byte {
+	var body []byte
+	for _, content := range contents {
+		body = append(body, content...)
+	}
+	out := []byte{tag}
+	switch n := len(body); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, body...)
+}
+
+// parseBER splits the first TLV off data, returning its tag, contents and
+// what follows it
+func parseBER(data []byte) (tag byte, content, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	length, header, err := berLength(data[1:])
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	start := 1 + header
+	if length > len(data)-start {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	return data[0], data[start : start+length], data[start+length:], nil
+}
+
+// readBER reads one TLV from r, returning its tag and contents
+func readBER(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if header[1]&0x80 != 0 {
+		extra := make([]byte, header[1]&0x7f)
+		if _, err := io.ReadFull(r, extra); err != nil {
+			return 0, nil, err
+		}
+		header = append(header, extra...)
+	}
+	length, _, err := berLength(header[1:])
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > ldapMaxMessage {
+		return 0, nil, fmt.Errorf("LDAP message of %d bytes is too large", length)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return header[0], content, nil
+}
+
+// berLength decodes a definite length, returning it and the number of bytes
+// it took. Servers such as Active Directory use the long form even for short
+// lengths, so non-minimal encodings are accepted.
+func berLength(data []byte) (int, int, error) {
+	if len(data) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	if data[0] < 0x80 {
+		return int(data[0]), 1, nil
+	}
+	n := int(data[0] & 0x7f)
+	if n == 0 || n > 4 {
+		return 0, 0, fmt.Errorf("unsupported BER length form 0x%02x", data[0])
+	}
+	if len(data) < 1+n {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	length := 0
+	for _, b := range data[1 : 1+n] {
+		length = length<<8 | int(b)
+	}
+	if length < 0 {
+		return 0, 0, fmt.Errorf("invalid BER length")
+	}
+	return length, 1 + n, nil
+}
@@ -1,40 +1,55 @@
 package scanner
 
 import (
-	"fmt"
 	"log"
 	"net"
 	"os/exec"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// arpTriggerPorts are dialed to make the OS resolve a host's MAC address
+var arpTriggerPorts = []int{80, 443, 22, 445, 139, 135, 8080, 3389, 5900}
+
 // GetMACFromIP attempts to get the MAC address for an IP using TCP/UDP connections
 func GetMACFromIP(ip string) string {
 	// Try to connect to common ports to trigger ARP
-	commonPorts := []int{80, 443, 22, 445, 139, 135, 8080, 3389, 5900}
-	for _, port := range commonPorts {
-		d := net.Dialer{Timeout: time.Millisecond * 100}
-		conn, err := d.Dial("tcp", fmt.Sprintf("%s:%d", ip, port))
+	for _, port := range arpTriggerPorts {
+		d := &net.Dialer{Timeout: time.Millisecond * 100}
+		conn, err := dial(d, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
 		if err == nil {
 			conn.Close()
 		}
 	}
+	triggerUDP(ip, nil)
+
+	// Give ARP time to populate
+	time.Sleep(time.Millisecond * 100)
+
+	return lookupMAC(ip)
+}
 
-	// Try UDP to trigger ARP
-	udpAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:137", ip))
+// triggerUDP sends a single NetBIOS datagram from source, or an address the
+// OS picks when it is nil. That is enough to make the OS resolve the host's
+// MAC even when every TCP port is filtered.
+func triggerUDP(ip string, source net.IP) {
+	conn, err := dial(dialer("udp", source, 0), "udp", net.JoinHostPort(ip, "137"))
 	if err == nil {
-		conn, err := net.DialUDP("udp", nil, udpAddr)
-		if err == nil {
-			conn.Write([]byte{0})
-			conn.Close()
-		}
+		conn.Write([]byte{0})
+		conn.Close()
 	}
+}
 
-	// Give ARP time to populate
-	time.Sleep(time.Millisecond * 100)
+// lookupMAC reads ip's MAC from the OS neighbor tables without sending
+// anything, so it only finds hosts that were recently contacted
+func lookupMAC(ip string) string {
+	// IPv6 hosts are resolved through neighbor discovery rather than ARP
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return lookupNeighborMAC(ip)
+	}
 
 	// Query ARP table based on OS
 	switch runtime.GOOS {
@@ -70,6 +85,16 @@ func NormalizeMACAddress(mac string) string {
 	// Convert to uppercase
 	mac = strings.ToUpper(mac)
 
+	// Pad unpadded octets such as "0:1b:..." as printed by macOS arp and ndp
+	if parts := strings.FieldsFunc(mac, func(r rune) bool { return r == ':' || r == '-' }); len(parts) == 6 {
+		for i, part := range parts {
+			if len(part) == 1 {
+				parts[i] = "0" + part
+			}
+		}
+		mac = strings.Join(parts, "")
+	}
+
 	// Remove any separators
 	mac = strings.ReplaceAll(mac, ":", "")
 	mac = strings.ReplaceAll(mac, "-", "")
@@ -87,6 +112,20 @@ func NormalizeMACAddress(mac string) string {
 	return result.String()
 }
 
+// RandomizedVendor is reported for locally administered MACs, which carry no
+// manufacturer OUI (typically privacy-randomized phones and laptops)
+const RandomizedVendor = "Randomized (locally administered)"
+
+// IsLocallyAdministered reports whether the U/L bit of the MAC's first octet
+// is set, meaning the address was assigned by software rather than the vendor
+func IsLocallyAdministered(mac string) bool {
+	hw, err := net.ParseMAC(NormalizeMACAddress(mac))
+	if err != nil || len(hw) == 0 {
+		return false
+	}
+	return hw[0]&0x02 != 0
+}
+
 // LookupVendor looks up the vendor for a MAC address
 func LookupVendor(mac string) string {
 	// Normalize MAC address format
@@ -95,6 +134,15 @@ func LookupVendor(mac string) string {
 		return "Unknown"
 	}
 
-	// TODO: Implement OUI lookup from IEEE database
+	oui := strings.ReplaceAll(mac, ":", "")
+	if len(oui) < 6 {
+		return "Unknown Vendor"
+	}
+	if IsLocallyAdministered(mac) {
+		return RandomizedVendor
+	}
+	if vendor, ok := loadOUITable()[oui[:6]]; ok {
+		return vendor
+	}
 	return "Unknown Vendor"
 }
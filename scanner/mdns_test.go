@@ -0,0 +1,98 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// TestLateNamesRace stores devices while their mDNS answers and PTR names
+// come in concurrently, as the background lookups of a scan deliver them,
+// with a consumer reading every device published. Run it with -race: the
+// published copies share no maps with the stored devices, and the last copy
+// of each device published is the one stored.
+func TestLateNamesRace(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	const hosts = 64
+	s := NewScannerWithOptions(Options{Explain: true, ResultsBuffer: 8})
+	s.portals = newPortalTracker()
+	results, _ := s.GetResults()
+
+	last := make(map[string]Device)
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		for device := range results {
+			if device.IPAddress == "" {
+				return
+			}
+			// Read every map and slice the scanner might still write
+			_ = fmt.Sprint(device)
+			last[device.IPAddress] = device
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < hosts; i++ {
+		i, ip := i, fmt.Sprintf("10.0.0.%d", i+1)
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			device := Device{
+				IPAddress:    ip,
+				Status:       "Up",
+				OpenPorts:    []int{22},
+				MDNSServices: map[string]string{"_device-info._tcp": "model=Xserve"}, // Heard announced
+			}
+			s.explaining(&device)
+			device.addNote("SMB hostname lookup returned no name")
+			s.store(device)
+		}()
+		go func() {
+			defer wg.Done()
+			s.updatePTR(ip, []string{fmt.Sprintf("host%d.lan", i)})
+		}()
+		go func() {
+			defer wg.Done()
+			s.updateMDNS(ip, mdnsAnswer{
+				name:     fmt.Sprintf("host%d.local", i),
+				services: map[string]string{"_ssh._tcp": fmt.Sprintf("host%d", i)},
+			})
+		}()
+		go func() {
+			// A retry pass asks reverse DNS again
+			defer wg.Done()
+			s.updatePTR(ip, []string{fmt.Sprintf("host%d.lan", i)})
+		}()
+	}
+	wg.Wait()
+	results <- Device{}
+	<-consumed
+
+	for i := 0; i < hosts; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i+1)
+		s.deviceMutex.RLock()
+		stored := s.devices[ip]
+		s.deviceMutex.RUnlock()
+
+		if want := fmt.Sprintf("host%d.local", i); stored.MDNSName != want {
+			t.Errorf("%s: mDNS name %q, want %q", ip, stored.MDNSName, want)
+		}
+		if want := fmt.Sprintf("host%d.lan", i); !slices.Contains(stored.Hostname, want) {
+			t.Errorf("%s: hostnames %v, want %s among them", ip, stored.Hostname, want)
+		}
+		if stored.Provenance[FieldHostname] == "" {
+			t.Errorf("%s: no source recorded for the hostname", ip)
+		}
+		if !reflect.DeepEqual(last[ip], stored) {
+			t.Errorf("%s: last published %+v, stored %+v", ip, last[ip], stored)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package scanner
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// queryUnicastMDNS asks the host at ip for its .local name with a one-shot
+// reverse (PTR) query sent straight to its port 5353 from an ephemeral port.
+// Responders answer such legacy unicast queries directly (RFC 6762 section
+// 6.7), so this needs no bind on 5353 and works alongside Avahi or
+// mDNSResponder.
+func queryUnicastMDNS(ip string, timeout time.Duration) (string, error) {
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(arpa, dns.TypePTR)
+	msg.RecursionDesired = false
+
+	conn, err := dial(&net.Dialer{Timeout: timeout}, "udp", net.JoinHostPort(ip, "5353"))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+	resp, _, err := client.ExchangeWithConn(msg, &dns.Conn{Conn: conn})
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			if name := strings.TrimSuffix(ptr.Ptr, "."); name != "" {
+				return name, nil
+			}
+		}
+	}
+	return "", errors.New("no PTR record in mDNS response")
+}
@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// genericNamePrefixes start the names ISPs and DHCP servers hand out
+var genericNamePrefixes = []string{"dhcp", "host-", "ip-", "unknown", "static-", "pool-"}
+
+// poorHostname reports whether name looks generated rather than chosen:
+// it embeds ip's octets, as in 192-168-1-5.isp.example, has no letters in its
+// first label, or starts like a DHCP or ISP pool name
+func poorHostname(name, ip string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	label, _, _ := strings.Cut(name, ".")
+	if !strings.ContainsFunc(label, unicode.IsLetter) {
+		return true
+	}
+	for _, prefix := range genericNamePrefixes {
+		if strings.HasPrefix(label, prefix) {
+			return true
+		}
+	}
+
+	addr := net.ParseIP(ip).To4()
+	if addr == nil {
+		return false
+	}
+	octets := make([]string, 4)
+	for i, b := range addr {
+		octets[i] = fmt.Sprint(b)
+	}
+	reversed := slices.Clone(octets)
+	slices.Reverse(reversed)
+	for _, order := range [][]string{octets, reversed} {
+		for _, sep := range []string{"-", ".", "_"} {
+			if strings.Contains(name, strings.Join(order, sep)) {
+				return true
+			}
+		}
+	}
+	return strings.Contains(name, fmt.Sprintf("%02x%02x%02x%02x", addr[0], addr[1], addr[2], addr[3]))
+}
+
+// withMDNSName returns names led by mdnsName when PreferMDNS is set and the
+// DNS names are poor, and names unchanged otherwise
+func (o Options) withMDNSName(names []string, mdnsName, ip string) []string {
+	if !o.PreferMDNS || mdnsName == "" || (len(names) > 0 && !poorHostname(names[0], ip)) {
+		return names
+	}
+	preferred := []string{mdnsName}
+	for _, name := range names {
+		if !strings.EqualFold(name, mdnsName) {
+			preferred = append(preferred, name)
+		}
+	}
+	return preferred
+}
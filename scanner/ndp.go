@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// neighborMACPattern matches a link-layer address in neighbor table output,
+// with colon or dash separators and optionally unpadded octets
+var neighborMACPattern = regexp.MustCompile(`([0-9A-Fa-f]{1,2}[:-]){5}[0-9A-Fa-f]{1,2}`)
+
+// lookupNeighborMAC finds ip in the IPv6 neighbor (NDP) table, the IPv6
+// counterpart of the ARP cache, and returns its normalized MAC address
+func lookupNeighborMAC(ip string) string {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("ip", "-6", "neigh", "show", ip)
+	case "darwin", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("ndp", "-an")
+	case "windows":
+		cmd = exec.Command("netsh", "interface", "ipv6", "show", "neighbors")
+	default:
+		return ""
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("DEBUG: neighbor table lookup for %s failed: %v", ip, err)
+		return ""
+	}
+	if mac := parseNeighborTable(output, ip); mac != "" {
+		log.Printf("DEBUG: Found MAC %s for IP %s in the neighbor table", mac, ip)
+		return mac
+	}
+	return ""
+}
+
+// parseNeighborTable returns the MAC on the line whose first column is ip,
+// ignoring any %zone suffix. Addresses are compared parsed, since tools
+// print them compressed differently. Incomplete and failed entries have no
+// MAC and are skipped.
+func parseNeighborTable(output []byte, ip string) string {
+	target := net.ParseIP(ip)
+	if target == nil {
+		return ""
+	}
+	lines := bufio.NewScanner(bytes.NewReader(output))
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		addr, _, _ := strings.Cut(fields[0], "%")
+		if !target.Equal(net.ParseIP(addr)) {
+			continue
+		}
+		if mac := neighborMACPattern.FindString(lines.Text()); mac != "" {
+			return NormalizeMACAddress(mac)
+		}
+	}
+	return ""
+}
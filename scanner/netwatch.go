@@ -0,0 +1,158 @@
+package scanner
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNetworkUnavailable is reported by Scanner.Err when a scan was aborted
+// because the network it was sending from went away
+var ErrNetworkUnavailable = errors.New("network unavailable")
+
+const (
+	// netwatchInterval is how often the source interface is checked
+	netwatchInterval = 2 * time.Second
+	// netwatchMisses consecutive failed checks abort the scan, so a blip
+	// while an interface renews its address is ridden out
+	netwatchMisses = 2
+	// noRouteLimit consecutive hosts whose every probe found no route abort
+	// the scan
+	noRouteLimit = 16
+)
+
+// Err returns why the last scan was aborted, or nil if it ran to completion
+// or was stopped with Stop
+func (s *Scanner) Err() error {
+	s.stopMutex.Lock()
+	defer s.stopMutex.Unlock()
+	return s.abortErr
+}
+
+// abort stops the scan, recording err for Err. A scan already stopped,
+// whether by Stop or an earlier abort, keeps its state.
+func (s *Scanner) abort(err error) {
+	s.stopMutex.Lock()
+	if s.stoppedLocked() {
+		s.stopMutex.Unlock()
+		return
+	}
+	s.abortErr = err
+	s.stopMutex.Unlock()
+
+	log.Printf("Aborting scan: %v", err)
+	s.report("\n=== Scan aborted: %v ===\n", err)
+	s.Stop()
+}
+
+// watchNetwork aborts the scan when the interface it sends from loses its
+// address or goes down, until finished is closed. Without a source address
+// it watches the one the route to the targets leaves from. It does nothing
+// if that address isn't on an interface that is up when the scan starts,
+// e.g. a scan of loopback.
+func (s *Scanner) watchNetwork(targets *Targets, finished <-chan struct{}) {
+	source := s.opts.SourceIP
+	if source == nil {
+		source = s.routeSource(targets)
+	}
+	if source == nil || source.IsLoopback() || !sourceAvailable(source) {
+		return
+	}
+	log.Printf("Watching %s for the network going away", source)
+	ticker := time.NewTicker(netwatchInterval)
+	defer ticker.Stop()
+
+	stop := s.stopping()
+	misses := 0
+	for {
+		select {
+		case <-finished:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+			if sourceAvailable(source) {
+				misses = 0
+				continue
+			}
+			misses++
+			log.Printf("Source interface unavailable (%d/%d checks)", misses, netwatchMisses)
+			if misses >= netwatchMisses {
+				s.abort(ErrNetworkUnavailable)
+				return
+			}
+		}
+	}
+}
+
+// noteRoute tracks hosts whose probes all failed for lack of a route,
+// aborting the scan after noRouteLimit in a row. A lost source address is
+// left to watchNetwork, since local failures also come from running out of
+// sockets.
+func (s *Scanner) noteRoute(probe portProbe, probed int) {
+	if probe.reachable() || probed == 0 || probe.noRoute < probed {
+		atomic.StoreInt32(&s.noRouteRun, 0)
+		return
+	}
+	if atomic.AddInt32(&s.noRouteRun, 1) == noRouteLimit {
+		s.abort(ErrNetworkUnavailable)
+	}
+}
+
+// routeSource returns the local address the route to the first target, or
+// to the SOCKS5 proxy, leaves from, nil if there is none. Connecting a UDP
+// socket picks the route without sending anything.
+func (s *Scanner) routeSource(targets *Targets) net.IP {
+	addr := s.opts.SOCKS5
+	if addr != "" {
+		addr, _, _ = parseSOCKS5(addr)
+	} else {
+		targets.iterate(func(ip net.IP) bool {
+			addr = net.JoinHostPort(ip.String(), "9")
+			return false
+		})
+	}
+	if addr == "" {
+		return nil
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	return local.IP
+}
+
+// sourceAvailable reports whether source is assigned to an interface that is
+// up
+func sourceAvailable(source net.IP) bool {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return true // Can't tell, so don't abort
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipNet.IP.Equal(source) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package scanner
+
+import "time"
+
+// Observer receives scan events as they happen, as an alternative to reading
+// the results and done channels and polling for progress. Methods are called
+// from scanner goroutines, possibly concurrently, and should return quickly.
+type Observer interface {
+	// OnDevice is called for each live host, and again when a late reverse
+	// DNS answer fills in its hostname
+	OnDevice(device Device)
+	// OnProgress is called every ProgressInterval while the scan runs and
+	// once more when it ends
+	OnProgress(scanned, total, discovered int32)
+	// OnComplete is called once when the scan has finished or been stopped
+	OnComplete(stats ScanStats)
+}
+
+// ProgressInterval is how often Observer.OnProgress is called
+const ProgressInterval = 500 * time.Millisecond
+
+// ObserverFuncs adapts plain functions to Observer. Nil functions are
+// skipped.
+type ObserverFuncs struct {
+	Device   func(device Device)
+	Progress func(scanned, total, discovered int32)
+	Complete func(stats ScanStats)
+}
+
+// OnDevice calls f.Device
+func (f ObserverFuncs) OnDevice(device Device) {
+	if f.Device != nil {
+		f.Device(device)
+	}
+}
+
+// OnProgress calls f.Progress
+func (f ObserverFuncs) OnProgress(scanned, total, discovered int32) {
+	if f.Progress != nil {
+		f.Progress(scanned, total, discovered)
+	}
+}
+
+// OnComplete calls f.Complete
+func (f ObserverFuncs) OnComplete(stats ScanStats) {
+	if f.Complete != nil {
+		f.Complete(stats)
+	}
+}
+
+// observeProgress reports progress to the observer until finished is closed
+func (s *Scanner) observeProgress(finished <-chan struct{}) {
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			s.reportProgress()
+		}
+	}
+}
+
+// reportProgress sends the current counters to the observer
+func (s *Scanner) reportProgress() {
+	stats := s.Stats()
+	s.opts.Observer.OnProgress(stats.Scanned, stats.Total, stats.Discovered)
+}
@@ -0,0 +1,256 @@
+package scanner
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Options configures a Scanner
+type Options struct {
+	Debug      bool   // Write a report file for each scan
+	ReportPath string // Report file location; empty picks a name from the scan range and start time
+
+	// ResolverConcurrency caps how many slow protocol resolutions (AFP, SMB,
+	// RDP, mDNS) run at once across all workers. Zero means no limit.
+	ResolverConcurrency int
+
+	// MaxSockets caps the connections open at once across all workers, port
+	// dials and resolvers, so a high worker count queues probes instead of
+	// running out of file descriptors. Zero uses DefaultMaxSockets and a
+	// negative value removes the limit.
+	MaxSockets int
+
+	// Retries is the number of extra passes over hosts that were down after
+	// the main sweep. Each pass uses proportionally longer timeouts and
+	// starts after a pause that doubles from 2s, up to 30s.
+	Retries int
+
+	// TimeoutScale multiplies the port probe timeouts, for slow or distant
+	// hosts. Zero or one keeps the defaults.
+	TimeoutScale int
+
+	// ResultsBuffer is the capacity of the results channel. Zero uses
+	// DefaultResultsBuffer.
+	ResultsBuffer int
+
+	// Intensity controls how much effort goes into hostname resolution
+	Intensity Intensity
+
+	// ConnectOnly probes only the common TCP ports, skipping the slower
+	// Apple service ports and MAC lookup retries, for a minimal footprint
+	ConnectOnly bool
+
+	// Ports are the TCP ports probed on every host. Empty uses DefaultPorts;
+	// PortProfile returns curated sets.
+	Ports []int
+
+	// MaxHosts is the largest range ScanNetwork accepts. Zero uses
+	// DefaultMaxHosts and a negative value removes the limit.
+	MaxHosts int
+
+	// Force scans ranges larger than MaxHosts
+	Force bool
+
+	// MaxResults caps how many live devices a scan keeps and reports, for
+	// networks where everything answers. Hosts found past it are still
+	// probed and counted in ScanStats.Discovered, and ScanStats.Truncated
+	// counts those dropped. Zero means no cap.
+	MaxResults int
+
+	// Passive sends no probes at all: devices come from the OS neighbor
+	// table and, for Listen, from mDNS and SSDP announcements. Ports,
+	// hostnames from DNS and every handshake are left out.
+	Passive bool
+
+	// Listen is how long a passive scan listens for announcements. Zero
+	// reads the neighbor table once and finishes.
+	Listen time.Duration
+
+	// Sniff captures ARP, DHCP, mDNS and NetBIOS broadcasts while the scan
+	// runs, or for Listen in a passive scan, and adds their senders to the
+	// results. It needs root or CAP_NET_RAW, and libpcap (-tags pcap)
+	// outside Linux; without them the scan goes on unsniffed.
+	Sniff bool
+
+	// ARPScan asks for every on-link address in the range with broadcast
+	// ARP requests before the sweep and probes only the hosts that answer,
+	// which is quicker than waiting out TCP timeouts and finds hosts that
+	// filter every port. It needs what Sniff does; without it, and for
+	// addresses beyond the local link, hosts are probed over TCP as usual.
+	ARPScan bool
+
+	// RemoteMAC looks up the MAC address of hosts beyond this machine's
+	// subnets as well. Those are reached through a router, which is the
+	// neighbor its packets go to, so by default their MAC lookup and the
+	// retries that wait for it are skipped.
+	RemoteMAC bool
+
+	// Explain keeps a provenance trail on each live device, recording in
+	// Device.Provenance which signal set its name, type, MAC and the other
+	// fields in ProvenanceFields, e.g. "MAC vendor: Apple, Inc.", so a
+	// classification can be checked
+	Explain bool
+
+	// SOCKS5 sends every TCP connect through the SOCKS5 proxy at this
+	// host:port, or user:password@host:port, to scan a network only the
+	// proxy reaches, e.g. from a jump host. ARPScan, Sniff and MAC lookups
+	// need the target network to be local and are turned off, and UDP
+	// probes such as NetBIOS, SNMP and mDNS are skipped. Reverse DNS still
+	// asks this machine's resolver.
+	SOCKS5 string
+
+	// FTPAnonymous tries an anonymous login on FTP servers after reading
+	// their banner and flags those that accept it in Device.AnonymousFTP.
+	// Login attempts can trip intrusion detection and lockout policies, so
+	// by default only the banner is read.
+	FTPAnonymous bool
+
+	// RecordFiltered keeps the ports that timed out on live hosts in
+	// Device.FilteredPorts. Closed (refused) ports are always kept.
+	RecordFiltered bool
+
+	// SourceIP is the local address reachability probes are sent from, so
+	// they leave through that interface on multi-homed hosts. Nil lets the
+	// OS choose.
+	SourceIP net.IP
+
+	// SkipOffline keeps only reachable hosts in the scanner's device map.
+	// Offline hosts are never reported, but by default each takes an entry,
+	// which adds up on large ranges.
+	SkipOffline bool
+
+	// Adaptive starts with a quarter of the workers probing and adjusts
+	// AIMD-style: more after healthy stretches, half as many when timeouts
+	// on live hosts climb, a sign the link or an upstream limiter is
+	// dropping probes. The worker count stays the ceiling.
+	Adaptive bool
+
+	// Randomize probes the range in random order instead of ascending, so
+	// the scan doesn't sweep a DHCP block or trip sequential-scan detection
+	Randomize bool
+
+	// GatewayFirst probes Gateway and the first and last host addresses of
+	// the range (.1 and .254 in a /24) before the sequential sweep, so the
+	// infrastructure shows up at the start of the scan
+	GatewayFirst bool
+
+	// SkipSelf leaves this machine's own addresses in the range unprobed, so
+	// its listening services don't turn up among the results. It is still
+	// listed, as RoleSelf, from its hostname and interface.
+	SkipSelf bool
+
+	// SelfPorts are the ports this process listens on, such as the web
+	// interface's. They are never probed on this machine's addresses, where
+	// they would only find the scanner itself, or trip its auth lockout.
+	SelfPorts []int
+
+	// Gateway is the default gateway, labeled RoleGateway in the results and
+	// probed first with GatewayFirst when it is in the range
+	Gateway net.IP
+
+	// TLSPorts are the open ports whose TLS certificates are recorded and
+	// searched for a hostname. Empty uses DefaultTLSPorts. A port is only
+	// tried if it is also probed, see Ports.
+	TLSPorts []int
+
+	// TLSServerName is the SNI sent when fetching certificates, for hosts
+	// that pick a certificate by name. Empty sends none.
+	TLSServerName string
+
+	// PreferMDNS lists a device's mDNS name before its DNS names when reverse
+	// DNS only gives a generated name, such as one embedding the address.
+	// Hosts with such a name are asked over mDNS too.
+	PreferMDNS bool
+
+	// UserAgent is sent by HTTP probes so the scan can be attributed in
+	// target logs. Empty sends no User-Agent at all.
+	UserAgent string
+
+	// Observer, when set, receives devices, progress and completion instead
+	// of the channels returned by GetResults, which then stay silent
+	Observer Observer
+}
+
+// Intensity trades scan speed for thoroughness of hostname resolution
+type Intensity int
+
+const (
+	// IntensityNormal resolves names over DNS, then AFP, NetBIOS/SMB, RDP and
+	// mDNS for hosts whose open ports suggest the protocol will answer
+	IntensityNormal Intensity = iota
+	// IntensityLow only uses reverse DNS, skipping every protocol handshake
+	IntensityLow
+	// IntensityHigh tries NetBIOS and mDNS on every unnamed host regardless of
+	// open ports, and doubles the resolution timeouts
+	IntensityHigh
+)
+
+// ParseIntensity converts "low", "normal" or "high" to an Intensity
+func ParseIntensity(name string) (Intensity, error) {
+	switch strings.ToLower(name) {
+	case "low":
+		return IntensityLow, nil
+	case "normal", "":
+		return IntensityNormal, nil
+	case "high":
+		return IntensityHigh, nil
+	}
+	return IntensityNormal, fmt.Errorf("unknown intensity %q (want low, normal or high)", name)
+}
+
+// String returns the intensity name accepted by ParseIntensity
+func (i Intensity) String() string {
+	switch i {
+	case IntensityLow:
+		return "low"
+	case IntensityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// resolverTimeoutScale is the multiplier applied to protocol resolution timeouts
+func (i Intensity) resolverTimeoutScale() int {
+	if i == IntensityHigh {
+		return 2
+	}
+	return 1
+}
+
+// timeoutScale returns the port probe timeout multiplier, at least 1
+func (o Options) timeoutScale() int {
+	return max(o.TimeoutScale, 1)
+}
+
+// DefaultResultsBuffer is the results channel capacity used when none is set
+const DefaultResultsBuffer = 100
+
+// resultsBuffer returns the configured results channel capacity
+func (o Options) resultsBuffer() int {
+	if o.ResultsBuffer > 0 {
+		return o.ResultsBuffer
+	}
+	return DefaultResultsBuffer
+}
+
+// dialer returns a dialer for network ("tcp" or "udp") that sends from
+// source when it is set
+func dialer(network string, source net.IP, timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout}
+	if source != nil {
+		if network == "udp" {
+			d.LocalAddr = &net.UDPAddr{IP: source}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: source}
+		}
+	}
+	return d
+}
+
+// DefaultReportPath returns a report filename unique to the scan range and start time
+func DefaultReportPath(cidr string, start time.Time) string {
+	name := strings.NewReplacer("/", "_", ":", "-").Replace(cidr)
+	return fmt.Sprintf("report-%s-%s.log", name, start.Format("20060102-150405"))
+}
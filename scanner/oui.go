@@ -0,0 +1,259 @@
+package scanner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OUISourceURL is the IEEE MA-L registry downloaded by UpdateOUIDatabase
+const OUISourceURL = "https://standards-oui.ieee.org/oui/oui.csv"
+
+// minOUIEntries guards against replacing the database with a truncated or
+// unrelated download; the IEEE registry has tens of thousands of entries
+const minOUIEntries = 1000
+
+// ouiHeaderPrefix starts the first line of a local database, followed by the
+// SHA-256 of everything after that line and, as key=value fields, the
+// number of entries and the SHA-256 of the download they came from
+const ouiHeaderPrefix = "# netventory-oui sha256="
+
+//go:embed oui.txt
+var embeddedOUI string
+
+var (
+	ouiOnce  sync.Once
+	ouiTable map[string]string
+)
+
+// DefaultOUIPath returns where the downloaded OUI database is kept
+func DefaultOUIPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "netventory", "oui.txt")
+}
+
+// loadOUITable returns the vendor table, preferring a valid local database
+// over the embedded one
+func loadOUITable() map[string]string {
+	ouiOnce.Do(func() {
+		path := DefaultOUIPath()
+		data, err := os.ReadFile(path)
+		if err == nil {
+			ouiTable, err = parseOUIDatabase(string(data))
+			if err == nil {
+				log.Printf("Loaded %d vendors from %s", len(ouiTable), path)
+				return
+			}
+			log.Printf("Warning: ignoring OUI database %s: %v", path, err)
+		}
+
+		ouiTable = make(map[string]string)
+		scanOUILines(embeddedOUI, ouiTable)
+	})
+	return ouiTable
+}
+
+// parseOUIDatabase verifies the checksum header of a local database, and
+// the entry count it records, and returns its entries
+func parseOUIDatabase(data string) (map[string]string, error) {
+	header, body, ok := strings.Cut(data, "\n")
+	if !ok || !strings.HasPrefix(header, ouiHeaderPrefix) {
+		return nil, errors.New("missing checksum header")
+	}
+	fields := strings.Fields(strings.TrimPrefix(header, ouiHeaderPrefix))
+	if len(fields) == 0 {
+		return nil, errors.New("missing checksum header")
+	}
+	sum := sha256.Sum256([]byte(body))
+	if hex.EncodeToString(sum[:]) != fields[0] {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	table := make(map[string]string)
+	scanOUILines(body, table)
+	for _, field := range fields[1:] {
+		if entries, ok := strings.CutPrefix(field, "entries="); ok && entries != strconv.Itoa(len(table)) {
+			return nil, fmt.Errorf("header lists %s entries, found %d", entries, len(table))
+		}
+	}
+	return table, nil
+}
+
+// scanOUILines adds "OUI<tab>Vendor" lines to table, skipping comments
+func scanOUILines(data string, table map[string]string) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if oui, vendor, ok := strings.Cut(line, "\t"); ok {
+			table[strings.ToUpper(oui)] = vendor
+		}
+	}
+}
+
+// UpdateOUIDatabase downloads the IEEE registry from url, checks it against
+// expectedSHA256 when one is given, and atomically replaces the database at
+// path once the copy written has passed the checks made on every load. It
+// returns the number of vendors written and the SHA-256 of the download,
+// to pass as expectedSHA256 when fetching the same registry elsewhere.
+func UpdateOUIDatabase(url, path, expectedSHA256 string) (int, string, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, "", fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	// Download to a temporary file next to the database, hashing as we go
+	download, err := os.CreateTemp(dir, ".oui-*.csv")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(download.Name())
+	defer download.Close()
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, "", fmt.Errorf("downloading %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(download, hash), resp.Body)
+	if err != nil {
+		return 0, "", fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return 0, "", fmt.Errorf("incomplete download: got %d of %d bytes", n, resp.ContentLength)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(sum, expectedSHA256) {
+		return 0, sum, fmt.Errorf("checksum mismatch: got %s, want %s", sum, expectedSHA256)
+	}
+
+	if _, err := download.Seek(0, io.SeekStart); err != nil {
+		return 0, sum, err
+	}
+	table, err := parseIEEECSV(download)
+	if err != nil {
+		return 0, sum, err
+	}
+	if len(table) < minOUIEntries {
+		return 0, sum, fmt.Errorf("download has only %d entries, refusing to replace the database", len(table))
+	}
+
+	if err := writeOUIDatabase(path, table, sum); err != nil {
+		return 0, sum, err
+	}
+	return len(table), sum, nil
+}
+
+// parseIEEECSV reads the Assignment and Organization Name columns of the
+// IEEE registry CSV
+func parseIEEECSV(r io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading OUI CSV header: %w", err)
+	}
+	assignment, organization := -1, -1
+	for i, column := range header {
+		switch strings.TrimSpace(column) {
+		case "Assignment":
+			assignment = i
+		case "Organization Name":
+			organization = i
+		}
+	}
+	if assignment < 0 || organization < 0 {
+		return nil, errors.New("OUI CSV is missing the Assignment or Organization Name column")
+	}
+
+	table := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading OUI CSV: %w", err)
+		}
+		if len(record) <= assignment || len(record) <= organization {
+			continue
+		}
+		oui := strings.ToUpper(strings.TrimSpace(record[assignment]))
+		vendor := strings.Join(strings.Fields(record[organization]), " ")
+		if len(oui) == 6 && vendor != "" {
+			table[oui] = vendor
+		}
+	}
+	return table, nil
+}
+
+// writeOUIDatabase writes table with a checksum header, recording source as
+// the download it came from, to a temporary file and renames it over path
+// once it reads back as written, so readers never see a partial or corrupt
+// database
+func writeOUIDatabase(path string, table map[string]string, source string) error {
+	ouis := make([]string, 0, len(table))
+	for oui := range table {
+		ouis = append(ouis, oui)
+	}
+	sort.Strings(ouis)
+
+	var body strings.Builder
+	for _, oui := range ouis {
+		fmt.Fprintf(&body, "%s\t%s\n", oui, table[oui])
+	}
+	sum := sha256.Sum256([]byte(body.String()))
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".oui-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := fmt.Fprintf(tmp, "%s%s entries=%d source=%s updated=%s\n%s",
+		ouiHeaderPrefix, hex.EncodeToString(sum[:]), len(table), source, time.Now().UTC().Format(time.RFC3339), body.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	written, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if _, err := parseOUIDatabase(string(written)); err != nil {
+		return fmt.Errorf("verifying the database written: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,399 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// passiveRefresh is how often the neighbor table is re-read while listening,
+// picking up hosts the machine has talked to in the meantime
+const passiveRefresh = 5 * time.Second
+
+// portSSDP is the UPnP discovery port, under which SSDP SERVER headers are
+// kept in Device.Banners
+const portSSDP = 1900
+
+var (
+	mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: portSSDP}
+)
+
+// observation is something heard about a host while listening passively
+type observation struct {
+	ip       string
+	mac      string            // Source MAC of a sniffed frame
+	name     string            // mDNS host name
+	hostname string            // Name from a DHCP request or NetBIOS registration
+	services map[string]string // mDNS service type to instance name
+	server   string            // SSDP SERVER header
+}
+
+// apply adds what was heard to device and reports whether anything changed
+func (o observation) apply(device *Device) bool {
+	changed := o.mac != "" && device.setObservedMAC(o.mac, "Source address of a sniffed broadcast")
+	if o.name != "" && device.MDNSName != o.name {
+		device.MDNSName = o.name
+		device.explain(FieldMDNSName, "mDNS announcement")
+		changed = true
+	}
+	name, source := o.name, "mDNS announcement"
+	if name == "" {
+		name, source = o.hostname, "Name in a DHCP request or NetBIOS registration"
+	}
+	if name != "" && len(device.Hostname) == 0 {
+		device.Hostname = []string{name}
+		device.explain(FieldHostname, "%s", source)
+		changed = true
+	}
+	for service, instance := range o.services {
+		if device.MDNSServices[service] != instance {
+			if device.MDNSServices == nil {
+				device.MDNSServices = make(map[string]string)
+			}
+			device.MDNSServices[service] = instance
+			changed = true
+		}
+	}
+	if o.server != "" && device.Banners[portSSDP] != o.server {
+		device.setBanner(portSSDP, o.server)
+		changed = true
+	}
+	device.LastSeen = time.Now()
+	return changed
+}
+
+// setObservedMAC records a MAC address seen for device, learned from
+// source, and reports whether it was new
+func (d *Device) setObservedMAC(mac, source string) bool {
+	if d.MACAddress == mac {
+		return false
+	}
+	d.MACAddress = mac
+	d.Vendor = LookupVendor(mac)
+	d.RandomMAC = IsLocallyAdministered(mac)
+	d.explainMAC(source)
+	d.Notes = slices.DeleteFunc(d.Notes, func(note string) bool { return note == noteMACUnresolved })
+	return true
+}
+
+// mergeObserved fills in what passive listening or the sniffer learned about
+// the device before it was probed, previous being its entry at the time
+func (d *Device) mergeObserved(previous Device) {
+	if d.MACAddress == "" && previous.MACAddress != "" {
+		source, ok := previous.Provenance[FieldMACAddress]
+		if !ok {
+			source = "Seen on the network before the probe"
+		}
+		d.setObservedMAC(previous.MACAddress, source)
+	}
+	if d.MDNSName == "" && previous.MDNSName != "" {
+		d.MDNSName = previous.MDNSName
+		d.carryProvenance(previous, FieldMDNSName)
+	}
+	if len(d.Hostname) == 0 && len(previous.Hostname) > 0 {
+		d.Hostname = previous.Hostname
+		d.carryProvenance(previous, FieldHostname)
+	}
+	for service, instance := range previous.MDNSServices {
+		if _, ok := d.MDNSServices[service]; !ok {
+			if d.MDNSServices == nil {
+				d.MDNSServices = make(map[string]string)
+			}
+			d.MDNSServices[service] = instance
+		}
+	}
+	for port, banner := range previous.Banners {
+		if _, ok := d.Banners[port]; !ok {
+			d.setBanner(port, banner)
+		}
+	}
+	d.CarrySeen(previous)
+}
+
+// observe applies change to the device at ip, creating it if the address is
+// a target not yet up, and stores it if anything changed. The device map is
+// read and written under publishMutex, so a probe result stored meanwhile is
+// never overwritten with an older copy.
+func (s *Scanner) observe(ip string, change func(*Device) bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || s.targets == nil || !s.targets.Contains(parsed) {
+		return
+	}
+	s.publishMutex.Lock()
+	device, keep := s.observeLocked(ip, change)
+	s.publishMutex.Unlock()
+	if keep {
+		s.publish(device)
+	}
+}
+
+// observeLocked is observe's change to the device map, made under
+// publishMutex; it returns the device stored, if any
+func (s *Scanner) observeLocked(ip string, change func(*Device) bool) (Device, bool) {
+
+	s.deviceMutex.Lock()
+	device, ok := s.devices[ip]
+	dropped := s.unkept[ip]
+	s.deviceMutex.Unlock()
+	if dropped {
+		return Device{}, false
+	}
+	if ok && device.Status == "Up" {
+		// The published copy shares these
+		device.Notes = slices.Clone(device.Notes)
+		device.MDNSServices = maps.Clone(device.MDNSServices)
+		device.Banners = maps.Clone(device.Banners)
+	} else {
+		now := time.Now()
+		device = Device{IPAddress: ip, Status: "Up", FirstSeen: now, LastSeen: now, Role: s.role(ip)}
+		s.explaining(&device)
+		ok = false
+	}
+	if !change(&device) && ok {
+		return Device{}, false
+	}
+	return s.storeLocked(device)
+}
+
+// scanPassive builds the device list for targets without sending a single
+// probe: hosts come from the OS neighbor table and, for Options.Listen, from
+// the mDNS and SSDP announcements devices multicast on their own. Joining
+// the multicast groups sends an IGMP membership report, nothing more.
+func (s *Scanner) scanPassive(targets *Targets, finished chan struct{}) {
+	log.Printf("Passive scan of %s: reading the neighbor table, listening for %v", targets, s.opts.Listen)
+	s.report("\nPassive scan: neighbor table and %v of mDNS/SSDP announcements\n", s.opts.Listen)
+
+	readTable := func() {
+		neighbors, err := readNeighbors()
+		if err != nil {
+			log.Printf("Could not read the neighbor table: %v", err)
+			return
+		}
+		for ip, mac := range neighbors {
+			s.observe(ip, func(device *Device) bool {
+				return device.setObservedMAC(mac, "Neighbor table")
+			})
+		}
+	}
+	readTable()
+	stopSniffer := s.startSniffer()
+
+	heard := make(chan observation, s.opts.resultsBuffer())
+	listeners := listenPassive(heard)
+	defer func() {
+		for _, conn := range listeners {
+			conn.Close()
+		}
+	}()
+
+	total := atomic.LoadInt32(&s.totalIPs)
+	start := time.Now()
+	deadline := time.After(s.opts.Listen)
+	refresh := time.NewTicker(passiveRefresh)
+	defer refresh.Stop()
+	for listening := s.opts.Listen > 0; listening; {
+		select {
+		case <-s.stopping():
+			listening = false
+		case <-deadline:
+			listening = false
+		case <-refresh.C:
+			readTable()
+			// Progress is the share of the listening time gone by
+			share := float64(time.Since(start)) / float64(s.opts.Listen)
+			atomic.StoreInt32(&s.scannedCount, int32(math.Min(share, 1)*float64(total)))
+		case o := <-heard:
+			s.observe(o.ip, o.apply)
+		}
+	}
+	stopSniffer()
+	if s.opts.Listen > 0 {
+		readTable()
+	}
+
+	atomic.StoreInt32(&s.sentCount, total)
+	atomic.StoreInt32(&s.scannedCount, total)
+	log.Printf("Passive scan complete: %d hosts observed", atomic.LoadInt32(&s.discovered))
+	s.complete(finished)
+}
+
+// listenPassive joins the mDNS and SSDP multicast groups and sends what it
+// hears to heard until the returned connections are closed. A group that
+// can't be joined, e.g. without a multicast route, is logged and skipped.
+func listenPassive(heard chan<- observation) []*net.UDPConn {
+	var conns []*net.UDPConn
+	for _, group := range []struct {
+		addr  *net.UDPAddr
+		parse func(packet []byte, from net.IP) observation
+	}{
+		{mdnsGroup, parseMDNSAnnouncement},
+		{ssdpGroup, parseSSDPAnnouncement},
+	} {
+		conn, err := net.ListenMulticastUDP("udp4", nil, group.addr)
+		if err != nil {
+			log.Printf("Not listening on %v: %v", group.addr, err)
+			continue
+		}
+		conns = append(conns, conn)
+		go func(parse func([]byte, net.IP) observation) {
+			buf := make([]byte, 9000)
+			for {
+				n, from, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				o := parse(buf[:n], from.IP)
+				o.ip = from.IP.String()
+				select {
+				case heard <- o:
+				default:
+				}
+			}
+		}(group.parse)
+	}
+	return conns
+}
+
+// parseMDNSAnnouncement reads the host name and service instances from an
+// mDNS response sent from the address from. Queries carry no answers and
+// yield only the sender.
+func parseMDNSAnnouncement(packet []byte, from net.IP) observation {
+	var o observation
+	var msg dns.Msg
+	if msg.Unpack(packet) != nil || !msg.Response {
+		return o
+	}
+	for _, rr := range append(msg.Answer, msg.Extra...) {
+		switch rr := rr.(type) {
+		case *dns.A:
+			if rr.A.Equal(from) {
+				o.name = strings.TrimSuffix(rr.Hdr.Name, ".")
+			}
+		case *dns.PTR:
+			// _airplay._tcp.local. PTR Living Room._airplay._tcp.local.
+			service := strings.TrimSuffix(rr.Hdr.Name, ".local.")
+			if !strings.HasPrefix(service, "_") || strings.HasPrefix(service, "_services.") {
+				continue
+			}
+			if o.services == nil {
+				o.services = make(map[string]string)
+			}
+			instance, _, _ := strings.Cut(rr.Ptr, "."+service)
+			o.services[service] = unescapeLabel(instance)
+		}
+	}
+	return o
+}
+
+// unescapeLabel undoes the escaping miekg/dns applies to a presentation
+// format label: \. and \  for special characters and \DDD for others
+func unescapeLabel(label string) string {
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		if label[i] != '\\' || i+1 == len(label) {
+			b.WriteByte(label[i])
+			continue
+		}
+		if i+3 < len(label) {
+			if n, err := strconv.Atoi(label[i+1 : i+4]); err == nil && n < 256 {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		i++
+		b.WriteByte(label[i])
+	}
+	return b.String()
+}
+
+// parseSSDPAnnouncement reads the SERVER header of an SSDP NOTIFY, which
+// names the device's OS and UPnP stack
+func parseSSDPAnnouncement(packet []byte, _ net.IP) observation {
+	var o observation
+	if !bytes.HasPrefix(packet, []byte("NOTIFY ")) {
+		return o
+	}
+	request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil {
+		return o
+	}
+	o.server = request.Header.Get("Server")
+	return o
+}
+
+// readNeighbors returns every complete entry of the OS ARP and IPv6
+// neighbor tables as IP to normalized MAC address
+func readNeighbors() (map[string]string, error) {
+	var commands [][]string
+	switch runtime.GOOS {
+	case "linux":
+		commands = [][]string{{"ip", "neigh", "show"}}
+	case "darwin", "freebsd", "openbsd", "netbsd":
+		commands = [][]string{{"arp", "-an"}, {"ndp", "-an"}}
+	case "windows":
+		commands = [][]string{{"arp", "-a"}, {"netsh", "interface", "ipv6", "show", "neighbors"}}
+	}
+
+	neighbors := make(map[string]string)
+	var lastErr error
+	for _, command := range commands {
+		output, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		parseNeighbors(output, neighbors)
+	}
+	if runtime.GOOS == "linux" && len(neighbors) == 0 {
+		// Without iproute2 the kernel's ARP table is still readable
+		if output, err := os.ReadFile("/proc/net/arp"); err == nil {
+			parseNeighbors(output, neighbors)
+			lastErr = nil
+		}
+	}
+	if len(neighbors) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return neighbors, nil
+}
+
+// parseNeighbors adds each line of neighbor table output that holds both
+// an address and a unicast MAC. The address is the first field that parses
+// as one, with any parentheses or %zone suffix removed, which covers the
+// ip, arp, ndp and netsh formats alike.
+func parseNeighbors(output []byte, neighbors map[string]string) {
+	lines := bufio.NewScanner(bytes.NewReader(output))
+	for lines.Scan() {
+		mac := neighborMACPattern.FindString(lines.Text())
+		if mac == "" {
+			continue
+		}
+		hw, err := net.ParseMAC(NormalizeMACAddress(mac))
+		if err != nil || hw[0]&0x01 != 0 || bytes.Equal(hw, make([]byte, len(hw))) {
+			continue // Broadcast, multicast or an empty entry
+		}
+		for _, field := range strings.Fields(lines.Text()) {
+			field, _, _ = strings.Cut(strings.Trim(field, "()"), "%")
+			if ip := net.ParseIP(field); ip != nil {
+				neighbors[ip.String()] = NormalizeMACAddress(mac)
+				break
+			}
+		}
+	}
+}
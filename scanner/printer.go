@@ -0,0 +1,521 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Device types assigned by printer identification
+const (
+	TypePrinter         = "Printer"
+	TypePossiblePrinter = "Possible Printer" // Printer ports open, but nothing confirmed it
+)
+
+const (
+	portSNMP      = 161
+	portLPD       = 515
+	portIPP       = 631
+	portJetDirect = 9100
+)
+
+// printerMaxResponse caps the size of an SNMP, IPP or PJL answer read from
+// a host
+const printerMaxResponse = 16 * 1024
+
+// printerServices are the mDNS service types printers advertise
+var printerServices = []string{"_ipp._tcp", "_ipps._tcp", "_pdl-datastream._tcp", "_printer._tcp"}
+
+// PrinterInfo is what a network printer revealed about itself
+type PrinterInfo struct {
+	Model     string // Make and model, e.g. "HP LaserJet M404dn"
+	PageCount int    // Pages printed over the printer's life, 0 if unknown
+	Source    string // Protocol the model was read over: SNMP, IPP or PJL
+}
+
+// String returns the model and page count
+func (p PrinterInfo) String() string {
+	text := p.Model
+	if text == "" {
+		text = "Unknown model"
+	}
+	if p.PageCount > 0 {
+		text += fmt.Sprintf(", %d pages", p.PageCount)
+	}
+	return text
+}
+
+// looksLikePrinter reports whether a host with openPorts and the mDNS
+// services advertises printing. Port 9100 alone is not enough: Prometheus
+// exporters listen there too.
+func looksLikePrinter(openPorts []int, services map[string]string) bool {
+	for _, service := range printerServices {
+		if _, ok := services[service]; ok {
+			return true
+		}
+	}
+	return contains(openPorts, portJetDirect) && (contains(openPorts, portLPD) || contains(openPorts, portIPP))
+}
+
+// identifyPrinter asks hosts with a printing port open what printer they
+// are: over SNMP first, which also has the page count, then IPP on port
+// 631 and, at high intensity, PJL on port 9100. PJL is held back because
+// a printer that doesn't speak it prints the query. A host that answers
+// becomes a Printer; one that only looks like it a Possible Printer.
+func (s *Scanner) identifyPrinter(device *Device, query bool) {
+	ports := device.OpenPorts
+	if !contains(ports, portJetDirect) && !contains(ports, portIPP) && !contains(ports, portLPD) &&
+		!looksLikePrinter(ports, device.MDNSServices) {
+		return
+	}
+
+	var info PrinterInfo
+	if query {
+		ip := device.IPAddress
+		scale := s.opts.Intensity.resolverTimeoutScale()
+		release := s.acquireResolver()
+		start := time.Now()
+		if model, pages, err := queryPrinterSNMP(ip, s.opts.SourceIP, scale); err == nil {
+			info = PrinterInfo{Model: model, PageCount: pages, Source: "SNMP"}
+		} else {
+			log.Printf("Printer SNMP query to %s failed: %v", ip, err)
+		}
+		if info.Model == "" && contains(ports, portIPP) {
+			if model, err := queryPrinterIPP(ip, s.opts.SourceIP, s.opts.UserAgent, scale); err == nil {
+				info.Model, info.Source = model, "IPP"
+			} else {
+				log.Printf("IPP printer query to %s failed: %v", ip, err)
+			}
+		}
+		if info.Model == "" && contains(ports, portJetDirect) && s.opts.Intensity == IntensityHigh {
+			if model, pages, err := queryPrinterPJL(ip, s.opts.SourceIP, scale); err == nil {
+				info.Model, info.Source = model, "PJL"
+				if info.PageCount == 0 {
+					info.PageCount = pages
+				}
+			} else {
+				log.Printf("PJL printer query to %s failed: %v", ip, err)
+			}
+		}
+		release()
+		s.timing().resolved(PhasePrinter, start, info.Source != "")
+	}
+
+	switch {
+	case info.Source != "":
+		log.Printf("Detected printer %s at %s over %s", info, device.IPAddress, info.Source)
+		device.DeviceType = TypePrinter
+		device.Printer = &info
+		device.explain(FieldDeviceType, "Printer model reported over %s", info.Source)
+	case device.DeviceType == "" && looksLikePrinter(ports, device.MDNSServices):
+		// A Mac sharing its printers advertises them too
+		device.DeviceType = TypePossiblePrinter
+		device.explain(FieldDeviceType, "Open printing ports or advertised printer services")
+	}
+}
+
+// SNMP objects read from printers
+const (
+	oidSysDescr           = "1.3.6.1.2.1.1.1.0"
+	oidHrDeviceDescr      = "1.3.6.1.2.1.25.3.2.1.3.1"    // The first device of a printer is the printer itself
+	oidPrtMarkerLifeCount = "1.3.6.1.2.1.43.10.2.1.4.1.1" // Printer-MIB, so only printers have it
+)
+
+// BER tags of SNMP messages beyond those LDAP uses
+const (
+	berNull            = 0x05
+	berOID             = 0x06
+	snmpCounter32      = 0x41 // [APPLICATION 1]
+	snmpGauge32        = 0x42 // [APPLICATION 2]
+	snmpGetRequest     = 0xa0 // [0], constructed
+	snmpGetResponse    = 0xa2 // [2], constructed
+	snmpNoSuchObject   = 0x80 // [0], primitive
+	snmpNoSuchInstance = 0x81 // [1], primitive
+	snmpEndOfMibView   = 0x82 // [2], primitive
+)
+
+const (
+	snmpVersion2c = 1
+	snmpCommunity = "public"
+	snmpRequestID = 0x4e56 // "NV"
+)
+
+// queryPrinterSNMP reads the model and page count of the printer at ip over
+// SNMPv2c with the public community. A host without the Printer-MIB is not
+// a printer, whatever it answers.
+func queryPrinterSNMP(ip string, source net.IP, timeoutScale int) (string, int, error) {
+	timeout := time.Second * 2 * time.Duration(timeoutScale)
+	conn, err := dial(dialer("udp", source, timeout), "udp", net.JoinHostPort(ip, strconv.Itoa(portSNMP)))
+	if err != nil {
+		return "", 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	request, err := snmpGetRequestFor(oidHrDeviceDescr, oidSysDescr, oidPrtMarkerLifeCount)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return "", 0, fmt.Errorf("sending request: %v", err)
+	}
+	buf := make([]byte, printerMaxResponse)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", 0, err
+	}
+	values, err := parseSNMPResponse(buf[:n])
+	if err != nil {
+		return "", 0, err
+	}
+
+	count, ok := values[oidPrtMarkerLifeCount]
+	if !ok {
+		return "", 0, errors.New("no Printer-MIB")
+	}
+	model := cleanPrinterText(values[oidHrDeviceDescr].text)
+	if model == "" {
+		// Only the first line; the rest is firmware detail
+		model, _, _ = strings.Cut(cleanPrinterText(values[oidSysDescr].text), "\n")
+	}
+	return model, count.number, nil
+}
+
+// snmpValue is one variable binding of a GetResponse
+type snmpValue struct {
+	text   string // OCTET STRING values
+	number int    // INTEGER, Counter32 and Gauge32 values
+}
+
+// snmpGetRequestFor encodes an SNMPv2c GetRequest for oids
+func snmpGetRequestFor(oids ...string) ([]byte, error) {
+	bindings := make([][]byte, len(oids))
+	for i, oid := range oids {
+		encoded, err := encodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		bindings[i] = encodeBER(berSequence, encodeBER(berOID, encoded), encodeBER(berNull))
+	}
+	pdu := encodeBER(snmpGetRequest,
+		encodeBER(berInteger, []byte{snmpRequestID >> 8, snmpRequestID & 0xff}),
+		encodeBER(berInteger, []byte{0}), // error-status
+		encodeBER(berInteger, []byte{0}), // error-index
+		encodeBER(berSequence, bindings...),
+	)
+	return encodeBER(berSequence,
+		encodeBER(berInteger, []byte{snmpVersion2c}),
+		encodeBER(berOctetString, []byte(snmpCommunity)),
+		pdu,
+	), nil
+}
+
+// parseSNMPResponse returns the values of a GetResponse by dotted OID,
+// leaving out the objects the agent doesn't have
+func parseSNMPResponse(data []byte) (map[string]snmpValue, error) {
+	tag, message, _, err := parseBER(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag != berSequence {
+		return nil, fmt.Errorf("unexpected SNMP message tag 0x%02x", tag)
+	}
+	// Skip the version and community
+	for i := 0; i < 2; i++ {
+		if _, _, message, err = parseBER(message); err != nil {
+			return nil, err
+		}
+	}
+	tag, pdu, _, err := parseBER(message)
+	if err != nil {
+		return nil, err
+	}
+	if tag != snmpGetResponse {
+		return nil, fmt.Errorf("unexpected SNMP PDU tag 0x%02x", tag)
+	}
+	// Skip the request ID, then check the error status
+	if _, _, pdu, err = parseBER(pdu); err != nil {
+		return nil, err
+	}
+	_, status, pdu, err := parseBER(pdu)
+	if err != nil {
+		return nil, err
+	}
+	if code := berInt(status); code != 0 {
+		return nil, fmt.Errorf("SNMP error status %d", code)
+	}
+	if _, _, pdu, err = parseBER(pdu); err != nil {
+		return nil, err
+	}
+	_, bindings, _, err := parseBER(pdu)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]snmpValue)
+	for len(bindings) > 0 {
+		var binding []byte
+		if _, binding, bindings, err = parseBER(bindings); err != nil {
+			return nil, err
+		}
+		_, oid, rest, err := parseBER(binding)
+		if err != nil {
+			return nil, err
+		}
+		tag, value, _, err := parseBER(rest)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case berOctetString:
+			values[decodeOID(oid)] = snmpValue{text: string(value)}
+		case berInteger, snmpCounter32, snmpGauge32:
+			values[decodeOID(oid)] = snmpValue{number: berInt(value)}
+		case snmpNoSuchObject, snmpNoSuchInstance, snmpEndOfMibView:
+		}
+	}
+	return values, nil
+}
+
+// encodeOID encodes a dotted object identifier as BER contents
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		arcs[i] = arc
+	}
+	out := []byte{byte(arcs[0]*40 + arcs[1])}
+	for _, arc := range arcs[2:] {
+		var base128 []byte
+		for {
+			base128 = append([]byte{byte(arc & 0x7f)}, base128...)
+			arc >>= 7
+			if arc == 0 {
+				break
+			}
+		}
+		for i := 0; i < len(base128)-1; i++ {
+			base128[i] |= 0x80
+		}
+		out = append(out, base128...)
+	}
+	return out, nil
+}
+
+// decodeOID returns BER object identifier contents in dotted form
+func decodeOID(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	arcs := []string{strconv.Itoa(int(data[0]) / 40), strconv.Itoa(int(data[0]) % 40)}
+	var arc uint64
+	for _, b := range data[1:] {
+		arc = arc<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+			arc = 0
+		}
+	}
+	return strings.Join(arcs, ".")
+}
+
+// berInt decodes a two's complement BER integer, saturating rather than
+// overflowing on oversized values
+func berInt(data []byte) int {
+	if len(data) == 0 || len(data) > 8 {
+		return 0
+	}
+	var value int64
+	if data[0]&0x80 != 0 {
+		value = -1
+	}
+	for _, b := range data {
+		value = value<<8 | int64(b)
+	}
+	return int(value)
+}
+
+// IPP operation and tags used by the Get-Printer-Attributes request
+const (
+	ippGetPrinterAttributes = 0x000b
+	ippOperationAttributes  = 0x01
+	ippEndOfAttributes      = 0x03
+	ippTagKeyword           = 0x44
+	ippTagURI               = 0x45
+	ippTagCharset           = 0x47
+	ippTagNaturalLanguage   = 0x48
+	ippTagTextWithLanguage  = 0x35
+)
+
+// queryPrinterIPP reads the printer-make-and-model of the IPP printer at
+// ip. It asks for /ipp/print, the IPP Everywhere printer path, which a CUPS
+// server sharing printers doesn't have.
+func queryPrinterIPP(ip string, source net.IP, userAgent string, timeoutScale int) (string, error) {
+	uri := "ipp://" + net.JoinHostPort(ip, strconv.Itoa(portIPP)) + "/ipp/print"
+	var body bytes.Buffer
+	binary.Write(&body, binary.BigEndian, []uint16{0x0200, ippGetPrinterAttributes})
+	binary.Write(&body, binary.BigEndian, uint32(1))
+	body.WriteByte(ippOperationAttributes)
+	writeIPPAttribute(&body, ippTagCharset, "attributes-charset", "utf-8")
+	writeIPPAttribute(&body, ippTagNaturalLanguage, "attributes-natural-language", "en")
+	writeIPPAttribute(&body, ippTagURI, "printer-uri", uri)
+	writeIPPAttribute(&body, ippTagKeyword, "requested-attributes", "printer-make-and-model")
+	body.WriteByte(ippEndOfAttributes)
+
+	client := &http.Client{
+		Timeout: time.Second * 3 * time.Duration(timeoutScale),
+		Transport: userAgentTransport{
+			base: &http.Transport{
+				DialContext:       limitedDial(dialer("tcp", source, 0)),
+				DisableKeepAlives: true,
+			},
+			userAgent: userAgent,
+		},
+	}
+	resp, err := client.Post("http://"+net.JoinHostPort(ip, strconv.Itoa(portIPP))+"/ipp/print", "application/ipp", &body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, printerMaxResponse))
+	if err != nil {
+		return "", err
+	}
+	return parseIPPModel(data)
+}
+
+// writeIPPAttribute appends a single-valued attribute to an IPP request
+func writeIPPAttribute(buf *bytes.Buffer, tag byte, name, value string) {
+	buf.WriteByte(tag)
+	binary.Write(buf, binary.BigEndian, uint16(len(name)))
+	buf.WriteString(name)
+	binary.Write(buf, binary.BigEndian, uint16(len(value)))
+	buf.WriteString(value)
+}
+
+// parseIPPModel returns printer-make-and-model from a Get-Printer-Attributes
+// response
+func parseIPPModel(data []byte) (string, error) {
+	if len(data) < 8 {
+		return "", io.ErrUnexpectedEOF
+	}
+	if status := binary.BigEndian.Uint16(data[2:4]); status >= 0x0100 {
+		return "", fmt.Errorf("IPP status 0x%04x", status)
+	}
+	data = data[8:]
+	for len(data) > 0 {
+		tag := data[0]
+		data = data[1:]
+		if tag == ippEndOfAttributes {
+			break
+		}
+		if tag < 0x10 {
+			continue // Start of the next attribute group
+		}
+		if len(data) < 2 {
+			return "", io.ErrUnexpectedEOF
+		}
+		nameLen := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+nameLen+2 {
+			return "", io.ErrUnexpectedEOF
+		}
+		name := string(data[2 : 2+nameLen])
+		data = data[2+nameLen:]
+		valueLen := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+valueLen {
+			return "", io.ErrUnexpectedEOF
+		}
+		value := data[2 : 2+valueLen]
+		data = data[2+valueLen:]
+
+		if name != "printer-make-and-model" {
+			continue
+		}
+		if tag == ippTagTextWithLanguage {
+			// A language tag precedes the text
+			if len(value) < 2 || len(value) < 4+int(binary.BigEndian.Uint16(value)) {
+				return "", io.ErrUnexpectedEOF
+			}
+			value = value[2+int(binary.BigEndian.Uint16(value)):]
+			value = value[2:]
+		}
+		if model := cleanPrinterText(string(value)); model != "" {
+			return model, nil
+		}
+	}
+	return "", errors.New("no printer-make-and-model")
+}
+
+// pjlQuery asks a PJL printer for its model and page count, wrapped in
+// Universal Exit Language sequences so it is not taken for a print job
+const pjlQuery = "\x1b%-12345X@PJL INFO ID\r\n@PJL INFO PAGECOUNT\r\n\x1b%-12345X"
+
+// queryPrinterPJL reads the model and page count of the printer at ip from
+// its raw printing port
+func queryPrinterPJL(ip string, source net.IP, timeoutScale int) (string, int, error) {
+	timeout := time.Second * 2 * time.Duration(timeoutScale)
+	conn, err := dial(dialer("tcp", source, timeout), "tcp", net.JoinHostPort(ip, strconv.Itoa(portJetDirect)))
+	if err != nil {
+		return "", 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte(pjlQuery)); err != nil {
+		return "", 0, fmt.Errorf("sending query: %v", err)
+	}
+
+	// Each answer echoes its command and ends with a form feed
+	var model string
+	var pages int
+	var answering string
+	lines := bufio.NewScanner(io.LimitReader(conn, printerMaxResponse))
+	for (model == "" || pages == 0) && lines.Scan() {
+		line := strings.Trim(lines.Text(), "\r\f \t")
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "@PJL INFO "):
+			answering = strings.TrimPrefix(line, "@PJL INFO ")
+		case answering == "ID":
+			model = cleanPrinterText(strings.Trim(line, `"`))
+			answering = ""
+		case answering == "PAGECOUNT":
+			pages, _ = strconv.Atoi(strings.TrimPrefix(line, "PAGECOUNT="))
+			answering = ""
+		}
+	}
+	if model == "" {
+		return "", 0, errors.New("no PJL INFO ID answer")
+	}
+	return model, pages, nil
+}
+
+// cleanPrinterText trims the padding and control characters some printers
+// leave in their model strings
+func cleanPrinterText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.TrimSpace(text)
+}
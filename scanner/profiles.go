@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultPorts are the TCP ports probed when no port profile is selected
+var DefaultPorts = []int{80, 443, 22, 445, 139, 135, 8080, 3389, 5900, 8006, 9100}
+
+// portProfiles are curated port sets for specialised networks. Every port is
+// probed with a TCP connect, so UDP-only services such as CoAP, BACnet and
+// SNMP only show up on devices that also listen on TCP.
+var portProfiles = map[string][]int{
+	"default":  DefaultPorts,
+	"ad":       {53, 88, 135, 139, 389, 445, 636, 3268, 3269, 3389, 5985},
+	"iot":      {1883, 8883, 5683, 80, 443},
+	"ics":      {502, 102, 20000, 44818, 47808},
+	"legacy":   {21, 23, 512, 513, 514, 2323},
+	"printers": {631, 9100, 515, 161},
+	"deep":     DeepPorts,
+}
+
+// DeepPorts are probed when a host is investigated in depth: the ports of
+// every other profile and the well-known services an unidentified host may
+// be running instead, such as databases, mail and iOS device sync
+var DeepPorts = []int{
+	21, 22, 23, 25, 53, 80, 81, 88, 102, 110, 111, 135, 139, 143, 161, 389,
+	443, 445, 502, 512, 513, 514, 515, 548, 554, 587, 631, 636, 993, 995,
+	1433, 1521, 1723, 1883, 2049, 2323, 3268, 3269, 3306, 3389, 3689, 5000,
+	5060, 5432, 5683, 5900, 5985, 5986, 6379, 7000, 8000, 8006, 8008, 8080,
+	8081, 8443, 8883, 8888, 9000, 9090, 9100, 9200, 9443, 10000, 20000,
+	27017, 44818, 47808, 49152, 62078,
+}
+
+// PortProfileNames returns the names accepted by PortProfile, sorted
+func PortProfileNames() []string {
+	names := make([]string, 0, len(portProfiles))
+	for name := range portProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PortProfile returns a copy of the ports in the named profile
+func PortProfile(name string) ([]int, error) {
+	ports, ok := portProfiles[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown port profile %q (want %s)", name, strings.Join(PortProfileNames(), ", "))
+	}
+	return append([]int(nil), ports...), nil
+}
+
+// ports returns the configured port list, or DefaultPorts
+func (o Options) ports() []int {
+	if len(o.Ports) > 0 {
+		return o.Ports
+	}
+	return DefaultPorts
+}
@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// Device fields whose source is kept in Device.Provenance under
+// Options.Explain
+const (
+	FieldHostname   = "Hostname"
+	FieldMDNSName   = "MDNSName"
+	FieldDeviceType = "DeviceType"
+	FieldVersion    = "Version"
+	FieldDomain     = "Domain"
+	FieldMACAddress = "MACAddress"
+	FieldVendor     = "Vendor"
+	FieldRole       = "Role"
+)
+
+// ProvenanceFields lists the explained fields in the order they are shown
+var ProvenanceFields = []string{
+	FieldHostname, FieldMDNSName, FieldDeviceType, FieldVersion, FieldDomain, FieldMACAddress, FieldVendor, FieldRole,
+}
+
+// explain records the signal that set field, such as "NetBIOS name query",
+// when the device keeps provenance. The map is replaced rather than written
+// to, since a copy of the device may already have been published.
+func (d *Device) explain(field, format string, args ...interface{}) {
+	if d.Provenance == nil {
+		return
+	}
+	provenance := maps.Clone(d.Provenance)
+	provenance[field] = fmt.Sprintf(format, args...)
+	d.Provenance = provenance
+}
+
+// explainHostname records source for d.Hostname, unless the mDNS name was
+// put first, in which case the name has the mDNS name's source
+func (d *Device) explainHostname(source string) {
+	if len(d.Hostname) > 0 && d.MDNSName != "" && strings.EqualFold(d.Hostname[0], d.MDNSName) {
+		if mdns, ok := d.Provenance[FieldMDNSName]; ok {
+			source = mdns
+		}
+	}
+	d.explain(FieldHostname, "%s", source)
+}
+
+// explainMAC records where the MAC address came from, and the vendor with
+// it, which is only ever looked up from the MAC
+func (d *Device) explainMAC(source string) {
+	d.explain(FieldMACAddress, "%s", source)
+	if d.Vendor != "" {
+		d.explain(FieldVendor, "OUI registry lookup of the MAC address")
+	}
+}
+
+// carryProvenance copies previous's source for field, when d took the field
+// from it
+func (d *Device) carryProvenance(previous Device, field string) {
+	if source, ok := previous.Provenance[field]; ok {
+		d.explain(field, "%s", source)
+	}
+}
+
+// keepProvenance keeps previous's source for each field d still has the same
+// value of, as when the device is found again without Options.Explain
+func (d *Device) keepProvenance(previous Device) {
+	for _, field := range ProvenanceFields {
+		source, ok := previous.Provenance[field]
+		if !ok {
+			continue
+		}
+		if _, known := d.Provenance[field]; known {
+			continue
+		}
+		value := d.fieldValue(field)
+		if value == "" || value != previous.fieldValue(field) {
+			continue
+		}
+		if d.Provenance == nil {
+			d.Provenance = make(map[string]string)
+		}
+		d.explain(field, "%s", source)
+	}
+}
+
+// fieldValue returns the value of an explained field as text, to compare
+// two finds of the same device
+func (d *Device) fieldValue(field string) string {
+	switch field {
+	case FieldHostname:
+		return strings.Join(d.Hostname, ",")
+	case FieldMDNSName:
+		return d.MDNSName
+	case FieldDeviceType:
+		return d.DeviceType
+	case FieldVersion:
+		return d.Version
+	case FieldDomain:
+		return d.Domain
+	case FieldMACAddress:
+		return strings.ToLower(d.MACAddress)
+	case FieldVendor:
+		return d.Vendor
+	case FieldRole:
+		return d.Role
+	}
+	return ""
+}
+
+// explaining starts the provenance of device under Options.Explain
+func (s *Scanner) explaining(device *Device) {
+	if s.opts.Explain && device.Provenance == nil {
+		device.Provenance = make(map[string]string)
+	}
+	switch device.Role {
+	case RoleSelf:
+		device.explain(FieldRole, "Address of one of this machine's interfaces")
+	case RoleGateway:
+		device.explain(FieldRole, "Default gateway in the routing table")
+	}
+}
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ptrConcurrency caps reverse DNS lookups in flight across all workers
+	ptrConcurrency = 16
+	// ptrTimeout bounds each lookup, scaled by the resolver timeout scale
+	ptrTimeout = 2 * time.Second
+	// ptrFailureLimit consecutive timeouts mark the DNS server dead for the
+	// rest of the scan, so later hosts skip reverse DNS instead of queueing
+	ptrFailureLimit = 10
+	// ptrNegativeTTL is how long an address with no PTR record is remembered
+	ptrNegativeTTL = 10 * time.Minute
+)
+
+// errDNSGivenUp is reported for lookups skipped after the DNS server stopped
+// answering
+var errDNSGivenUp = errors.New("DNS server not answering, skipped")
+
+// ptrNegativeCache remembers addresses without a PTR record, shared by every
+// scan in the process so rescans don't repeat lookups that just failed
+var ptrNegativeCache sync.Map // IP string -> expiry time.Time
+
+// ptrPool resolves PTR records for one scan in the background, so a slow or
+// dead DNS server doesn't hold up the workers
+type ptrPool struct {
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	timeout  time.Duration
+	timeouts int32 // Consecutive timed-out lookups
+	dead     int32 // Set once timeouts reaches ptrFailureLimit
+}
+
+func newPTRPool(timeoutScale int) *ptrPool {
+	return &ptrPool{
+		sem:     make(chan struct{}, ptrConcurrency),
+		timeout: ptrTimeout * time.Duration(timeoutScale),
+	}
+}
+
+// lookup resolves ip in the background and calls done with its names or
+// the lookup error. It returns false, and never calls done, for addresses in
+// the negative cache or once the DNS server has been given up on. stop
+// abandons lookups that have not started yet, also without calling done.
+func (p *ptrPool) lookup(ip string, stop <-chan struct{}, done func(names []string, err error)) bool {
+	if expiry, ok := ptrNegativeCache.Load(ip); ok && time.Now().Before(expiry.(time.Time)) {
+		return false
+	}
+	if atomic.LoadInt32(&p.dead) != 0 {
+		return false
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		select {
+		case p.sem <- struct{}{}:
+		case <-stop:
+			return
+		}
+		defer func() { <-p.sem }()
+		if atomic.LoadInt32(&p.dead) != 0 {
+			done(nil, errDNSGivenUp)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+		cancel()
+
+		if err != nil || len(names) == 0 {
+			if dnsErr, ok := err.(*net.DNSError); ok && (dnsErr.IsTimeout || ctx.Err() != nil) {
+				if atomic.AddInt32(&p.timeouts, 1) == ptrFailureLimit {
+					atomic.StoreInt32(&p.dead, 1)
+					log.Printf("Reverse DNS timed out %d times in a row; skipping it for the rest of the scan", ptrFailureLimit)
+				}
+			} else {
+				atomic.StoreInt32(&p.timeouts, 0)
+				ptrNegativeCache.Store(ip, time.Now().Add(ptrNegativeTTL))
+			}
+			done(nil, err)
+			return
+		}
+
+		atomic.StoreInt32(&p.timeouts, 0)
+		done(names, nil)
+	}()
+	return true
+}
+
+// wait blocks until every queued lookup has finished
+func (p *ptrPool) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,22 @@
+package scanner
+
+import "slices"
+
+// QuickPorts are probed by a quick scan: the services most hosts on a home
+// or office network answer on
+var QuickPorts = []int{80, 443, 22, 445, 3389, 8080}
+
+// Quick returns o set up for a fast first look at a subnet: the QuickPorts
+// unless ports were chosen, reverse DNS alone for names (IntensityLow), no
+// Apple port probes or MAC retries (ConnectOnly), the shortest timeouts and
+// no retry passes
+func (o Options) Quick() Options {
+	if len(o.Ports) == 0 {
+		o.Ports = slices.Clone(QuickPorts)
+	}
+	o.Intensity = IntensityLow
+	o.ConnectOnly = true
+	o.TimeoutScale = 1
+	o.Retries = 0
+	return o
+}
@@ -0,0 +1,182 @@
+package scanner
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"strings"
+)
+
+// DefaultMaxHosts is the largest range scanned without Options.Force
+const DefaultMaxHosts = 65536
+
+// TooManyHostsError is returned by ScanNetwork for ranges larger than the
+// configured limit, such as an accidental /8
+type TooManyHostsError struct {
+	CIDR  string
+	Hosts uint64
+	Limit int
+}
+
+func (e *TooManyHostsError) Error() string {
+	return fmt.Sprintf("%s has %d hosts, more than the limit of %d; use --force or raise --max-hosts to scan it",
+		e.CIDR, e.Hosts, e.Limit)
+}
+
+// CheckHosts returns a TooManyHostsError if scanning hosts addresses in cidr
+// needs an explicit override
+func (o Options) CheckHosts(cidr string, hosts uint64) error {
+	limit := o.MaxHosts
+	if limit == 0 {
+		limit = DefaultMaxHosts
+	}
+	if o.Force || limit < 0 || hosts <= uint64(limit) {
+		return nil
+	}
+	return &TooManyHostsError{CIDR: cidr, Hosts: hosts, Limit: limit}
+}
+
+// NormalizeCIDR returns cidr in its network form, with any host bits
+// cleared: 192.168.1.50/24 is 192.168.1.0/24, the range it names
+func NormalizeCIDR(cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return "", err
+	}
+	return ipNet.String(), nil
+}
+
+// CountIPs returns how many addresses GetAllIPs yields for ipNet without
+// allocating them. Ranges with more than 2^64 addresses report math.MaxUint64.
+func CountIPs(ipNet *net.IPNet) uint64 {
+	ones, bits := ipNet.Mask.Size()
+	hostBits := bits - ones
+	if hostBits >= 64 {
+		return math.MaxUint64
+	}
+	count := uint64(1) << uint(hostBits)
+	if count > 2 {
+		count -= 2 // network and broadcast addresses
+	}
+	return count
+}
+
+// IterateIPs calls fn with each address GetAllIPs would return, in order,
+// until fn returns false. Each address is a fresh copy fn may keep.
+func IterateIPs(ipNet *net.IPNet, fn func(net.IP) bool) {
+	count := CountIPs(ipNet)
+	ip := ipNet.IP.Mask(ipNet.Mask)
+	if ones, bits := ipNet.Mask.Size(); bits-ones >= 2 {
+		inc(ip) // skip the network address
+	}
+	for i := uint64(0); i < count; i++ {
+		next := make(net.IP, len(ip))
+		copy(next, ip)
+		if !fn(next) {
+			return
+		}
+		inc(ip)
+	}
+}
+
+// IterateIPsRandom calls fn with each address IterateIPs would, in random
+// order, until fn returns false
+func IterateIPsRandom(ipNet *net.IPNet, fn func(net.IP) bool) {
+	first := ipNet.IP.Mask(ipNet.Mask)
+	if ones, bits := ipNet.Mask.Size(); bits-ones >= 2 {
+		inc(first) // skip the network address
+	}
+	permute(CountIPs(ipNet), func(index uint64) bool {
+		return fn(addOffset(first, index))
+	})
+}
+
+// permute calls fn with each index below count in random order until fn
+// returns false. Up to DefaultMaxHosts indexes are shuffled outright; more
+// are walked in a random affine permutation, which spreads them without
+// holding every index.
+func permute(count uint64, fn func(index uint64) bool) {
+	if count <= DefaultMaxHosts {
+		for _, i := range rand.Perm(int(count)) {
+			if !fn(uint64(i)) {
+				return
+			}
+		}
+		return
+	}
+
+	// i -> (a*i + b) mod count visits every index once when a and count
+	// are coprime
+	n := new(big.Int).SetUint64(count)
+	a := new(big.Int)
+	for {
+		a.SetUint64(rand.Uint64()%count | 1)
+		if new(big.Int).GCD(nil, nil, a, n).Cmp(big.NewInt(1)) == 0 {
+			break
+		}
+	}
+	b := new(big.Int).SetUint64(rand.Uint64() % count)
+
+	index := new(big.Int)
+	for i := uint64(0); i < count; i++ {
+		index.SetUint64(i)
+		index.Mul(index, a).Add(index, b).Mod(index, n)
+		if !fn(index.Uint64()) {
+			return
+		}
+	}
+}
+
+// addOffset returns a copy of ip advanced by offset addresses
+func addOffset(ip net.IP, offset uint64) net.IP {
+	next := dup(ip)
+	for j := len(next) - 1; j >= 0 && offset > 0; j-- {
+		sum := uint64(next[j]) + offset&0xff
+		next[j] = byte(sum)
+		offset = offset>>8 + sum>>8
+	}
+	return next
+}
+
+// priorityIPs returns the addresses Options.GatewayFirst probes ahead of the
+// sweep of targets: the gateway, then the first and last hosts of each
+// range. Only addresses among the targets are included, each once.
+func (o Options) priorityIPs(targets *Targets) []net.IP {
+	if !o.GatewayFirst || targets.Count() < 2 {
+		return nil
+	}
+
+	candidates := []net.IP{o.Gateway}
+	for _, r := range targets.ranges {
+		candidates = append(candidates, family(r.start), family(r.end))
+	}
+	var ips []net.IP
+	seen := make(map[string]bool)
+	for _, ip := range candidates {
+		if ip == nil || !targets.Contains(ip) || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// dup returns a copy of ip
+func dup(ip net.IP) net.IP {
+	c := make(net.IP, len(ip))
+	copy(c, ip)
+	return c
+}
+
+// dec decrements ip in place
+func dec(ip net.IP) {
+	for j := len(ip) - 1; j >= 0; j-- {
+		ip[j]--
+		if ip[j] != 0xff {
+			break
+		}
+	}
+}
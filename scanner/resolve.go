@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resolutionNotes start the notes left by hostname lookups that failed or
+// found no name, which a new resolution replaces
+var resolutionNotes = []string{
+	"Reverse DNS lookup failed",
+	"AFP hostname lookup",
+	"NetBIOS name query",
+	"SMB hostname lookup",
+	"RDP hostname lookup",
+	"mDNS hostname lookup failed",
+}
+
+// Resolve runs hostname resolution again on the up devices among devices
+// without probing them: reverse DNS, then the AFP, NetBIOS, SMB, RDP and
+// mDNS lookups their open ports and the scan intensity call for, as a scan
+// would. It is for when DNS comes back or the resolver is fixed after a
+// scan. The devices are returned in the same order, down ones unchanged; a
+// device that no lookup names keeps its old hostnames. workers bounds how
+// many devices are resolved at once.
+func (s *Scanner) Resolve(devices []Device, workers int) []Device {
+	resolved := slices.Clone(devices)
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < max(workers, 1); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				resolved[i] = s.resolveAgain(resolved[i])
+			}
+		}()
+	}
+	for i, device := range resolved {
+		if device.Status == "Up" {
+			work <- i
+		}
+	}
+	close(work)
+	wg.Wait()
+	return resolved
+}
+
+// resolveAgain re-runs the hostname lookups of scanIP on device
+func (s *Scanner) resolveAgain(device Device) Device {
+	ipStr := device.IPAddress
+	previous, previousSource := device.Hostname, device.Provenance[FieldHostname]
+	device.Hostname = nil
+	device.Notes = slices.DeleteFunc(slices.Clone(device.Notes), func(note string) bool {
+		for _, prefix := range resolutionNotes {
+			if strings.HasPrefix(note, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+
+	tryMDNS := false
+	if names, err := s.lookupAddrNow(ipStr); len(names) > 0 {
+		device.Hostname = names
+		device.explainHostname(sourcePTR)
+		log.Printf("DNS hostname found for %s: %v", ipStr, names)
+		tryMDNS = s.opts.PreferMDNS && s.opts.Intensity != IntensityLow && poorHostname(names[0], ipStr)
+	} else {
+		if err != nil {
+			device.addNote("Reverse DNS lookup failed: %v", err)
+		}
+		tryMDNS = s.resolveHostname(ipStr, &device, device.OpenPorts)
+	}
+	if tryMDNS {
+		device.MDNSServices = maps.Clone(device.MDNSServices)
+		s.applyMDNS(&device, s.lookupMDNSNow(ipStr))
+	}
+
+	if len(device.Hostname) == 0 {
+		// A name from a certificate or directory, or an earlier lookup, is
+		// better than none
+		device.Hostname = previous
+		if previousSource != "" {
+			device.explain(FieldHostname, "%s", previousSource)
+		}
+	}
+	return device
+}
+
+// lookupAddrNow resolves the PTR names of ip, bypassing the negative cache
+// the scan keeps, since the point is to ask again
+func (s *Scanner) lookupAddrNow(ip string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ptrTimeout*time.Duration(s.opts.Intensity.resolverTimeoutScale()))
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err == nil && len(names) > 0 {
+		ptrNegativeCache.Delete(ip)
+	}
+	return names, err
+}
+
+// SetNames takes the names Resolve found for the same device into d,
+// leaving what the scan probed alone, and reports whether they changed
+func (d *Device) SetNames(resolved Device) bool {
+	if slices.Equal(d.Hostname, resolved.Hostname) && d.MDNSName == resolved.MDNSName {
+		return false
+	}
+	d.Hostname = resolved.Hostname
+	d.MDNSName = resolved.MDNSName
+	d.MDNSServices = resolved.MDNSServices
+	d.DeviceType = resolved.DeviceType
+	d.Notes = resolved.Notes
+	for _, field := range []string{FieldHostname, FieldMDNSName, FieldDeviceType} {
+		d.carryProvenance(resolved, field)
+	}
+	return true
+}
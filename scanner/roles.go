@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"net"
+	"os"
+	"time"
+)
+
+// Roles of hosts that orient the results
+const (
+	RoleSelf    = "This Device" // The machine running the scan
+	RoleGateway = "Gateway"     // The default gateway, see Options.Gateway
+)
+
+// noteSelfSkipped is the note on this machine's device under
+// Options.SkipSelf, which lists it without probing it
+const noteSelfSkipped = "Not probed: this is the scanning machine"
+
+// localAddrs returns the addresses of this machine's interfaces
+func localAddrs() map[string]bool {
+	addrs := make(map[string]bool)
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return addrs
+	}
+	for _, addr := range ifaceAddrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			addrs[ipNet.IP.String()] = true
+		}
+	}
+	return addrs
+}
+
+// localNetworks returns the subnets of this machine's interfaces, the
+// hosts it reaches without a router. Loopback is left out, having no MACs.
+func localNetworks() []*net.IPNet {
+	var networks []*net.IPNet
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range ifaceAddrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			networks = append(networks, &net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask})
+		}
+	}
+	return networks
+}
+
+// onLink reports whether ip is on one of this machine's subnets, so its MAC
+// can be learned. Every host counts as on-link with Options.RemoteMAC, or
+// when the subnets couldn't be read, and none through a SOCKS5 proxy.
+func (s *Scanner) onLink(ip net.IP) bool {
+	if s.opts.SOCKS5 != "" {
+		return false
+	}
+	if s.opts.RemoteMAC || len(s.localNets) == 0 {
+		return true
+	}
+	for _, network := range s.localNets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// role returns the Role of the host at ip, empty for an ordinary host
+func (s *Scanner) role(ip string) string {
+	switch {
+	case s.localIPs[ip]:
+		return RoleSelf
+	case s.opts.Gateway != nil && s.opts.Gateway.String() == ip:
+		return RoleGateway
+	}
+	return ""
+}
+
+// selfDevice describes this machine at ip from its own hostname and
+// interfaces, standing in for probing it with Options.SkipSelf
+func (s *Scanner) selfDevice(ip string) Device {
+	now := time.Now()
+	device := Device{
+		IPAddress: ip,
+		Status:    "Up",
+		Role:      RoleSelf,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	s.explaining(&device)
+	if name, err := os.Hostname(); err == nil && name != "" {
+		device.Hostname = []string{name}
+		device.explain(FieldHostname, "This machine's hostname")
+	}
+	if iface := interfaceWithAddr(ip); iface != nil {
+		device.Interface = iface.Name
+		if mac := iface.HardwareAddr.String(); mac != "" {
+			device.MACAddress = mac
+			device.Vendor = LookupVendor(mac)
+			device.RandomMAC = IsLocallyAdministered(mac)
+			device.explainMAC("Hardware address of the local interface " + iface.Name)
+		}
+	}
+	device.addNote(noteSelfSkipped)
+	return device
+}
+
+// interfaceWithAddr returns the local interface that has ip, nil if none
+func interfaceWithAddr(ip string) *net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.String() == ip {
+				return &ifaces[i]
+			}
+		}
+	}
+	return nil
+}
@@ -5,14 +5,22 @@ import (
 	"context"
 	"encoding/asn1"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"maps"
+	"math"
 	"net"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"crypto/tls"
@@ -26,35 +34,172 @@ var oidCommonName = asn1.ObjectIdentifier{2, 5, 4, 3}
 
 // Device represents a discovered network device
 type Device struct {
-	IPAddress    string
-	Hostname     []string          // Multiple hostnames possible
-	MDNSName     string            // mDNS discovered name
-	MDNSServices map[string]string // Map of service type to service info
-	MACAddress   string
-	Vendor       string
-	DeviceType   string
-	Interface    string
-	Status       string // For showing discovery status
-	OpenPorts    []int  // Separate ports from status
+	IPAddress     string
+	Hostname      []string          // Multiple hostnames possible
+	MDNSName      string            // mDNS discovered name
+	MDNSServices  map[string]string // Map of service type to service info
+	MACAddress    string
+	Vendor        string
+	DeviceType    string
+	Version       string // Product version reported by the device, e.g. a hypervisor release
+	Domain        string // DNS domain from the LDAP rootDSE of a directory server
+	Interface     string
+	Status        string              // For showing discovery status
+	OpenPorts     []int               // Separate ports from status
+	ClosedPorts   []int               // Probed ports that refused the connection (RST)
+	FilteredPorts []int               // Probed ports that timed out; only kept with Options.RecordFiltered
+	Notes         []string            // Non-fatal probe errors, e.g. failed hostname lookups
+	RandomMAC     bool                // MAC is locally administered, so Vendor is not a real OUI
+	AllIPs        []string            // Every address of a device merged by MAC, empty otherwise
+	Certificates  map[int]Certificate // TLS certificate presented on each open TLS port
+	Web           map[int]WebResponse // Front page response on each open plain HTTP port
+	CaptivePortal bool                // Web ports were answered by a captive portal or proxy shared with other hosts
+	VNC           *VNCInfo            // RFB handshake of a VNC server on port 5900, nil if none answered
+	Banners       map[int]string      // Greeting sent by the service on each open port that has one, e.g. FTP
+	AnonymousFTP  bool                // The FTP server accepted an anonymous login
+	Printer       *PrinterInfo        // Model and page count of an identified printer, nil otherwise
+	Role          string              // RoleSelf or RoleGateway for the scanning machine and the default gateway
+	FirstSeen     time.Time           // When the device was first found up, carried over from earlier scans
+	LastSeen      time.Time           // When the device was last found up
+	Provenance    map[string]string   `json:",omitempty"` // Signal that set each field, keyed by field name as in ProvenanceFields; only kept under Options.Explain
+}
+
+// noteMACUnresolved is the note on an up device whose MAC address could
+// not be found, dropped if the sniffer or neighbor table supplies it
+const noteMACUnresolved = "MAC address not resolved"
+
+// Notes marking how a device got into the results other than by a sweep
+const (
+	NoteDeepProbed    = "Deep probed"    // Details come from a deep probe
+	NoteAddedManually = "Added manually" // Added by hand rather than found by a sweep
+)
+
+// addNote records a non-fatal probe problem on the device, once
+func (d *Device) addNote(format string, args ...interface{}) {
+	note := fmt.Sprintf(format, args...)
+	if !slices.Contains(d.Notes, note) {
+		d.Notes = append(d.Notes, note)
+	}
+}
+
+// AddNote records note on the device unless it already has it, as when a
+// device is deep probed twice
+func (d *Device) AddNote(note string) {
+	d.addNote("%s", note)
+}
+
+// CarrySeen keeps the earlier FirstSeen of previous, the same device found
+// by an earlier scan. A different MAC at the address means a different
+// device, so its history is not carried over.
+func (d *Device) CarrySeen(previous Device) {
+	if previous.FirstSeen.IsZero() || d.FirstSeen.IsZero() {
+		return
+	}
+	if d.MACAddress != "" && previous.MACAddress != "" && d.MACAddress != previous.MACAddress {
+		return
+	}
+	if previous.FirstSeen.Before(d.FirstSeen) {
+		d.FirstSeen = previous.FirstSeen
+	}
+}
+
+// Merge fills in what d lacks from previous, the device an earlier scan
+// found at the same address, as when results accumulate across scans:
+// names, MAC, mDNS services and banners d didn't get this time are kept,
+// and so are the first-seen time and the sources of the fields kept or found
+// the same again. A different MAC means a different device, so nothing is
+// carried over.
+func (d *Device) Merge(previous Device) {
+	if d.MACAddress != "" && previous.MACAddress != "" && !strings.EqualFold(d.MACAddress, previous.MACAddress) {
+		return
+	}
+	d.mergeObserved(previous)
+	d.keepProvenance(previous)
+}
+
+// DeviceWarning reports, while the scan runs, a reachable host that could not
+// be fully characterized, e.g. a failed or timed-out protocol handshake
+type DeviceWarning struct {
+	IPAddress string
+	Message   string
+	Time      time.Time
+}
+
+// warn records a note on device and publishes it as a DeviceWarning. Warnings
+// are dropped when nobody drains the channel; the note is kept either way.
+func (s *Scanner) warn(device *Device, format string, args ...interface{}) {
+	device.addNote(format, args...)
+	warning := DeviceWarning{
+		IPAddress: device.IPAddress,
+		Message:   device.Notes[len(device.Notes)-1],
+		Time:      time.Now(),
+	}
+	select {
+	case s.warningsChan <- warning:
+	default:
+	}
+}
+
+// warnLookup notes a name lookup that found nothing. Only a lookup that
+// failed is a warning; an answer without a name is just noted.
+func (s *Scanner) warnLookup(device *Device, lookup string, err error) {
+	if err != nil {
+		s.warn(device, "%s failed: %v", lookup, err)
+		return
+	}
+	device.addNote("%s returned no name", lookup)
 }
 
 // Scanner handles network scanning operations
 type Scanner struct {
-	devices      map[string]Device
-	deviceMutex  sync.RWMutex
-	workerStats  map[int]*WorkerStatus
-	statsLock    sync.RWMutex
-	resultsChan  chan Device
-	doneChan     chan bool
-	reportFile   *os.File
-	scannedCount int32                        // IPs completed (both online and offline)
-	totalIPs     int32                        // Total number of IPs to scan
-	sentCount    int32                        // Number of IPs sent to workers
-	stopChan     chan struct{}                // Channel to signal stopping
-	mdnsNames    map[string]string            // Map of IP to mDNS names
-	mdnsServices map[string]map[string]string // Map of IP to service map
-	mdnsMutex    sync.RWMutex
-	mdnsWg       sync.WaitGroup // WaitGroup for tracking mDNS operations
+	opts            Options
+	devices         map[string]Device
+	deviceMutex     sync.RWMutex
+	workerStats     map[int]*WorkerStatus
+	statsLock       sync.RWMutex
+	resultsChan     chan Device
+	doneChan        chan bool
+	warningsChan    chan DeviceWarning
+	reportFile      *os.File
+	reportMutex     sync.Mutex
+	scannedCount    int32                        // IPs completed (both online and offline)
+	discovered      int32                        // Live hosts found
+	totalIPs        int32                        // Total number of IPs to scan
+	sentCount       int32                        // Number of IPs sent to workers
+	backpressure    int64                        // Times the results channel was full
+	dropped         int64                        // Results dropped while the channel was full
+	stopChan        chan struct{}                // Channel to signal stopping
+	stopMutex       sync.Mutex                   // Guards stopChan and finished, which each scan replaces
+	finished        chan struct{}                // Closed when the current scan has completed
+	mdnsNames       map[string]string            // Map of IP to mDNS names
+	mdnsServices    map[string]map[string]string // Map of IP to service map
+	mdnsMutex       sync.RWMutex
+	mdnsWg          sync.WaitGroup // WaitGroup for tracking mDNS operations
+	mdnsUnavailable atomic.Bool    // Multicast mDNS queries failed, e.g. port 5353 is taken
+	resolverSem     chan struct{}  // Limits concurrent protocol resolutions, nil when unlimited
+	retryIPs        []net.IP       // Down hosts waiting for a retry pass
+	retryMutex      sync.Mutex
+	ptr             *ptrPool              // Reverse DNS lookups for the current scan
+	portals         *portalTracker        // Web responses shared across hosts, for the current scan
+	throttle        *throttle             // Adaptive concurrency cap, nil unless Options.Adaptive
+	arp             *arpResult            // Replies to the ARP sweep, nil without one; set before the first host is sent to a worker
+	abortErr        error                 // Why the scan was aborted, see Err; guarded by stopMutex
+	noRouteRun      int32                 // Consecutive hosts with no route, see noteRoute
+	ptrNames        map[string][]string   // PTR names by IP, guarded by deviceMutex
+	mdnsAnswers     map[string]mdnsAnswer // mDNS lookup outcomes by IP, guarded by deviceMutex
+	kept            int                   // Live devices kept, see Options.MaxResults; guarded by deviceMutex
+	localIPs        map[string]bool       // This machine's addresses, for Device.Role
+	localNets       []*net.IPNet          // This machine's subnets, see onLink
+	targets         *Targets              // Addresses of the current scan, for observed hosts
+	unkept          map[string]bool       // Hosts counted past Options.MaxResults; guarded by deviceMutex
+	truncated       int64                 // Live hosts found past Options.MaxResults and not kept
+	publishMutex    sync.Mutex            // Makes changes to a stored device atomic; never held while sending it
+	versions        map[string]uint64     // Times each live device was stored, see deliver; guarded by deviceMutex
+	delivered       map[string]uint64     // Version of each device last sent; guarded by deviceMutex
+	sendLocks       [sendLockShards]sync.Mutex
+
+	timings atomic.Pointer[timings]   // Where the current scan's time went, see ScanStats
+	sockets atomic.Pointer[socketUse] // The current scan's share of the socket limit
 }
 
 // WorkerStatus tracks the status of each worker goroutine
@@ -67,106 +212,288 @@ type WorkerStatus struct {
 	IPsScanned int32
 	TotalIPs   int32
 	SentCount  int32 // Track IPs sent to workers
+
+	PortsProbed   int32 // Ports probed on live hosts, plus dials that failed locally
+	PortsTimedOut int32 // Of those, ports that timed out or failed locally
 }
 
 // NewScanner creates a new scanner instance
 func NewScanner(debug bool) *Scanner {
+	return NewScannerWithOptions(Options{Debug: debug})
+}
+
+// NewScannerWithOptions creates a new scanner instance with the given options
+func NewScannerWithOptions(opts Options) *Scanner {
+	opts = opts.viaProxy()
 	s := &Scanner{
+		opts:         opts,
 		devices:      make(map[string]Device),
+		ptrNames:     make(map[string][]string),
+		mdnsAnswers:  make(map[string]mdnsAnswer),
+		versions:     make(map[string]uint64),
+		delivered:    make(map[string]uint64),
+		ptr:          newPTRPool(opts.Intensity.resolverTimeoutScale()),
 		workerStats:  make(map[int]*WorkerStatus),
-		resultsChan:  make(chan Device, 100),
+		resultsChan:  make(chan Device, opts.resultsBuffer()),
 		doneChan:     make(chan bool),
+		warningsChan: make(chan DeviceWarning, opts.resultsBuffer()),
 		scannedCount: 0,
 		stopChan:     make(chan struct{}),
+		finished:     make(chan struct{}),
+	}
+	if opts.ResolverConcurrency > 0 {
+		s.resolverSem = make(chan struct{}, opts.ResolverConcurrency)
 	}
+	proxied.set(opts.SOCKS5)
+	return s
+}
 
-	if debug {
-		// Create/truncate report file only in debug mode
-		f, err := os.OpenFile("report.log", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
-		if err != nil {
-			log.Printf("Error creating report file: %v", err)
-			return nil
+// acquireResolver blocks until a protocol resolution slot is free and returns
+// the function that releases it
+func (s *Scanner) acquireResolver() func() {
+	if s.resolverSem == nil {
+		return func() {}
+	}
+	s.resolverSem <- struct{}{}
+	return func() { <-s.resolverSem }
+}
+
+// openReport creates the report file for a scan of cidr. Failures are not
+// fatal: the scan continues without a report.
+func (s *Scanner) openReport(cidr string) {
+	if !s.opts.Debug {
+		return
+	}
+
+	path := s.opts.ReportPath
+	if path == "" {
+		path = DefaultReportPath(cidr, time.Now())
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Warning: could not create report directory %s, continuing without report: %v", dir, err)
+			return
 		}
+	}
 
-		// Write header
-		fmt.Fprintf(f, "=== Scan started at %s ===\n", time.Now().Format(time.RFC3339))
-		fmt.Fprintf(f, "IP Address\tHostname\tmDNS Name\tMAC Address\tVendor\tStatus\tPorts\n")
-		s.reportFile = f
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		log.Printf("Warning: could not create report file %s, continuing without report: %v", path, err)
+		return
 	}
 
-	return s
+	// Write header
+	fmt.Fprintf(f, "=== Scan started at %s ===\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(f, "IP Address\tHostname\tmDNS Name\tMAC Address\tVendor\tStatus\tPorts\n")
+	s.reportMutex.Lock()
+	s.reportFile = f
+	s.reportMutex.Unlock()
+	log.Printf("Writing scan report to %s", path)
+}
+
+// report writes a line to the report file, doing nothing when no report is open
+func (s *Scanner) report(format string, args ...interface{}) {
+	s.reportMutex.Lock()
+	defer s.reportMutex.Unlock()
+	if s.reportFile == nil {
+		return
+	}
+	fmt.Fprintf(s.reportFile, format, args...)
 }
 
 // Close closes the scanner and its report file
 func (s *Scanner) Close() {
+	s.report("\n=== Scan completed at %s ===\n", time.Now().Format(time.RFC3339))
+
+	s.reportMutex.Lock()
+	defer s.reportMutex.Unlock()
 	if s.reportFile != nil {
-		fmt.Fprintf(s.reportFile, "\n=== Scan completed at %s ===\n", time.Now().Format(time.RFC3339))
 		s.reportFile.Close()
+		s.reportFile = nil
 	}
 }
 
-// Stop signals the scanner to stop
+// Stop signals the scanner to stop. Calling it more than once is harmless.
 func (s *Scanner) Stop() {
+	s.stopMutex.Lock()
+	defer s.stopMutex.Unlock()
+	if s.stoppedLocked() {
+		return
+	}
 	close(s.stopChan)
+	if s.throttle != nil {
+		s.throttle.wake()
+	}
+	s.report("\n=== Scan stopped at %s, results are partial ===\n", time.Now().Format(time.RFC3339))
+}
+
+// Wait blocks until the current scan's workers and mDNS lookups have
+// finished or timeout passes, and reports whether the scan finished
+func (s *Scanner) Wait(timeout time.Duration) bool {
+	finished := s.finishing()
+	if finished == nil {
+		return true // No scan was started
+	}
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 // ScanNetwork starts scanning the specified CIDR range
 func (s *Scanner) ScanNetwork(cidr string, workers int) error {
-	// Reset stop channel
-	s.stopChan = make(chan struct{})
-	// Write scan parameters to report
-	fmt.Fprintf(s.reportFile, "\nScanning network: %s with %d workers\n\n", cidr, workers)
-
 	_, ipNet, err := net.ParseCIDR(cidr)
 	if err != nil {
 		return err
 	}
+	// Report the range scanned, not the address typed in it
+	return s.scan(ipNet.String(), NewTargets(ipNet), workers)
+}
+
+// ScanTargets starts scanning every address in targets, e.g. a list of
+// ranges read with ParseTargets
+func (s *Scanner) ScanTargets(targets *Targets, workers int) error {
+	return s.scan(targets.String(), targets, workers)
+}
+
+// scan starts scanning targets, named cidr in the report and errors
+func (s *Scanner) scan(cidr string, targets *Targets, workers int) error {
+	// A passive scan sends nothing, however large the range
+	hosts := targets.Count()
+	if !s.opts.Passive {
+		if err := s.opts.CheckHosts(cidr, hosts); err != nil {
+			return err
+		}
+	}
+	if err := s.opts.CheckProxy(); err != nil {
+		return err
+	}
+	if s.opts.SOCKS5 != "" {
+		log.Printf("Connecting to hosts through the SOCKS5 proxy; ARP, MAC lookups and UDP probes are off")
+	}
 
-	ips := GetAllIPs(ipNet)
-	totalIPs := int32(len(ips))
+	// Reset stop and completion channels
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	s.stopMutex.Lock()
+	s.stopChan = stop
+	s.finished = finished
+	s.abortErr = nil
+	s.stopMutex.Unlock()
+	s.openReport(cidr)
+	// Write scan parameters to report
+	s.report("\nScanning network: %s with %d workers\n\n", cidr, workers)
+
+	totalIPs := int32(math.MaxInt32)
+	if hosts < math.MaxInt32 {
+		totalIPs = int32(hosts)
+	}
 	atomic.StoreInt32(&s.totalIPs, totalIPs)
 	atomic.StoreInt32(&s.scannedCount, 0) // Reset counter
 	atomic.StoreInt32(&s.sentCount, 0)    // Reset sent counter
-
+	atomic.StoreInt32(&s.discovered, 0)
+	atomic.StoreInt32(&s.noRouteRun, 0)
+	atomic.StoreInt64(&s.backpressure, 0)
+	atomic.StoreInt64(&s.dropped, 0)
+	atomic.StoreInt64(&s.truncated, 0)
+	s.timings.Store(newTimings(cidr))
+
+	s.localIPs = localAddrs()
+	s.localNets = localNetworks()
+	s.targets = targets
 	s.deviceMutex.Lock()
 	s.devices = make(map[string]Device)
+	s.kept = 0
+	s.unkept = make(map[string]bool)
+	s.ptrNames = make(map[string][]string)
+	s.mdnsAnswers = make(map[string]mdnsAnswer)
+	s.versions = make(map[string]uint64)
+	s.delivered = make(map[string]uint64)
 	s.deviceMutex.Unlock()
+	s.ptr = newPTRPool(s.opts.Intensity.resolverTimeoutScale())
+	s.portals = newPortalTracker()
+	s.throttle = nil
+	s.arp = nil
+	if s.opts.Adaptive {
+		s.throttle = newThrottle(workers, s.portTotals)
+	}
+	s.takeRetries()
+	maxSockets := s.opts.maxSockets()
+	sockets.setLimit(maxSockets, s.opts.MaxSockets == 0)
+	s.sockets.Store(newSocketUse(stop))
+	if maxSockets > 0 {
+		log.Printf("Allowing %d connections open at once", maxSockets)
+	}
 
-	workChan := make(chan net.IP, len(ips))
+	if s.opts.Passive {
+		if s.opts.Observer != nil {
+			go s.observeProgress(finished)
+		}
+		go s.scanPassive(targets, finished)
+		return nil
+	}
 
-	// Start workers
-	var wg sync.WaitGroup
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		workerID := i
+	stopSniffer := s.startSniffer()
 
-		s.statsLock.Lock()
-		s.workerStats[workerID] = &WorkerStatus{
-			StartTime: time.Now(),
-			State:     "starting",
-			CurrentIP: "waiting",
-			LastSeen:  time.Now(),
-			TotalIPs:  totalIPs,
-		}
-		s.statsLock.Unlock()
+	// A small buffer keeps workers busy while memory stays flat however
+	// large the range is
+	workChan := make(chan net.IP, workers*2)
 
-		go s.worker(workerID, workChan, &wg)
+	// Start workers
+	var wg sync.WaitGroup
+	s.startWorkers(workers, workChan, &wg, 0)
+
+	// Feed IPs to workers as they are generated, any priority addresses
+	// first
+	priority := s.opts.priorityIPs(targets)
+	prioritized := make(map[string]bool, len(priority))
+	for _, ip := range priority {
+		prioritized[ip.String()] = true
+	}
+	if len(priority) > 0 {
+		log.Printf("Probing %v ahead of the sweep", priority)
 	}
-
-	// Feed IPs to workers
 	go func() {
-		for _, ip := range ips {
+		defer close(workChan)
+		// The workers wait on the ARP sweep, which settles which on-link
+		// hosts are worth probing
+		if s.opts.ARPScan {
+			s.arp = s.sweepARP(targets)
+		}
+		send := func(ip net.IP) bool {
 			select {
-			case <-s.stopChan:
-				close(workChan)
-				return
+			case <-stop:
+				return false
 			case workChan <- ip:
 				atomic.AddInt32(&s.sentCount, 1)
+				return true
+			}
+		}
+		for _, ip := range priority {
+			if !send(ip) {
+				return
 			}
 		}
-		close(workChan)
+		iterate := targets.iterate
+		if s.opts.Randomize {
+			iterate = targets.iterateRandom
+		}
+		iterate(func(ip net.IP) bool {
+			if len(prioritized) > 0 && prioritized[ip.String()] {
+				return true
+			}
+			return send(ip)
+		})
 	}()
 
+	if s.opts.Observer != nil {
+		go s.observeProgress(finished)
+	}
+	go s.watchNetwork(targets, finished)
+
 	// Wait for completion in a goroutine
 	go func() {
 		log.Printf("Starting scan completion wait routine")
@@ -182,19 +509,217 @@ func (s *Scanner) ScanNetwork(cidr string, workers int) error {
 			atomic.AddInt32(&s.scannedCount, remaining)
 		}
 
+		// Re-probe hosts that looked down, with longer timeouts on each pass
+		// and a growing pause before it, so a congested link or a rate
+		// limit has time to clear
+		for attempt := 1; attempt <= s.opts.Retries; attempt++ {
+			retryIPs := s.takeRetries()
+			if len(retryIPs) == 0 || s.stopped() {
+				break
+			}
+			delay := retryBackoff(attempt)
+			log.Printf("Waiting %s before retry pass %d", delay, attempt)
+			select {
+			case <-stop:
+			case <-time.After(delay):
+			}
+			if s.stopped() {
+				break
+			}
+			log.Printf("Retry pass %d: re-probing %d down hosts", attempt, len(retryIPs))
+			s.report("\nRetry pass %d: re-probing %d down hosts\n", attempt, len(retryIPs))
+
+			retryChan := make(chan net.IP, workers*2)
+			go func() {
+				defer close(retryChan)
+				for _, ip := range retryIPs {
+					select {
+					case <-stop:
+						return
+					case retryChan <- ip:
+					}
+				}
+			}()
+
+			var retryWg sync.WaitGroup
+			s.startWorkers(min(workers, len(retryIPs)), retryChan, &retryWg, attempt)
+			retryWg.Wait()
+		}
+
 		// Now wait for all mDNS operations to complete
 		log.Printf("Workers complete, waiting for mDNS operations to finish...")
 		s.mdnsWg.Wait()
 		log.Printf("All mDNS operations complete")
 
-		log.Printf("Scan completion routine finished, sending done signal")
-		s.doneChan <- true
+		// Late PTR answers still update devices, so the scan isn't done
+		// until they are in
+		s.ptr.wait()
+		stopSniffer()
+
+		s.complete(finished)
 	}()
 
 	return nil
 }
 
-func (s *Scanner) worker(id int, workChan chan net.IP, wg *sync.WaitGroup) {
+// complete logs the health of the finished scan and signals its completion
+// to the observer or GetResults
+func (s *Scanner) complete(finished chan struct{}) {
+	s.timing().finish()
+	if stats := s.Stats(); stats.Backpressure > 0 {
+		log.Printf("Results channel was full %d times (%d results dropped, still in the stored devices); consider a larger results buffer",
+			stats.Backpressure, stats.Dropped)
+		s.report("\nResults channel was full %d times (%d results dropped)\n", stats.Backpressure, stats.Dropped)
+	}
+	if stats := s.Stats(); stats.SocketWaits > 0 {
+		log.Printf("%d connections waited for a socket slot; the socket limit slowed the scan", stats.SocketWaits)
+		s.report("\n%d connections waited for a socket slot\n", stats.SocketWaits)
+	}
+
+	if s.opts.Observer != nil {
+		s.reportProgress()
+		s.opts.Observer.OnComplete(s.Stats())
+		log.Printf("Scan completion routine finished")
+		close(finished)
+		return
+	}
+
+	log.Printf("Scan completion routine finished, sending done signal")
+	close(finished)
+	s.doneChan <- true
+}
+
+// ScanHost probes a single address, e.g. a documented host the sweep
+// missed, and returns its device with Status "Down" if nothing answered. It
+// runs a scan of its own, so it must not be called while ScanNetwork is
+// running on the same Scanner.
+func (s *Scanner) ScanHost(ip string) (Device, error) {
+	parsed := net.ParseIP(strings.TrimSpace(ip)).To4()
+	if parsed == nil {
+		return Device{}, fmt.Errorf("invalid IPv4 address %q", ip)
+	}
+	ipStr := parsed.String()
+	if err := s.ScanNetwork(ipStr+"/32", 1); err != nil {
+		return Device{}, err
+	}
+
+	// The device map has the final result, including a Down entry, so the
+	// channels only need draining
+	if s.opts.Observer != nil {
+		<-s.finishing()
+	} else {
+		resultsChan, doneChan := s.GetResults()
+		for done := false; !done; {
+			select {
+			case <-resultsChan:
+			case <-doneChan:
+				done = true
+			}
+		}
+	}
+
+	s.deviceMutex.RLock()
+	device, ok := s.devices[ipStr]
+	s.deviceMutex.RUnlock()
+	if !ok {
+		device = Device{IPAddress: ipStr, Status: "Down"} // Stopped before the probe
+	}
+	return device, nil
+}
+
+// startWorkers launches workers that drain workChan, registering their stats
+func (s *Scanner) startWorkers(workers int, workChan chan net.IP, wg *sync.WaitGroup, attempt int) {
+	totalIPs := atomic.LoadInt32(&s.totalIPs)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		workerID := i
+
+		s.statsLock.Lock()
+		s.workerStats[workerID] = &WorkerStatus{
+			StartTime: time.Now(),
+			State:     "starting",
+			CurrentIP: "waiting",
+			LastSeen:  time.Now(),
+			TotalIPs:  totalIPs,
+		}
+		s.statsLock.Unlock()
+
+		go s.worker(workerID, workChan, wg, attempt)
+	}
+}
+
+// stopped reports whether Stop has been called for the current scan
+func (s *Scanner) stopped() bool {
+	select {
+	case <-s.stopping():
+		return true
+	default:
+		return false
+	}
+}
+
+// stoppedLocked is stopped for callers holding stopMutex
+func (s *Scanner) stoppedLocked() bool {
+	select {
+	case <-s.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopping returns the stop channel of the current scan, which is closed
+// when it is stopped. A new scan replaces it, so it is read under stopMutex.
+func (s *Scanner) stopping() <-chan struct{} {
+	s.stopMutex.Lock()
+	defer s.stopMutex.Unlock()
+	return s.stopChan
+}
+
+// finishing returns the channel closed when the current scan has completed,
+// nil before the first scan
+func (s *Scanner) finishing() <-chan struct{} {
+	s.stopMutex.Lock()
+	defer s.stopMutex.Unlock()
+	return s.finished
+}
+
+// retryBackoffBase and retryBackoffMax bound the pause before each retry
+// pass, which doubles from one pass to the next
+const (
+	retryBackoffBase = 2 * time.Second
+	retryBackoffMax  = 30 * time.Second
+)
+
+// retryBackoff returns the pause before retry pass attempt, counted from 1
+func retryBackoff(attempt int) time.Duration {
+	delay := retryBackoffBase
+	for i := 1; i < attempt && delay < retryBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > retryBackoffMax {
+		return retryBackoffMax
+	}
+	return delay
+}
+
+// queueRetry records a down host for another probe after the main sweep
+func (s *Scanner) queueRetry(ip net.IP) {
+	s.retryMutex.Lock()
+	s.retryIPs = append(s.retryIPs, ip)
+	s.retryMutex.Unlock()
+}
+
+// takeRetries returns and clears the hosts queued for another probe
+func (s *Scanner) takeRetries() []net.IP {
+	s.retryMutex.Lock()
+	defer s.retryMutex.Unlock()
+	ips := s.retryIPs
+	s.retryIPs = nil
+	return ips
+}
+
+func (s *Scanner) worker(id int, workChan chan net.IP, wg *sync.WaitGroup, attempt int) {
 	defer wg.Done()
 	defer func() {
 		s.statsLock.Lock()
@@ -202,233 +727,857 @@ func (s *Scanner) worker(id int, workChan chan net.IP, wg *sync.WaitGroup) {
 		s.statsLock.Unlock()
 	}()
 
+	stop := s.stopping()
 	for ip := range workChan {
 		select {
-		case <-s.stopChan:
+		case <-stop:
 			return
 		default:
-			ipStr := ip.String()
-			var mdnsWait sync.WaitGroup
-
-			s.statsLock.Lock()
-			if stat := s.workerStats[id]; stat != nil {
-				stat.CurrentIP = ipStr
-				stat.LastSeen = time.Now()
-				stat.State = "scanning"
+			s.scanIP(id, ip, attempt)
+		}
+	}
+}
+
+// scanIP probes a single address. attempt is 0 for the main sweep and counts
+// up for each retry pass over hosts that were down.
+func (s *Scanner) scanIP(id int, ip net.IP, attempt int) {
+
+	ipStr := ip.String()
+
+	s.statsLock.Lock()
+	if stat := s.workerStats[id]; stat != nil {
+		stat.CurrentIP = ipStr
+		stat.LastSeen = time.Now()
+		stat.State = "scanning"
+	}
+	s.statsLock.Unlock()
+
+	if s.opts.SkipSelf && s.localIPs[ipStr] {
+		log.Printf("Not probing %s, an address of this machine", ipStr)
+		if attempt == 0 {
+			s.store(s.selfDevice(ipStr))
+		}
+		s.countScanned(id, ipStr, attempt)
+		return
+	}
+	opts := s.opts
+	if s.localIPs[ipStr] && len(opts.SelfPorts) > 0 {
+		opts.Ports = slices.DeleteFunc(slices.Clone(opts.ports()), func(port int) bool {
+			return slices.Contains(opts.SelfPorts, port)
+		})
+	}
+
+	// Every dial to the host is bound to ctx, which SkipWorker cancels
+	ctx, done := hostProbes.begin(ipStr, s.sockets.Load())
+	defer done()
+	defer s.timing().host(ipStr, time.Now())
+
+	// An on-link host that didn't answer the ARP sweep is down without
+	// waiting out the port probes; one that did is up whatever they find
+	var probe portProbe
+	onLink := s.onLink(ip)
+	if !onLink {
+		log.Printf("%s is routed, not looking up its MAC", ipStr)
+	}
+	arpMAC, swept := s.arp.reply(ip)
+	silent := swept && arpMAC == ""
+	if silent {
+		log.Printf("No ARP reply from %s, not probing it", ipStr)
+	} else {
+		// Under adaptive throttling only the probe waits for a slot; name
+		// resolution has its own limit
+		if s.throttle != nil {
+			waited := false
+			if !s.throttle.acquire(s.stopped, func() { waited = true; s.setWorkerState(id, "throttled") }) {
+				return
 			}
-			s.statsLock.Unlock()
+			if waited {
+				s.setWorkerState(id, "scanning")
+			}
+		}
+		reachStart := time.Now()
+		probe = isReachable(ipStr, (attempt+1)*opts.timeoutScale(), opts, onLink)
+		s.timing().resolved(PhaseReachability, reachStart, probe.reachable())
+		s.recordProbe(id, probe)
+		if s.throttle != nil {
+			s.throttle.release()
+		}
+		s.noteRoute(probe, len(s.opts.ports()))
+		if probe.mac == "" {
+			probe.mac = arpMAC
+		}
+	}
 
-			if reachable, openPorts := IsReachable(ipStr); reachable {
-				device := Device{
-					IPAddress: ipStr,
-					Status:    "Up",
-					OpenPorts: openPorts,
-				}
+	if probe.reachable() {
+		mac := probe.mac
+		now := time.Now()
+		device := Device{
+			IPAddress:   ipStr,
+			Status:      "Up",
+			OpenPorts:   probe.open,
+			ClosedPorts: probe.closed,
+			FirstSeen:   now,
+			LastSeen:    now,
+			Role:        s.role(ipStr),
+		}
+		if s.opts.RecordFiltered {
+			device.FilteredPorts = probe.filtered
+		}
+		s.explaining(&device)
+		macSource := "Neighbor table after the port probes"
+		if mac != "" && mac == arpMAC {
+			macSource = "Reply to the ARP sweep"
+		}
 
-				// Try to get MAC address - retry a few times if needed
-				for i := 0; i < 3; i++ {
-					if mac := GetMACFromIP(ipStr); mac != "" {
-						device.MACAddress = mac
-						device.Vendor = LookupVendor(mac)
-						// Check if it's a Mac based on vendor
-						if strings.Contains(strings.ToLower(device.Vendor), "apple") {
-							log.Printf("DEBUG: Detected Apple device at %s based on MAC vendor", ipStr)
-							device.DeviceType = "Apple"
-						}
-						break
-					}
-					time.Sleep(time.Millisecond * 100) // Brief pause between retries
-				}
+		// The ARP reply can trail the port probes, so re-read the table a few
+		// times before giving up; connect-only scans take what they got, and
+		// a routed host has no MAC to wait for
+		if mac == "" && !s.opts.ConnectOnly && onLink {
+			macStart := time.Now()
+			for i := 0; i < 3 && mac == ""; i++ {
+				time.Sleep(time.Millisecond * 100)
+				mac = lookupMAC(ipStr)
+			}
+			macSource = "Neighbor table, re-read after the port probes"
+			s.timing().resolved(PhaseMAC, macStart, mac != "")
+		}
+		if mac != "" {
+			device.MACAddress = mac
+			device.Vendor = LookupVendor(mac)
+			device.RandomMAC = IsLocallyAdministered(mac)
+			device.explainMAC(macSource)
+			// Check if it's a Mac based on vendor
+			if strings.Contains(strings.ToLower(device.Vendor), "apple") {
+				log.Printf("DEBUG: Detected Apple device at %s based on MAC vendor", ipStr)
+				device.DeviceType = "Apple"
+				device.explain(FieldDeviceType, "MAC vendor: %s", device.Vendor)
+			}
+		}
+		if device.MACAddress == "" && onLink {
+			device.addNote(noteMACUnresolved)
+		}
 
-				// Add any mDNS info from our pre-sweep
-				if mdnsName, mdnsServices := s.getMDNSInfo(ipStr); mdnsName != "" {
-					device.MDNSName = mdnsName
-					device.MDNSServices = mdnsServices
-					log.Printf("DEBUG: Using pre-collected mDNS for %s - Name: %s, Services: %v",
-						ipStr, mdnsName, mdnsServices)
-
-					// Check for Apple-specific mDNS services
-					for service := range mdnsServices {
-						if strings.Contains(service, "apple") ||
-							strings.Contains(service, "airport") ||
-							strings.Contains(service, "airplay") ||
-							strings.Contains(service, "homekit") {
-							log.Printf("DEBUG: Detected Apple device at %s based on mDNS service: %s", ipStr, service)
-							device.DeviceType = "Apple"
-							break
-						}
-					}
+		// Add any mDNS info from our pre-sweep
+		if mdnsName, mdnsServices := s.getMDNSInfo(ipStr); mdnsName != "" {
+			device.MDNSName = mdnsName
+			device.MDNSServices = mdnsServices
+			device.explain(FieldMDNSName, "mDNS sweep before the scan")
+			log.Printf("DEBUG: Using pre-collected mDNS for %s - Name: %s, Services: %v",
+				ipStr, mdnsName, mdnsServices)
+
+			// Check for Apple-specific mDNS services
+			for service := range mdnsServices {
+				if strings.Contains(service, "apple") ||
+					strings.Contains(service, "airport") ||
+					strings.Contains(service, "airplay") ||
+					strings.Contains(service, "homekit") {
+					log.Printf("DEBUG: Detected Apple device at %s based on mDNS service: %s", ipStr, service)
+					device.DeviceType = "Apple"
+					device.explain(FieldDeviceType, "Apple mDNS service %s", service)
+					break
 				}
+			}
+		}
 
-				// Try DNS lookup first
-				if names, err := net.LookupAddr(ipStr); err == nil && len(names) > 0 {
-					device.Hostname = names
-					log.Printf("DNS hostname found for %s: %v", ipStr, names)
-				} else {
-					// Try protocol-specific resolution methods
-					if contains(openPorts, 548) {
-						log.Printf("DNS lookup failed for %s, trying AFP resolution", ipStr)
-						if afpHostname, err := getAFPHostname(ipStr); err == nil && afpHostname != "" {
-							device.Hostname = []string{afpHostname}
-							device.DeviceType = "Apple" // AFP is specific to Apple
-							log.Printf("Got AFP hostname for %s: %s", ipStr, afpHostname)
-						} else {
-							log.Printf("AFP hostname resolution failed for %s: %v", ipStr, err)
-						}
-					}
+		if ctx.Err() != nil {
+			s.storeSkipped(device)
+			s.countScanned(id, ipStr, attempt)
+			return
+		}
 
-					// Try other protocols if still no hostname
-					if len(device.Hostname) == 0 {
-						if len(device.Hostname) == 0 && contains(openPorts, 445) {
-							log.Printf("Trying NetBIOS/SMB resolution for %s", ipStr)
-							if nbName, err := getNetBIOSName(ipStr); err == nil && nbName != "" {
-								device.Hostname = []string{nbName}
-								log.Printf("Got NetBIOS name for %s: %s", ipStr, nbName)
-							} else if smbHostname, err := getSMBHostname(ipStr); err == nil && smbHostname != "" {
-								device.Hostname = []string{smbHostname}
-								log.Printf("Got SMB hostname for %s: %s", ipStr, smbHostname)
-							}
-						}
+		// Certificates on TLS ports are recorded and directory servers
+		// identified. When reverse DNS comes up empty a domain controller's
+		// own name is used; a certificate's only once the protocol lookups
+		// have found nothing, since appliances often ship generic ones.
+		var certName, certSource, directoryName string
+		var portalIPs []string
+		handshakes := !s.opts.ConnectOnly && s.opts.Intensity != IntensityLow
+		if handshakes {
+			certName, certSource = s.collectCertificates(&device)
+			portalIPs = s.probeWeb(&device)
+			s.probeVNC(&device)
+			s.probeFTP(&device)
+			s.probeTelnet(&device)
+		}
+		noteCleartext(&device)
+		directoryName = s.identifyDirectory(&device, handshakes)
 
-						if len(device.Hostname) == 0 && contains(openPorts, 3389) {
-							log.Printf("Trying RDP resolution for %s", ipStr)
-							if rdpHostname, err := getRDPHostname(ipStr); err == nil && rdpHostname != "" {
-								device.Hostname = []string{rdpHostname}
-								log.Printf("Got RDP hostname for %s: %s", ipStr, rdpHostname)
-							}
-						}
+		if ctx.Err() != nil {
+			s.storeSkipped(device)
+			s.countScanned(id, ipStr, attempt)
+			return
+		}
 
-						// Only try mDNS if we still don't have a hostname and it's likely an Apple device
-						if len(device.Hostname) == 0 && (device.DeviceType == "Apple" || device.DeviceType == "Possible Apple" ||
-							contains(openPorts, 5353) || // mDNS port
-							contains(openPorts, 5000) || // AirPlay
-							contains(openPorts, 7000)) { // AirPlay alternate
-							log.Printf("No hostname found via other methods, initiating mDNS resolution for %s (worker %d)", ipStr, id)
-							mdnsWait.Add(1)
-							go func() {
-								defer func() {
-									mdnsWait.Done()
-									log.Printf("Local mDNS wait completed for %s (worker %d)", ipStr, id)
-								}()
-
-								if bonjourHostname, err := getBonjourHostname(s, ipStr); err == nil && bonjourHostname != "" {
-									s.deviceMutex.Lock()
-									device.Hostname = []string{bonjourHostname}
-									// Check if it's an Apple device based on the service type
-									if device.DeviceType == "" {
-										device.DeviceType = "Possible Apple"
-									}
-									s.deviceMutex.Unlock()
-									log.Printf("Successfully resolved mDNS hostname for %s: %s (worker %d)", ipStr, bonjourHostname, id)
-								} else {
-									log.Printf("mDNS resolution failed for %s: %v (worker %d)", ipStr, err, id)
-								}
-							}()
-						} else if len(device.Hostname) > 0 {
-							log.Printf("Skipping mDNS resolution for %s - hostname already found via other methods", ipStr)
-						}
-					}
+		// Try DNS first. The lookup runs in the PTR pool; a quick answer
+		// saves the protocol lookups, and a slow one fills the name in later.
+		// So does mDNS, which runs in the background and updates the stored
+		// device when it answers.
+		var tryMDNS bool
+		if names, answered, err := s.lookupPTR(ipStr); answered && len(names) > 0 {
+			device.Hostname = names
+			device.explainHostname(sourcePTR)
+			log.Printf("DNS hostname found for %s: %v", ipStr, names)
+			if s.opts.PreferMDNS && s.opts.Intensity != IntensityLow && poorHostname(names[0], ipStr) {
+				log.Printf("DNS name %s for %s looks generated, trying mDNS", names[0], ipStr)
+				tryMDNS = true
+			}
+		} else {
+			if err != nil {
+				device.addNote("Reverse DNS lookup failed: %v", err)
+			}
+			if directoryName != "" {
+				device.Hostname = []string{directoryName}
+				device.explain(FieldHostname, "dnsHostName in the LDAP rootDSE")
+				log.Printf("LDAP hostname found for %s: %s", ipStr, directoryName)
+			} else {
+				tryMDNS = s.resolveHostname(ipStr, &device, device.OpenPorts)
+				if len(device.Hostname) == 0 && certName != "" {
+					device.Hostname = []string{certName}
+					device.explain(FieldHostname, "%s", certSource)
+					log.Printf("Certificate hostname found for %s: %s", ipStr, certName)
 				}
+			}
+		}
+		if tryMDNS {
+			log.Printf("Starting mDNS resolution for %s (worker %d)", ipStr, id)
+			s.lookupMDNS(ipStr, func(answer mdnsAnswer) {
+				s.updateMDNS(ipStr, answer)
+			})
+		}
 
-				// Check for Mac-specific ports as additional identifier
-				if contains(openPorts, 548) || // AFP
-					contains(openPorts, 5353) || // mDNS
-					contains(openPorts, 5000) || // AirPlay
-					contains(openPorts, 7000) || // AirPlay alternate
-					contains(openPorts, 3689) { // iTunes sharing
-					if device.DeviceType == "" {
-						device.DeviceType = "Possible Apple"
-						log.Printf("DEBUG: Marked %s as possible Apple device based on open ports", ipStr)
-					}
+		// Check for Mac-specific ports as additional identifier
+		if contains(device.OpenPorts, 548) || // AFP
+			contains(device.OpenPorts, 5353) || // mDNS
+			contains(device.OpenPorts, 5000) || // AirPlay
+			contains(device.OpenPorts, 7000) || // AirPlay alternate
+			contains(device.OpenPorts, 3689) { // iTunes sharing
+			if device.DeviceType == "" {
+				device.DeviceType = "Possible Apple"
+				device.explain(FieldDeviceType, "Open Apple service port (AFP, mDNS, AirPlay or iTunes sharing)")
+				log.Printf("DEBUG: Marked %s as possible Apple device based on open ports", ipStr)
+			}
+		}
+
+		s.identifyPrinter(&device, handshakes)
+
+		// Hypervisors are the most valuable thing to find, so their type
+		// overrides the guesses above
+		if !s.opts.ConnectOnly && s.opts.Intensity != IntensityLow &&
+			(contains(device.OpenPorts, 8006) || contains(device.OpenPorts, 443)) {
+			release := s.acquireResolver()
+			start := time.Now()
+			deviceType, version := detectHypervisor(ipStr, device.OpenPorts, s.opts.UserAgent, s.opts.Intensity.resolverTimeoutScale())
+			release()
+			s.timing().resolved(PhaseHypervisor, start, deviceType != "")
+			if deviceType != "" {
+				device.DeviceType = deviceType
+				device.Version = version
+				device.explain(FieldDeviceType, "Hypervisor web API fingerprint")
+				if version != "" {
+					device.explain(FieldVersion, "Hypervisor web API fingerprint")
 				}
+			}
+		}
 
-				// Wait for mDNS resolution to complete before proceeding
-				log.Printf("Waiting for mDNS operations to complete for %s (worker %d)", ipStr, id)
-				mdnsWait.Wait()
-				log.Printf("All mDNS operations completed for %s (worker %d)", ipStr, id)
+		s.statsLock.Lock()
+		if stat := s.workerStats[id]; stat != nil {
+			atomic.AddInt32(&stat.IPsFound, 1)
+		}
+		s.statsLock.Unlock()
 
-				s.statsLock.Lock()
-				if stat := s.workerStats[id]; stat != nil {
-					atomic.AddInt32(&stat.IPsFound, 1)
-				}
-				s.statsLock.Unlock()
+		if ctx.Err() != nil {
+			s.storeSkipped(device)
+		} else {
+			s.store(device)
+		}
 
-				// Store device in map
-				s.deviceMutex.Lock()
+		// Hosts that answered like this one before it are portal victims too
+		s.flagPortal(portalIPs)
+	} else {
+		if attempt == 0 && !s.opts.SkipOffline {
+			// Store offline device
+			device := Device{
+				IPAddress: ipStr,
+				Status:    "Down",
+			}
+			if ctx.Err() != nil {
+				device.addNote(noteSkipped)
+			}
+			// A host the sniffer or a listener already saw stays up
+			s.deviceMutex.Lock()
+			if previous, ok := s.devices[ipStr]; !ok || previous.Status != "Up" {
 				s.devices[ipStr] = device
-				s.deviceMutex.Unlock()
+			}
+			s.deviceMutex.Unlock()
+		}
+		if attempt < s.opts.Retries && !silent && ctx.Err() == nil {
+			s.queueRetry(ip)
+		}
+	}
 
-				// Write to report file
-				hostnames := "N/A"
-				if len(device.Hostname) > 0 {
-					hostnames = strings.Join(device.Hostname, ",")
-				}
+	s.countScanned(id, ipStr, attempt)
+}
 
-				// Format mDNS services for logging
-				var mdnsInfo string
-				if device.MDNSName != "" {
-					mdnsInfo = device.MDNSName
-					if len(device.MDNSServices) > 0 {
-						var services []string
-						for svcType, svcInfo := range device.MDNSServices {
-							services = append(services, fmt.Sprintf("%s: %s", svcType, svcInfo))
-						}
-						mdnsInfo += fmt.Sprintf(" (Services: %s)", strings.Join(services, ", "))
-					}
-				} else {
-					mdnsInfo = "No mDNS"
-				}
+// setWorkerState sets the state worker id reports in its stats
+func (s *Scanner) setWorkerState(id int, state string) {
+	s.statsLock.Lock()
+	if stat := s.workerStats[id]; stat != nil {
+		stat.State = state
+	}
+	s.statsLock.Unlock()
+}
 
-				log.Printf("Found device: %s (MAC: %s, Vendor: %s, mDNS: %s, Ports: %v)",
-					ipStr, device.MACAddress, device.Vendor, mdnsInfo, device.OpenPorts)
-				fmt.Fprintf(s.reportFile, "%s\t%s\t%s\t%s\t%s\t%s\t%v\n",
-					device.IPAddress,
-					hostnames,
-					device.MDNSName,
-					device.MACAddress,
-					device.Vendor,
-					device.Status,
-					device.OpenPorts)
-
-				select {
-				case s.resultsChan <- device:
-					log.Printf("Sent device %s to results channel", ipStr)
-				default:
-					log.Printf("Warning: Results channel full, skipping device %s", ipStr)
-				}
+// recordProbe adds the ports probing a host tried to worker id's stats.
+// Only live hosts' ports count, since most of a sweep is empty address space
+// where every probe times out, along with dials that failed locally.
+func (s *Scanner) recordProbe(id int, probe portProbe) {
+	probed, timedOut := probe.failed, probe.failed
+	if probe.reachable() {
+		probed += len(probe.open) + len(probe.closed) + len(probe.filtered)
+		timedOut += len(probe.filtered)
+	}
+	s.statsLock.Lock()
+	if stat := s.workerStats[id]; stat != nil {
+		stat.PortsProbed += int32(probed)
+		stat.PortsTimedOut += int32(timedOut)
+	}
+	s.statsLock.Unlock()
+}
+
+// portTotals sums the ports probed and timed out across the workers
+func (s *Scanner) portTotals() (probed, timedOut int) {
+	s.statsLock.RLock()
+	defer s.statsLock.RUnlock()
+	for _, stat := range s.workerStats {
+		probed += int(stat.PortsProbed)
+		timedOut += int(stat.PortsTimedOut)
+	}
+	return probed, timedOut
+}
+
+// countScanned counts ipStr as scanned once scanIP is done with it
+func (s *Scanner) countScanned(id int, ipStr string, attempt int) {
+	// Only increment the scan counter after all probes and lookups except
+	// mDNS, which the scan waits for at the end, are complete.
+	// Retry passes revisit hosts that were already counted.
+	if attempt == 0 {
+		atomic.AddInt32(&s.scannedCount, 1)
+	}
+	log.Printf("Completed all operations for %s (worker %d, scanned: %d/%d)",
+		ipStr, id, atomic.LoadInt32(&s.scannedCount), atomic.LoadInt32(&s.totalIPs))
+
+	// Update worker stats with completed count
+	s.statsLock.Lock()
+	if stat := s.workerStats[id]; stat != nil {
+		atomic.StoreInt32(&stat.IPsScanned, atomic.LoadInt32(&s.scannedCount))
+		atomic.StoreInt32(&stat.TotalIPs, atomic.LoadInt32(&s.totalIPs))
+		atomic.StoreInt32(&stat.SentCount, atomic.LoadInt32(&s.sentCount))
+	}
+	s.statsLock.Unlock()
+}
+
+// store records a live device in the device map, taking any PTR answer that
+// came in meanwhile, and publishes it. It reports false when
+// Options.MaxResults was reached and the device was counted but not kept.
+func (s *Scanner) store(device Device) bool {
+	s.publishMutex.Lock()
+	device, keep := s.storeLocked(device)
+	s.publishMutex.Unlock()
+	if keep {
+		s.publish(device)
+	}
+	return keep
+}
+
+// sendLockShards is how many locks the sends of all addresses are spread
+// over, see deliver
+const sendLockShards = 64
+
+// keepLocked puts device in the device map as its next version, for deliver
+// to send. The caller holds deviceMutex.
+func (s *Scanner) keepLocked(device Device) {
+	s.devices[device.IPAddress] = device
+	s.versions[device.IPAddress]++
+}
+
+// deliver sends the device stored at ip unless that version was already
+// sent. Changes to a device are made under publishMutex and delivered after
+// it is released, so a slow consumer holds up only the sends of addresses
+// sharing a lock with it; the lock keeps an older copy of a device from
+// overtaking a newer one, such as its first result a late PTR update.
+func (s *Scanner) deliver(ip string) {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	lock := &s.sendLocks[h.Sum32()%sendLockShards]
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.deviceMutex.Lock()
+	device, version := s.devices[ip], s.versions[ip]
+	fresh := version > s.delivered[ip]
+	s.delivered[ip] = version
+	s.deviceMutex.Unlock()
+	if fresh {
+		s.sendResult(device)
+	}
+}
+
+// storeLocked puts device in the device map for store, returning it as
+// stored and whether it was kept. The caller holds publishMutex and
+// publishes the device once it has released it.
+func (s *Scanner) storeLocked(device Device) (Device, bool) {
+	s.deviceMutex.Lock()
+	if answer, ok := s.mdnsAnswers[device.IPAddress]; ok {
+		s.applyMDNS(&device, answer)
+	}
+	if names := s.ptrNames[device.IPAddress]; len(names) > 0 {
+		device.Hostname = s.opts.withMDNSName(names, device.MDNSName, device.IPAddress)
+		device.explainHostname(sourcePTR)
+	}
+	if s.portals.isFlagged(device.IPAddress) {
+		markPortal(&device)
+	}
+	if s.unkept[device.IPAddress] {
+		// Already counted past Options.MaxResults
+		s.deviceMutex.Unlock()
+		return device, false
+	}
+	// Past Options.MaxResults new hosts are counted but not kept
+	previous, ok := s.devices[device.IPAddress]
+	found := !ok || previous.Status != "Up"
+	if !found {
+		device.mergeObserved(previous)
+	}
+	keep := !found || s.opts.MaxResults <= 0 || s.kept < s.opts.MaxResults
+	if found {
+		atomic.AddInt32(&s.discovered, 1)
+	}
+	if keep {
+		if found {
+			s.kept++
+		}
+		s.keepLocked(device)
+	} else {
+		s.unkept[device.IPAddress] = true
+	}
+	s.deviceMutex.Unlock()
+
+	if !keep && atomic.AddInt64(&s.truncated, 1) == 1 {
+		log.Printf("Result cap of %d reached at %s; further hosts are counted but not kept", s.opts.MaxResults, device.IPAddress)
+		s.report("\nResults truncated at %d devices\n", s.opts.MaxResults)
+	}
+	return device, keep
+}
+
+// sourcePTR is the provenance of a name from reverse DNS
+const sourcePTR = "Reverse DNS (PTR record)"
+
+// ptrGrace is how long a worker waits for reverse DNS before falling back to
+// the protocol lookups; the answer is still used if it comes later
+const ptrGrace = 300 * time.Millisecond
+
+// lookupPTR queues a reverse DNS lookup of ip and waits up to ptrGrace for
+// it. answered is false when the lookup was skipped or is still running; a
+// late answer is applied by updatePTR.
+func (s *Scanner) lookupPTR(ip string) (names []string, answered bool, err error) {
+	type answer struct {
+		names []string
+		err   error
+	}
+	result := make(chan answer, 1)
+	start := time.Now()
+	queued := s.ptr.lookup(ip, s.stopping(), func(names []string, err error) {
+		s.timing().resolved(PhaseDNS, start, len(names) > 0)
+		if len(names) > 0 {
+			s.updatePTR(ip, names)
+		}
+		result <- answer{names, err}
+	})
+	if !queued {
+		return nil, false, nil
+	}
+
+	select {
+	case a := <-result:
+		return a.names, true, a.err
+	case <-time.After(ptrGrace):
+		return nil, false, nil
+	}
+}
+
+// updatePTR records the PTR names for ip and, if its device has already been
+// sent, sends it again with the names filled in
+func (s *Scanner) updatePTR(ip string, names []string) {
+	s.publishMutex.Lock()
+	s.deviceMutex.Lock()
+	s.ptrNames[ip] = names
+	device, sent := s.devices[ip]
+	if sent {
+		names = s.opts.withMDNSName(names, device.MDNSName, ip)
+	}
+	if !sent || device.Status != "Up" || slices.Equal(device.Hostname, names) {
+		s.deviceMutex.Unlock()
+		s.publishMutex.Unlock()
+		return
+	}
+	device.Hostname = names
+	device.explainHostname(sourcePTR + ", answered late")
+	s.keepLocked(device)
+	s.deviceMutex.Unlock()
+	s.publishMutex.Unlock()
+
+	log.Printf("Late DNS hostname for %s: %v", ip, names)
+	s.deliver(ip)
+}
+
+// resolveHostname runs the protocol-specific hostname lookups for a device
+// that reverse DNS could not name, as far as the scan intensity allows. It
+// reports whether mDNS should be asked too, which is left to the caller
+// since it is slow enough to run in the background.
+func (s *Scanner) resolveHostname(ipStr string, device *Device, openPorts []int) bool {
+	if s.opts.Intensity == IntensityLow {
+		return false
+	}
+	thorough := s.opts.Intensity == IntensityHigh
+	scale := s.opts.Intensity.resolverTimeoutScale()
+
+	if contains(openPorts, 548) {
+		log.Printf("DNS lookup failed for %s, trying AFP resolution", ipStr)
+		release := s.acquireResolver()
+		start := time.Now()
+		afpHostname, err := getAFPHostname(ipStr, scale)
+		release()
+		s.timing().resolved(PhaseAFP, start, err == nil && afpHostname != "")
+		if err == nil && afpHostname != "" {
+			device.Hostname = []string{afpHostname}
+			device.DeviceType = "Apple" // AFP is specific to Apple
+			device.explain(FieldHostname, "AFP server info")
+			device.explain(FieldDeviceType, "AFP server, which only Apple devices run")
+			log.Printf("Got AFP hostname for %s: %s", ipStr, afpHostname)
+		} else {
+			log.Printf("AFP hostname resolution failed for %s: %v", ipStr, err)
+			s.warnLookup(device, "AFP hostname lookup", err)
+		}
+	}
+
+	// Try other protocols if still no hostname
+	if len(device.Hostname) > 0 {
+		return false
+	}
+
+	// NetBIOS answers over UDP 137 even when SMB is closed, so a thorough
+	// scan asks every host. A SOCKS5 proxy carries no UDP, so through one
+	// only SMB is tried.
+	netbios := s.opts.SOCKS5 == ""
+	if contains(openPorts, 445) || (thorough && netbios) {
+		log.Printf("Trying NetBIOS/SMB resolution for %s", ipStr)
+		release := s.acquireResolver()
+		if netbios {
+			start := time.Now()
+			nbName, err := getNetBIOSName(ipStr, scale)
+			s.timing().resolved(PhaseNetBIOS, start, err == nil && nbName != "")
+			if err == nil && nbName != "" {
+				device.Hostname = []string{nbName}
+				device.explain(FieldHostname, "NetBIOS name query")
+				log.Printf("Got NetBIOS name for %s: %s", ipStr, nbName)
 			} else {
-				// Store offline device
-				device := Device{
-					IPAddress: ipStr,
-					Status:    "Down",
-				}
-				s.deviceMutex.Lock()
-				s.devices[ipStr] = device
-				s.deviceMutex.Unlock()
+				s.warnLookup(device, "NetBIOS name query", err)
 			}
+		}
+		if len(device.Hostname) == 0 && contains(openPorts, 445) {
+			start := time.Now()
+			smbHostname, err := getSMBHostname(ipStr, scale)
+			s.timing().resolved(PhaseSMB, start, err == nil && smbHostname != "")
+			if err == nil && smbHostname != "" {
+				device.Hostname = []string{smbHostname}
+				device.explain(FieldHostname, "SMB session setup")
+				log.Printf("Got SMB hostname for %s: %s", ipStr, smbHostname)
+			} else {
+				s.warnLookup(device, "SMB hostname lookup", err)
+			}
+		}
+		release()
+	}
+
+	if len(device.Hostname) == 0 && contains(openPorts, 3389) {
+		log.Printf("Trying RDP resolution for %s", ipStr)
+		release := s.acquireResolver()
+		start := time.Now()
+		rdpHostname, err := getRDPHostname(ipStr, scale)
+		release()
+		s.timing().resolved(PhaseRDP, start, err == nil && rdpHostname != "")
+		if err == nil && rdpHostname != "" {
+			device.Hostname = []string{rdpHostname}
+			device.explain(FieldHostname, "RDP handshake")
+			log.Printf("Got RDP hostname for %s: %s", ipStr, rdpHostname)
+		} else {
+			s.warnLookup(device, "RDP hostname lookup", err)
+		}
+	}
+
+	// Only try mDNS if we still don't have a hostname and it's likely an Apple
+	// device, or for every host in a thorough scan
+	if len(device.Hostname) > 0 {
+		log.Printf("Skipping mDNS resolution for %s - hostname already found via other methods", ipStr)
+		return false
+	}
+	if thorough || device.DeviceType == "Apple" || device.DeviceType == "Possible Apple" ||
+		contains(openPorts, 5353) || // mDNS port
+		contains(openPorts, 5000) || // AirPlay
+		contains(openPorts, 7000) { // AirPlay alternate
+		log.Printf("No hostname found via other methods, initiating mDNS resolution for %s", ipStr)
+		return true
+	}
+	return false
+}
+
+// mdnsAnswer is the outcome of an mDNS lookup of one host
+type mdnsAnswer struct {
+	name     string
+	services map[string]string // TXT records by service type
+	err      error
+}
+
+// lookupMDNS resolves ipStr's mDNS name in the background and hands the
+// answer to done. A scan waits for every lookup before it completes.
+// Through a SOCKS5 proxy, which carries no UDP, there is no answer.
+func (s *Scanner) lookupMDNS(ipStr string, done func(mdnsAnswer)) {
+	if s.opts.SOCKS5 != "" {
+		done(mdnsAnswer{})
+		return
+	}
+	scale := s.opts.Intensity.resolverTimeoutScale()
+	s.mdnsWg.Add(1)
+	go func() {
+		defer s.mdnsWg.Done()
+		release := s.acquireResolver()
+		start := time.Now()
+		name, services, err := getBonjourHostname(s, ipStr, scale)
+		release()
+		s.timing().resolved(PhaseMDNS, start, err == nil && name != "")
+		if err != nil {
+			log.Printf("mDNS resolution failed for %s: %v", ipStr, err)
+		} else if name != "" {
+			log.Printf("Successfully resolved mDNS hostname for %s: %s", ipStr, name)
+		}
+		done(mdnsAnswer{name: name, services: services, err: err})
+	}()
+}
+
+// lookupMDNSNow is lookupMDNS waiting for the answer
+func (s *Scanner) lookupMDNSNow(ipStr string) mdnsAnswer {
+	answers := make(chan mdnsAnswer, 1)
+	s.lookupMDNS(ipStr, func(answer mdnsAnswer) { answers <- answer })
+	return <-answers
+}
+
+// updateMDNS records the mDNS answer for ip, for storeLocked to apply, and
+// if its device has already been stored applies it there and sends the
+// device again, as updatePTR does for late PTR names
+func (s *Scanner) updateMDNS(ip string, answer mdnsAnswer) {
+	s.publishMutex.Lock()
+	s.deviceMutex.Lock()
+	s.mdnsAnswers[ip] = answer
+	device, sent := s.devices[ip]
+	changed := false
+	if sent && device.Status == "Up" {
+		// The published copy shares these
+		device.Notes = slices.Clone(device.Notes)
+		device.MDNSServices = maps.Clone(device.MDNSServices)
+		if changed = s.applyMDNS(&device, answer); changed {
+			s.keepLocked(device)
+		}
+	}
+	s.deviceMutex.Unlock()
+	s.publishMutex.Unlock()
+
+	if changed {
+		log.Printf("mDNS answer for %s applied to its stored device", ip)
+		s.deliver(ip)
+	}
+}
+
+// applyMDNS records answer on device and reports whether that changed it.
+// The name becomes the hostname of an unnamed device, or leads a poor DNS
+// name with Options.PreferMDNS. Applying the same answer twice changes
+// nothing the second time.
+func (s *Scanner) applyMDNS(device *Device, answer mdnsAnswer) bool {
+	if answer.err != nil {
+		note := fmt.Sprintf("mDNS hostname lookup failed: %v", answer.err)
+		if slices.Contains(device.Notes, note) {
+			return false
+		}
+		s.warn(device, "%s", note)
+		return true
+	}
+	if answer.name == "" {
+		return false
+	}
 
-			// Only increment the scan counter after all operations (including mDNS) are complete
-			atomic.AddInt32(&s.scannedCount, 1)
-			log.Printf("Completed all operations for %s (worker %d, scanned: %d/%d)",
-				ipStr, id, atomic.LoadInt32(&s.scannedCount), atomic.LoadInt32(&s.totalIPs))
-
-			// Update worker stats with completed count
-			s.statsLock.Lock()
-			if stat := s.workerStats[id]; stat != nil {
-				atomic.StoreInt32(&stat.IPsScanned, atomic.LoadInt32(&s.scannedCount))
-				atomic.StoreInt32(&stat.TotalIPs, atomic.LoadInt32(&s.totalIPs))
-				atomic.StoreInt32(&stat.SentCount, atomic.LoadInt32(&s.sentCount))
+	changed := device.MDNSName != answer.name
+	device.MDNSName = answer.name
+	device.explain(FieldMDNSName, "mDNS query")
+	for service, info := range answer.services {
+		if current, ok := device.MDNSServices[service]; ok && current == info {
+			continue
+		}
+		if device.MDNSServices == nil {
+			device.MDNSServices = make(map[string]string)
+		}
+		device.MDNSServices[service] = info
+		changed = true
+	}
+	hostnames := []string{answer.name}
+	if len(device.Hostname) > 0 {
+		hostnames = s.opts.withMDNSName(device.Hostname, answer.name, device.IPAddress)
+	} else if device.DeviceType == "" {
+		// Only Apple devices used to answer mDNS name queries
+		device.DeviceType = "Possible Apple"
+		device.explain(FieldDeviceType, "Answered an mDNS name query, as Apple devices do")
+		changed = true
+	}
+	if !slices.Equal(device.Hostname, hostnames) {
+		device.Hostname = hostnames
+		device.explainHostname("mDNS query")
+		changed = true
+	}
+	return changed
+}
+
+// publish writes a live device to the log and report and delivers it to the
+// consumer
+func (s *Scanner) publish(device Device) {
+	// Write to report file
+	hostnames := "N/A"
+	if len(device.Hostname) > 0 {
+		hostnames = strings.Join(device.Hostname, ",")
+	}
+
+	// Format mDNS services for logging
+	var mdnsInfo string
+	if device.MDNSName != "" {
+		mdnsInfo = device.MDNSName
+		if len(device.MDNSServices) > 0 {
+			var services []string
+			for svcType, svcInfo := range device.MDNSServices {
+				services = append(services, fmt.Sprintf("%s: %s", svcType, svcInfo))
 			}
-			s.statsLock.Unlock()
+			mdnsInfo += fmt.Sprintf(" (Services: %s)", strings.Join(services, ", "))
 		}
+	} else {
+		mdnsInfo = "No mDNS"
+	}
+
+	log.Printf("Found device: %s (MAC: %s, Vendor: %s, mDNS: %s, Ports: %v)",
+		device.IPAddress, device.MACAddress, device.Vendor, mdnsInfo, device.OpenPorts)
+	s.report("%s\t%s\t%s\t%s\t%s\t%s\t%v\n",
+		device.IPAddress,
+		hostnames,
+		device.MDNSName,
+		device.MACAddress,
+		device.Vendor,
+		device.Status,
+		device.OpenPorts)
+
+	s.deliver(device.IPAddress)
+}
+
+// resultWait bounds how long a result waits for room in a full results
+// channel, so a stalled consumer can't hold up the workers
+const resultWait = 5 * time.Second
+
+// sendResult delivers device to the observer if there is one, otherwise to
+// the results channel. When the buffer is full it records a backpressure
+// event and waits up to resultWait for the consumer, dropping and counting
+// the result if the wait runs out or the scan is stopped. The device stays
+// stored either way, for GetDevices and the final results.
+func (s *Scanner) sendResult(device Device) {
+	if s.opts.Observer != nil {
+		s.opts.Observer.OnDevice(device)
+		return
+	}
+
+	select {
+	case s.resultsChan <- device:
+		log.Printf("Sent device %s to results channel", device.IPAddress)
+		return
+	default:
+	}
+
+	atomic.AddInt64(&s.backpressure, 1)
+	log.Printf("Results channel full, waiting to send device %s", device.IPAddress)
+	timer := time.NewTimer(resultWait)
+	defer timer.Stop()
+	select {
+	case s.resultsChan <- device:
+		log.Printf("Sent device %s to results channel", device.IPAddress)
+	case <-timer.C:
+		atomic.AddInt64(&s.dropped, 1)
+		log.Printf("Warning: results channel full for %s, dropping device %s", resultWait, device.IPAddress)
+	case <-s.stopping():
+		atomic.AddInt64(&s.dropped, 1)
+		log.Printf("Warning: scan stopped with results channel full, dropping device %s", device.IPAddress)
 	}
 }
 
-// GetResults returns the channels for receiving scan results
+// ScanStats summarizes the progress and health of the current scan
+type ScanStats struct {
+	Total        int32 // IPs in the scan range
+	Sent         int32 // IPs handed to workers
+	Scanned      int32 // IPs completed, online or offline
+	Discovered   int32 // Live hosts found
+	Concurrency  int32 // Hosts probed at once under Options.Adaptive, 0 otherwise
+	Backpressure int64 // Times a result found the results channel full
+	Dropped      int64 // Results not sent: the channel stayed full past resultWait or the scan stopped
+	Truncated    int64 // Live hosts found past Options.MaxResults and not kept
+	SocketWaits  int64 // Dials that waited for a socket slot, see Options.MaxSockets
+}
+
+// Stats returns a snapshot of the scan counters
+func (s *Scanner) Stats() ScanStats {
+	return ScanStats{
+		Total:        atomic.LoadInt32(&s.totalIPs),
+		Sent:         atomic.LoadInt32(&s.sentCount),
+		Scanned:      atomic.LoadInt32(&s.scannedCount),
+		Discovered:   atomic.LoadInt32(&s.discovered),
+		Concurrency:  s.concurrency(),
+		Backpressure: atomic.LoadInt64(&s.backpressure),
+		Dropped:      atomic.LoadInt64(&s.dropped),
+		Truncated:    atomic.LoadInt64(&s.truncated),
+		SocketWaits:  s.socketWaits(),
+	}
+}
+
+// socketWaits returns how many of the current scan's dials waited for a
+// socket slot
+func (s *Scanner) socketWaits() int64 {
+	if use := s.sockets.Load(); use != nil {
+		return atomic.LoadInt64(&use.waits)
+	}
+	return 0
+}
+
+// concurrency returns the adaptive concurrency cap, or 0 without one
+func (s *Scanner) concurrency() int32 {
+	if s.throttle == nil {
+		return 0
+	}
+	return int32(s.throttle.current())
+}
+
+// GetResults returns the channels for receiving scan results. A device can
+// arrive more than once: it is sent again when a slow reverse DNS lookup
+// fills in its hostname, so consumers should key results by IP. Nothing is
+// sent on them when Options.Observer is set.
 func (s *Scanner) GetResults() (chan Device, chan bool) {
 	return s.resultsChan, s.doneChan
 }
 
+// GetWarnings returns the channel of per-host warnings raised during the scan
+func (s *Scanner) GetWarnings() <-chan DeviceWarning {
+	return s.warningsChan
+}
+
 // GetWorkerStats returns a copy of current worker statistics
 func (s *Scanner) GetWorkerStats() map[int]WorkerStatus {
 	s.statsLock.RLock()
@@ -439,14 +1588,17 @@ func (s *Scanner) GetWorkerStats() map[int]WorkerStatus {
 	sent := atomic.LoadInt32(&s.sentCount)
 	total := atomic.LoadInt32(&s.totalIPs)
 
-	// If we have no workers but have devices, we're done - return final stats
+	// If we have no workers but have scanned, we're done - return final
+	// stats. Offline hosts may not be stored, so go by the scanned count.
 	if len(s.workerStats) == 0 {
-		if len(s.devices) > 0 {
+		if scanned > 0 {
+			// s.devices also holds Down hosts, so found comes from the
+			// live host count
 			stats[0] = WorkerStatus{
 				StartTime:  time.Now(),
 				LastSeen:   time.Now(),
 				State:      "completed",
-				IPsFound:   int32(len(s.devices)),
+				IPsFound:   atomic.LoadInt32(&s.discovered),
 				IPsScanned: total, // Use total IPs as scanned count
 				TotalIPs:   total,
 				SentCount:  total, // All IPs were sent
@@ -469,88 +1621,119 @@ func (s *Scanner) GetWorkerStats() map[int]WorkerStatus {
 
 // IsReachable checks if a host is reachable using various methods
 func IsReachable(ip string) (bool, []int) {
-	log.Printf("Checking reachability for %s", ip)
-	var openPorts []int
-	isReachable := false
+	probe := isReachable(ip, 1, Options{}, true)
+	return probe.reachable(), probe.open
+}
+
+// portState is the outcome of one TCP connect
+type portState int
 
-	// First check ARP cache and actively probe - fastest method for local devices
-	if mac := GetMACFromIP(ip); mac != "" {
-		log.Printf("%s found in ARP cache/probe with MAC %s", ip, mac)
-		isReachable = true
-		// Continue checking ports even if found via ARP
+const (
+	portOpen     portState = iota // Connected
+	portClosed                    // Refused: the host answered with a RST
+	portFiltered                  // Timed out: dropped by the host or a firewall
+	portFailed                    // Failed locally, e.g. out of sockets or buffers
+	portNoRoute                   // No route to the network, e.g. the interface went down
+	portUnknown                   // Any other error, e.g. host unreachable
+)
+
+// classifyDial turns the result of a TCP connect into a portState
+func classifyDial(err error) portState {
+	if err == nil {
+		return portOpen
+	}
+	// The proxy failing says nothing about the host behind it
+	var proxyErr *proxyError
+	if errors.As(err, &proxyErr) {
+		return portFailed
+	}
+	if isRefused(err) {
+		return portClosed
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return portFiltered
+	}
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.ENOBUFS) || errors.Is(err, syscall.EADDRNOTAVAIL) {
+		return portFailed
+	}
+	if errors.Is(err, syscall.ENETUNREACH) {
+		return portNoRoute
 	}
+	return portUnknown
+}
+
+// portProbe is what isReachable learned about a host
+type portProbe struct {
+	open     []int
+	closed   []int
+	filtered []int
+	failed   int // Dials that failed locally, e.g. out of sockets
+	noRoute  int // Dials that found no route to the network
+	mac      string
+}
+
+// reachable reports whether the host showed any sign of life. A refused
+// connection counts, as the RST normally comes from the host itself; a
+// firewall that rejects with a RST on behalf of the addresses behind it
+// makes every one of them look up, and only its own ports tell them apart.
+func (p portProbe) reachable() bool {
+	return len(p.open) > 0 || len(p.closed) > 0 || p.mac != ""
+}
+
+// isReachable probes ip with every timeout multiplied by timeoutScale and
+// returns the state of each port and, when the host is onLink, its MAC
+// address. The port dials double as the ARP trigger, so each port is
+// connected to once. The ports, source address and connect-only mode come
+// from opts.
+func isReachable(ip string, timeoutScale int, opts Options, onLink bool) portProbe {
+	scale := time.Duration(timeoutScale)
+	log.Printf("Checking reachability for %s", ip)
+	var probe portProbe
 
-	// Try common TCP ports with moderate timeout
-	commonPorts := []int{80, 443, 22, 445, 139, 135, 8080, 3389, 5900, 8006}
+	// Nudge the host over UDP as well, so hosts with every port filtered
+	// still land in the ARP cache
+	if onLink {
+		triggerUDP(ip, opts.SourceIP)
+	}
 
 	// Create a channel for collecting results
-	results := make(chan int, len(commonPorts))
+	type portResult struct {
+		port  int
+		state portState
+	}
+	ports := opts.ports()
+	results := make(chan portResult, len(ports)+len(macProbePorts))
 	var wg sync.WaitGroup
 
-	// Check ports concurrently
-	for _, port := range commonPorts {
+	// Check common TCP ports concurrently with moderate timeout
+	for _, port := range ports {
 		wg.Add(1)
 		go func(p int) {
 			defer wg.Done()
 			log.Printf("Trying TCP port %d for %s", p, ip)
-			d := net.Dialer{Timeout: time.Millisecond * 750}
-			conn, err := d.Dial("tcp", fmt.Sprintf("%s:%d", ip, p))
+			d := dialer("tcp", opts.SourceIP, time.Millisecond*750*scale)
+			conn, err := dial(d, "tcp", net.JoinHostPort(ip, strconv.Itoa(p)))
 			if err == nil {
 				conn.Close()
 				log.Printf("%s is reachable via TCP port %d", ip, p)
-				results <- p
-				isReachable = true
 			}
+			results <- portResult{p, classifyDial(err)}
 		}(port)
 	}
 
 	// Check Mac-specific ports separately with longer timeouts
-	macPorts := []struct {
-		port    int
-		timeout time.Duration
-	}{
-		{548, time.Second * 3},  // AFP needs more time
-		{5353, time.Second * 2}, // mDNS
-		{5000, time.Second * 1}, // AirPlay
-		{7000, time.Second * 1}, // AirPlay alternate
-		{3689, time.Second * 1}, // iTunes sharing
-	}
-
-	for _, macPort := range macPorts {
-		wg.Add(1)
-		go func(p int, timeout time.Duration) {
-			defer wg.Done()
-			log.Printf("Trying Mac-specific port %d for %s with %v timeout", p, ip, timeout)
-
-			if p == 5353 {
-				// Special handling for mDNS (UDP)
-				conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:%d", ip, p), timeout)
-				if err == nil {
-					// Send a minimal mDNS query
-					query := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-					conn.Write(query)
-					conn.SetReadDeadline(time.Now().Add(timeout))
-					buffer := make([]byte, 32)
-					_, err := conn.Read(buffer)
-					conn.Close()
-					if err == nil {
-						log.Printf("%s responded to mDNS query on port %d", ip, p)
-						results <- p
-						isReachable = true
-					}
-				}
-			} else {
-				// TCP ports
-				d := net.Dialer{Timeout: timeout}
-				conn, err := d.Dial("tcp", fmt.Sprintf("%s:%d", ip, p))
-				if err == nil {
-					conn.Close()
-					log.Printf("%s is reachable via Mac-specific TCP port %d", ip, p)
-					results <- p
-					isReachable = true
+	if !opts.ConnectOnly {
+		for _, macPort := range macProbePorts {
+			wg.Add(1)
+			go func(p int, timeout time.Duration) {
+				defer wg.Done()
+				if probeMacPort(ip, p, timeout, opts.SourceIP) {
+					results <- portResult{p, portOpen}
 				}
-			}
-		}(macPort.port, macPort.timeout)
+			}(macPort.port, macPort.timeout*scale)
+		}
 	}
 
 	// Wait for all port checks to complete
@@ -560,29 +1743,99 @@ func IsReachable(ip string) (bool, []int) {
 	}()
 
 	// Collect results
-	for port := range results {
-		openPorts = append(openPorts, port)
+	for result := range results {
+		switch result.state {
+		case portOpen:
+			probe.open = append(probe.open, result.port)
+		case portClosed:
+			probe.closed = append(probe.closed, result.port)
+		case portFiltered:
+			probe.filtered = append(probe.filtered, result.port)
+		case portFailed:
+			probe.failed++
+		case portNoRoute:
+			probe.noRoute++
+		}
 	}
 
 	// Sort ports for consistent output
-	sort.Ints(openPorts)
-	return isReachable, openPorts
+	sort.Ints(probe.open)
+	sort.Ints(probe.closed)
+	sort.Ints(probe.filtered)
+
+	// Every dial above has finished, so any on-link host that answered ARP is
+	// now in the neighbor table
+	if onLink {
+		probe.mac = lookupMAC(ip)
+	}
+	if probe.mac != "" {
+		log.Printf("%s found in ARP cache with MAC %s", ip, probe.mac)
+	}
+	return probe
+}
+
+// macProbePorts are the Apple service ports, which need longer timeouts
+var macProbePorts = []struct {
+	port    int
+	timeout time.Duration
+}{
+	{548, time.Second * 3},  // AFP needs more time
+	{5353, time.Second * 2}, // mDNS
+	{5000, time.Second * 1}, // AirPlay
+	{7000, time.Second * 1}, // AirPlay alternate
+	{3689, time.Second * 1}, // iTunes sharing
 }
 
-// GetAllIPs returns all IP addresses in a subnet
+// probeMacPort reports whether ip answers on one of the macProbePorts,
+// sending from source when it is set
+func probeMacPort(ip string, p int, timeout time.Duration, source net.IP) bool {
+	log.Printf("Trying Mac-specific port %d for %s with %v timeout", p, ip, timeout)
+	addr := net.JoinHostPort(ip, strconv.Itoa(p))
+
+	if p == 5353 {
+		// Special handling for mDNS (UDP)
+		conn, err := dial(dialer("udp", source, timeout), "udp", addr)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		// Send a minimal mDNS query
+		query := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		conn.Write(query)
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		buffer := make([]byte, 32)
+		if _, err := conn.Read(buffer); err != nil {
+			return false
+		}
+		log.Printf("%s responded to mDNS query on port %d", ip, p)
+		return true
+	}
+
+	// TCP ports
+	conn, err := dial(dialer("tcp", source, timeout), "tcp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	log.Printf("%s is reachable via Mac-specific TCP port %d", ip, p)
+	return true
+}
+
+// GetAllIPs returns all IP addresses in a subnet. It allocates every address
+// up front, so large ranges should use IterateIPs and CountIPs instead.
 func GetAllIPs(ipNet *net.IPNet) []net.IP {
 	var ips []net.IP
-	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); inc(ip) {
-		newIP := make(net.IP, len(ip))
-		copy(newIP, ip)
-		ips = append(ips, newIP)
-	}
-	if len(ips) > 2 {
-		ips = ips[1 : len(ips)-1]
+	if count := CountIPs(ipNet); count <= DefaultMaxHosts {
+		ips = make([]net.IP, 0, count)
 	}
+	IterateIPs(ipNet, func(ip net.IP) bool {
+		ips = append(ips, ip)
+		return true
+	})
 	return ips
 }
 
+// inc advances ip to the next address in place
 func inc(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
 		ip[j]++
@@ -610,11 +1863,12 @@ func (s *Scanner) getMDNSInfo(ip string) (string, map[string]string) {
 }
 
 // Add new function for SMB hostname resolution
-func getSMBHostname(ip string) (string, error) {
+func getSMBHostname(ip string, timeoutScale int) (string, error) {
+	scale := time.Duration(timeoutScale)
 	log.Printf("Attempting SMB hostname resolution for %s", ip)
 
 	// Set up SMB connection with guest credentials
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:445", ip), time.Second*2)
+	conn, err := dial(&net.Dialer{Timeout: time.Second * 2 * scale}, "tcp", fmt.Sprintf("%s:445", ip))
 	if err != nil {
 		log.Printf("SMB connection failed for %s: %v", ip, err)
 		return "", fmt.Errorf("SMB connection failed: %v", err)
@@ -686,7 +1940,8 @@ func contains(slice []int, val int) bool {
 }
 
 // Add NetBIOS name resolution function
-func getNetBIOSName(ip string) (string, error) {
+func getNetBIOSName(ip string, timeoutScale int) (string, error) {
+	scale := time.Duration(timeoutScale)
 	log.Printf("Attempting NetBIOS name resolution for %s", ip)
 
 	// NetBIOS name query packet
@@ -710,7 +1965,7 @@ func getNetBIOSName(ip string) (string, error) {
 	}
 
 	// Create UDP connection with timeout
-	conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:137", ip), time.Second*1)
+	conn, err := dial(&net.Dialer{Timeout: time.Second * 1 * scale}, "udp", fmt.Sprintf("%s:137", ip))
 	if err != nil {
 		log.Printf("NetBIOS connection failed for %s: %v", ip, err)
 		return "", fmt.Errorf("NetBIOS connection failed: %v", err)
@@ -726,7 +1981,7 @@ func getNetBIOSName(ip string) (string, error) {
 
 	// Read response with shorter timeout
 	response := make([]byte, 1024)
-	conn.SetReadDeadline(time.Now().Add(time.Millisecond * 500))
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond * 500 * scale))
 	n, err := conn.Read(response)
 	if err != nil {
 		log.Printf("Failed to read NetBIOS response from %s: %v", ip, err)
@@ -802,7 +2057,8 @@ func getNetBIOSName(ip string) (string, error) {
 }
 
 // Add RDP hostname resolution function
-func getRDPHostname(ip string) (string, error) {
+func getRDPHostname(ip string, timeoutScale int) (string, error) {
+	scale := time.Duration(timeoutScale)
 	log.Printf("Attempting RDP hostname resolution for %s", ip)
 
 	// Step 1: Initial X.224 Connection Request
@@ -824,7 +2080,7 @@ func getRDPHostname(ip string) (string, error) {
 	}
 
 	// Step 2: Establish TCP connection
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:3389", ip), time.Second*2)
+	conn, err := dial(&net.Dialer{Timeout: time.Second * 2 * scale}, "tcp", fmt.Sprintf("%s:3389", ip))
 	if err != nil {
 		log.Printf("TCP connection to RDP server %s failed: %v", ip, err)
 		return "", fmt.Errorf("TCP connection failed: %v", err)
@@ -841,7 +2097,7 @@ func getRDPHostname(ip string) (string, error) {
 
 	// Step 4: Read Response
 	response := make([]byte, 1024)
-	conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	conn.SetReadDeadline(time.Now().Add(time.Second * 2 * scale))
 	n, err := conn.Read(response)
 	if err != nil {
 		log.Printf("Failed to read RDP response from %s: %v", ip, err)
@@ -880,8 +2136,12 @@ func getRDPHostname(ip string) (string, error) {
 	if selectedProtocol&0x06 != 0 { // Check for TLS (0x02) or CredSSP (0x04)
 		log.Printf("RDP server %s supports secure protocols (0x%x), initiating SSL handshake", ip, selectedProtocol)
 
+		// Give back the first connection's socket slot before taking
+		// another, or workers holding one each could all wait for a second
+		conn.Close()
+
 		// Create new connection for SSL handshake
-		sslConn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:3389", ip), time.Second*2)
+		sslConn, err := dial(&net.Dialer{Timeout: time.Second * 2 * scale}, "tcp", fmt.Sprintf("%s:3389", ip))
 		if err != nil {
 			return "", fmt.Errorf("SSL connection failed: %v", err)
 		}
@@ -898,7 +2158,7 @@ func getRDPHostname(ip string) (string, error) {
 		}
 
 		// Proceed with SSL handshake
-		return getRDPHostnameSSL(sslConn, ip)
+		return getRDPHostnameSSL(sslConn, ip, timeoutScale)
 	}
 
 	log.Printf("RDP server %s only supports basic RDP (protocol=0x%x)", ip, selectedProtocol)
@@ -906,7 +2166,8 @@ func getRDPHostname(ip string) (string, error) {
 }
 
 // Helper function for SSL/TLS based hostname resolution
-func getRDPHostnameSSL(conn net.Conn, ip string) (string, error) {
+func getRDPHostnameSSL(conn net.Conn, ip string, timeoutScale int) (string, error) {
+	scale := time.Duration(timeoutScale)
 	// Create TLS connection with custom config
 	tlsConn := tls.Client(conn, &tls.Config{
 		InsecureSkipVerify: true,
@@ -923,7 +2184,7 @@ func getRDPHostnameSSL(conn net.Conn, ip string) (string, error) {
 	})
 
 	// Perform TLS Handshake with context and timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2*scale)
 	defer cancel()
 
 	if err := tlsConn.HandshakeContext(ctx); err != nil {
@@ -1000,7 +2261,7 @@ func extractHostnameFromCert(cert *x509.Certificate, ip string) (string, error)
 			log.Printf("Processing possible name for %s: %s", ip, name)
 			cleaned := cleanHostname(name)
 			log.Printf("Cleaned hostname: %s", cleaned)
-			if cleaned != "" && isValidHostname(cleaned) {
+			if cleaned != "" && isValidHostname(cleaned) && !genericCertNames[strings.ToLower(cleaned)] {
 				log.Printf("Found valid hostname in certificate for %s: %s (from %s)",
 					ip, cleaned, name)
 				return cleaned, nil
@@ -1014,6 +2275,19 @@ func extractHostnameFromCert(cert *x509.Certificate, ip string) (string, error)
 	return "", fmt.Errorf("no valid hostname in certificate")
 }
 
+// genericCertNames are certificate names, as cleanHostname leaves them, that
+// say nothing about the host: placeholders, web server defaults and the
+// stock names appliances ship with
+var genericCertNames = map[string]bool{
+	"www": true, "web": true, "mail": true, "localhost": true, "localdomain": true,
+	"example": true, "default": true, "test": true, "unknown": true, "none": true,
+	"server": true, "host": true, "device": true, "router": true, "gateway": true,
+	"admin": true, "selfsigned": true, "self-signed": true, "snakeoil": true,
+	"ubnt": true, "unifi": true, "synology": true, "qnap": true, "fritz": true,
+	"pfsense": true, "opnsense": true, "openwrt": true, "mikrotik": true, "idrac": true,
+	"printer": true, "ipmi": true, "plex": true,
+}
+
 // Helper function to clean hostnames from certificates
 func cleanHostname(name string) string {
 	// Remove any port numbers
@@ -1064,8 +2338,9 @@ func min(a, b int) int {
 }
 
 // Add new function for AFP hostname resolution
-func getAFPHostname(ip string) (string, error) {
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:548", ip), time.Second*2)
+func getAFPHostname(ip string, timeoutScale int) (string, error) {
+	scale := time.Duration(timeoutScale)
+	conn, err := dial(&net.Dialer{Timeout: time.Second * 2 * scale}, "tcp", fmt.Sprintf("%s:548", ip))
 	if err != nil {
 		return "", err
 	}
@@ -1096,17 +2371,11 @@ func getAFPHostname(ip string) (string, error) {
 	return "", fmt.Errorf("no hostname in AFP banner")
 }
 
-// Add new function for Bonjour hostname resolution
-func getBonjourHostname(s *Scanner, ip string) (string, error) {
-	log.Printf("Starting mDNS resolution for %s (adding to WaitGroup)", ip)
-
-	// Add to WaitGroup before starting mDNS operations
-	s.mdnsWg.Add(1)
-	defer func() {
-		s.mdnsWg.Done()
-		log.Printf("Completed mDNS resolution for %s (removed from WaitGroup)", ip)
-	}()
-
+// getBonjourHostname browses common service types for ip and returns the
+// name it advertises, with the TXT record of the matching service keyed by
+// service type, e.g. the model from _device-info._tcp
+func getBonjourHostname(s *Scanner, ip string, timeoutScale int) (string, map[string]string, error) {
+	scale := time.Duration(timeoutScale)
 	// Common Apple and network service types - reduced list to most common ones
 	serviceTypes := []string{
 		"_device-info._tcp",
@@ -1121,8 +2390,13 @@ func getBonjourHostname(s *Scanner, ip string) (string, error) {
 		"_http._tcp",
 	}
 
-	// Try each service type with shorter timeout
+	// Try each service type with shorter timeout. Skip multicast browsing
+	// entirely once it has failed, e.g. because Avahi or mDNSResponder holds
+	// port 5353, and go straight to the unicast fallback below.
 	for _, service := range serviceTypes {
+		if s.mdnsUnavailable.Load() {
+			break
+		}
 		log.Printf("Querying for service type: %s", service)
 
 		// Create a channel to receive entries
@@ -1133,7 +2407,7 @@ func getBonjourHostname(s *Scanner, ip string) (string, error) {
 			params := &mdns.QueryParam{
 				Service:             service,
 				Domain:              "local",
-				Timeout:             time.Millisecond * 250, // Reduced from 1 second
+				Timeout:             time.Millisecond * 250 * scale, // Reduced from 1 second
 				Entries:             ch,
 				DisableIPv6:         true,
 				WantUnicastResponse: true,
@@ -1141,12 +2415,15 @@ func getBonjourHostname(s *Scanner, ip string) (string, error) {
 
 			if err := mdns.Query(params); err != nil {
 				log.Printf("Failed to query service %s: %v", service, err)
+				if !s.mdnsUnavailable.Swap(true) {
+					log.Printf("Multicast mDNS unavailable (%v), using unicast queries instead", err)
+				}
 				return
 			}
 		}(entryChan)
 
 		// Process results with shorter timeout
-		timeout := time.After(time.Millisecond * 300) // Reduced from 1 second
+		timeout := time.After(time.Millisecond * 300 * scale) // Reduced from 1 second
 	L:
 		for {
 			select {
@@ -1156,13 +2433,17 @@ func getBonjourHostname(s *Scanner, ip string) (string, error) {
 				}
 				if entry.AddrV4.String() == ip {
 					log.Printf("Found matching mDNS entry for %s: %+v", ip, entry)
+					var services map[string]string
+					if len(entry.InfoFields) > 0 {
+						services = map[string]string{service: strings.Join(entry.InfoFields, ", ")}
+					}
 
 					// Try host first (usually cleaner)
 					if entry.Host != "" {
 						hostname := strings.TrimSuffix(entry.Host, ".")
 						if hostname != "" {
 							log.Printf("Using host name for %s: %s", ip, hostname)
-							return hostname, nil
+							return hostname, services, nil
 						}
 					}
 
@@ -1179,7 +2460,7 @@ func getBonjourHostname(s *Scanner, ip string) (string, error) {
 							name += ".local"
 						}
 						log.Printf("Using service name for %s: %s", ip, name)
-						return name, nil
+						return name, services, nil
 					}
 				}
 			case <-timeout:
@@ -1189,5 +2470,13 @@ func getBonjourHostname(s *Scanner, ip string) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("no hostname found via mDNS")
+	// Ask the host directly, which works even when multicast browsing can't
+	hostname, err := queryUnicastMDNS(ip, time.Millisecond*500*scale)
+	if err == nil {
+		log.Printf("Using unicast mDNS name for %s: %s", ip, hostname)
+		return hostname, nil, nil
+	}
+	log.Printf("Unicast mDNS query failed for %s: %v", ip, err)
+
+	return "", nil, fmt.Errorf("no hostname found via mDNS")
 }
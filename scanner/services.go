@@ -0,0 +1,64 @@
+package scanner
+
+import "fmt"
+
+// serviceNames maps well-known ports, including those the scanner probes and
+// the Apple-specific ones it uses for identification, to service names
+var serviceNames = map[int]string{
+	21:    "FTP",
+	22:    "SSH",
+	23:    "Telnet",
+	25:    "SMTP",
+	53:    "DNS",
+	80:    "HTTP",
+	88:    "Kerberos",
+	102:   "S7comm",
+	135:   "MSRPC",
+	139:   "NetBIOS",
+	161:   "SNMP",
+	389:   "LDAP",
+	443:   "HTTPS",
+	445:   "SMB",
+	502:   "Modbus",
+	512:   "rexec",
+	513:   "rlogin",
+	514:   "rsh",
+	515:   "LPD",
+	548:   "AFP",
+	631:   "IPP",
+	636:   "LDAPS",
+	1883:  "MQTT",
+	2323:  "Telnet-Alt",
+	3268:  "LDAP-GC",
+	3269:  "LDAPS-GC",
+	3389:  "RDP",
+	3689:  "iTunes",
+	5000:  "AirPlay",
+	5353:  "mDNS",
+	5683:  "CoAP",
+	5900:  "VNC",
+	5985:  "WinRM",
+	5986:  "WinRM-TLS",
+	7000:  "AirPlay",
+	8006:  "Proxmox",
+	8080:  "HTTP-Alt",
+	8443:  "HTTPS-Alt",
+	8883:  "MQTT-TLS",
+	9100:  "JetDirect",
+	20000: "DNP3",
+	44818: "EtherNet/IP",
+	47808: "BACnet",
+}
+
+// ServiceName returns the usual service name for port, or "" if unknown
+func ServiceName(port int) string {
+	return serviceNames[port]
+}
+
+// FormatPort renders port with its service name, e.g. "443 (HTTPS)"
+func FormatPort(port int) string {
+	if name := ServiceName(port); name != "" {
+		return fmt.Sprintf("%d (%s)", port, name)
+	}
+	return fmt.Sprintf("%d", port)
+}
@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+)
+
+// noteSkipped is the note on a host whose probes were cancelled with
+// SkipWorker; what was learned before then is kept
+const noteSkipped = "Skipped: probing was cancelled from the worker panel"
+
+// hostProbes holds a context for each host being probed, so a host that
+// hangs its worker can be skipped without stopping the scan. Every dial to
+// the host is bound to it, and the connections already open are closed when
+// it is cancelled, which fails whatever handshake was stuck.
+var hostProbes = &probeRegistry{hosts: make(map[string]*hostProbe)}
+
+// probeRegistry maps host addresses to the context of their probes
+type probeRegistry struct {
+	mu    sync.Mutex
+	hosts map[string]*hostProbe
+}
+
+// hostProbe is the context shared by the probes of one host, by any
+// Scanner, while users of them are under way
+type hostProbe struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	users  int
+	uses   map[*socketUse]int // Socket shares of the scans probing the host, by users
+}
+
+// begin returns the context for probing ip in the scan with socket share
+// use, and the function to call when the probes are done
+func (r *probeRegistry) begin(ip string, use *socketUse) (context.Context, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	probe := r.hosts[ip]
+	if probe == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		probe = &hostProbe{ctx: ctx, cancel: cancel, uses: make(map[*socketUse]int)}
+		r.hosts[ip] = probe
+	}
+	probe.users++
+	probe.uses[use]++
+	return probe.ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if probe.uses[use]--; probe.uses[use] == 0 {
+			delete(probe.uses, use)
+		}
+		if probe.users--; probe.users == 0 {
+			delete(r.hosts, ip)
+			probe.cancel()
+		}
+	}
+}
+
+// lookup returns the context of the probes of the host in addr, a bare
+// address or host:port, and the socket shares of the scans probing it, or
+// nil and none when it isn't being probed
+func (r *probeRegistry) lookup(addr string) (context.Context, []*socketUse) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	probe := r.hosts[host]
+	if probe == nil {
+		return nil, nil
+	}
+	uses := make([]*socketUse, 0, len(probe.uses))
+	for use := range probe.uses {
+		uses = append(uses, use)
+	}
+	return probe.ctx, uses
+}
+
+// cancel cancels the probes of ip, reporting whether any were under way
+func (r *probeRegistry) cancel(ip string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	probe := r.hosts[ip]
+	if probe == nil {
+		return false
+	}
+	probe.cancel()
+	return true
+}
+
+// SkipWorker cancels the probes of the host worker id is on, for a host
+// that hangs it, and returns the host's address. The worker moves on to the
+// next host once its open connections are closed, and the skipped one is
+// kept with what was learned so far and a note. It reports false when the
+// worker isn't probing anything.
+func (s *Scanner) SkipWorker(id int) (string, bool) {
+	s.statsLock.RLock()
+	var ip string
+	if stat := s.workerStats[id]; stat != nil {
+		ip = stat.CurrentIP
+	}
+	s.statsLock.RUnlock()
+	if net.ParseIP(ip) == nil || !hostProbes.cancel(ip) {
+		return "", false
+	}
+	log.Printf("Skipping %s on worker %d", ip, id)
+	s.report("\nSkipped %s on worker %d\n", ip, id)
+	return ip, true
+}
+
+// storeSkipped keeps what was learned about a live host before it was
+// skipped
+func (s *Scanner) storeSkipped(device Device) {
+	log.Printf("Skipped %s with its probes unfinished", device.IPAddress)
+	device.addNote(noteSkipped)
+	s.store(device)
+}
@@ -0,0 +1,279 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// frameSource reads Ethernet frames off the wire. The raw socket reader is
+// built in on Linux; the libpcap one replaces it with -tags pcap and is the
+// only one on other systems.
+type frameSource interface {
+	// ReadFrame returns the next frame received by the host, or nil with no
+	// error when none arrived within about a second
+	ReadFrame() ([]byte, error)
+	Close() error
+}
+
+// Ethernet types and IP protocol of the frames worth decoding
+const (
+	etherTypeARP  = 0x0806
+	etherTypeIPv4 = 0x0800
+	ipProtocolUDP = 17
+)
+
+// UDP ports of the broadcast traffic the sniffer harvests
+const (
+	portDHCPServer = 67
+	portDHCPClient = 68
+	portNBNS       = 137
+	portMDNS       = 5353
+)
+
+// startSniffer listens on the wire for ARP, DHCP, mDNS and NetBIOS traffic
+// other hosts send anyway and adds who sent it to the device list, alongside
+// whatever the scan finds itself. The returned function stops the sniffer
+// and waits for it. Without Options.Sniff, or when no capture can be opened,
+// nothing is started and the scan carries on without it.
+func (s *Scanner) startSniffer() func() {
+	if !s.opts.Sniff {
+		return func() {}
+	}
+	iface := sniffInterface(s.opts.SourceIP, s.targets)
+	source, err := openFrameSource(iface)
+	if err != nil {
+		log.Printf("Not sniffing: %v", err)
+		s.report("\nNot sniffing: %v\n", err)
+		return func() {}
+	}
+	if iface == "" {
+		log.Printf("Sniffing ARP, DHCP, mDNS and NetBIOS traffic on all interfaces")
+	} else {
+		log.Printf("Sniffing ARP, DHCP, mDNS and NetBIOS traffic on %s", iface)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer source.Close()
+		heard := 0
+		for {
+			select {
+			case <-stop:
+				log.Printf("Sniffer stopped after %d frames of interest", heard)
+				return
+			default:
+			}
+			frame, err := source.ReadFrame()
+			if err != nil {
+				log.Printf("Sniffer stopped: %v", err)
+				return
+			}
+			if o, ok := decodeFrame(frame); ok {
+				heard++
+				s.observe(o.ip, o.apply)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// decodeFrame returns who sent frame and what it revealed about itself, if
+// it is one of the broadcasts the sniffer harvests. Everything else is
+// skipped by the Ethernet type and IP protocol before gopacket sees it.
+func decodeFrame(frame []byte) (observation, bool) {
+	var o observation
+	if len(frame) < 14 {
+		return o, false
+	}
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case etherTypeARP:
+	case etherTypeIPv4:
+		if len(frame) < 14+20 || frame[14+9] != ipProtocolUDP {
+			return o, false
+		}
+	default:
+		return o, false
+	}
+
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		// Requests and replies alike name their sender; a probe for a
+		// conflicting address comes from 0.0.0.0 and is no one yet
+		sender := net.IP(arp.SourceProtAddress).To4()
+		if sender == nil || sender.IsUnspecified() {
+			return o, false
+		}
+		o.ip = sender.String()
+		o.mac = observedMAC(arp.SourceHwAddress)
+		return o, o.mac != ""
+	}
+
+	eth, _ := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	ip, _ := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	udp, _ := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if eth == nil || ip == nil || udp == nil {
+		return o, false
+	}
+	if udp.DstPort == portDHCPServer || udp.DstPort == portDHCPClient {
+		return decodeDHCP(packet)
+	}
+	// mDNS and NetBIOS are only taken from link-local broadcasts, whose
+	// source MAC is the sender's own rather than a router's
+	if eth.DstMAC[0]&0x01 == 0 {
+		return o, false
+	}
+	o.ip = ip.SrcIP.String()
+	o.mac = observedMAC(eth.SrcMAC)
+	switch {
+	case udp.SrcPort == portMDNS:
+		mdns := parseMDNSAnnouncement(udp.Payload, ip.SrcIP)
+		o.name, o.services = mdns.name, mdns.services
+		return o, true
+	case udp.SrcPort == portNBNS && udp.DstPort == portNBNS:
+		o.hostname = parseNBNSRegistration(udp.Payload)
+		return o, o.hostname != ""
+	}
+	return o, false
+}
+
+// decodeDHCP reads the client's address, MAC and host name from a DHCP
+// request, acknowledgement or inform, which between them cover both a
+// client joining and one renewing its lease
+func decodeDHCP(packet gopacket.Packet) (observation, bool) {
+	var o observation
+	dhcp, ok := packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+	if !ok {
+		return o, false
+	}
+	var msgType layers.DHCPMsgType
+	var requested net.IP
+	for _, option := range dhcp.Options {
+		switch option.Type {
+		case layers.DHCPOptMessageType:
+			if len(option.Data) == 1 {
+				msgType = layers.DHCPMsgType(option.Data[0])
+			}
+		case layers.DHCPOptRequestIP:
+			if len(option.Data) == 4 {
+				requested = net.IP(option.Data)
+			}
+		case layers.DHCPOptHostname:
+			o.hostname = strings.TrimRight(string(option.Data), "\x00")
+		}
+	}
+
+	var address net.IP
+	switch msgType {
+	case layers.DHCPMsgTypeRequest:
+		address = requested
+		if address == nil {
+			address = dhcp.ClientIP
+		}
+	case layers.DHCPMsgTypeAck:
+		address = dhcp.YourClientIP
+	case layers.DHCPMsgTypeInform:
+		address = dhcp.ClientIP
+	default:
+		return o, false
+	}
+	if address = address.To4(); address == nil || address.IsUnspecified() {
+		return o, false
+	}
+	o.ip = address.String()
+	o.mac = observedMAC(dhcp.ClientHWAddr)
+	return o, o.mac != ""
+}
+
+// parseNBNSRegistration returns the unique name a NetBIOS name registration,
+// refresh or overwrite claims, or "" for anything else. Group names such as
+// the workgroup say nothing about the host.
+func parseNBNSRegistration(payload []byte) string {
+	// 12 byte header, the 34 byte encoded question name, type and class,
+	// then an additional record pointing back at it whose RDATA starts with
+	// the NB_FLAGS
+	if len(payload) < 64 {
+		return ""
+	}
+	flags := binary.BigEndian.Uint16(payload[2:4])
+	opcode := flags >> 11 & 0x0f
+	if flags&0x8000 != 0 || (opcode != 5 && opcode != 8 && opcode != 9) || payload[12] != 32 {
+		return ""
+	}
+	if payload[50] != 0xc0 || binary.BigEndian.Uint16(payload[62:64])&0x8000 != 0 {
+		return ""
+	}
+
+	// Each byte of the name is two letters from 'A' holding a nibble each;
+	// the 16th byte is the suffix, 0x00 for the workstation name
+	var name [16]byte
+	for i := range name {
+		high, low := payload[13+2*i]-'A', payload[14+2*i]-'A'
+		if high > 15 || low > 15 {
+			return ""
+		}
+		name[i] = high<<4 | low
+	}
+	if name[15] != 0x00 && name[15] != 0x20 {
+		return ""
+	}
+	return strings.TrimSpace(string(name[:15]))
+}
+
+// observedMAC normalizes a hardware address from a frame, returning "" for
+// one that can't be a host's own
+func observedMAC(hw net.HardwareAddr) string {
+	if len(hw) != 6 || hw[0]&0x01 != 0 || hw.String() == "00:00:00:00:00:00" {
+		return ""
+	}
+	return NormalizeMACAddress(hw.String())
+}
+
+// sniffInterface picks the interface to capture on: the one holding the
+// source address, else the one on the network of the first target. It
+// returns "" when neither is known, which captures on all interfaces where
+// the platform allows it.
+func sniffInterface(source net.IP, targets *Targets) string {
+	var first net.IP
+	if targets != nil {
+		targets.iterate(func(ip net.IP) bool {
+			first = dup(ip)
+			return false
+		})
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	onTarget := ""
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			network, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if source != nil && network.IP.Equal(source) {
+				return iface.Name
+			}
+			if onTarget == "" && first != nil && network.Contains(first) {
+				onTarget = iface.Name
+			}
+		}
+	}
+	return onTarget
+}
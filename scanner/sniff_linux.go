@@ -0,0 +1,95 @@
+//go:build linux && !pcap
+
+package scanner
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// packetSource reads frames from an AF_PACKET socket, which needs root or
+// CAP_NET_RAW but no libpcap
+type packetSource struct {
+	fd    int
+	buf   []byte
+	bound bool // Bound to one interface, which frames are sent out of
+}
+
+// openFrameSource opens a raw packet socket on iface, or on every interface
+// when iface is ""
+func openFrameSource(iface string) (frameSource, error) {
+	protocol := htons(syscall.ETH_P_ALL)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, int(protocol))
+	if err != nil {
+		return nil, fmt.Errorf("opening a packet socket (needs root or CAP_NET_RAW): %v", err)
+	}
+	if iface != "" {
+		link, err := net.InterfaceByName(iface)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+		if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: protocol, Ifindex: link.Index}); err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("binding to %s: %v", iface, err)
+		}
+	}
+	// A read timeout lets the sniffer notice it was stopped
+	timeout := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &packetSource{fd: fd, buf: make([]byte, 65536), bound: iface != ""}, nil
+}
+
+func (p *packetSource) ReadFrame() ([]byte, error) {
+	for {
+		n, from, err := syscall.Recvfrom(p.fd, p.buf, 0)
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		link, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok {
+			continue
+		}
+		// Frames this host sends are looped back too; it isn't one of the
+		// hosts being listened for
+		if link.Pkttype == syscall.PACKET_OUTGOING {
+			continue
+		}
+		// An unbound socket also reads links without Ethernet headers, such
+		// as tun and WireGuard interfaces, whose frames would parse as junk
+		if link.Hatype != syscall.ARPHRD_ETHER {
+			continue
+		}
+		return p.buf[:n], nil
+	}
+}
+
+// WriteFrame sends frame out of the interface the socket is bound to
+func (p *packetSource) WriteFrame(frame []byte) error {
+	if !p.bound {
+		return errors.New("sending needs a socket bound to an interface")
+	}
+	_, err := syscall.Write(p.fd, frame)
+	return err
+}
+
+func (p *packetSource) Close() error {
+	return syscall.Close(p.fd)
+}
+
+// htons converts a protocol number to network byte order as the socket
+// calls expect it
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return binary.NativeEndian.Uint16(b[:])
+}
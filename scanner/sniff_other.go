@@ -0,0 +1,11 @@
+//go:build !linux && !pcap
+
+package scanner
+
+import "errors"
+
+// openFrameSource fails: outside Linux capturing needs libpcap, which this
+// build left out so it runs without it
+func openFrameSource(iface string) (frameSource, error) {
+	return nil, errors.New("packet capture on this system needs a build with -tags pcap and libpcap installed")
+}
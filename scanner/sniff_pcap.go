@@ -0,0 +1,95 @@
+//go:build pcap
+
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// pcapSource reads frames through libpcap, or Npcap on Windows
+type pcapSource struct {
+	handle *pcap.Handle
+}
+
+// openFrameSource opens a live capture on iface, or on the first device
+// libpcap lists when iface is ""
+func openFrameSource(iface string) (frameSource, error) {
+	if iface == "" {
+		devices, err := pcap.FindAllDevs()
+		if err != nil {
+			return nil, fmt.Errorf("listing capture devices: %v", err)
+		}
+		if len(devices) == 0 {
+			return nil, errors.New("no capture devices; capturing may need root or administrator rights")
+		}
+		iface = devices[0].Name
+	} else if name, ok := pcapDeviceName(iface); ok {
+		iface = name
+	}
+	handle, err := pcap.OpenLive(iface, 1600, true, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("capturing on %s: %v", iface, err)
+	}
+	// Only what other hosts send is of interest; not every platform can
+	// filter by direction, which just costs some decoding
+	handle.SetDirection(pcap.DirectionIn)
+	if err := handle.SetBPFFilter("arp or udp port 67 or udp port 68 or udp port 137 or udp port 5353"); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("setting capture filter: %v", err)
+	}
+	return &pcapSource{handle: handle}, nil
+}
+
+func (p *pcapSource) ReadFrame() ([]byte, error) {
+	frame, _, err := p.handle.ReadPacketData()
+	if errors.Is(err, pcap.NextErrorTimeoutExpired) {
+		return nil, nil
+	}
+	return frame, err
+}
+
+// WriteFrame injects frame on the capture's interface
+func (p *pcapSource) WriteFrame(frame []byte) error {
+	return p.handle.WritePacketData(frame)
+}
+
+func (p *pcapSource) Close() error {
+	p.handle.Close()
+	return nil
+}
+
+// pcapDeviceName maps an interface name as Go reports it to the libpcap
+// device holding the same addresses. They differ on Windows, where libpcap
+// names devices \Device\NPF_{GUID}.
+func pcapDeviceName(iface string) (string, bool) {
+	link, err := net.InterfaceByName(iface)
+	if err != nil {
+		return "", false
+	}
+	addrs, err := link.Addrs()
+	if err != nil {
+		return "", false
+	}
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return "", false
+	}
+	for _, device := range devices {
+		if device.Name == iface {
+			return iface, true
+		}
+		for _, address := range device.Addresses {
+			for _, addr := range addrs {
+				if network, ok := addr.(*net.IPNet); ok && network.IP.Equal(address.IP) {
+					return device.Name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
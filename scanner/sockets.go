@@ -0,0 +1,251 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// sockets bounds the connections open at once across the whole process:
+// workers, their concurrent port dials and the protocol resolvers all draw
+// on the one open file limit
+var sockets = &socketLimiter{}
+
+// socketLimiter is a resizable semaphore of socket slots. Each connection
+// keeps the channel it took its slot from, so resizing between scans never
+// releases a slot into the wrong one.
+type socketLimiter struct {
+	mu        sync.Mutex
+	slots     chan struct{} // nil when unlimited
+	limit     int
+	fromFiles bool // limit was derived from the open file limit
+}
+
+// socketUse is one scan's share of the socket limit. Several scans can run
+// at once, e.g. a deep probe during a sweep, so each counts its own waits
+// and has its waiting dials give up only when it is stopped.
+type socketUse struct {
+	stop      <-chan struct{} // Closed when the scan is stopped
+	waits     int64           // Dials that had to wait for a slot
+	warned    atomic.Bool     // The limit was reported as the bottleneck
+	exhausted atomic.Bool     // A dial failed for lack of file descriptors
+}
+
+// newSocketUse starts the share of a scan whose stop channel is stop
+func newSocketUse(stop <-chan struct{}) *socketUse {
+	return &socketUse{stop: stop}
+}
+
+// DefaultMaxSockets returns the socket ceiling used when Options.MaxSockets
+// is zero: three quarters of the open file limit, leaving the rest for the
+// report, the OUI database, the web server and the OS's own needs. Zero
+// means no limit was detected and connections are not bounded.
+func DefaultMaxSockets() int {
+	files, ok := fileLimit()
+	if !ok || files > 1<<20 {
+		return 0
+	}
+	return max(16, int(files)*3/4)
+}
+
+// maxSockets returns the configured socket ceiling, 0 for none
+func (o Options) maxSockets() int {
+	switch {
+	case o.MaxSockets > 0:
+		return o.MaxSockets
+	case o.MaxSockets < 0:
+		return 0
+	}
+	return DefaultMaxSockets()
+}
+
+// setLimit resizes the semaphore for a new scan
+func (l *socketLimiter) setLimit(limit int, fromFiles bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit != l.limit {
+		l.slots = nil
+		if limit > 0 {
+			l.slots = make(chan struct{}, limit)
+		}
+		l.limit = limit
+	}
+	l.fromFiles = fromFiles
+}
+
+// errStopped fails a dial that was waiting for a socket slot when the scan
+// was stopped
+var errStopped = errors.New("scan stopped while waiting for a socket slot")
+
+// acquire blocks until a socket slot is free, ctx is done or every scan in
+// uses, those probing the host dialed, is stopped. It returns the channel to
+// release the slot to.
+func (l *socketLimiter) acquire(ctx context.Context, uses []*socketUse) (chan struct{}, error) {
+	l.mu.Lock()
+	slots, fromFiles := l.slots, l.fromFiles
+	l.mu.Unlock()
+	if slots == nil {
+		return nil, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return slots, nil
+	default:
+	}
+
+	for _, use := range uses {
+		atomic.AddInt64(&use.waits, 1)
+		if use.warned.Swap(true) {
+			continue
+		}
+		if fromFiles {
+			files, _ := fileLimit()
+			log.Printf("Warning: %d connections open, the most the open file limit of %d allows; probes are queuing. Raise ulimit -n for a faster scan", cap(slots), files)
+		} else {
+			log.Printf("Warning: %d connections open, the --max-sockets limit; probes are queuing", cap(slots))
+		}
+	}
+
+	stop, done := allStopped(uses)
+	defer done()
+	select {
+	case slots <- struct{}{}:
+		return slots, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-stop:
+		return nil, errStopped
+	}
+}
+
+// allStopped returns a channel closed once every scan in uses is stopped,
+// nil when there are none, and the function that frees it when the caller
+// stops waiting
+func allStopped(uses []*socketUse) (<-chan struct{}, func()) {
+	switch len(uses) {
+	case 0:
+		return nil, func() {}
+	case 1:
+		return uses[0].stop, func() {}
+	}
+	all := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		for _, use := range uses {
+			select {
+			case <-use.stop:
+			case <-done:
+				return
+			}
+		}
+		close(all)
+	}()
+	return all, func() { close(done) }
+}
+
+// release frees a slot taken by acquire
+func release(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// noteDialError reports, once per scan in uses, a dial that failed because
+// the process or system ran out of file descriptors despite the limit
+func noteDialError(err error, uses []*socketUse) {
+	if !errors.Is(err, syscall.EMFILE) && !errors.Is(err, syscall.ENFILE) {
+		return
+	}
+	for _, use := range uses {
+		if !use.exhausted.Swap(true) {
+			files, _ := fileLimit()
+			log.Printf("Warning: out of file descriptors (open file limit %d): %v. Lower --max-sockets or raise ulimit -n; until then hosts may look down", files, err)
+		}
+	}
+}
+
+// limitedConn gives its socket slot back when closed
+type limitedConn struct {
+	net.Conn
+	slots  chan struct{}
+	once   sync.Once
+	unbind func() bool // Stops the close on skipping its host, nil if none
+}
+
+func (c *limitedConn) Close() error {
+	if c.unbind != nil {
+		c.unbind()
+	}
+	err := c.Conn.Close()
+	c.once.Do(func() { release(c.slots) })
+	return err
+}
+
+// dialContext dials addr with d once a socket slot is free, through the
+// SOCKS5 proxy when one is set. The slot is held until the returned
+// connection is closed. When the host is being probed, skipping it cancels
+// the dial and closes the connection, and the scans probing it count the
+// wait for a slot.
+func dialContext(ctx context.Context, d *net.Dialer, network, addr string) (net.Conn, error) {
+	hostCtx, uses := hostProbes.lookup(addr)
+	if hostCtx != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(hostCtx, cancel)()
+	}
+	slots, err := sockets.acquire(ctx, uses)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	if route := proxied.get(); route != nil {
+		conn, err = dialProxied(ctx, route, d, network, addr)
+	} else {
+		conn, err = d.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		release(slots)
+		noteDialError(err, uses)
+		return nil, err
+	}
+	limited := &limitedConn{Conn: conn, slots: slots}
+	if hostCtx != nil {
+		limited.unbind = context.AfterFunc(hostCtx, func() { conn.Close() })
+	}
+	return limited, nil
+}
+
+// dial is dialContext without a context
+func dial(d *net.Dialer, network, addr string) (net.Conn, error) {
+	return dialContext(context.Background(), d, network, addr)
+}
+
+// limitedDial returns d's DialContext bounded by the socket limit, for
+// http.Transport
+func limitedDial(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialContext(ctx, d, network, addr)
+	}
+}
+
+// dialTLS connects to addr over TCP within the socket limit and completes a
+// TLS handshake before ctx is done
+func dialTLS(ctx context.Context, d *net.Dialer, addr string, config *tls.Config) (*tls.Conn, error) {
+	conn, err := dialContext(ctx, d, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// fileLimit returns the soft limit on open files, which Go raises to the
+// hard limit at startup on most systems
+func fileLimit() (uint64, bool) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, false
+	}
+	return uint64(rlimit.Cur), true
+}
+
+// isRefused reports whether a connect failed with ECONNREFUSED, the target
+// answering with a RST
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
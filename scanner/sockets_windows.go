@@ -0,0 +1,22 @@
+package scanner
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaECONNREFUSED is the Winsock error of a refused connect, which does not
+// match syscall.ECONNREFUSED
+const wsaECONNREFUSED = syscall.Errno(10061)
+
+// fileLimit reports no limit: Windows has no per-process cap on sockets
+// comparable to RLIMIT_NOFILE
+func fileLimit() (uint64, bool) {
+	return 0, false
+}
+
+// isRefused reports whether a connect failed with WSAECONNREFUSED, the
+// target answering with a RST
+func isRefused(err error) bool {
+	return errors.Is(err, wsaECONNREFUSED) || errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,171 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// proxyCheckTimeout bounds the connection to the proxy made before a scan
+const proxyCheckTimeout = 5 * time.Second
+
+// socksRefused ends the error of a dial the proxy answered with SOCKS5
+// reply 5, connection refused by the target
+const socksRefused = "connection refused"
+
+// errUDPOverProxy fails UDP dials while TCP goes through a SOCKS5 proxy,
+// which would otherwise leave from this machine straight to the target
+var errUDPOverProxy = errors.New("UDP is not carried through the SOCKS5 proxy")
+
+// proxied routes TCP dials through the SOCKS5 proxy of the last Scanner
+// made, see Options.SOCKS5. Like the socket limit it is process-wide, since
+// every dial helper goes through it; it is installed when the Scanner is
+// made, so Resolve and handshakes outside a scan go through it too.
+var proxied = &proxyRoute{}
+
+// proxyRoute holds the dialer of the SOCKS5 proxy in use
+type proxyRoute struct {
+	mu     sync.RWMutex
+	dialer proxy.ContextDialer // nil to connect directly
+}
+
+// set sends later TCP dials through the proxy at spec, or directly for "".
+// A spec that can't be used fails every dial instead, so none leaves for
+// the target directly; CheckProxy reports why.
+func (r *proxyRoute) set(spec string) {
+	var d proxy.ContextDialer
+	if spec != "" {
+		if addr, auth, err := parseSOCKS5(spec); err != nil {
+			d = brokenProxy{err}
+		} else if socks, err := proxy.SOCKS5("tcp", addr, auth, proxyForward{}); err != nil {
+			d = brokenProxy{err}
+		} else {
+			d = socks.(proxy.ContextDialer)
+		}
+	}
+	r.mu.Lock()
+	r.dialer = d
+	r.mu.Unlock()
+}
+
+// get returns the proxy dialer, nil when dials go directly
+func (r *proxyRoute) get() proxy.ContextDialer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dialer
+}
+
+// dialProxied connects to addr through route within d's timeout
+func dialProxied(ctx context.Context, route proxy.ContextDialer, d *net.Dialer, network, addr string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, errUDPOverProxy
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	conn, err := route.DialContext(ctx, network, addr)
+	var proxyErr *proxyError
+	if err != nil && !errors.As(err, &proxyErr) && strings.HasSuffix(err.Error(), socksRefused) {
+		// The proxy relays the target's RST as a reply code without an
+		// errno, so hand it on as the refusal a direct dial would see
+		return nil, fmt.Errorf("%v: %w", err, syscall.ECONNREFUSED)
+	}
+	return conn, err
+}
+
+// proxyError is a failure to reach the proxy itself, which says nothing
+// about the target: a refused connection to the proxy is no sign of life
+type proxyError struct {
+	err error
+}
+
+func (e *proxyError) Error() string { return "SOCKS5 proxy: " + e.err.Error() }
+
+func (e *proxyError) Unwrap() error { return e.err }
+
+// brokenProxy stands in for a proxy that could not be set up, failing
+// every dial with its error
+type brokenProxy struct {
+	err error
+}
+
+func (p brokenProxy) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, &proxyError{p.err}
+}
+
+// proxyForward connects to the SOCKS5 proxy, marking its failures as
+// proxyError
+type proxyForward struct{}
+
+func (f proxyForward) Dial(network, addr string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, addr)
+}
+
+func (proxyForward) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, &proxyError{err}
+	}
+	return conn, nil
+}
+
+// parseSOCKS5 reads a proxy given as host:port or user:password@host:port
+func parseSOCKS5(spec string) (string, *proxy.Auth, error) {
+	spec = strings.TrimPrefix(strings.TrimSpace(spec), "socks5://")
+	var auth *proxy.Auth
+	if credentials, addr, ok := strings.Cut(spec, "@"); ok {
+		user, password, _ := strings.Cut(credentials, ":")
+		auth = &proxy.Auth{User: user, Password: password}
+		spec = addr
+	}
+	host, port, err := net.SplitHostPort(spec)
+	if err != nil || host == "" || port == "" {
+		return "", nil, fmt.Errorf("SOCKS5 proxy %q: want host:port or user:password@host:port", spec)
+	}
+	return spec, auth, nil
+}
+
+// CheckProxy reports whether the SOCKS5 proxy in Options.SOCKS5, if any, is
+// well formed and accepts connections, so a scan doesn't find every host
+// down because the proxy is
+func (o Options) CheckProxy() error {
+	if o.SOCKS5 == "" {
+		return nil
+	}
+	if o.Passive {
+		return errors.New("a passive scan sends nothing to route through a SOCKS5 proxy")
+	}
+	addr, _, err := parseSOCKS5(o.SOCKS5)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", addr, proxyCheckTimeout)
+	if err != nil {
+		return fmt.Errorf("SOCKS5 proxy %s unreachable: %w", addr, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// viaProxy turns off what needs direct access to the target network when
+// TCP goes through a SOCKS5 proxy: the ARP sweep, the sniffer and MAC
+// lookups. UDP probes such as NetBIOS and mDNS are skipped where they run.
+func (o Options) viaProxy() Options {
+	if o.SOCKS5 == "" {
+		return o
+	}
+	o.ARPScan = false
+	o.Sniff = false
+	o.RemoteMAC = false
+	return o
+}
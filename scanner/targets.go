@@ -0,0 +1,226 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Targets is a set of addresses to scan, built from CIDRs, single addresses
+// and start-end ranges. Overlapping and adjacent entries are merged, so each
+// address is probed once however often it is listed.
+type Targets struct {
+	ranges []ipRange // Sorted and merged
+	counts []uint64  // Addresses before each range, for random access
+	total  uint64    // Addresses in all ranges, math.MaxUint64 if more
+	specs  []string  // The targets as given, for String
+}
+
+// ipRange is an inclusive span of addresses, both in 16-byte form
+type ipRange struct {
+	start, end net.IP
+}
+
+// NewTargets returns the addresses of ipNet that IterateIPs yields: every
+// host, without the network and broadcast addresses of ranges larger than
+// a /31
+func NewTargets(ipNet *net.IPNet) *Targets {
+	t := &Targets{}
+	t.addNet(ipNet)
+	t.specs = []string{ipNet.String()}
+	t.merge()
+	return t
+}
+
+// ParseTargets reads one target per line: a CIDR (10.0.0.0/24), an address
+// (10.0.0.5) or a range (10.0.0.10-10.0.0.20, or 10.0.0.10-20 within the
+// last octet). Blank lines and anything after # are ignored.
+func ParseTargets(r io.Reader) (*Targets, error) {
+	t := &Targets{}
+	lines := bufio.NewScanner(r)
+	for n := 1; lines.Scan(); n++ {
+		line, _, _ := strings.Cut(lines.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := t.add(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.specs) == 0 {
+		return nil, fmt.Errorf("no targets found")
+	}
+	t.merge()
+	return t, nil
+}
+
+// add parses one target and appends its addresses
+func (t *Targets) add(spec string) error {
+	switch {
+	case strings.Contains(spec, "/"):
+		_, ipNet, err := net.ParseCIDR(spec)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q", spec)
+		}
+		t.addNet(ipNet)
+		spec = ipNet.String() // 10.0.0.5/24 names 10.0.0.0/24
+	case strings.Contains(spec, "-"):
+		from, to, _ := strings.Cut(spec, "-")
+		start := net.ParseIP(strings.TrimSpace(from))
+		if start == nil {
+			return fmt.Errorf("invalid range %q", spec)
+		}
+		end := net.ParseIP(strings.TrimSpace(to))
+		if end == nil && start.To4() != nil {
+			// Short form: only the last octet of the end address
+			if octet, err := strconv.ParseUint(strings.TrimSpace(to), 10, 8); err == nil {
+				end = dup(start.To4())
+				end[3] = byte(octet)
+			}
+		}
+		if end == nil || (start.To4() == nil) != (end.To4() == nil) {
+			return fmt.Errorf("invalid range %q", spec)
+		}
+		start, end = start.To16(), end.To16()
+		if bytes.Compare(start, end) > 0 {
+			return fmt.Errorf("range %q ends before it starts", spec)
+		}
+		t.ranges = append(t.ranges, ipRange{start: start, end: end})
+	default:
+		ip := net.ParseIP(spec)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", spec)
+		}
+		t.ranges = append(t.ranges, ipRange{start: ip.To16(), end: ip.To16()})
+	}
+	t.specs = append(t.specs, spec)
+	return nil
+}
+
+// addNet appends the hosts of ipNet
+func (t *Targets) addNet(ipNet *net.IPNet) {
+	network := ipNet.IP.Mask(ipNet.Mask)
+	first, last := dup(network), dup(network)
+	for i := range last {
+		last[i] |= ^ipNet.Mask[i]
+	}
+	if ones, bits := ipNet.Mask.Size(); bits-ones >= 2 {
+		inc(first) // skip the network address
+		dec(last)  // and the broadcast address
+	}
+	t.ranges = append(t.ranges, ipRange{start: first.To16(), end: last.To16()})
+}
+
+// merge sorts the ranges, joins those that overlap or touch and counts the
+// addresses
+func (t *Targets) merge() {
+	sort.Slice(t.ranges, func(i, j int) bool {
+		return bytes.Compare(t.ranges[i].start, t.ranges[j].start) < 0
+	})
+
+	merged := t.ranges[:0]
+	for _, r := range t.ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			next := dup(last.end)
+			inc(next)
+			sameFamily := (last.end.To4() == nil) == (r.start.To4() == nil)
+			if sameFamily && (bytes.Compare(r.start, last.end) <= 0 || r.start.Equal(next)) {
+				if bytes.Compare(r.end, last.end) > 0 {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	t.ranges = merged
+
+	t.counts = make([]uint64, len(t.ranges))
+	t.total = 0
+	for i, r := range t.ranges {
+		t.counts[i] = t.total
+		size := new(big.Int).Sub(new(big.Int).SetBytes(r.end), new(big.Int).SetBytes(r.start))
+		size.Add(size, big.NewInt(1))
+		if !size.IsUint64() || size.Uint64() > math.MaxUint64-t.total {
+			t.total = math.MaxUint64
+			continue
+		}
+		t.total += size.Uint64()
+	}
+}
+
+// Count returns how many addresses the targets hold, math.MaxUint64 if more
+func (t *Targets) Count() uint64 {
+	return t.total
+}
+
+// Contains reports whether ip is one of the targets
+func (t *Targets) Contains(ip net.IP) bool {
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+	i := sort.Search(len(t.ranges), func(i int) bool {
+		return bytes.Compare(t.ranges[i].end, ip) >= 0
+	})
+	return i < len(t.ranges) && bytes.Compare(t.ranges[i].start, ip) <= 0
+}
+
+// String names the targets for progress messages and reports: the only
+// target as given, or the first one and how many more follow, e.g.
+// 10.0.0.0/24+3
+func (t *Targets) String() string {
+	switch len(t.specs) {
+	case 0:
+		return ""
+	case 1:
+		return t.specs[0]
+	default:
+		return fmt.Sprintf("%s+%d", t.specs[0], len(t.specs)-1)
+	}
+}
+
+// iterate calls fn with each address in ascending order until fn returns
+// false. Each address is a fresh copy fn may keep.
+func (t *Targets) iterate(fn func(net.IP) bool) {
+	for _, r := range t.ranges {
+		for ip := dup(r.start); ; inc(ip) {
+			if !fn(family(ip)) {
+				return
+			}
+			if ip.Equal(r.end) {
+				break
+			}
+		}
+	}
+}
+
+// iterateRandom calls fn with each address in random order until fn
+// returns false
+func (t *Targets) iterateRandom(fn func(net.IP) bool) {
+	permute(t.total, func(index uint64) bool {
+		i := sort.Search(len(t.counts), func(i int) bool { return t.counts[i] > index }) - 1
+		return fn(family(addOffset(t.ranges[i].start, index-t.counts[i])))
+	})
+}
+
+// family returns a copy of ip in 4-byte form for IPv4, as net.ParseCIDR
+// gives it
+func family(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return dup(v4)
+	}
+	return dup(ip)
+}
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telnetPorts are the ports whose Telnet banner is read: the standard port
+// and the alternate many IoT devices use
+var telnetPorts = []int{23, 2323}
+
+// cleartextServices are remote login services that send credentials
+// unencrypted. An open one is noted on the device as a security finding.
+var cleartextServices = map[int]string{
+	23:   "Telnet",
+	512:  "rexec",
+	513:  "rlogin",
+	514:  "rsh",
+	2323: "Telnet",
+}
+
+// Telnet commands, RFC 854
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+)
+
+// noteCleartext notes each open remote login service that sends credentials
+// in clear text
+func noteCleartext(device *Device) {
+	for _, port := range device.OpenPorts {
+		if name, ok := cleartextServices[port]; ok {
+			device.addNote("Insecure service: %s on port %d sends credentials in clear text", name, port)
+		}
+	}
+}
+
+// probeTelnet reads the banner of each open Telnet port into device.Banners
+func (s *Scanner) probeTelnet(device *Device) {
+	for _, port := range telnetPorts {
+		if !contains(device.OpenPorts, port) {
+			continue
+		}
+		release := s.acquireResolver()
+		start := time.Now()
+		banner, err := getTelnetBanner(device.IPAddress, port, s.opts.SourceIP, s.opts.Intensity.resolverTimeoutScale())
+		release()
+		s.timing().resolved(PhaseTelnet, start, err == nil)
+		if err != nil {
+			log.Printf("Telnet banner from %s:%d unavailable: %v", device.IPAddress, port, err)
+			continue
+		}
+		log.Printf("Telnet banner from %s:%d: %q", device.IPAddress, port, banner)
+		device.setBanner(port, banner)
+	}
+}
+
+// getTelnetBanner returns the text the Telnet server at ip sends before the
+// login prompt, refusing every option it asks to negotiate. Reading stops at
+// a prompt, after a short lull once text has arrived, or at the timeout.
+func getTelnetBanner(ip string, port int, source net.IP, timeoutScale int) (string, error) {
+	scale := time.Duration(timeoutScale)
+	timeout := time.Second * 2 * scale
+	conn, err := dial(dialer("tcp", source, timeout), "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	var t telnetReader
+	deadline := time.Now().Add(timeout * 2)
+	buf := make([]byte, 512)
+	for len(t.text) < bannerMaxLength {
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		if reply := t.feed(buf[:n]); len(reply) > 0 {
+			conn.SetWriteDeadline(deadline)
+			if _, err := conn.Write(reply); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+		if atPrompt(t.text) {
+			break
+		}
+		if len(strings.TrimSpace(string(t.text))) > 0 {
+			if lull := time.Now().Add(time.Millisecond * 500 * scale); lull.Before(deadline) {
+				deadline = lull
+			}
+		}
+	}
+
+	banner := strings.TrimSpace(string(t.text))
+	if banner == "" {
+		return "", errors.New("no banner before the login prompt")
+	}
+	return banner, nil
+}
+
+// atPrompt reports whether text ends in a login, password or shell prompt
+func atPrompt(text []byte) bool {
+	trimmed := strings.TrimRight(string(text), " ")
+	return strings.HasSuffix(trimmed, ":") || strings.HasSuffix(trimmed, ">") ||
+		strings.HasSuffix(trimmed, "#") || strings.HasSuffix(trimmed, "$")
+}
+
+// telnetReader separates the text of a Telnet stream from its commands,
+// which may be split across reads
+type telnetReader struct {
+	text  []byte
+	state int  // Bytes of the current command seen, 0 outside one
+	verb  byte // Negotiation verb awaiting its option
+	sub   bool // Inside a subnegotiation
+}
+
+// feed consumes data and returns the replies refusing the options the
+// server asked for
+func (t *telnetReader) feed(data []byte) []byte {
+	var reply []byte
+	for _, b := range data {
+		switch {
+		case t.state == 0 && b == telnetIAC:
+			t.state = 1
+		case t.state == 0:
+			if !t.sub && b != 0 && b != '\r' {
+				t.text = append(t.text, b)
+			}
+		case t.state == 1:
+			t.state = 0
+			switch b {
+			case telnetIAC:
+				if !t.sub {
+					t.text = append(t.text, b)
+				}
+			case telnetSB:
+				t.sub = true
+			case telnetSE:
+				t.sub = false
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.verb, t.state = b, 2
+			}
+		case t.state == 2:
+			t.state = 0
+			switch t.verb {
+			case telnetDO:
+				reply = append(reply, telnetIAC, telnetWONT, b)
+			case telnetWILL:
+				reply = append(reply, telnetIAC, telnetDONT, b)
+			}
+		}
+	}
+	return reply
+}
@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"log"
+	"sync"
+)
+
+const (
+	// throttleWindow is how many hosts are probed between adjustments
+	throttleWindow = 32
+	// throttleThreshold is how far a window's timeout ratio may rise above
+	// the best window seen before concurrency is cut
+	throttleThreshold = 0.25
+)
+
+// throttle caps how many hosts are probed at once with AIMD control: the cap
+// grows by a step after each healthy window and halves when timeouts rise.
+//
+// The signal is the ports the workers record in their stats: those on live
+// hosts, plus local dial failures such as running out of sockets. A live
+// host's ports normally answer or time out in a steady mix; more of them
+// timing out means the link or an upstream limiter is dropping probes.
+type throttle struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int // Hosts that may be probed at once
+	max    int // The worker count, which limit never exceeds
+	step   int // Additive increase per healthy window
+	active int
+
+	totals   func() (probed, timedOut int) // Port counts so far, summed from the worker stats
+	hosts    int                           // Hosts probed this window
+	probed   int                           // totals when this window started
+	timedOut int
+	best     float64 // Lowest timeout ratio of any window, -1 before the first
+}
+
+// newThrottle starts at a quarter of workers and grows from there, judging
+// each window by the port counts totals returns
+func newThrottle(workers int, totals func() (probed, timedOut int)) *throttle {
+	t := &throttle{
+		limit:  max(1, workers/4),
+		max:    workers,
+		step:   max(1, workers/10),
+		totals: totals,
+		best:   -1,
+	}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire blocks until a probe slot is free or stopped reports true, and
+// says whether the slot was taken. waiting is called once if the caller has
+// to wait.
+func (t *throttle) acquire(stopped func() bool, waiting func()) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.active >= t.limit {
+		if stopped() {
+			return false
+		}
+		if waiting != nil {
+			waiting()
+			waiting = nil
+		}
+		t.cond.Wait()
+	}
+	t.active++
+	return true
+}
+
+// release frees a slot once the host's probe is recorded in the worker stats
+func (t *throttle) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	t.hosts++
+
+	if t.hosts >= throttleWindow {
+		t.adjust()
+	}
+	t.cond.Broadcast()
+}
+
+// adjust applies AIMD at the end of a window. The caller must hold mu.
+func (t *throttle) adjust() {
+	probed, timedOut := t.totals()
+	windowProbed, windowTimedOut := probed-t.probed, timedOut-t.timedOut
+	if windowProbed < 0 || windowTimedOut < 0 {
+		// A retry pass's workers started counting afresh
+		windowProbed, windowTimedOut = probed, timedOut
+	}
+	t.hosts, t.probed, t.timedOut = 0, probed, timedOut
+
+	ratio := 0.0
+	if windowProbed > 0 {
+		ratio = float64(windowTimedOut) / float64(windowProbed)
+	}
+
+	if t.best < 0 || ratio < t.best {
+		t.best = ratio
+	}
+	if ratio > t.best+throttleThreshold {
+		limit := max(1, t.limit/2)
+		if limit != t.limit {
+			log.Printf("Timeouts rose to %.0f%% (best %.0f%%), cutting concurrency from %d to %d",
+				ratio*100, t.best*100, t.limit, limit)
+		}
+		t.limit = limit
+		return
+	}
+	t.limit = min(t.max, t.limit+t.step)
+}
+
+// wake releases waiters so they can notice the scan was stopped
+func (t *throttle) wake() {
+	t.mu.Lock()
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// current returns the concurrency cap
+func (t *throttle) current() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
@@ -0,0 +1,251 @@
+package scanner
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scan phases timed for ScanStats: reaching the host, finding its MAC, and
+// each name lookup and handshake run on it
+const (
+	PhaseReachability = "reachability"
+	PhaseMAC          = "mac"
+	PhaseDNS          = "dns"
+	PhaseAFP          = "afp"
+	PhaseNetBIOS      = "netbios"
+	PhaseSMB          = "smb"
+	PhaseRDP          = "rdp"
+	PhaseMDNS         = "mdns"
+	PhaseTLS          = "tls"
+	PhaseWeb          = "web"
+	PhaseVNC          = "vnc"
+	PhaseFTP          = "ftp"
+	PhaseTelnet       = "telnet"
+	PhaseLDAP         = "ldap"
+	PhasePrinter      = "printer"
+	PhaseHypervisor   = "hypervisor"
+)
+
+// timedPhases lists the phases in the order a host goes through them
+var timedPhases = []string{
+	PhaseReachability, PhaseMAC, PhaseTLS, PhaseWeb, PhaseVNC, PhaseFTP, PhaseTelnet, PhaseLDAP,
+	PhaseDNS, PhaseAFP, PhaseNetBIOS, PhaseSMB, PhaseRDP, PhaseMDNS, PhasePrinter, PhaseHypervisor,
+}
+
+// timingBuckets are the upper bounds of the duration histogram of each
+// phase; a last bucket holds anything slower
+var timingBuckets = [...]time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// slowestKept is how many of the slowest hosts ScanStats lists
+const slowestKept = 10
+
+// phaseTimer accumulates the runs of one phase. Its counters are updated
+// atomically, so workers never wait on each other to record one.
+type phaseTimer struct {
+	count   int64
+	ok      int64
+	failed  int64
+	total   int64 // Nanoseconds
+	max     int64 // Nanoseconds
+	buckets [len(timingBuckets) + 1]int64
+}
+
+// add records one run of the phase that took elapsed
+func (p *phaseTimer) add(elapsed time.Duration) {
+	atomic.AddInt64(&p.count, 1)
+	atomic.AddInt64(&p.total, int64(elapsed))
+	for {
+		max := atomic.LoadInt64(&p.max)
+		if int64(elapsed) <= max || atomic.CompareAndSwapInt64(&p.max, max, int64(elapsed)) {
+			break
+		}
+	}
+	bucket := sort.Search(len(timingBuckets), func(i int) bool { return elapsed <= timingBuckets[i] })
+	atomic.AddInt64(&p.buckets[bucket], 1)
+}
+
+// timings is where one scan's time went. The phase map is filled in when
+// it is made and only read after, so it needs no lock.
+type timings struct {
+	network  string
+	started  time.Time
+	finished atomic.Int64 // UnixNano of completion, 0 while the scan runs
+	phases   map[string]*phaseTimer
+	hosts    int64 // Hosts probed, a retried host once per pass
+
+	slowMutex sync.Mutex
+	slowest   []HostTiming // Slowest first, at most slowestKept
+}
+
+// newTimings starts the timings of a scan of network
+func newTimings(network string) *timings {
+	t := &timings{network: network, started: time.Now(), phases: make(map[string]*phaseTimer, len(timedPhases))}
+	for _, phase := range timedPhases {
+		t.phases[phase] = &phaseTimer{}
+	}
+	return t
+}
+
+// resolved records a run of phase begun at start and whether it got the
+// answer it was after. A nil timings records nothing, as when a lookup runs
+// outside a scan.
+func (t *timings) resolved(phase string, start time.Time, ok bool) {
+	if t == nil {
+		return
+	}
+	p := t.phases[phase]
+	p.add(time.Since(start))
+	if ok {
+		atomic.AddInt64(&p.ok, 1)
+	} else {
+		atomic.AddInt64(&p.failed, 1)
+	}
+}
+
+// host records the time a worker spent on ip, begun at start, keeping it if
+// it is among the slowest so far. A host retried keeps its slowest pass.
+func (t *timings) host(ip string, start time.Time) {
+	if t == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	atomic.AddInt64(&t.hosts, 1)
+
+	t.slowMutex.Lock()
+	defer t.slowMutex.Unlock()
+	if len(t.slowest) == slowestKept && elapsed <= t.slowest[len(t.slowest)-1].Duration {
+		return
+	}
+	for i, h := range t.slowest {
+		if h.IPAddress == ip {
+			if elapsed <= h.Duration {
+				return
+			}
+			t.slowest = append(t.slowest[:i], t.slowest[i+1:]...)
+			break
+		}
+	}
+	at := sort.Search(len(t.slowest), func(i int) bool { return t.slowest[i].Duration < elapsed })
+	t.slowest = append(t.slowest, HostTiming{})
+	copy(t.slowest[at+1:], t.slowest[at:])
+	t.slowest[at] = HostTiming{IPAddress: ip, Duration: elapsed, Millis: millis(elapsed)}
+	if len(t.slowest) > slowestKept {
+		t.slowest = t.slowest[:slowestKept]
+	}
+}
+
+// finish marks the scan complete, freezing its duration
+func (t *timings) finish() {
+	if t != nil {
+		t.finished.CompareAndSwap(0, time.Now().UnixNano())
+	}
+}
+
+// HostTiming is the time the scan spent on one host
+type HostTiming struct {
+	IPAddress string        `json:"ip"`
+	Duration  time.Duration `json:"-"`
+	Millis    float64       `json:"ms"`
+}
+
+// TimingBucket counts the runs of a phase that took at most UpTo, or any
+// longer for the last bucket, whose UpTo is "+Inf"
+type TimingBucket struct {
+	UpTo  string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+// PhaseTiming is the time spent in one phase across the scan. Succeeded
+// and Failed count the runs that did or didn't get an answer, adding up to
+// Count.
+type PhaseTiming struct {
+	Count     int64          `json:"count"`
+	Succeeded int64          `json:"succeeded"`
+	Failed    int64          `json:"failed"`
+	TotalMs   float64        `json:"total_ms"`
+	MeanMs    float64        `json:"mean_ms"`
+	MaxMs     float64        `json:"max_ms"`
+	Histogram []TimingBucket `json:"histogram"`
+}
+
+// ScanReport is where a scan's time went, for tuning: how long it has run,
+// the time spent in each phase, and the hosts that took longest. Phase
+// times add up across workers, so together they can exceed the duration.
+type ScanReport struct {
+	Network    string                 `json:"network"`
+	Started    time.Time              `json:"started"`
+	Complete   bool                   `json:"complete"`
+	DurationMs float64                `json:"duration_ms"`
+	Hosts      int64                  `json:"hosts_probed"` // Hosts a worker took on, a retried host once per pass
+	Counts     ScanStats              `json:"counts"`
+	Phases     map[string]PhaseTiming `json:"phases"`
+	Slowest    []HostTiming           `json:"slowest_hosts"`
+}
+
+// ScanStats returns the timing breakdown of the current or last scan. It
+// can be called while the scan runs; the zero report comes back before the
+// first scan.
+func (s *Scanner) ScanStats() ScanReport {
+	report := ScanReport{Counts: s.Stats(), Phases: map[string]PhaseTiming{}, Slowest: []HostTiming{}}
+	t := s.timing()
+	if t == nil {
+		return report
+	}
+	report.Network = t.network
+	report.Started = t.started
+	report.Hosts = atomic.LoadInt64(&t.hosts)
+	end := time.Now()
+	if finished := t.finished.Load(); finished != 0 {
+		report.Complete = true
+		end = time.Unix(0, finished)
+	}
+	report.DurationMs = millis(end.Sub(t.started))
+
+	for _, phase := range timedPhases {
+		p := t.phases[phase]
+		timing := PhaseTiming{
+			Count:     atomic.LoadInt64(&p.count),
+			Succeeded: atomic.LoadInt64(&p.ok),
+			Failed:    atomic.LoadInt64(&p.failed),
+			TotalMs:   millis(time.Duration(atomic.LoadInt64(&p.total))),
+			MaxMs:     millis(time.Duration(atomic.LoadInt64(&p.max))),
+		}
+		if timing.Count > 0 {
+			timing.MeanMs = timing.TotalMs / float64(timing.Count)
+		}
+		for i := range p.buckets {
+			upTo := "+Inf"
+			if i < len(timingBuckets) {
+				upTo = timingBuckets[i].String()
+			}
+			timing.Histogram = append(timing.Histogram, TimingBucket{UpTo: upTo, Count: atomic.LoadInt64(&p.buckets[i])})
+		}
+		report.Phases[phase] = timing
+	}
+
+	t.slowMutex.Lock()
+	report.Slowest = append(report.Slowest, t.slowest...)
+	t.slowMutex.Unlock()
+	return report
+}
+
+// timing returns the timings of the current scan, nil before the first
+func (s *Scanner) timing() *timings {
+	return s.timings.Load()
+}
+
+// millis converts d to fractional milliseconds, rounded to the microsecond
+func millis(d time.Duration) float64 {
+	return float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+}
@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTLSPorts are the open ports certificates are fetched from when
+// Options.TLSPorts is empty: HTTPS, alternate HTTPS, WinRM over HTTPS and
+// LDAPS. RDP's certificate is read by the RDP lookup, which has to negotiate
+// TLS first.
+var DefaultTLSPorts = []int{443, 8443, 5986, 636}
+
+// Certificate summarizes the certificate a host presented on one port
+type Certificate struct {
+	Subject    string    // Subject common name
+	DNSNames   []string  // Subject alternative names
+	Issuer     string    // Issuer common name
+	NotAfter   time.Time // Expiry
+	SelfSigned bool      // Subject and issuer match
+}
+
+// String returns the subject, or first alternative name, and the expiry date
+func (c Certificate) String() string {
+	name := c.Subject
+	if name == "" && len(c.DNSNames) > 0 {
+		name = c.DNSNames[0]
+	}
+	if name == "" {
+		name = "(no subject)"
+	}
+	text := fmt.Sprintf("%s, expires %s", name, c.NotAfter.Format("2006-01-02"))
+	if c.SelfSigned {
+		text += ", self-signed"
+	}
+	return text
+}
+
+// CertificatePorts returns the ports d has a certificate recorded for, in
+// ascending order
+func (d Device) CertificatePorts() []int {
+	ports := make([]int, 0, len(d.Certificates))
+	for port := range d.Certificates {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// newCertificate summarizes cert
+func newCertificate(cert *x509.Certificate) Certificate {
+	return Certificate{
+		Subject:    cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		Issuer:     cert.Issuer.CommonName,
+		NotAfter:   cert.NotAfter,
+		SelfSigned: cert.Subject.String() == cert.Issuer.String(),
+	}
+}
+
+// tlsPorts returns the configured certificate ports
+func (o Options) tlsPorts() []int {
+	if len(o.TLSPorts) > 0 {
+		return o.TLSPorts
+	}
+	return DefaultTLSPorts
+}
+
+// serverName returns the SNI sent to ip: Options.TLSServerName when set,
+// otherwise the IP itself. Go leaves an IP literal out of the handshake, as
+// RFC 6066 requires, so hosts without a configured name get the server's
+// default certificate.
+func (o Options) serverName(ip string) string {
+	if o.TLSServerName != "" {
+		return o.TLSServerName
+	}
+	return ip
+}
+
+// collectCertificates fetches the certificate on each of device's open TLS
+// ports into device.Certificates, and returns the first hostname one of them
+// names and which certificate that was, for Device.Provenance
+func (s *Scanner) collectCertificates(device *Device) (hostname, source string) {
+	scale := s.opts.Intensity.resolverTimeoutScale()
+	for _, port := range s.opts.tlsPorts() {
+		if !contains(device.OpenPorts, port) {
+			continue
+		}
+		release := s.acquireResolver()
+		start := time.Now()
+		cert, err := fetchCertificate(device.IPAddress, port, s.opts.serverName(device.IPAddress), s.opts.SourceIP, scale)
+		release()
+		s.timing().resolved(PhaseTLS, start, err == nil)
+		if err != nil {
+			log.Printf("No certificate from %s:%d: %v", device.IPAddress, port, err)
+			device.addNote("TLS certificate on port %d unavailable: %v", port, err)
+			continue
+		}
+
+		if device.Certificates == nil {
+			device.Certificates = make(map[int]Certificate)
+		}
+		device.Certificates[port] = newCertificate(cert)
+		if hostname == "" {
+			if name, err := extractHostnameFromCert(cert, device.IPAddress); err == nil {
+				hostname = name
+				source = fmt.Sprintf("TLS certificate on port %d", port)
+			}
+		}
+	}
+	return hostname, source
+}
+
+// fetchCertificate completes a TLS handshake with ip on port, sending
+// serverName as the SNI, and returns the leaf certificate. Certificates are
+// never verified; only their names are wanted.
+func fetchCertificate(ip string, port int, serverName string, source net.IP, timeoutScale int) (*x509.Certificate, error) {
+	timeout := time.Second * 2 * time.Duration(timeoutScale)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	config := &tls.Config{
+		ServerName:         strings.TrimSuffix(serverName, "."),
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	}
+	conn, err := dialTLS(ctx, dialer("tcp", source, timeout), net.JoinHostPort(ip, strconv.Itoa(port)), config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates available")
+	}
+	return certs[0], nil
+}
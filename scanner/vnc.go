@@ -0,0 +1,265 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// portVNC is the RFB port of display :0
+const portVNC = 5900
+
+// vncMaxText caps the length of a desktop name or failure reason read from
+// a host
+const vncMaxText = 1024
+
+// RFB security types, from the IANA registry
+const (
+	vncSecurityInvalid = 0
+	vncSecurityNone    = 1
+)
+
+// vncSecurityNames names the RFB security types seen in the wild
+var vncSecurityNames = map[byte]string{
+	1:   "None",
+	2:   "VNC Authentication",
+	5:   "RA2",
+	6:   "RA2ne",
+	16:  "Tight",
+	17:  "Ultra",
+	18:  "TLS",
+	19:  "VeNCrypt",
+	20:  "SASL",
+	21:  "MD5 hash",
+	22:  "xvp",
+	30:  "Apple Remote Desktop",
+	35:  "Apple",
+	113: "UltraVNC MS-Logon II",
+}
+
+// rfbBanner matches the ProtocolVersion message a VNC server opens with
+var rfbBanner = regexp.MustCompile(`^RFB (\d{3})\.(\d{3})\n$`)
+
+// VNCInfo is what a VNC server revealed in the RFB handshake before
+// authentication
+type VNCInfo struct {
+	Version  string   // Protocol version the server offered, e.g. "3.8"
+	Security []string // Security types offered, e.g. "VNC Authentication"
+	Desktop  string   // Desktop name, only readable when no authentication is required
+	Server   string   // Likely server software, guessed from the version and security types
+	Refused  string   // Why the server refused the connection, e.g. too many failed logins
+}
+
+// AuthRequired reports whether the server offered no way in without a
+// password
+func (v VNCInfo) AuthRequired() bool {
+	for _, security := range v.Security {
+		if security == "None" {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the protocol version, server, whether a password is needed
+// and the desktop name
+func (v VNCInfo) String() string {
+	text := "RFB " + v.Version
+	if v.Server != "" {
+		text += " (" + v.Server + ")"
+	}
+	switch {
+	case v.Refused != "":
+		text += ", refused: " + v.Refused
+	case v.AuthRequired():
+		text += ", auth: " + strings.Join(v.Security, ", ")
+	default:
+		text += ", no auth"
+	}
+	if v.Desktop != "" {
+		text += fmt.Sprintf(", desktop %q", v.Desktop)
+	}
+	return text
+}
+
+// probeVNC reads the RFB handshake of a device with the VNC port open into
+// device.VNC
+func (s *Scanner) probeVNC(device *Device) {
+	if !contains(device.OpenPorts, portVNC) {
+		return
+	}
+	release := s.acquireResolver()
+	start := time.Now()
+	info, err := getVNCInfo(device.IPAddress, s.opts.SourceIP, s.opts.Intensity.resolverTimeoutScale())
+	release()
+	s.timing().resolved(PhaseVNC, start, err == nil)
+	if err != nil {
+		log.Printf("VNC handshake with %s failed: %v", device.IPAddress, err)
+		device.addNote("VNC handshake failed: %v", err)
+		return
+	}
+	log.Printf("VNC on %s: %s", device.IPAddress, info)
+	device.VNC = info
+}
+
+// getVNCInfo reads the RFB version banner and security types from the VNC
+// server at ip. When the server needs no authentication it completes the
+// handshake as a shared client, so other viewers stay connected, to read the
+// desktop name.
+func getVNCInfo(ip string, source net.IP, timeoutScale int) (*VNCInfo, error) {
+	timeout := time.Second * 2 * time.Duration(timeoutScale)
+	conn, err := dial(dialer("tcp", source, timeout), "tcp", net.JoinHostPort(ip, strconv.Itoa(portVNC)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	banner := make([]byte, 12)
+	if _, err := io.ReadFull(conn, banner); err != nil {
+		return nil, fmt.Errorf("reading banner: %v", err)
+	}
+	match := rfbBanner.FindSubmatch(banner)
+	if match == nil {
+		return nil, fmt.Errorf("not an RFB banner: %q", banner)
+	}
+	major, _ := strconv.Atoi(string(match[1]))
+	minor, _ := strconv.Atoi(string(match[2]))
+	info := &VNCInfo{Version: fmt.Sprintf("%d.%d", major, minor)}
+
+	// Answer with the highest version both sides speak. Servers announcing
+	// more than 3.8, such as Apple's 3.889, accept 3.8.
+	if major == 3 && minor < 7 {
+		minor = 3
+	} else if major > 3 || minor > 8 {
+		major, minor = 3, 8
+	}
+	if _, err := fmt.Fprintf(conn, "RFB %03d.%03d\n", major, minor); err != nil {
+		return nil, fmt.Errorf("sending version: %v", err)
+	}
+
+	var types []byte
+	if minor == 3 {
+		// 3.3 servers pick the security type themselves
+		var chosen uint32
+		if err := binary.Read(conn, binary.BigEndian, &chosen); err != nil {
+			return nil, fmt.Errorf("reading security type: %v", err)
+		}
+		if chosen != vncSecurityInvalid {
+			types = []byte{byte(chosen)}
+		}
+	} else {
+		count := make([]byte, 1)
+		if _, err := io.ReadFull(conn, count); err != nil {
+			return nil, fmt.Errorf("reading security types: %v", err)
+		}
+		types = make([]byte, count[0])
+		if _, err := io.ReadFull(conn, types); err != nil {
+			return nil, fmt.Errorf("reading security types: %v", err)
+		}
+	}
+	if len(types) == 0 {
+		reason, err := readRFBString(conn)
+		if err != nil {
+			return nil, fmt.Errorf("reading refusal: %v", err)
+		}
+		info.Refused = reason
+		info.Server = guessVNCServer(info)
+		return info, nil
+	}
+	for _, t := range types {
+		name, ok := vncSecurityNames[t]
+		if !ok {
+			name = fmt.Sprintf("type %d", t)
+		}
+		info.Security = append(info.Security, name)
+	}
+	info.Server = guessVNCServer(info)
+
+	if info.AuthRequired() {
+		return info, nil
+	}
+	desktop, err := readDesktopName(conn, minor)
+	if err != nil {
+		// The version and security types are still worth keeping
+		log.Printf("Could not read the VNC desktop name of %s: %v", ip, err)
+		return info, nil
+	}
+	info.Desktop = desktop
+	return info, nil
+}
+
+// readDesktopName picks the None security type, sends a shared ClientInit
+// and returns the name from the ServerInit message
+func readDesktopName(conn net.Conn, minor int) (string, error) {
+	if minor >= 7 {
+		if _, err := conn.Write([]byte{vncSecurityNone}); err != nil {
+			return "", err
+		}
+	}
+	if minor >= 8 {
+		// Only 3.8 sends a SecurityResult for None
+		var result uint32
+		if err := binary.Read(conn, binary.BigEndian, &result); err != nil {
+			return "", err
+		}
+		if result != 0 {
+			return "", errors.New("security handshake failed")
+		}
+	}
+	if _, err := conn.Write([]byte{1}); err != nil { // ClientInit, shared
+		return "", err
+	}
+	// Width, height and pixel format come before the name
+	if _, err := io.ReadFull(conn, make([]byte, 2+2+16)); err != nil {
+		return "", err
+	}
+	return readRFBString(conn)
+}
+
+// readRFBString reads a length-prefixed RFB string, refusing long ones
+func readRFBString(r io.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length > vncMaxText {
+		return "", fmt.Errorf("string of %d bytes is too long", length)
+	}
+	text := make([]byte, length)
+	if _, err := io.ReadFull(r, text); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(text)), nil
+}
+
+// guessVNCServer names the server software its version and security types
+// point to, or returns "" when they are too generic
+func guessVNCServer(info *VNCInfo) string {
+	has := func(name string) bool {
+		for _, security := range info.Security {
+			if security == name {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case info.Version == "3.889" || has("Apple Remote Desktop") || has("Apple"):
+		return "Apple Screen Sharing"
+	case strings.HasPrefix(info.Version, "4.") || has("RA2") || has("RA2ne"):
+		return "RealVNC"
+	case has("Ultra") || has("UltraVNC MS-Logon II"):
+		return "UltraVNC"
+	case has("Tight"):
+		return "TightVNC"
+	}
+	return ""
+}
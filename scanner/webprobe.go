@@ -0,0 +1,216 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// webProbePorts are the plain HTTP ports whose front page is fetched, where
+// captive portals and transparent proxies intercept traffic
+var webProbePorts = []int{80, 8080}
+
+const (
+	// portalRedirectHosts distinct hosts redirecting to the same absolute
+	// URL mark a captive portal
+	portalRedirectHosts = 3
+	// portalPageHosts distinct hosts serving the same page mark a portal or
+	// proxy. It is higher than portalRedirectHosts because a fleet of
+	// identical devices can serve identical pages too.
+	portalPageHosts = 16
+)
+
+// WebResponse is how a host answered a request for its front page
+type WebResponse struct {
+	Status   int    // HTTP status code
+	Location string // Redirect target, empty unless Status is a redirect
+	Server   string // Server header
+}
+
+// String returns the status, and where it redirects to
+func (r WebResponse) String() string {
+	text := fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+	if r.Location != "" {
+		text += " → " + r.Location
+	}
+	return text
+}
+
+// WebPorts returns the ports d has a web response recorded for, in
+// ascending order
+func (d Device) WebPorts() []int {
+	ports := make([]int, 0, len(d.Web))
+	for port := range d.Web {
+		ports = append(ports, port)
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// portalTracker groups hosts by the web response they gave, to spot captive
+// portals and transparent proxies answering for every address
+type portalTracker struct {
+	mu      sync.Mutex
+	groups  map[string][]string // Response fingerprint to the IPs that gave it
+	portals map[string]bool     // Fingerprints identified as a portal
+	flagged map[string]bool     // IPs whose response came from a portal
+}
+
+func newPortalTracker() *portalTracker {
+	return &portalTracker{
+		groups:  make(map[string][]string),
+		portals: make(map[string]bool),
+		flagged: make(map[string]bool),
+	}
+}
+
+// add records that ip gave the response with fingerprint, and returns the
+// IPs newly found to be behind a portal, including ip itself
+func (p *portalTracker) add(fingerprint string, threshold int, ip string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	group := p.groups[fingerprint]
+	for _, seen := range group {
+		if seen == ip {
+			return nil
+		}
+	}
+	group = append(group, ip)
+	p.groups[fingerprint] = group
+
+	var newly []string
+	switch {
+	case p.portals[fingerprint]:
+		newly = []string{ip}
+	case len(group) >= threshold:
+		p.portals[fingerprint] = true
+		newly = group
+	}
+	for _, flagged := range newly {
+		p.flagged[flagged] = true
+	}
+	return newly
+}
+
+// isFlagged reports whether ip's web response came from a portal
+func (p *portalTracker) isFlagged(ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.flagged[ip]
+}
+
+// probeWeb fetches the front page on each of device's open plain HTTP ports
+// into device.Web, and returns the IPs found to be behind a captive portal
+// as a result, which may include hosts already published
+func (s *Scanner) probeWeb(device *Device) []string {
+	scale := time.Duration(s.opts.Intensity.resolverTimeoutScale())
+	timeout := time.Second * 2 * scale
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: userAgentTransport{
+			base: &http.Transport{
+				DialContext:       limitedDial(dialer("tcp", s.opts.SourceIP, timeout)),
+				DisableKeepAlives: true,
+			},
+			userAgent: s.opts.UserAgent,
+		},
+		// The first redirect is what identifies a portal, so don't follow it
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var flagged []string
+	for _, port := range webProbePorts {
+		if !contains(device.OpenPorts, port) {
+			continue
+		}
+		release := s.acquireResolver()
+		start := time.Now()
+		response, fingerprint, threshold, err := fetchFrontPage(client, device.IPAddress, port)
+		release()
+		s.timing().resolved(PhaseWeb, start, err == nil)
+		if err != nil {
+			log.Printf("Web probe of %s:%d failed: %v", device.IPAddress, port, err)
+			continue
+		}
+
+		if device.Web == nil {
+			device.Web = make(map[int]WebResponse)
+		}
+		device.Web[port] = response
+		if threshold > 0 {
+			flagged = append(flagged, s.portals.add(fingerprint, threshold, device.IPAddress)...)
+		}
+	}
+	return flagged
+}
+
+// fetchFrontPage requests / from ip on port. It returns the response with a
+// fingerprint of it, and how many hosts must give the same fingerprint to
+// mark a portal: 0 for responses that don't count, such as redirects to
+// relative or per-host URLs.
+func fetchFrontPage(client *http.Client, ip string, port int) (WebResponse, string, int, error) {
+	resp, err := client.Get("http://" + net.JoinHostPort(ip, strconv.Itoa(port)) + "/")
+	if err != nil {
+		return WebResponse{}, "", 0, err
+	}
+	defer resp.Body.Close()
+
+	response := WebResponse{
+		Status: resp.StatusCode,
+		Server: resp.Header.Get("Server"),
+	}
+	hash := sha256.New()
+	io.Copy(hash, io.LimitReader(resp.Body, 64*1024))
+
+	if location := resp.Header.Get("Location"); location != "" {
+		response.Location = location
+		target, err := url.Parse(location)
+		if err != nil || target.Host == "" || target.Hostname() == ip {
+			return response, "", 0, nil
+		}
+		return response, fmt.Sprintf("redirect %d %s", resp.StatusCode, location), portalRedirectHosts, nil
+	}
+	return response, fmt.Sprintf("page %d %s", resp.StatusCode, hex.EncodeToString(hash.Sum(nil))), portalPageHosts, nil
+}
+
+// flagPortal marks the published devices among ips as answered by a captive
+// portal and sends them again. Devices not yet published pick the flag up
+// when they are stored.
+func (s *Scanner) flagPortal(ips []string) {
+	for _, ip := range ips {
+		s.publishMutex.Lock()
+		s.deviceMutex.Lock()
+		device, sent := s.devices[ip]
+		if !sent || device.CaptivePortal {
+			s.deviceMutex.Unlock()
+			s.publishMutex.Unlock()
+			continue
+		}
+		device.Notes = slices.Clone(device.Notes) // The published copy shares the slice
+		markPortal(&device)
+		s.keepLocked(device)
+		s.deviceMutex.Unlock()
+		s.publishMutex.Unlock()
+
+		log.Printf("Web response from %s matches a captive portal", ip)
+		s.deliver(ip)
+	}
+}
+
+// markPortal flags device as answered by a captive portal or proxy
+func markPortal(device *Device) {
+	device.CaptivePortal = true
+	device.addNote("Web ports answered by a captive portal or proxy, not the host")
+}
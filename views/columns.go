@@ -0,0 +1,192 @@
+package views
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// DefaultColumns is the device table layout when none is configured
+const DefaultColumns = "ip,hostname,status"
+
+// minColumnWidth is the narrowest a column is configured or squeezed to
+// before columns are dropped from the right to fit the terminal
+const minColumnWidth = 8
+
+// columnKind describes a device table column that can be configured
+type columnKind struct {
+	title string
+	width int                         // Default width, including the gap to the next column
+	flex  bool                        // Shrinks first when the terminal is narrow
+	value func(scanner.Device) string // Cell text for a device
+}
+
+// columnKinds are the available columns by configuration name
+var columnKinds = map[string]columnKind{
+	"ip":       {title: "IP Address", width: 16, value: func(d scanner.Device) string { return d.IPAddress }},
+	"hostname": {title: "Hostname", width: 42, flex: true, value: hostnameCell},
+	"mac":      {title: "MAC Address", width: 18, value: func(d scanner.Device) string { return d.MACAddress }},
+	"vendor":   {title: "Vendor", width: 24, flex: true, value: func(d scanner.Device) string { return d.Vendor }},
+	"type":     {title: "Type", width: 18, value: func(d scanner.Device) string { return d.DeviceType }},
+	"ports":    {title: "Open Ports", width: 24, flex: true, value: portsCell},
+	"status":   {title: "Status", width: 15, value: statusCell},
+}
+
+// columnOrder lists the column names in the order they are documented
+var columnOrder = []string{"ip", "hostname", "mac", "vendor", "type", "ports", "status"}
+
+// ColumnNames returns the names ParseColumns accepts
+func ColumnNames() []string {
+	return append([]string(nil), columnOrder...)
+}
+
+// Column is a device table column and its width
+type Column struct {
+	Name  string
+	Width int
+}
+
+// ParseColumns reads a comma-separated column list such as
+// "ip,hostname:30,mac", where a number after the colon sets the width
+func ParseColumns(spec string) ([]Column, error) {
+	var columns []Column
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(spec, ",") {
+		name, width, hasWidth := strings.Cut(strings.TrimSpace(field), ":")
+		name = strings.ToLower(name)
+		if name == "" {
+			continue
+		}
+		kind, ok := columnKinds[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(columnOrder, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("column %q listed twice", name)
+		}
+		seen[name] = true
+		column := Column{Name: name, Width: kind.width}
+		if hasWidth {
+			w, err := strconv.Atoi(width)
+			if err != nil || w < minColumnWidth {
+				return nil, fmt.Errorf("column %s: width %q must be a number of at least %d", name, width, minColumnWidth)
+			}
+			column.Width = w
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns given (available: %s)", strings.Join(columnOrder, ", "))
+	}
+	return columns, nil
+}
+
+// fitColumns returns columns narrowed to fit width: free-text columns such
+// as the hostname shrink, rightmost first, and columns that still don't fit
+// are dropped from the right. The first column is always kept.
+func fitColumns(columns []Column, width int) []Column {
+	fitted := append([]Column(nil), columns...)
+	total := 0
+	for _, column := range fitted {
+		total += column.Width
+	}
+	for i := len(fitted) - 1; i >= 0 && total > width; i-- {
+		if !columnKinds[fitted[i].Name].flex {
+			continue
+		}
+		if cut := min(total-width, fitted[i].Width-minColumnWidth); cut > 0 {
+			fitted[i].Width -= cut
+			total -= cut
+		}
+	}
+	for len(fitted) > 1 && total > width {
+		total -= fitted[len(fitted)-1].Width
+		fitted = fitted[:len(fitted)-1]
+	}
+	return fitted
+}
+
+// tableColumns returns the bubbles table columns for columns
+func tableColumns(columns []Column) []table.Column {
+	result := make([]table.Column, len(columns))
+	for i, column := range columns {
+		result[i] = table.Column{Title: truncate(columnKinds[column.Name].title, column.Width-1), Width: column.Width}
+	}
+	return result
+}
+
+// deviceRow returns the cells of device under columns, each cut short of
+// its column so a gap is left before the next one
+func deviceRow(device scanner.Device, columns []Column) table.Row {
+	row := make(table.Row, len(columns))
+	for i, column := range columns {
+		row[i] = truncate(columnKinds[column.Name].value(device), column.Width-1)
+	}
+	return row
+}
+
+// headerRow returns a subnet header spanning the first two columns, or all
+// of it in the first when there is only one, marked ▸ when its devices are
+// collapsed under it and ▾ when they are listed
+func headerRow(group string, count int, collapsed bool, columns []Column) table.Row {
+	row := make(table.Row, len(columns))
+	label := fmt.Sprintf("%s (%d device(s))", group, count)
+	marker := "▾"
+	if collapsed {
+		marker = "▸"
+	}
+	if len(columns) == 1 {
+		row[0] = truncate(marker+" "+label, columns[0].Width-1)
+		return row
+	}
+	row[0] = marker + " Subnet"
+	row[1] = truncate(label, columns[1].Width-1)
+	return row
+}
+
+// hostnameCell shows the first hostname, led by the device's role and, for
+// a hypervisor, its type. A live host with no name or MAC is flagged as
+// unidentified, a candidate for a deep probe.
+func hostnameCell(device scanner.Device) string {
+	hostname := "N/A"
+	if len(device.Hostname) > 0 {
+		hostname = device.Hostname[0]
+	} else if device.IsMystery() {
+		hostname = "? Unidentified"
+	}
+	if device.IsHypervisor() {
+		hostname = fmt.Sprintf("[%s] %s", device.DeviceType, hostname)
+	}
+	if device.Role != "" {
+		hostname = fmt.Sprintf("[%s] %s", device.Role, hostname)
+	}
+	return hostname
+}
+
+// statusCell shows the status with markers for mDNS, merged addresses and
+// captive portals
+func statusCell(device scanner.Device) string {
+	status := device.Status
+	if device.MDNSName != "" || len(device.MDNSServices) > 0 {
+		status += ",mDNS"
+	}
+	if len(device.AllIPs) > 1 {
+		status += fmt.Sprintf(",+%d IPs", len(device.AllIPs)-1)
+	}
+	if device.CaptivePortal {
+		status += ",Portal"
+	}
+	return status
+}
+
+// portsCell lists the open ports
+func portsCell(device scanner.Device) string {
+	ports := make([]string, len(device.OpenPorts))
+	for i, port := range device.OpenPorts {
+		ports[i] = strconv.Itoa(port)
+	}
+	return strings.Join(ports, ",")
+}
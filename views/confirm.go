@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/ramborogers/netventory/scanner"
 )
 
 // ConfirmView handles the network scan configuration screen
@@ -15,8 +16,12 @@ type ConfirmView struct {
 	height   int
 	selected Interface
 	range_   string
+	subnet   int
 	editing  bool
 	cursor   int
+
+	hostLimit    int
+	confirmLarge bool
 }
 
 // NewConfirmView creates a new confirmation view
@@ -42,6 +47,11 @@ func (v *ConfirmView) SetRange(r string) {
 	v.range_ = r
 }
 
+// SetSubnetIndex updates which of the interface's subnets is selected
+func (v *ConfirmView) SetSubnetIndex(index int) {
+	v.subnet = index
+}
+
 // SetEditing updates the editing state
 func (v *ConfirmView) SetEditing(editing bool) {
 	v.editing = editing
@@ -52,6 +62,13 @@ func (v *ConfirmView) SetCursor(pos int) {
 	v.cursor = pos
 }
 
+// SetHostLimit updates the largest range scanned without confirmation, 0 for
+// no limit, and whether the user has been asked to confirm a larger one
+func (v *ConfirmView) SetHostLimit(limit int, confirming bool) {
+	v.hostLimit = limit
+	v.confirmLarge = confirming
+}
+
 // Render generates the view
 func (v *ConfirmView) Render() string {
 	// Create banner
@@ -69,6 +86,22 @@ func (v *ConfirmView) Render() string {
 	content.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#FFFFFF")).Render(interfaceInfo))
 	content.WriteString("\n\n")
 
+	// Subnet choices when the interface has several addresses
+	if len(v.selected.Subnets) > 1 {
+		content.WriteString(v.styles.DialogText.Render("Interface Subnets:"))
+		content.WriteString("\n")
+		for i, subnet := range v.selected.Subnets {
+			if i == v.subnet {
+				content.WriteString(v.styles.RangeInput.Render("▶ "))
+				content.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#FFFFFF")).Render(subnet))
+			} else {
+				content.WriteString(v.styles.DialogText.Render("  " + subnet))
+			}
+			content.WriteString("\n")
+		}
+		content.WriteString("\n")
+	}
+
 	// Network range section
 	content.WriteString(v.styles.DialogText.Render("Network Range:"))
 	content.WriteString("\n")
@@ -88,14 +121,33 @@ func (v *ConfirmView) Render() string {
 	// Add network info if valid CIDR
 	_, ipNet, _ := net.ParseCIDR(v.range_)
 	if ipNet != nil {
-		ones, bits := ipNet.Mask.Size()
-		hosts := 1<<uint(bits-ones) - 2 // subtract network and broadcast addresses
+		hosts := scanner.CountIPs(ipNet)
 		content.WriteString("\n\n")
 		content.WriteString(lipgloss.JoinHorizontal(
 			lipgloss.Left,
 			v.styles.DialogText.Copy().Foreground(lipgloss.Color("#00ff00")).Render("Hosts to scan: "),
 			v.styles.DialogText.Copy().Foreground(lipgloss.Color("#FFFFFF")).Render(fmt.Sprintf("%d", hosts)),
 		))
+
+		// An address with a prefix names the network it is in
+		if network := ipNet.String(); network != v.range_ {
+			content.WriteString("\n")
+			content.WriteString(lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				v.styles.DialogText.Copy().Foreground(lipgloss.Color("#00ff00")).Render("Network: "),
+				v.styles.DialogText.Copy().Foreground(lipgloss.Color("#FFFFFF")).Render(network),
+				v.styles.DialogText.Render(" (host bits of "+v.range_+" ignored)"),
+			))
+		}
+
+		if v.hostLimit > 0 && hosts > uint64(v.hostLimit) {
+			warning := fmt.Sprintf("⚠ More than the %d host limit", v.hostLimit)
+			if v.confirmLarge {
+				warning += " - press ↵ again to scan anyway"
+			}
+			content.WriteString("\n")
+			content.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Bold(v.confirmLarge).Render(warning))
+		}
 	}
 
 	content.WriteString("\n\n")
@@ -106,6 +158,9 @@ func (v *ConfirmView) Render() string {
 		v.styles.KeyStyle.Render("↵") + v.styles.DescStyle.Render(" Confirm"),
 		v.styles.KeyStyle.Render("esc") + v.styles.DescStyle.Render(" Cancel"),
 	}
+	if len(v.selected.Subnets) > 1 {
+		keyHelp = append([]string{v.styles.KeyStyle.Render("tab") + v.styles.DescStyle.Render(" Subnet")}, keyHelp...)
+	}
 	content.WriteString(v.styles.Help.Render(strings.Join(keyHelp, " • ")))
 
 	dialog := v.styles.DialogBox.Render(content.String())
@@ -4,17 +4,33 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/ramborogers/netventory/scanner"
 )
 
+// provenanceLabels names the explained fields as the details view does
+var provenanceLabels = map[string]string{
+	scanner.FieldHostname:   "Hostname",
+	scanner.FieldMDNSName:   "mDNS Name",
+	scanner.FieldDeviceType: "Type",
+	scanner.FieldVersion:    "Version",
+	scanner.FieldDomain:     "Domain",
+	scanner.FieldMACAddress: "MAC",
+	scanner.FieldVendor:     "Vendor",
+	scanner.FieldRole:       "Role",
+}
+
 // DeviceDetailsView handles the device details screen
 type DeviceDetailsView struct {
-	styles *Styles
-	width  int
-	height int
-	device scanner.Device
+	styles        *Styles
+	width         int
+	height        int
+	device        scanner.Device
+	statusMessage string
+	offset        int // First content line shown when the details don't fit
+	pageSize      int // Content lines shown at the last render, for paging
 }
 
 // NewDeviceDetailsView creates a new device details view
@@ -30,9 +46,31 @@ func (v *DeviceDetailsView) SetDimensions(width, height int) {
 	v.height = height
 }
 
-// SetDevice updates the device being displayed
+// SetDevice updates the device being displayed, scrolled to the top
 func (v *DeviceDetailsView) SetDevice(device scanner.Device) {
 	v.device = device
+	v.offset = 0
+}
+
+// Scroll moves the details by lines, up when negative. The offset is
+// clamped to the content on the next render.
+func (v *DeviceDetailsView) Scroll(lines int) {
+	v.offset = max(0, v.offset+lines)
+}
+
+// ScrollPage moves the details by pages, up when negative
+func (v *DeviceDetailsView) ScrollPage(pages int) {
+	v.Scroll(pages * max(1, v.pageSize-1))
+}
+
+// GetDevice returns the device being displayed
+func (v *DeviceDetailsView) GetDevice() scanner.Device {
+	return v.device
+}
+
+// SetStatusMessage updates the transient status line shown under the help box
+func (v *DeviceDetailsView) SetStatusMessage(msg string) {
+	v.statusMessage = msg
 }
 
 // formatPortURL returns a properly formatted URL for a given port
@@ -81,6 +119,14 @@ func (v *DeviceDetailsView) Render() string {
 		Align(lipgloss.Right).
 		Foreground(lipgloss.Color("#FFFFFF"))
 
+	// A live host nothing could name is worth a closer look
+	if v.device.IsMystery() {
+		content.WriteString(v.styles.DialogText.Copy().
+			Foreground(lipgloss.Color("#FFAA00")).
+			Render("Unidentified: no hostname or MAC address was found.\nPress d to probe it in depth."))
+		content.WriteString("\n\n")
+	}
+
 	// Network Information section
 	content.WriteString(headerStyle.Render("Network Information"))
 	content.WriteString("\n\n")
@@ -93,6 +139,16 @@ func (v *DeviceDetailsView) Render() string {
 	))
 	content.WriteString("\n")
 
+	// All IPs row for devices merged by MAC address
+	if len(v.device.AllIPs) > 1 {
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Right,
+			labelStyle.Align(lipgloss.Right).Render("All IPs"),
+			valueStyle.Align(lipgloss.Left).Render(strings.Join(v.device.AllIPs, ", ")),
+		))
+		content.WriteString("\n")
+	}
+
 	// MAC Address row
 	macAddress := "Unknown"
 	if v.device.MACAddress != "" {
@@ -105,6 +161,78 @@ func (v *DeviceDetailsView) Render() string {
 	))
 	content.WriteString("\n")
 
+	// Vendor row
+	if v.device.Vendor != "" {
+		vendor := v.device.Vendor
+		if v.device.RandomMAC {
+			vendor = "⚠ " + vendor
+		}
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Right,
+			labelStyle.Align(lipgloss.Right).Render("Vendor"),
+			valueStyle.Align(lipgloss.Left).Render(vendor),
+		))
+		content.WriteString("\n")
+	}
+
+	// Device type row, highlighted for hypervisors
+	if v.device.DeviceType != "" {
+		deviceType := v.device.DeviceType
+		if v.device.Version != "" {
+			deviceType += " " + v.device.Version
+		}
+		typeStyle := valueStyle
+		if v.device.IsHypervisor() {
+			typeStyle = typeStyle.Bold(true)
+		}
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Right,
+			labelStyle.Align(lipgloss.Right).Render("Type"),
+			typeStyle.Align(lipgloss.Left).Render(deviceType),
+		))
+		content.WriteString("\n")
+	}
+
+	// Role row for the scanning machine and the gateway
+	if v.device.Role != "" {
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Right,
+			labelStyle.Align(lipgloss.Right).Render("Role"),
+			valueStyle.Bold(true).Align(lipgloss.Left).Render(v.device.Role),
+		))
+		content.WriteString("\n")
+	}
+
+	// Domain row
+	if v.device.Domain != "" {
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Right,
+			labelStyle.Align(lipgloss.Right).Render("Domain"),
+			valueStyle.Align(lipgloss.Left).Render(v.device.Domain),
+		))
+		content.WriteString("\n")
+	}
+
+	// VNC row
+	if v.device.VNC != nil {
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Right,
+			labelStyle.Align(lipgloss.Right).Render("VNC"),
+			valueStyle.Align(lipgloss.Left).Render(v.device.VNC.String()),
+		))
+		content.WriteString("\n")
+	}
+
+	// Printer row
+	if v.device.Printer != nil {
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Right,
+			labelStyle.Align(lipgloss.Right).Render("Printer"),
+			valueStyle.Align(lipgloss.Left).Render(v.device.Printer.String()),
+		))
+		content.WriteString("\n")
+	}
+
 	// mDNS Name row
 	if v.device.MDNSName != "" {
 		content.WriteString(lipgloss.JoinHorizontal(
@@ -137,6 +265,48 @@ func (v *DeviceDetailsView) Render() string {
 		valueStyle.Align(lipgloss.Left).Render(v.device.Status),
 	))
 
+	// First and last seen rows, relative to now
+	for _, row := range []struct {
+		label string
+		seen  time.Time
+	}{
+		{"First Seen", v.device.FirstSeen},
+		{"Last Seen", v.device.LastSeen},
+	} {
+		if row.seen.IsZero() {
+			continue
+		}
+		content.WriteString("\n")
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Left,
+			labelStyle.Align(lipgloss.Right).Render(row.label),
+			valueStyle.Align(lipgloss.Left).Render(timeAgo(row.seen)),
+		))
+	}
+
+	// Closed and filtered rows show the firewall posture of the probed ports
+	for _, row := range []struct {
+		label string
+		ports []int
+	}{
+		{"Closed", v.device.ClosedPorts},
+		{"Filtered", v.device.FilteredPorts},
+	} {
+		if len(row.ports) == 0 {
+			continue
+		}
+		names := make([]string, len(row.ports))
+		for i, port := range row.ports {
+			names[i] = scanner.FormatPort(port)
+		}
+		content.WriteString("\n")
+		content.WriteString(lipgloss.JoinHorizontal(
+			lipgloss.Left,
+			labelStyle.Align(lipgloss.Right).Render(row.label),
+			valueStyle.Align(lipgloss.Left).Render(strings.Join(names, ", ")),
+		))
+	}
+
 	// Open Ports section
 	if len(v.device.OpenPorts) > 0 {
 		content.WriteString("\n\n")
@@ -148,9 +318,9 @@ func (v *DeviceDetailsView) Render() string {
 		copy(ports, v.device.OpenPorts)
 		sort.Ints(ports)
 
-		// Port label style (includes "Port" prefix)
+		// Port label style (includes "Port" prefix and service name)
 		portLabelStyle := v.styles.DialogText.Copy().
-			Width(11).
+			Width(22).
 			Align(lipgloss.Right).
 			Foreground(lipgloss.Color("#00ff00"))
 
@@ -164,7 +334,7 @@ func (v *DeviceDetailsView) Render() string {
 		for _, port := range ports {
 			content.WriteString(lipgloss.JoinHorizontal(
 				lipgloss.Left,
-				portLabelStyle.Render(fmt.Sprintf("Port %d", port)),
+				portLabelStyle.Render("Port "+scanner.FormatPort(port)),
 				"  ",
 				urlStyle.Render(v.formatPortURL(port)),
 			))
@@ -172,6 +342,62 @@ func (v *DeviceDetailsView) Render() string {
 		}
 	}
 
+	// Web section
+	if len(v.device.Web) > 0 {
+		content.WriteString("\n\n")
+		content.WriteString(headerStyle.Render("Web"))
+		content.WriteString("\n\n")
+
+		for _, port := range v.device.WebPorts() {
+			content.WriteString(lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Align(lipgloss.Right).Render(scanner.FormatPort(port)),
+				valueStyle.Align(lipgloss.Left).Render(v.device.Web[port].String()),
+			))
+			content.WriteString("\n")
+		}
+	}
+
+	// Banners section
+	if len(v.device.Banners) > 0 || v.device.AnonymousFTP {
+		content.WriteString("\n\n")
+		content.WriteString(headerStyle.Render("Banners"))
+		content.WriteString("\n\n")
+
+		for _, port := range v.device.BannerPorts() {
+			content.WriteString(lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Align(lipgloss.Right).Render(scanner.FormatPort(port)),
+				valueStyle.Align(lipgloss.Left).Render(v.device.Banners[port]),
+			))
+			content.WriteString("\n")
+		}
+		if v.device.AnonymousFTP {
+			content.WriteString(lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Align(lipgloss.Right).Render("Anonymous FTP"),
+				valueStyle.Foreground(lipgloss.Color("#FFAA00")).Bold(true).Align(lipgloss.Left).Render("allowed"),
+			))
+			content.WriteString("\n")
+		}
+	}
+
+	// Certificates section
+	if len(v.device.Certificates) > 0 {
+		content.WriteString("\n\n")
+		content.WriteString(headerStyle.Render("Certificates"))
+		content.WriteString("\n\n")
+
+		for _, port := range v.device.CertificatePorts() {
+			content.WriteString(lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Align(lipgloss.Right).Render(scanner.FormatPort(port)),
+				valueStyle.Align(lipgloss.Left).Render(v.device.Certificates[port].String()),
+			))
+			content.WriteString("\n")
+		}
+	}
+
 	// mDNS Services section
 	if len(v.device.MDNSServices) > 0 {
 		content.WriteString("\n\n")
@@ -190,22 +416,101 @@ func (v *DeviceDetailsView) Render() string {
 		}
 	}
 
-	// Help text in a box
-	helpBox := v.styles.Box.Copy().
+	// How we know section: the signal behind each field, under --explain
+	if len(v.device.Provenance) > 0 {
+		content.WriteString("\n\n")
+		content.WriteString(headerStyle.Render("How we know"))
+		content.WriteString("\n\n")
+
+		for _, field := range scanner.ProvenanceFields {
+			source, ok := v.device.Provenance[field]
+			if !ok {
+				continue
+			}
+			content.WriteString(lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Align(lipgloss.Right).Render(provenanceLabels[field]),
+				valueStyle.Align(lipgloss.Left).Render(source),
+			))
+			content.WriteString("\n")
+		}
+	}
+
+	// Notes section
+	if len(v.device.Notes) > 0 {
+		content.WriteString("\n\n")
+		content.WriteString(headerStyle.Render("Notes"))
+		content.WriteString("\n\n")
+
+		noteStyle := v.styles.DialogText.Copy().
+			Align(lipgloss.Left).
+			Foreground(lipgloss.Color("#FFFFFF"))
+
+		for _, note := range v.device.Notes {
+			content.WriteString(noteStyle.Render("• " + note))
+			content.WriteString("\n")
+		}
+	}
+
+	// Wrap the content as the dialog would, so it can be cut to the lines
+	// that fit the terminal
+	dialog := v.styles.DialogBox
+	lines := strings.Split(lipgloss.NewStyle().
+		Width(dialog.GetWidth()-dialog.GetHorizontalPadding()).
+		Align(dialog.GetAlignHorizontal()).
+		Render(content.String()), "\n")
+
+	helpText := "Enter/Return to go back\nc Copy IP • C Copy Record • d Deep Probe"
+	helpStyle := v.styles.Box.Copy().
 		BorderStyle(lipgloss.RoundedBorder()).
 		BorderForeground(lipgloss.Color("#00ff00")).
 		Width(40).
 		Align(lipgloss.Center).
 		Margin(1, 0).
-		Padding(1, 2).
-		Render("Enter/Return to go back")
+		Padding(1, 2)
+	available := func() int {
+		space := v.height - dialog.GetVerticalFrameSize() - lipgloss.Height(helpStyle.Render(helpText))
+		if v.statusMessage != "" {
+			space--
+		}
+		return space
+	}
+
+	// Scroll when the details are taller than the space left for them,
+	// keeping a line above and below for the indicators
+	if v.height > 0 && len(lines) > available() {
+		helpText += "\n↑↓ PgUp/PgDn Home/End Scroll"
+		v.pageSize = max(1, available()-2)
+		v.offset = min(v.offset, len(lines)-v.pageSize)
+		above, below := "", ""
+		if v.offset > 0 {
+			above = fmt.Sprintf("▲ %d more", v.offset)
+		}
+		if rest := len(lines) - v.offset - v.pageSize; rest > 0 {
+			below = fmt.Sprintf("▼ %d more", rest)
+		}
+		indicator := v.styles.DialogText.Copy().Foreground(lipgloss.Color("#888888"))
+		visible := append([]string{indicator.Render(above)}, lines[v.offset:v.offset+v.pageSize]...)
+		lines = append(visible, indicator.Render(below))
+	} else {
+		v.offset = 0
+		v.pageSize = len(lines)
+	}
+	helpBox := helpStyle.Render(helpText)
 
 	// Combine content and help box
 	finalContent := lipgloss.JoinVertical(
 		lipgloss.Center,
-		v.styles.DialogBox.Render(content.String()),
+		dialog.Render(strings.Join(lines, "\n")),
 		helpBox,
 	)
+	if v.statusMessage != "" {
+		finalContent = lipgloss.JoinVertical(
+			lipgloss.Center,
+			finalContent,
+			v.styles.KeyStyle.Render(v.statusMessage),
+		)
+	}
 
 	// Place everything in the center of the screen
 	return lipgloss.Place(
@@ -216,3 +521,18 @@ func (v *DeviceDetailsView) Render() string {
 		finalContent,
 	)
 }
+
+// timeAgo formats how long ago t was in its largest unit, e.g. "2m ago"
+func timeAgo(t time.Time) string {
+	elapsed := time.Since(t)
+	switch {
+	case elapsed < time.Minute:
+		return fmt.Sprintf("%ds ago", int(elapsed.Seconds()))
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(elapsed.Hours()/24))
+	}
+}
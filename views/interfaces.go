@@ -121,6 +121,12 @@ func (v *InterfacesView) Render() string {
 						"  ",
 						v.styles.DialogText.Copy().Foreground(lipgloss.Color("#FFFFFF")).Render(selected.MACAddress),
 					),
+					lipgloss.JoinHorizontal(
+						lipgloss.Left,
+						v.styles.DialogText.Copy().Width(14).Align(lipgloss.Right).Foreground(lipgloss.Color("#00ff00")).Render("Vendor"),
+						"  ",
+						v.styles.DialogText.Copy().Foreground(lipgloss.Color("#FFFFFF")).Render(selected.Vendor),
+					),
 					lipgloss.JoinHorizontal(
 						lipgloss.Left,
 						v.styles.DialogText.Copy().Width(14).Align(lipgloss.Right).Foreground(lipgloss.Color("#00ff00")).Render("Subnet Mask"),
@@ -138,7 +144,7 @@ func (v *InterfacesView) Render() string {
 	}
 
 	// Create help text
-	help := v.styles.Help.Render("↑↓ Select • Enter Confirm")
+	help := v.styles.Help.Render("↑↓ Select • Enter Confirm • Q Quick Scan /24")
 
 	// Combine all elements with proper spacing
 	content := lipgloss.JoinVertical(
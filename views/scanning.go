@@ -2,6 +2,7 @@ package views
 
 import (
 	"fmt"
+	"net"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,33 +14,48 @@ import (
 	"github.com/ramborogers/netventory/scanner"
 )
 
+const (
+	maxTableRows  = 10 // Rows shown in the device table at most
+	compactHeight = 26 // Terminal heights below this use the condensed layout
+)
+
 // ScanningView handles the network scanning screen
 type ScanningView struct {
 	styles         *Styles
 	width          int
 	height         int
 	devices        map[string]scanner.Device
+	selectedIP     string
 	selectedIndex  int
 	tableOffset    int
+	grouped        bool
+	collapsed      map[string]bool // Subnet groups folded under their header
+	showWorkers    bool
 	showingDetails bool
 	scanningActive bool
 	currentIP      string
 	scanStartTime  time.Time
 	workerStats    map[int]*scanner.WorkerStatus
 	statsLock      sync.RWMutex
+	selectedWorker int // ID of the worker picked in the panel, -1 for the top one
 	table          table.Model
 	finalProgress  float64
 	finalScanned   int32
 	finalTotal     int32
 	finalElapsed   time.Duration
+	statusMessage  string
+	scanErr        error
+	truncatedAt    int      // Result cap the scan hit, 0 if it kept everything
+	columns        []Column // Device table columns, the DefaultColumns when empty
 }
 
 // NewScanningView creates a new scanning view
 func NewScanningView(styles *Styles) *ScanningView {
 	return &ScanningView{
-		styles:      styles,
-		devices:     make(map[string]scanner.Device),
-		workerStats: make(map[int]*scanner.WorkerStatus),
+		styles:         styles,
+		devices:        make(map[string]scanner.Device),
+		workerStats:    make(map[int]*scanner.WorkerStatus),
+		selectedWorker: -1,
 	}
 }
 
@@ -54,14 +70,30 @@ func (v *ScanningView) SetDevices(devices map[string]scanner.Device) {
 	v.devices = devices
 }
 
-// SetSelectedIndex updates the selected device index
-func (v *ScanningView) SetSelectedIndex(index int) {
-	v.selectedIndex = index
+// SetSelectedIP updates the selected device. The row is recomputed from the
+// current sort order on each render so the selection follows the device.
+func (v *ScanningView) SetSelectedIP(ip string) {
+	v.selectedIP = ip
 }
 
-// SetTableOffset updates the table scroll offset
-func (v *ScanningView) SetTableOffset(offset int) {
-	v.tableOffset = offset
+// SetColumns sets the device table columns, the DefaultColumns when empty
+func (v *ScanningView) SetColumns(columns []Column) {
+	v.columns = columns
+}
+
+// SetShowWorkers updates whether the per-worker panel is shown
+func (v *ScanningView) SetShowWorkers(show bool) {
+	v.showWorkers = show
+}
+
+// SetGrouped updates whether devices are grouped under subnet headers
+func (v *ScanningView) SetGrouped(grouped bool) {
+	v.grouped = grouped
+}
+
+// SetCollapsed updates which subnet groups show only their header
+func (v *ScanningView) SetCollapsed(collapsed map[string]bool) {
+	v.collapsed = collapsed
 }
 
 // SetShowingDetails updates whether device details are being shown
@@ -108,6 +140,7 @@ func (v *ScanningView) SetScanningActive(active bool) {
 		v.finalElapsed = 0
 		v.currentIP = ""
 		v.tableOffset = 0
+		v.selectedIP = ""
 		v.selectedIndex = 0
 
 		// Clear worker stats
@@ -151,27 +184,239 @@ func (v *ScanningView) SetWorkerStats(stats map[int]*scanner.WorkerStatus) {
 	v.statsLock.Unlock()
 }
 
+// SetTruncated sets the result cap the scan hit, 0 if it kept every device
+func (v *ScanningView) SetTruncated(limit int) {
+	v.truncatedAt = limit
+}
+
+// SetScanError sets why the scan was aborted, nil if it wasn't
+func (v *ScanningView) SetScanError(err error) {
+	v.scanErr = err
+}
+
+// SetStatusMessage updates the transient status line shown in the help box
+func (v *ScanningView) SetStatusMessage(msg string) {
+	v.statusMessage = msg
+}
+
 // GetSelectedDevice returns the currently selected device
 func (v *ScanningView) GetSelectedDevice() (scanner.Device, bool) {
 	if len(v.devices) == 0 {
 		return scanner.Device{}, false
 	}
 
-	// Get sorted list of IPs
-	var ips []string
+	if device, ok := v.devices[v.selectedIP]; ok {
+		return device, true
+	}
+
+	// Nothing chosen yet (or the device is gone): fall back to the first
+	// row, unless it is a subnet header
+	if v.grouped || isGroupKey(v.selectedIP) {
+		return scanner.Device{}, false
+	}
+	ips := v.sortedIPs()
+	return v.devices[ips[0]], true
+}
+
+// SelectedGroup returns the subnet whose header row is selected
+func (v *ScanningView) SelectedGroup() (string, bool) {
+	if !v.grouped {
+		return "", false
+	}
+	if isGroupKey(v.selectedIP) {
+		return strings.TrimPrefix(v.selectedIP, groupKeyPrefix), true
+	}
+	if _, ok := v.devices[v.selectedIP]; !ok && len(v.devices) > 0 {
+		// Nothing chosen yet: the first row is a header
+		return SubnetGroup(v.sortedIPs()[0]), true
+	}
+	return "", false
+}
+
+// sortedIPs returns the device IPs in display order
+func (v *ScanningView) sortedIPs() []string {
+	ips := make([]string, 0, len(v.devices))
 	for ip := range v.devices {
 		ips = append(ips, ip)
 	}
 	sort.Slice(ips, func(i, j int) bool {
 		return compareIPs(ips[i], ips[j])
 	})
+	return ips
+}
+
+// workerSpinner animates the indicator of workers that reported recently
+var workerSpinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// workerOrder returns the worker IDs longest-silent first, as the worker
+// panel lists them, and a copy of their stats
+func (v *ScanningView) workerOrder() ([]int, map[int]scanner.WorkerStatus) {
+	v.statsLock.RLock()
+	ids := make([]int, 0, len(v.workerStats))
+	stats := make(map[int]scanner.WorkerStatus, len(v.workerStats))
+	for id, stat := range v.workerStats {
+		ids = append(ids, id)
+		stats[id] = *stat
+	}
+	v.statsLock.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := stats[ids[i]].LastSeen, stats[ids[j]].LastSeen
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return ids[i] < ids[j]
+	})
+	return ids, stats
+}
+
+// SelectWorker moves the worker panel selection by step rows, wrapping
+// around
+func (v *ScanningView) SelectWorker(step int) {
+	ids, _ := v.workerOrder()
+	if len(ids) == 0 {
+		return
+	}
+	current := 0
+	for i, id := range ids {
+		if id == v.selectedWorker {
+			current = i
+		}
+	}
+	v.selectedWorker = ids[((current+step)%len(ids)+len(ids))%len(ids)]
+}
+
+// SelectedWorker returns the worker picked in the panel: the top one, the
+// longest silent, until another is picked or once the picked one is gone
+func (v *ScanningView) SelectedWorker() (int, bool) {
+	ids, _ := v.workerOrder()
+	if len(ids) == 0 {
+		return 0, false
+	}
+	for _, id := range ids {
+		if id == v.selectedWorker {
+			return id, true
+		}
+	}
+	return ids[0], true
+}
 
-	// Ensure selected index is valid
-	if v.selectedIndex >= 0 && v.selectedIndex < len(ips) {
-		return v.devices[ips[v.selectedIndex]], true
+// renderWorkerPanel lists what each worker is doing, longest-silent first so
+// a worker stuck on one host is at the top, showing at most maxRows workers.
+// The worker picked for skipping is marked.
+func (v *ScanningView) renderWorkerPanel(maxRows int) string {
+	ids, stats := v.workerOrder()
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+	if len(ids) == 0 {
+		return dim.Render("No active workers")
 	}
+	selected, _ := v.SelectedWorker()
+
+	frame := workerSpinner[int(time.Now().UnixMilli()/100)%len(workerSpinner)]
+	lines := []string{lipgloss.NewStyle().Bold(true).Foreground(primaryColor).
+		Render(fmt.Sprintf("Workers (%d)", len(ids)))}
+	for _, id := range ids[:min(len(ids), maxRows)] {
+		stat := stats[id]
+		idle := time.Since(stat.LastSeen).Round(time.Second)
+		indicator := lipgloss.NewStyle().Foreground(primaryColor).Render(frame)
+		if idle >= 10*time.Second {
+			indicator = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAA00")).Render("⚠")
+		}
+		marker := " "
+		if id == selected {
+			marker = lipgloss.NewStyle().Bold(true).Foreground(primaryColor).Render("›")
+		}
+		lines = append(lines, fmt.Sprintf("%s%s #%-3d %-15s %-12s %6s",
+			marker, indicator, id, truncate(stat.CurrentIP, 15), truncate(stat.State, 12), idle))
+	}
+	if len(ids) > maxRows {
+		lines = append(lines, dim.Render(fmt.Sprintf("... and %d more", len(ids)-maxRows)))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// tableRow is one row of the device table: either a device, or a subnet
+// header when ip is empty
+type tableRow struct {
+	ip     string
+	group  string
+	count  int
+	device int // Position of the device in sort order
+}
+
+// key returns the selection key of the row: the device IP, or GroupKey of
+// the subnet for a header
+func (r tableRow) key() string {
+	if r.ip == "" {
+		return GroupKey(r.group)
+	}
+	return r.ip
+}
+
+// tableRows lays out the sorted IPs as table rows, inserting a header before
+// each subnet when grouping is enabled and leaving out the devices of the
+// collapsed ones
+func (v *ScanningView) tableRows(ips []string) []tableRow {
+	return layoutRows(ips, v.grouped, v.collapsed)
+}
+
+func layoutRows(ips []string, grouped bool, collapsed map[string]bool) []tableRow {
+	rows := make([]tableRow, 0, len(ips))
+	header := -1
+	for i, ip := range ips {
+		if grouped {
+			group := SubnetGroup(ip)
+			if header < 0 || rows[header].group != group {
+				header = len(rows)
+				rows = append(rows, tableRow{group: group})
+			}
+			rows[header].count++
+			if collapsed[group] {
+				continue
+			}
+		}
+		rows = append(rows, tableRow{ip: ip, device: i})
+	}
+	return rows
+}
+
+// SelectionKeys returns the keys of the rows the selection moves over, in
+// table order, for IPs sorted as the table lists them: device IPs, and with
+// grouping the GroupKey of each subnet header
+func SelectionKeys(ips []string, grouped bool, collapsed map[string]bool) []string {
+	rows := layoutRows(ips, grouped, collapsed)
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		keys[i] = row.key()
+	}
+	return keys
+}
+
+// groupKeyPrefix marks the selection key of a subnet header, which no IP
+// address starts with
+const groupKeyPrefix = "subnet:"
+
+// GroupKey returns the selection key of the header of subnet group
+func GroupKey(group string) string {
+	return groupKeyPrefix + group
+}
 
-	return scanner.Device{}, false
+func isGroupKey(key string) bool {
+	return strings.HasPrefix(key, groupKeyPrefix)
+}
+
+// SubnetGroup returns the /24 (or /64 for IPv6) network containing ip
+func SubnetGroup(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "Other"
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		network := net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		return network.String()
+	}
+	network := net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}
+	return network.String()
 }
 
 // Render generates the view
@@ -224,7 +469,15 @@ func (v *ScanningView) Render() string {
 		}
 	}
 
+	// Small terminals (e.g. 80x24 or a tmux split) get a condensed layout
+	compact := v.height < compactHeight
+
 	progressWidth := 48
+	if compact {
+		progressWidth = max(10, min(progressWidth, v.width-40))
+	} else {
+		progressWidth = max(10, min(progressWidth, v.width-4))
+	}
 	filledWidth := int(float64(progressWidth) * progress / 100)
 
 	var progressBar strings.Builder
@@ -271,18 +524,32 @@ func (v *ScanningView) Render() string {
 
 	// Show more detailed stats with completion status
 	var statusText string
-	if !v.scanningActive && activeWorkers == 0 {
+	if !v.scanningActive && v.scanErr != nil {
+		statusText = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FFAA00")).
+			Bold(true).
+			Render("Scan Aborted: " + v.scanErr.Error())
+	} else if !v.scanningActive && activeWorkers == 0 {
 		statusText = "Scan Done"
 	} else {
 		statusText = fmt.Sprintf("Active Workers: %d", activeWorkers)
 	}
 
+	// Say so when the device list stopped growing at the result cap
+	found := fmt.Sprintf("%d devices", totalFound)
+	if v.truncatedAt > 0 {
+		found = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FFAA00")).
+			Bold(true).
+			Render(fmt.Sprintf("%d devices, results truncated at %d", totalFound, v.truncatedAt))
+	}
+
 	foundText := lipgloss.NewStyle().
 		Width(v.width).
 		Align(lipgloss.Center).
 		Render(fmt.Sprintf(
-			"Found: %d devices | %s | Time: %v",
-			totalFound,
+			"Found: %s | %s | Time: %v",
+			found,
 			statusText,
 			elapsed,
 		))
@@ -292,62 +559,135 @@ func (v *ScanningView) Render() string {
 		Align(lipgloss.Center).
 		Render("⎯ NetVentory ⎯")
 
-	// Join stats vertically
-	statsInfo := lipgloss.JoinVertical(
-		lipgloss.Center,
-		brandingText,
-		progressInfo,
-		statsText,
-		foundText,
-	)
+	// Join stats vertically, or onto one line in compact mode
+	var statsInfo string
+	if compact {
+		statsInfo = lipgloss.NewStyle().
+			Width(v.width).
+			Align(lipgloss.Center).
+			Render(fmt.Sprintf(
+				"%s %.0f%% | Found: %s | %s | %v",
+				progressBar.String(),
+				progress,
+				found,
+				statusText,
+				elapsed,
+			))
+	} else {
+		statsInfo = lipgloss.JoinVertical(
+			lipgloss.Center,
+			brandingText,
+			progressInfo,
+			statsText,
+			foundText,
+		)
+	}
 
-	// Calculate available height for table
-	// Reserve space for stats(4), margins(4), and help(3)
-	reservedHeight := 14
-	availableHeight := v.height - reservedHeight
-	// Limit table to maximum of 10 rows, regardless of screen size
-	visibleRows := min(availableHeight, len(v.devices))
+	if v.showWorkers {
+		maxWorkers := 8
+		if compact {
+			maxWorkers = 3
+		}
+		statsInfo = lipgloss.JoinVertical(lipgloss.Center, statsInfo, "", v.renderWorkerPanel(maxWorkers))
+	}
 
-	// Create table data with scrolling
-	var rows []table.Row
-	var ips []string
-	for ip := range v.devices {
-		ips = append(ips, ip)
+	// Update help text based on state
+	var helpText string
+	if v.scanningActive {
+		helpText = "↑↓ Select • Enter Details • c/C Copy • a Add Host • g Group • m Merge • w Workers • s Stop Scan • q Quit"
+		if v.showWorkers {
+			helpText = "↑↓ Select • Enter Details • Tab Pick Worker • K Skip Its Host • w Hide Workers • s Stop Scan • q Quit"
+		}
+	} else {
+		if len(v.devices) > maxTableRows {
+			helpText = "↑↓ Scroll • PgUp/PgDn/Home/End Jump • Enter Details • c/C/x Copy • a Add Host • d Deep Probe • g Group • m Merge • n Names • r Rescan • q Quit"
+		} else {
+			helpText = "↑↓ Select • Enter Details • c/C/x Copy • a Add Host • d Deep Probe • g Group • m Merge • n Names • r Rescan • q Quit"
+		}
 	}
-	sort.Slice(ips, func(i, j int) bool {
-		return compareIPs(ips[i], ips[j])
-	})
 
-	// Calculate visible range
-	startIdx := v.tableOffset
-	endIdx := min(startIdx+visibleRows, len(ips))
-
-	// Create rows for visible devices
-	for _, ip := range ips[startIdx:endIdx] {
-		device := v.devices[ip]
-		hostname := "N/A"
-		if len(device.Hostname) > 0 {
-			hostname = truncate(device.Hostname[0], 40)
+	if v.grouped {
+		helpText = strings.Replace(helpText, "Enter Details", "Enter Details/Fold", 1)
+	}
+	if v.statusMessage != "" {
+		helpText = v.statusMessage
+	}
+
+	// Create help box that will be placed at the bottom, without padding
+	// when space is tight so it always stays on screen
+	helpStyle := v.styles.Help.Copy().
+		Width(v.width-4). // Account for margins
+		Padding(0, 1)
+	if !compact {
+		helpStyle = helpStyle.Padding(1, 1)
+	}
+	helpBox := helpStyle.Render(helpText)
+
+	// Calculate available height for table: everything not used by the
+	// stats, spacing, help box, table header, the two scroll indicators and
+	// the position line
+	spacing := 4
+	if compact {
+		spacing = 1
+	}
+	availableHeight := v.height - lipgloss.Height(statsInfo) - spacing - lipgloss.Height(helpBox) - 4
+	ips := v.sortedIPs()
+	tableRows := v.tableRows(ips)
+
+	// Limit table to maximum of 10 rows, regardless of screen size
+	visibleRows := max(1, min(min(availableHeight, maxTableRows), len(tableRows)))
+
+	// Find the selected row in the current layout
+	v.selectedIndex = 0
+	for i, row := range tableRows {
+		if row.key() == v.selectedIP {
+			v.selectedIndex = i
+			break
 		}
+	}
 
-		// Format status with mDNS indicator if applicable
-		status := device.Status
-		if device.MDNSName != "" || len(device.MDNSServices) > 0 {
-			status += ",mDNS"
+	// Never scroll past the last full page, then keep the selected row
+	// inside the visible window, showing its subnet header when possible
+	v.tableOffset = max(0, min(v.tableOffset, len(tableRows)-visibleRows))
+	if v.selectedIndex >= v.tableOffset+visibleRows {
+		v.tableOffset = v.selectedIndex - visibleRows + 1
+	}
+	if v.selectedIndex < v.tableOffset {
+		v.tableOffset = v.selectedIndex
+		if v.tableOffset > 0 && tableRows[v.tableOffset-1].ip == "" {
+			v.tableOffset--
 		}
+	}
+
+	// Create table data with scrolling
+	var rows []table.Row
 
-		rows = append(rows, table.Row{
-			device.IPAddress,
-			hostname,
-			status,
-		})
+	// Calculate visible range
+	startIdx := min(v.tableOffset, len(tableRows))
+	endIdx := min(startIdx+visibleRows, len(tableRows))
+
+	// Lay the configured columns out across the terminal
+	columns := v.columns
+	if len(columns) == 0 {
+		columns, _ = ParseColumns(DefaultColumns)
 	}
+	if v.width > 0 {
+		columns = fitColumns(columns, v.width-4)
+	}
+
+	// Create rows for visible devices and headers
+	firstDevice, lastDevice := -1, -1
+	for _, row := range tableRows[startIdx:endIdx] {
+		if row.ip == "" {
+			rows = append(rows, headerRow(row.group, row.count, v.collapsed[row.group], columns))
+			continue
+		}
+		if firstDevice < 0 {
+			firstDevice = row.device
+		}
+		lastDevice = row.device
 
-	// Configure table with fixed widths
-	columns := []table.Column{
-		{Title: "IP Address", Width: 15},
-		{Title: "Hostname", Width: 42},
-		{Title: "Status", Width: 15},
+		rows = append(rows, deviceRow(v.devices[row.ip], columns))
 	}
 
 	// Enhanced selected row style
@@ -367,7 +707,7 @@ func (v *ScanningView) Render() string {
 	}
 
 	t := table.New(
-		table.WithColumns(columns),
+		table.WithColumns(tableColumns(columns)),
 		table.WithRows(rows),
 		table.WithFocused(true),
 		table.WithHeight(visibleRows),
@@ -387,7 +727,7 @@ func (v *ScanningView) Render() string {
 	// Calculate if scrolling is possible
 	totalDevices := len(v.devices)
 	hasMoreAbove := v.tableOffset > 0
-	hasMoreBelow := v.tableOffset+visibleRows < totalDevices
+	hasMoreBelow := v.tableOffset+visibleRows < len(tableRows)
 
 	// Add scroll indicators to table
 	tableView := v.table.View()
@@ -397,25 +737,11 @@ func (v *ScanningView) Render() string {
 	if hasMoreBelow {
 		tableView = tableView + "\n" + v.styles.DialogText.Foreground(primaryColor).SetString("▼").String()
 	}
-
-	// Update help text based on state
-	var helpText string
-	if v.scanningActive {
-		helpText = "↑↓ Select • Enter Details • s Stop Scan • q Quit"
-	} else {
-		if totalDevices > visibleRows {
-			helpText = "↑↓ Scroll • PgUp/PgDn Jump • Enter Details • r Rescan • q Quit"
-		} else {
-			helpText = "↑↓ Select • Enter Details • r Rescan • q Quit"
-		}
+	if firstDevice >= 0 {
+		position := fmt.Sprintf("Showing %d-%d of %d", firstDevice+1, lastDevice+1, totalDevices)
+		tableView = tableView + "\n" + v.styles.DialogText.Foreground(lipgloss.Color("#888888")).Render(position)
 	}
 
-	// Create help box that will be placed at the bottom
-	helpBox := v.styles.Help.Copy().
-		Width(v.width-4). // Account for margins
-		Padding(0, 1).
-		Render(helpText)
-
 	// Create the main layout
 	mainLayout := lipgloss.JoinVertical(
 		lipgloss.Center,
@@ -424,11 +750,19 @@ func (v *ScanningView) Render() string {
 		"\n",
 		tableView,
 	)
+	if compact {
+		mainLayout = lipgloss.JoinVertical(
+			lipgloss.Center,
+			statsInfo,
+			"",
+			tableView,
+		)
+	}
 
 	// Place the main layout in the content area
 	mainView := lipgloss.Place(
 		v.width,
-		v.height-3, // Reserve space for help box
+		max(0, v.height-lipgloss.Height(helpBox)), // Reserve space for help box
 		lipgloss.Center,
 		lipgloss.Top,
 		mainLayout,
@@ -7,8 +7,10 @@ type Interface struct {
 	SubnetMask   string
 	CIDR         string
 	MACAddress   string
+	Vendor       string // Vendor of the NIC from its MAC, empty without one
 	Gateway      string
 	IsUp         bool
 	Priority     int
-	FriendlyName string // For Windows display names
+	FriendlyName string   // For Windows display names
+	Subnets      []string // All networks bound to this interface, in CIDR form
 }
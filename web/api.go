@@ -0,0 +1,234 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ramborogers/netventory/export"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// maxAPIWorkers caps the workers a single API request may ask for
+const maxAPIWorkers = 1000
+
+// apiProfiles are the scan profiles accepted by POST /api/scan, on top of
+// the intensity names low, normal and high
+var apiProfiles = map[string]scanner.Intensity{
+	"fast":     scanner.IntensityLow,
+	"thorough": scanner.IntensityHigh,
+}
+
+// apiScanRequest is the body of POST /api/scan. Unset fields fall back to
+// the server's scan options.
+type apiScanRequest struct {
+	Range       string `json:"range"`
+	Workers     int    `json:"workers,omitempty"`
+	Profile     string `json:"profile,omitempty"`      // fast, normal or thorough
+	PortProfile string `json:"port_profile,omitempty"` // Named port set, e.g. iot
+	Ports       []int  `json:"ports,omitempty"`        // Explicit ports, overrides port_profile
+}
+
+// apiScanStatus describes a scan to API clients
+type apiScanStatus struct {
+	SchemaVersion int              `json:"schema_version"` // Version of the device objects, as in JSON exports
+	ID            uint64           `json:"id"`
+	State         ScanState        `json:"state"`
+	Range         string           `json:"range"`
+	Started       string           `json:"started,omitempty"`
+	Finished      string           `json:"finished,omitempty"`
+	Scanned       int32            `json:"scanned"`
+	Total         int32            `json:"total"`
+	Truncated     int64            `json:"truncated,omitempty"` // Devices dropped past the result cap
+	Devices       []scanner.Device `json:"devices"`
+}
+
+// handleAPIScan starts a scan on POST and describes the current scan on GET
+func (s *Server) handleAPIScan(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.apiStartScan(w, r)
+	case http.MethodGet:
+		s.scanMutex.RLock()
+		id := s.scanID
+		s.scanMutex.RUnlock()
+		s.apiWriteStatus(w, id, http.StatusOK)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleAPIScanID serves GET (status) and DELETE (stop) for /api/scan/{id}
+func (s *Server) handleAPIScanID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/scan/"), 10, 64)
+	if err != nil {
+		apiError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.apiWriteStatus(w, id, http.StatusOK)
+	case http.MethodDelete:
+		if !s.isCurrentScan(id) {
+			apiError(w, http.StatusNotFound, "scan not found")
+			return
+		}
+		// A finished scan is left alone and reported as it is
+		if s.State() != StateScanning {
+			s.apiWriteStatus(w, id, http.StatusOK)
+			return
+		}
+		log.Printf("%s[API]%s Stop requested for scan %d%s", colorBlue, colorWhite, id, colorReset)
+		s.StopScan()
+		s.apiWriteStatus(w, id, http.StatusAccepted)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// apiStartScan validates a scan request and starts it, answering with the
+// new scan's ID and status
+func (s *Server) apiStartScan(w http.ResponseWriter, r *http.Request) {
+	var req apiScanRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if network, err := scanner.NormalizeCIDR(req.Range); err == nil {
+		req.Range = network
+	}
+	opts, workers, err := s.apiScanOptions(req)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := s.startScan(req.Range, opts, workers)
+	if errors.Is(err, ErrScanInProgress) {
+		apiError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("%s[API]%s Started scan %d of %s with %d workers%s",
+		colorBlue, colorWhite, id, req.Range, workers, colorReset)
+	w.Header().Set("Location", fmt.Sprintf("/api/scan/%d", id))
+	s.apiWriteStatus(w, id, http.StatusAccepted)
+}
+
+// apiScanOptions applies a scan request on top of the server's options
+func (s *Server) apiScanOptions(req apiScanRequest) (scanner.Options, int, error) {
+	opts := s.scanOptions
+	workers := s.workerCount
+
+	_, ipNet, err := net.ParseCIDR(req.Range)
+	if err != nil {
+		return opts, 0, fmt.Errorf("invalid range %q", req.Range)
+	}
+	if err := opts.CheckHosts(req.Range, scanner.CountIPs(ipNet)); err != nil {
+		return opts, 0, err
+	}
+
+	if req.Workers < 0 || req.Workers > maxAPIWorkers {
+		return opts, 0, fmt.Errorf("workers must be between 1 and %d", maxAPIWorkers)
+	}
+	if req.Workers > 0 {
+		workers = req.Workers
+	}
+
+	if req.Profile != "" {
+		intensity, ok := apiProfiles[strings.ToLower(req.Profile)]
+		if !ok {
+			if intensity, err = scanner.ParseIntensity(req.Profile); err != nil {
+				return opts, 0, fmt.Errorf("unknown profile %q (want fast, normal or thorough)", req.Profile)
+			}
+		}
+		opts.Intensity = intensity
+	}
+
+	switch {
+	case len(req.Ports) > 0:
+		for _, port := range req.Ports {
+			if port < 1 || port > 65535 {
+				return opts, 0, fmt.Errorf("invalid port %d", port)
+			}
+		}
+		opts.Ports = req.Ports
+	case req.PortProfile != "":
+		if opts.Ports, err = scanner.PortProfile(req.PortProfile); err != nil {
+			return opts, 0, err
+		}
+	}
+
+	return opts, workers, nil
+}
+
+// apiWriteStatus writes the status of scan id, or 404 if it is no longer
+// the current scan
+func (s *Server) apiWriteStatus(w http.ResponseWriter, id uint64, code int) {
+	s.scanMutex.RLock()
+	if id == 0 || id != s.scanID {
+		s.scanMutex.RUnlock()
+		apiError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	status := apiScanStatus{
+		SchemaVersion: export.SchemaVersion,
+		ID:            id,
+		State:         s.state,
+		Range:         s.redactor.Range(s.scanRange),
+	}
+	if !s.scanStarted.IsZero() {
+		status.Started = s.scanStarted.Format(time.RFC3339)
+	}
+	if !s.scanFinished.IsZero() {
+		status.Finished = s.scanFinished.Format(time.RFC3339)
+	}
+	if s.scanner != nil && s.state != StateCleared {
+		stats := s.scanner.Stats()
+		status.Scanned, status.Total = stats.Scanned, stats.Total
+		status.Truncated = stats.Truncated
+	}
+	s.scanMutex.RUnlock()
+
+	devices, keys := s.clientDevices(s.filter.Apply(s.snapshotDevices()))
+	status.Devices = make([]scanner.Device, 0, len(devices))
+	for _, device := range devices {
+		status.Devices = append(status.Devices, device)
+	}
+	sort.Slice(status.Devices, func(i, j int) bool {
+		return keys[status.Devices[i].IPAddress].IP < keys[status.Devices[j].IPAddress].IP
+	})
+
+	writeAPIJSON(w, code, status)
+}
+
+// apiError writes a JSON error response
+func apiError(w http.ResponseWriter, code int, message string) {
+	writeAPIJSON(w, code, map[string]string{"error": message})
+}
+
+// writeAPIJSON writes v as a JSON response with the given status code
+func writeAPIJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing API response: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAuthTokenLength is the length of tokens generated by NewServer
+const DefaultAuthTokenLength = 50
+
+const tokenCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// GenerateAuthToken returns a random alphanumeric token from crypto/rand
+func GenerateAuthToken(length int) (string, error) {
+	// Reject bytes beyond the largest multiple of the charset size so every
+	// character is equally likely
+	limit := 256 - 256%len(tokenCharset)
+	token := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(token) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("generating auth token: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(token) < length {
+				token = append(token, tokenCharset[int(b)%len(tokenCharset)])
+			}
+		}
+	}
+	return string(token), nil
+}
+
+// AuthToken returns the token clients must pass as ?auth=
+func (s *Server) AuthToken() string {
+	return s.authToken
+}
+
+// Brute-force protection: a client that fails authentication maxAuthFailures
+// times within authFailureWindow is refused for authLockout
+const (
+	maxAuthFailures   = 5
+	authFailureWindow = 5 * time.Minute
+	authLockout       = 15 * time.Minute
+)
+
+// authFailures tracks recent failed attempts from one client
+type authFailures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// authLimiter throttles failed authentication per client IP
+type authLimiter struct {
+	mu       sync.Mutex
+	failures map[string]*authFailures
+}
+
+func newAuthLimiter() *authLimiter {
+	return &authLimiter{failures: make(map[string]*authFailures)}
+}
+
+// lockedOut returns how long ip must wait before trying again, or 0
+func (l *authLimiter) lockedOut(ip string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f := l.failures[ip]; f != nil && now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail records a failed attempt and reports whether it locked ip out
+func (l *authLimiter) fail(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget stale entries so the map can't grow without bound
+	for key, f := range l.failures {
+		if now.Sub(f.first) > authFailureWindow && now.After(f.lockedUntil) {
+			delete(l.failures, key)
+		}
+	}
+
+	f := l.failures[ip]
+	if f == nil {
+		f = &authFailures{first: now}
+		l.failures[ip] = f
+	}
+	f.count++
+	if f.count >= maxAuthFailures {
+		f.lockedUntil = now.Add(authLockout)
+		f.count = 0
+		f.first = now
+		return true
+	}
+	return false
+}
+
+// succeed clears the failure history of ip
+func (l *authLimiter) succeed(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, ip)
+}
+
+// tokenMatches compares token to the server's token in constant time
+func (s *Server) tokenMatches(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.authToken)) == 1
+}
+
+// authCookieName is the cookie that carries the token once a page has been
+// opened with it, so stylesheets, scripts and later requests need no ?auth=
+const authCookieName = "netventory_auth"
+
+// requestToken returns the token from the auth query parameter, an
+// "Authorization: Bearer" header for API clients, or the auth cookie
+func requestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("auth"); token != "" {
+		return token
+	}
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if cookie, err := r.Cookie(authCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// setAuthCookie stores the token in a cookie after a request authenticated
+// some other way. The cookie is HttpOnly and SameSite=Strict, so scripts
+// and other sites can't use it.
+func (s *Server) setAuthCookie(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(authCookieName); err == nil && s.tokenMatches(cookie.Value) {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    s.authToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// remoteIP returns the address of the connecting peer. Headers such as
+// X-Real-IP are ignored because a client can set them to dodge the lockout.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+)
+
+// requiredStaticFiles must be present in the embedded static filesystem
+var requiredStaticFiles = []string{
+	"css/styles.css",
+	"js/app.js",
+	"favicon.svg",
+}
+
+// checkAssets reports the first template or static file the UI needs that
+// failed to load
+func checkAssets(templates *template.Template, staticFS fs.FS) error {
+	if templates == nil || templates.Lookup("index.html") == nil {
+		return fmt.Errorf("required template missing - index.html")
+	}
+	if staticFS == nil {
+		return fmt.Errorf("static file system not loaded")
+	}
+	for _, file := range requiredStaticFiles {
+		if _, err := fs.Stat(staticFS, file); err != nil {
+			return fmt.Errorf("required static file missing - %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// handleHealthz reports that the server is up
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports whether the templates and static files loaded, so
+// the UI can be served
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := checkAssets(s.templates, s.staticFS); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready: %v\n", err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
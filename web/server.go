@@ -2,8 +2,8 @@ package web
 
 import (
 	"embed"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
@@ -11,7 +11,9 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,11 +23,12 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/jackpal/gateway"
+	"github.com/ramborogers/netventory/export"
 	"github.com/ramborogers/netventory/scanner"
 	"github.com/ramborogers/netventory/views"
 )
 
-//go:embed all:templates/* all:static/css/* all:static/js/*
+//go:embed all:templates/* all:static/css/* all:static/js/* static/favicon.svg
 var content embed.FS
 
 // Add color constants at the top of the file after imports
@@ -44,23 +47,53 @@ const (
 // Server represents the web interface server
 type Server struct {
 	port         int
+	bind         string // Listen address, empty for all interfaces
+	authLimiter  *authLimiter
 	upgrader     websocket.Upgrader
 	clients      map[*websocket.Conn]bool
 	clientsMutex sync.RWMutex
 	devices      map[string]scanner.Device
+	history      map[string]scanner.Device // Devices found by earlier scans, for first-seen times
 	deviceMutex  sync.RWMutex
 	templates    *template.Template
 	scanner      *scanner.Scanner
-	scanActive   bool
+	state        ScanState
 	scanMutex    sync.RWMutex
+	statusMutex  sync.Mutex // Serializes status broadcasts
+	scanID       uint64     // Incremented by each StartScan and DumpScan
+	scanRange    string     // CIDR of the current or last scan
+	scanStarted  time.Time
+	scanFinished time.Time
+	scanErr      error               // Why the last scan was aborted, if it was
+	scanInfo     export.ScanInfo     // Parameters of the current or last scan, for exports
+	resultsOut   *export.JSONLWriter // Incremental results file, nil for none
+	redactor     *export.Redactor    // Anonymizes what clients see, the results file and CSV download, nil for none
+	filter       export.Filter       // Devices shown and exported
+	appendScans  bool                // Keep earlier scans' devices when a scan starts
+	onComplete   CompleteFunc        // Called after each scan ends, nil for none
+	onStats      StatsFunc           // Called with each scan's timing report, nil for none
 	authToken    string
 	staticFS     fs.FS
 	version      string
 	writeMutex   sync.Map // Per-connection write mutex
+	scanOptions  scanner.Options
+	workerCount  int
+	scanDone     chan struct{} // Closed when the current scan finishes
+	resolving    atomic.Bool   // Hostnames are being resolved again
+	lastScan     time.Time     // When the last scheduled scan finished
+	nextScan     time.Time     // When the next scheduled scan starts
 }
 
-// NewServer creates a new web interface server
+// NewServer creates a new web interface server. An empty authToken is
+// replaced with a random one, available from AuthToken.
 func NewServer(port int, authToken string, version string) (*Server, error) {
+	if authToken == "" {
+		var err error
+		if authToken, err = GenerateAuthToken(DefaultAuthTokenLength); err != nil {
+			return nil, err
+		}
+	}
+
 	// Parse templates from embedded filesystem
 	templates, err := template.ParseFS(content, "templates/*.html")
 	if err != nil {
@@ -74,77 +107,178 @@ func NewServer(port int, authToken string, version string) (*Server, error) {
 	}
 
 	// Verify critical files exist
-	files := []string{
-		"css/styles.css",
-		"js/app.js",
-	}
-	for _, file := range files {
-		if _, err := fs.Stat(staticFS, file); err != nil {
-			return nil, fmt.Errorf("required static file missing - %s: %v", file, err)
-		}
+	if err := checkAssets(templates, staticFS); err != nil {
+		return nil, err
 	}
 
 	return &Server{
-		port:      port,
-		upgrader:  websocket.Upgrader{},
-		clients:   make(map[*websocket.Conn]bool),
-		devices:   make(map[string]scanner.Device),
-		templates: templates,
-		authToken: authToken,
-		staticFS:  staticFS,
-		version:   version,
+		port:        port,
+		upgrader:    websocket.Upgrader{EnableCompression: true},
+		clients:     make(map[*websocket.Conn]bool),
+		devices:     make(map[string]scanner.Device),
+		history:     make(map[string]scanner.Device),
+		templates:   templates,
+		authToken:   authToken,
+		staticFS:    staticFS,
+		version:     version,
+		workerCount: 50,
+		authLimiter: newAuthLimiter(),
+		state:       StateIdle,
 	}, nil
 }
 
+// SetScanOptions sets the scanner options and worker count used for
+// web-initiated scans. The server's own port is kept out of probes of this
+// machine, where every scan would otherwise count against its auth lockout.
+func (s *Server) SetScanOptions(opts scanner.Options, workers int) {
+	opts.SelfPorts = append(slices.Clone(opts.SelfPorts), s.port)
+	s.scanOptions = opts
+	if workers > 0 {
+		s.workerCount = workers
+	}
+}
+
+// SetResultsOut appends every device found by web scans to out as it
+// arrives
+func (s *Server) SetResultsOut(out *export.JSONLWriter) {
+	s.resultsOut = out
+}
+
+// SetFilter limits the devices shown, exported and written to the results
+// file to those matching filter. Scans still find every device.
+func (s *Server) SetFilter(filter export.Filter) {
+	s.filter = filter
+}
+
+// SetRedactor anonymizes the devices shown in the UI and the API, the
+// results file and the CSV download with r, nil to leave them as found
+func (s *Server) SetRedactor(r *export.Redactor) {
+	s.redactor = r
+}
+
+// SetAppend makes each scan merge its results into the devices found by
+// earlier ones instead of starting from an empty list. Clearing the results
+// still empties it.
+func (s *Server) SetAppend(enabled bool) {
+	s.appendScans = enabled
+}
+
+// CompleteFunc is called when a scan ends in state, complete, stopped or
+// aborted, with the devices passing the filter and the scan parameters
+type CompleteFunc func(devices map[string]scanner.Device, info export.ScanInfo, state ScanState)
+
+// SetOnComplete calls fn after each scan ends. It runs in a goroutine of
+// its own, so it may take its time.
+func (s *Server) SetOnComplete(fn CompleteFunc) {
+	s.onComplete = fn
+}
+
+// StatsFunc is called when a scan ends with where its time went
+type StatsFunc func(report scanner.ScanReport)
+
+// SetOnStats calls fn with the timing report of each scan that ends, before
+// the scan's final state is broadcast
+func (s *Server) SetOnStats(fn StatsFunc) {
+	s.onStats = fn
+}
+
+// writeResult appends device to the results file if it passes the filter
+func (s *Server) writeResult(device scanner.Device) {
+	if !s.filter.Match(device) {
+		return
+	}
+	if err := s.resultsOut.Write(s.redactor.Device(device)); err != nil {
+		log.Printf("Error writing %s to results file: %v", device.IPAddress, err)
+	}
+}
+
+// SetBindAddress sets the address the server listens on, empty for all
+// interfaces
+func (s *Server) SetBindAddress(host string) {
+	s.bind = host
+}
+
 // authenticateRequest checks if the request has a valid auth token
 func (s *Server) authenticateRequest(r *http.Request) bool {
-	token := r.URL.Query().Get("auth")
-	return token == s.authToken
+	return s.tokenMatches(requestToken(r))
 }
 
 // Start initializes and starts the web server
 func (s *Server) Start() error {
 
-	// Authentication middleware
-	authMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+	// Authentication middleware. Static assets are fetched by the browser
+	// without a token before the page's cookie is set, so those requests
+	// don't count toward the lockout; a token guessed there still does.
+	requireAuth := func(next http.HandlerFunc, asset bool) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			token := r.URL.Query().Get("auth")
 			clientIP := r.Header.Get("X-Real-IP")
 			if clientIP == "" {
 				clientIP = r.RemoteAddr
 			}
 
+			peer := remoteIP(r)
+			now := time.Now()
+			if wait := s.authLimiter.lockedOut(peer, now); wait > 0 {
+				log.Printf("%s[LOCKED]%s Refused %s for another %s after repeated invalid tokens%s",
+					colorRed, colorWhite, clientIP, wait.Round(time.Second), colorReset)
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+				return
+			}
+
 			if !s.authenticateRequest(r) {
-				log.Printf("%s[DENIED]%s Access attempt from %s - Invalid token: %s%s",
-					colorRed, colorWhite, clientIP, token, colorReset)
+				log.Printf("%s[DENIED]%s Access attempt from %s - Invalid token%s",
+					colorRed, colorWhite, clientIP, colorReset)
+				if asset && requestToken(r) == "" {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				if s.authLimiter.fail(peer, now) {
+					log.Printf("%s[LOCKED]%s Locking out %s for %s%s",
+						colorRed, colorWhite, peer, authLockout, colorReset)
+				}
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
+			s.authLimiter.succeed(peer)
+			s.setAuthCookie(w, r)
 			log.Printf("%s[AUTH]%s Successful access from %s%s",
 				colorGreen, colorWhite, clientIP, colorReset)
 			next(w, r)
 		}
 	}
+	authMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return requireAuth(next, false)
+	}
 
 	// Serve static files with auth
 	fileServer := http.FileServer(http.FS(s.staticFS))
-	http.HandleFunc("/static/", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/static/", requireAuth(gzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/static/")
+		setStaticContentType(w, r.URL.Path)
 		fileServer.ServeHTTP(w, r)
-	}))
+	}), true))
+
+	// The favicon is public so browsers don't trip the auth lockout asking
+	// for it before the page has loaded
+	http.HandleFunc("/favicon.ico", gzipMiddleware(s.handleFavicon))
+	http.HandleFunc("/favicon.svg", gzipMiddleware(s.handleFavicon))
 
-	// Handle main routes with auth
-	http.HandleFunc("/", authMiddleware(s.handleIndex))
+	// Health checks are public so load balancers and orchestrators can
+	// probe the server without a token
+	http.HandleFunc("/healthz", s.handleHealthz)
+	http.HandleFunc("/readyz", s.handleReadyz)
+
+	// Handle main routes with auth. The WebSocket compresses per message, so
+	// it is left out of the gzip middleware.
+	http.HandleFunc("/", authMiddleware(gzipMiddleware(s.handleIndex)))
 	http.HandleFunc("/ws", authMiddleware(s.handleWebSocket))
-	http.HandleFunc("/save", authMiddleware(s.handleSaveScan))
+	http.HandleFunc("/save", authMiddleware(gzipMiddleware(s.handleSaveScan)))
+	http.HandleFunc("/api/scan", authMiddleware(gzipMiddleware(s.handleAPIScan)))
+	http.HandleFunc("/api/scan/", authMiddleware(gzipMiddleware(s.handleAPIScanID)))
 
 	// Start server
-	addr := fmt.Sprintf(":%d", s.port)
-	//log.Printf("%s[SERVER]%s Web interface available at:%s", colorCyan, colorWhite, colorReset)
-	//log.Printf("%s[URL]%s http://localhost%s?auth=%s%s",
-	//	colorGreen, colorWhite, addr, s.authToken, colorReset)
-	//	log.Printf("%s[URL]%s http://<your-ip>%s?auth=%s%s",
-	//	colorGreen, colorWhite, addr, s.authToken, colorReset)
+	addr := net.JoinHostPort(s.bind, strconv.Itoa(s.port))
 	return http.ListenAndServe(addr, nil)
 }
 
@@ -161,7 +295,6 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
 		"Version":    s.version,
 		"Interfaces": interfaces,
-		"AuthToken":  s.authToken,
 	}
 
 	if err := s.templates.ExecuteTemplate(w, "index.html", data); err != nil {
@@ -170,6 +303,80 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// staticContentTypes are set explicitly because the system MIME table can be
+// wrong, e.g. some Windows registries map .js to text/plain
+var staticContentTypes = map[string]string{
+	".css": "text/css; charset=utf-8",
+	".js":  "text/javascript; charset=utf-8",
+	".svg": "image/svg+xml",
+}
+
+// setStaticContentType sets the Content-Type for a static file by extension
+func setStaticContentType(w http.ResponseWriter, name string) {
+	if contentType, ok := staticContentTypes[path.Ext(name)]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+}
+
+// handleFavicon serves the embedded favicon
+func (s *Server) handleFavicon(w http.ResponseWriter, r *http.Request) {
+	data, err := fs.ReadFile(s.staticFS, "favicon.svg")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	setStaticContentType(w, "favicon.svg")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(data)
+}
+
+// WebSocket keepalive: the server pings every pingPeriod and drops clients
+// that have not answered, or sent anything, within pongWait
+const (
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	writeWait  = 10 * time.Second
+)
+
+// connMutex returns the mutex serializing writes to conn
+func (s *Server) connMutex(conn *websocket.Conn) *sync.Mutex {
+	mutex, _ := s.writeMutex.LoadOrStore(conn, &sync.Mutex{})
+	return mutex.(*sync.Mutex)
+}
+
+// writeJSON sends v to a single client
+func (s *Server) writeJSON(conn *websocket.Conn, v interface{}) error {
+	mutex := s.connMutex(conn)
+	mutex.Lock()
+	defer mutex.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return conn.WriteJSON(v)
+}
+
+// pingClient pings conn until done is closed, closing the connection when a
+// ping can't be written so the read loop exits and reaps the client
+func (s *Server) pingClient(conn *websocket.Conn, clientIP string, done <-chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			mutex := s.connMutex(conn)
+			mutex.Lock()
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			mutex.Unlock()
+			if err != nil {
+				log.Printf("%s[WS-TIMEOUT]%s Ping to %s failed: %v%s",
+					colorYellow, colorWhite, clientIP, err, colorReset)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
 // handleWebSocket handles WebSocket connections
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	clientIP := r.Header.Get("X-Real-IP")
@@ -210,26 +417,43 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			colorYellow, colorWhite, clientIP, colorReset)
 	}()
 
+	// Keep the connection alive, and drop it if the client stops answering
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go s.pingClient(conn, clientIP, stopPing)
+
 	// Send initial interface list
 	interfaces, err := getNetworkInterfaces()
 	if err == nil {
-		conn.WriteJSON(map[string]interface{}{
+		s.writeJSON(conn, map[string]interface{}{
 			"type":       "interfaces",
 			"interfaces": interfaces,
 		})
 	}
 
+	// Send the scan state so the client shows the right view and buttons; it
+	// goes first so a client joining mid-scan keeps the devices that follow
+	s.scanMutex.RLock()
+	status := s.statusUpdate()
+	s.scanMutex.RUnlock()
+	s.writeJSON(conn, status)
+
 	// Send existing device data if available
 	s.deviceMutex.RLock()
 	if len(s.devices) > 0 {
-		conn.WriteJSON(map[string]interface{}{
-			"type":    "devices",
-			"devices": s.devices,
-			"total":   len(s.devices),
-		})
+		s.writeJSON(conn, s.devicesUpdate(s.devices))
 	}
 	s.deviceMutex.RUnlock()
 
+	// Send the rescan schedule if periodic scanning is enabled
+	if schedule := s.scheduleUpdate(); schedule != nil {
+		s.writeJSON(conn, schedule)
+	}
+
 	// Handle messages
 	for {
 		messageType, p, err := conn.ReadMessage()
@@ -239,6 +463,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			}
 			break
 		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
 
 		if messageType == websocket.TextMessage {
 			var msg map[string]interface{}
@@ -253,7 +478,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 				if range_, ok := msg["range"].(string); ok {
 					log.Printf("Web client requested scan of %s", range_)
 					if err := s.StartScan(range_); err != nil {
-						conn.WriteJSON(map[string]interface{}{
+						s.writeJSON(conn, map[string]interface{}{
 							"type":  "error",
 							"error": err.Error(),
 						})
@@ -262,14 +487,42 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			case "stop_scan":
 				s.StopScan()
 			case "dump_scan":
-				s.DumpScan()
-				conn.WriteJSON(map[string]interface{}{
-					"type": "scan_dumped",
-				})
-			}
-		} else if messageType == websocket.PingMessage {
-			if err := conn.WriteMessage(websocket.PongMessage, nil); err != nil {
-				return
+				// Waits for a running scan to wind down
+				go s.DumpScan()
+			case "resolve_names":
+				log.Printf("Web client requested hostname resolution")
+				go func() {
+					if err := s.ResolveNames(); err != nil {
+						s.writeJSON(conn, map[string]interface{}{
+							"type":  "error",
+							"error": err.Error(),
+						})
+					}
+				}()
+			case "deep_probe":
+				if ip, ok := msg["ip"].(string); ok {
+					log.Printf("Web client requested deep probe of %s", ip)
+					go func() {
+						if err := s.DeepProbe(s.deviceIP(ip)); err != nil {
+							s.writeJSON(conn, map[string]interface{}{
+								"type":  "error",
+								"error": err.Error(),
+							})
+						}
+					}()
+				}
+			case "add_host":
+				if ip, ok := msg["ip"].(string); ok {
+					log.Printf("Web client requested manual scan of %s", ip)
+					go func() {
+						if err := s.AddHost(ip); err != nil {
+							s.writeJSON(conn, map[string]interface{}{
+								"type":  "error",
+								"error": err.Error(),
+							})
+						}
+					}()
+				}
 			}
 		}
 	}
@@ -281,12 +534,10 @@ func (s *Server) BroadcastUpdate(update interface{}) {
 	defer s.clientsMutex.RUnlock()
 
 	for client := range s.clients {
-		// Get or create mutex for this connection
-		mutex, _ := s.writeMutex.LoadOrStore(client, &sync.Mutex{})
-		writeMutex := mutex.(*sync.Mutex)
-
-		// Protect the write with the mutex
+		// Bound the write so a half-open connection can't stall the broadcast
+		writeMutex := s.connMutex(client)
 		writeMutex.Lock()
+		client.SetWriteDeadline(time.Now().Add(writeWait))
 		err := client.WriteJSON(update)
 		writeMutex.Unlock()
 
@@ -309,10 +560,7 @@ func (s *Server) UpdateDevices(devices map[string]scanner.Device) {
 	s.devices = devices
 	s.deviceMutex.Unlock()
 
-	s.BroadcastUpdate(map[string]interface{}{
-		"type":    "devices",
-		"devices": devices,
-	})
+	s.BroadcastUpdate(s.devicesUpdate(devices))
 }
 
 // UpdateProgress sends a progress update to all clients
@@ -325,55 +573,212 @@ func (s *Server) UpdateProgress(scanned, total, discovered int32) {
 	})
 }
 
-// StartScan initiates a network scan
+// AddHost scans a single address, e.g. a documented host the sweep missed,
+// and adds it to the results even if it is down
+func (s *Server) AddHost(ip string) error {
+	opts := s.scanOptions
+	opts.Debug = false
+	opts.Gateway = discoverGateway()
+	sc := scanner.NewScannerWithOptions(opts)
+	defer sc.Close()
+
+	device, err := sc.ScanHost(ip)
+	if err != nil {
+		return err
+	}
+	device.AddNote(scanner.NoteAddedManually)
+
+	s.deviceMutex.Lock()
+	device.CarrySeen(s.history[device.IPAddress])
+	s.devices[device.IPAddress] = device
+	s.deviceMutex.Unlock()
+	s.writeResult(device)
+	s.UpdateDevices(s.snapshotDevices())
+
+	log.Printf("%s[SCAN-ADD]%s Added %s manually (%s)%s",
+		colorCyan, colorWhite, device.IPAddress, device.Status, colorReset)
+	return nil
+}
+
+// DeepProbe investigates a listed device in depth, for a host the sweep
+// couldn't identify: the deep port set, every hostname resolver and longer
+// timeouts. What the sweep learned and the probe didn't is kept.
+func (s *Server) DeepProbe(ip string) error {
+	opts := s.scanOptions.Deep()
+	opts.Debug = false
+	opts.Gateway = discoverGateway()
+	sc := scanner.NewScannerWithOptions(opts)
+	defer sc.Close()
+
+	device, err := sc.ScanHost(ip)
+	if err != nil {
+		return err
+	}
+	if device.Status != "Up" {
+		return fmt.Errorf("deep probe of %s got no answer", device.IPAddress)
+	}
+
+	s.deviceMutex.Lock()
+	if previous, ok := s.devices[device.IPAddress]; ok {
+		device.Merge(previous)
+	}
+	device.AddNote(scanner.NoteDeepProbed)
+	s.devices[device.IPAddress] = device
+	s.deviceMutex.Unlock()
+	s.writeResult(device)
+	s.UpdateDevices(s.snapshotDevices())
+
+	log.Printf("%s[SCAN-DEEP]%s Deep probed %s%s",
+		colorCyan, colorWhite, device.IPAddress, colorReset)
+	return nil
+}
+
+// ErrScanInProgress is returned when a scan is started while another is
+// still running
+var ErrScanInProgress = errors.New("scan already in progress")
+
+// ResolveNames runs hostname resolution again on the current devices
+// without probing them, for when DNS came back after the scan, and
+// broadcasts the devices whose names changed
+func (s *Server) ResolveNames() error {
+	if !s.resolving.CompareAndSwap(false, true) {
+		return errors.New("hostnames are already being resolved")
+	}
+	defer s.resolving.Store(false)
+	s.scanMutex.RLock()
+	active, scanID := s.state.Active(), s.scanID
+	s.scanMutex.RUnlock()
+	if active {
+		return ErrScanInProgress
+	}
+
+	current := s.snapshotDevices()
+	devices := make([]scanner.Device, 0, len(current))
+	for _, device := range current {
+		devices = append(devices, device)
+	}
+	opts := s.scanOptions
+	opts.Debug = false
+	sc := scanner.NewScannerWithOptions(opts)
+	defer sc.Close()
+	resolved := sc.Resolve(devices, s.workerCount)
+
+	// A scan or dump started meanwhile replaced the devices
+	s.scanMutex.RLock()
+	stale := s.scanID != scanID || s.state.Active()
+	s.scanMutex.RUnlock()
+	if stale {
+		return nil
+	}
+	changed := 0
+	s.deviceMutex.Lock()
+	for _, device := range resolved {
+		listed, ok := s.devices[device.IPAddress]
+		if !ok || !listed.SetNames(device) {
+			continue
+		}
+		s.devices[device.IPAddress] = listed
+		s.writeResult(listed)
+		changed++
+	}
+	s.deviceMutex.Unlock()
+	s.UpdateDevices(s.snapshotDevices())
+	s.BroadcastUpdate(map[string]interface{}{
+		"type":    "names_resolved",
+		"changed": changed,
+		"total":   len(resolved),
+	})
+
+	log.Printf("%s[RESOLVE]%s Resolved hostnames again: %d of %d devices changed%s",
+		colorCyan, colorWhite, changed, len(resolved), colorReset)
+	return nil
+}
+
+// StartScan initiates a network scan with the server's scan options
 func (s *Server) StartScan(cidr string) error {
+	_, err := s.startScan(cidr, s.scanOptions, s.workerCount)
+	return err
+}
+
+// discoverGateway returns the default gateway, labeled in the results and
+// probed first with GatewayFirst, or nil when none is found. It asks the OS,
+// so it's called as each scan starts rather than kept in scanOptions.
+func discoverGateway() net.IP {
+	ip, err := gateway.DiscoverGateway()
+	if err != nil {
+		log.Printf("Error discovering gateway: %v", err)
+		return nil
+	}
+	return ip
+}
+
+// startScan scans cidr with opts and workers in the background, returning
+// the new scan's ID
+func (s *Server) startScan(cidr string, opts scanner.Options, workers int) (uint64, error) {
+	// Scan, report and record the network an address with a prefix is in
+	if network, err := scanner.NormalizeCIDR(cidr); err == nil {
+		cidr = network
+	}
+	opts.Gateway = discoverGateway() // Asks the OS, so not under scanMutex
 	s.scanMutex.Lock()
-	if s.scanActive {
+	if s.state.Active() {
 		s.scanMutex.Unlock()
 		log.Printf("%s[SCAN-ERROR]%s Attempted to start scan while another is in progress%s",
 			colorRed, colorWhite, colorReset)
-		return fmt.Errorf("scan already in progress")
+		return 0, ErrScanInProgress
 	}
-	s.scanActive = true
+	s.state = StateScanning
+	s.scanRange = cidr
+	s.scanStarted = time.Now()
+	s.scanFinished = time.Time{}
+	s.scanErr = nil
+	s.scanInfo = export.NewScanInfo(s.version, cidr, opts, workers, 0, s.scanStarted)
+	s.scanID++
+	scanID := s.scanID
+	scanDone := make(chan struct{})
+	s.scanDone = scanDone
+
+	// Create new scanner instance
+	opts.Debug = false // debug disabled for web interface
+	sc := scanner.NewScannerWithOptions(opts)
+	s.scanner = sc
 	s.scanMutex.Unlock()
 
 	log.Printf("%s[SCAN-START]%s Beginning network scan of %s%s",
 		colorCyan, colorWhite, cidr, colorReset)
 
-	// Create new scanner instance
-	s.scanner = scanner.NewScanner(false) // debug disabled for web interface
-	if s.scanner == nil {
-		s.scanActive = false
-		return fmt.Errorf("failed to create scanner")
-	}
-
-	// Reset device list
+	// Reset device list, unless this scan adds to it
 	s.deviceMutex.Lock()
-	s.devices = make(map[string]scanner.Device)
+	export.RecordSeen(s.history, s.devices)
+	if !s.appendScans {
+		s.devices = make(map[string]scanner.Device)
+	}
 	s.deviceMutex.Unlock()
+	s.broadcastStatus()
 
 	// Start scan in background
 	go func() {
-		defer func() {
-			s.scanMutex.Lock()
-			s.scanActive = false
-			s.scanMutex.Unlock()
-		}()
+		defer close(scanDone)
 
-		if err := s.scanner.ScanNetwork(cidr, 50); err != nil {
+		if err := sc.ScanNetwork(cidr, workers); err != nil {
 			log.Printf("Scan error: %v", err)
 			s.BroadcastUpdate(map[string]interface{}{
 				"type":  "error",
 				"error": err.Error(),
 			})
+			s.finishScan(scanID, StateIdle)
 			return
 		}
 
 		// Process results
-		resultsChan, doneChan := s.scanner.GetResults()
+		resultsChan, doneChan := sc.GetResults()
+		warningsChan := sc.GetWarnings()
 		var discoveredCount int32
+		found := make(map[string]bool) // Devices counted in discoveredCount, those passing the filter
 
-		// UpdateProgress sends a progress update to all clients
+		// Send progress to all clients until the scan finishes. Only the
+		// loop below reads doneChan; it closes finished for this goroutine.
+		finished := make(chan struct{})
 		progressDone := make(chan struct{})
 		go func() {
 			ticker := time.NewTicker(500 * time.Millisecond)
@@ -382,186 +787,296 @@ func (s *Server) StartScan(cidr string) error {
 
 			for {
 				select {
-				case <-doneChan:
-					// Send one final progress update before exiting
-					s.scanMutex.RLock()
-					scanner := s.scanner
-					s.scanMutex.RUnlock()
-
-					if scanner != nil {
-						stats := scanner.GetWorkerStats()
-						if len(stats) > 0 {
-							var totalIPs int32
-							var scannedIPs int32
-							for _, stat := range stats {
-								totalIPs = stat.TotalIPs
-								scannedIPs = stat.IPsScanned
-								break
-							}
-							s.UpdateProgress(scannedIPs, totalIPs, atomic.LoadInt32(&discoveredCount))
-						}
-					}
+				case <-finished:
 					return
 				case <-ticker.C:
-					s.scanMutex.RLock()
-					active := s.scanActive
-					scanner := s.scanner
-					s.scanMutex.RUnlock()
-
-					if !active || scanner == nil {
-						return
-					}
-
-					stats := scanner.GetWorkerStats()
-					if len(stats) > 0 {
-						var totalIPs int32
-						var scannedIPs int32
-						for _, stat := range stats {
-							totalIPs = stat.TotalIPs
-							scannedIPs = stat.IPsScanned
-							break
-						}
-						s.UpdateProgress(scannedIPs, totalIPs, atomic.LoadInt32(&discoveredCount))
+					if s.isCurrentScan(scanID) {
+						s.broadcastProgress(sc, atomic.LoadInt32(&discoveredCount), opts.MaxResults)
 					}
 				}
 			}
 		}()
 
+		// storeDevice keeps a result unless the scan was dumped meanwhile;
+		// results are still drained so the scanner can wind down
+		storeDevice := func(device scanner.Device) {
+			if !s.isCurrentScan(scanID) {
+				return
+			}
+			s.deviceMutex.Lock()
+			device.CarrySeen(s.history[device.IPAddress])
+			if previous, ok := s.devices[device.IPAddress]; ok && s.appendScans {
+				device.Merge(previous)
+			}
+			s.devices[device.IPAddress] = device
+			s.deviceMutex.Unlock()
+			// A device is sent again when a late hostname arrives, which
+			// may change whether it passes the filter
+			if match := s.filter.Match(device); match != found[device.IPAddress] {
+				found[device.IPAddress] = match
+				if match {
+					atomic.AddInt32(&discoveredCount, 1)
+				} else {
+					atomic.AddInt32(&discoveredCount, -1)
+				}
+			}
+			s.writeResult(device)
+		}
+
 		// Process results until done
 		for {
 			select {
-			case device, ok := <-resultsChan:
-				if !ok {
-					// Channel closed, wait for doneChan
-					continue
+			case device := <-resultsChan:
+				storeDevice(device)
+				if s.isCurrentScan(scanID) {
+					s.UpdateDevices(s.snapshotDevices())
+				}
+
+			case warning := <-warningsChan:
+				if s.isCurrentScan(scanID) {
+					s.BroadcastUpdate(map[string]interface{}{
+						"type":    "device_warning",
+						"ip":      s.redactor.Tag(warning.IPAddress),
+						"message": warning.Message,
+						"time":    warning.Time,
+					})
 				}
-				s.deviceMutex.Lock()
-				s.devices[device.IPAddress] = device
-				s.deviceMutex.Unlock()
-				atomic.AddInt32(&discoveredCount, 1)
-				s.UpdateDevices(s.devices)
 
 			case <-doneChan:
-				// Wait for progress goroutine to finish
+				close(finished)
 				<-progressDone
 
-				// Send final update
-				s.deviceMutex.RLock()
-				finalDevices := make(map[string]scanner.Device)
-				for k, v := range s.devices {
-					finalDevices[k] = v
-				}
-				s.deviceMutex.RUnlock()
-
-				// Send final progress update
-				s.scanMutex.RLock()
-				scanner := s.scanner
-				s.scanMutex.RUnlock()
-
-				if scanner != nil {
-					stats := scanner.GetWorkerStats()
-					if len(stats) > 0 {
-						var totalIPs int32
-						var scannedIPs int32
-						for _, stat := range stats {
-							totalIPs = stat.TotalIPs
-							scannedIPs = stat.IPsScanned
-							break
-						}
-						s.UpdateProgress(scannedIPs, totalIPs, atomic.LoadInt32(&discoveredCount))
+				// Pick up results still buffered when the scan finished
+				for drained := false; !drained; {
+					select {
+					case device := <-resultsChan:
+						storeDevice(device)
+					default:
+						drained = true
 					}
 				}
 
-				// Send final device update
-				s.BroadcastUpdate(map[string]interface{}{
-					"type":    "devices",
-					"devices": finalDevices,
-					"total":   len(finalDevices),
-				})
+				if !s.isCurrentScan(scanID) {
+					// DumpScan already told clients the results are gone
+					return
+				}
+
+				if s.onStats != nil {
+					s.onStats(sc.ScanStats())
+				}
+				s.broadcastProgress(sc, atomic.LoadInt32(&discoveredCount), opts.MaxResults)
+				finalDevices := s.snapshotDevices()
+				s.BroadcastUpdate(s.devicesUpdate(finalDevices))
+
+				if err := sc.Err(); err != nil {
+					log.Printf("%s[SCAN-ABORT]%s Scan of %s aborted (%v) with %d devices kept%s",
+						colorRed, colorWhite, cidr, err, len(finalDevices), colorReset)
+					s.abortScan(scanID, err)
+				} else if s.State() == StateStopping {
+					log.Printf("%s[SCAN-STOP]%s Scan of %s stopped with %d devices kept%s",
+						colorYellow, colorWhite, cidr, len(finalDevices), colorReset)
+					s.finishScan(scanID, StateStopped)
+				} else {
+					s.finishScan(scanID, StateComplete)
+				}
+				return
+			}
+		}
+	}()
+
+	return scanID, nil
+}
+
+// finishScan moves scan scanID to its final state, unless it has been
+// replaced or dumped in the meantime
+func (s *Server) finishScan(scanID uint64, state ScanState) {
+	s.scanMutex.Lock()
+	if s.scanID != scanID {
+		s.scanMutex.Unlock()
+		return
+	}
+	s.state = state
+	s.scanFinished = time.Now()
+	info := s.scanInfo
+	s.scanMutex.Unlock()
+	s.broadcastStatus()
+
+	if s.onComplete != nil {
+		devices := s.filter.Apply(s.snapshotDevices())
+		go s.onComplete(devices, info, state)
+	}
+}
+
+// abortScan moves scan scanID to StateAborted with err, unless it has been
+// replaced or dumped in the meantime
+func (s *Server) abortScan(scanID uint64, err error) {
+	s.scanMutex.Lock()
+	if s.scanID == scanID {
+		s.scanErr = err
+	}
+	s.scanMutex.Unlock()
+	s.finishScan(scanID, StateAborted)
+}
+
+// isCurrentScan reports whether scanID is still the latest scan, i.e. it has
+// not been replaced or dumped
+func (s *Server) isCurrentScan(scanID uint64) bool {
+	s.scanMutex.RLock()
+	defer s.scanMutex.RUnlock()
+	return s.scanID == scanID
+}
+
+// broadcastProgress sends sc's progress to all clients, with the result cap
+// limit once the scan has dropped devices past it
+func (s *Server) broadcastProgress(sc *scanner.Scanner, discovered int32, limit int) {
+	stats := sc.Stats()
+	update := map[string]interface{}{
+		"type":       "progress",
+		"scanned":    stats.Scanned,
+		"total":      stats.Total,
+		"discovered": discovered,
+	}
+	if stats.Truncated > 0 {
+		update["truncated_at"] = limit
+	}
+	s.BroadcastUpdate(update)
+}
 
-				// Send scan complete notification
+// StartSchedule rescans cidr every interval until the process exits,
+// broadcasting the difference from the previous scan after each run
+func (s *Server) StartSchedule(cidr string, interval time.Duration) {
+	go func() {
+		var previous map[string]scanner.Device
+		for {
+			if err := s.StartScan(cidr); err != nil {
+				// A scan started from the browser is running; check back shortly
+				log.Printf("Scheduled scan skipped: %v", err)
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			s.scanMutex.RLock()
+			done := s.scanDone
+			s.scanMutex.RUnlock()
+			<-done
+
+			current := s.snapshotDevices()
+			if previous != nil {
+				diff := export.DiffDevices(previous, current)
+				log.Printf("%s[SCAN-DIFF]%s %s: %s%s", colorBlue, colorWhite, cidr, diff, colorReset)
 				s.BroadcastUpdate(map[string]interface{}{
-					"type":    "scan_complete",
-					"message": "Scan Complete",
-					"status":  "SCAN DONE",
+					"type": "scan_diff",
+					"diff": s.clientDiff(diff),
 				})
+			}
+			previous = current
 
-				// Ensure scan is marked as complete
-				s.scanMutex.Lock()
-				s.scanActive = false
-				s.scanMutex.Unlock()
-				return
+			s.scanMutex.Lock()
+			s.lastScan = time.Now()
+			s.nextScan = s.lastScan.Add(interval)
+			s.scanMutex.Unlock()
+			if schedule := s.scheduleUpdate(); schedule != nil {
+				s.BroadcastUpdate(schedule)
 			}
+
+			time.Sleep(interval)
 		}
 	}()
+}
 
-	return nil
+// scheduleUpdate returns the last/next scheduled scan times as a client
+// message, or nil if no scheduled scan has run yet
+func (s *Server) scheduleUpdate() map[string]interface{} {
+	s.scanMutex.RLock()
+	defer s.scanMutex.RUnlock()
+	if s.lastScan.IsZero() {
+		return nil
+	}
+	return map[string]interface{}{
+		"type":      "schedule",
+		"last_scan": s.lastScan.Format(time.RFC3339),
+		"next_scan": s.nextScan.Format(time.RFC3339),
+	}
 }
 
-// StopScan stops the current scan
+// snapshotDevices returns a copy of the current device list
+func (s *Server) snapshotDevices() map[string]scanner.Device {
+	s.deviceMutex.RLock()
+	defer s.deviceMutex.RUnlock()
+	devices := make(map[string]scanner.Device, len(s.devices))
+	for k, v := range s.devices {
+		devices[k] = v
+	}
+	return devices
+}
+
+// StopScan stops the current scan. Devices found so far are kept; the state
+// moves to stopping, then to stopped once the workers have wound down.
 func (s *Server) StopScan() {
 	s.scanMutex.Lock()
-	defer s.scanMutex.Unlock()
-
-	if s.scanActive && s.scanner != nil {
-		log.Printf("%s[SCAN-STOP]%s Scan stopped by user request%s",
-			colorYellow, colorWhite, colorReset)
-		s.scanner.Stop()
-		s.scanActive = false
+	if s.state != StateScanning || s.scanner == nil {
+		s.scanMutex.Unlock()
+		return
 	}
+	log.Printf("%s[SCAN-STOP]%s Scan stopped by user request%s",
+		colorYellow, colorWhite, colorReset)
+	s.state = StateStopping
+	s.scanner.Stop()
+	s.scanMutex.Unlock()
+	s.broadcastStatus()
 }
 
-// DumpScan clears all scan data
+// DumpScan stops any active scan, waits for it to wind down and clears all
+// scan data
 func (s *Server) DumpScan() {
 	log.Printf("%s[SCAN-DUMP]%s Clearing scan data%s",
 		colorPurple, colorWhite, colorReset)
 
-	// Stop any active scan first
-	s.StopScan()
+	// Stop any active scan first and wait until it has completed, so none
+	// of its late results land after the clear
+	s.scanMutex.Lock()
+	for s.state.Active() && s.scanner != nil {
+		sc, done := s.scanner, s.scanDone
+		stopping := s.state == StateScanning
+		if stopping {
+			s.state = StateStopping
+		}
+		s.scanMutex.Unlock()
+		if stopping {
+			s.broadcastStatus()
+		}
+		sc.Stop()
+		<-done
+		s.scanMutex.Lock()
+	}
+	s.scanID++
+	s.state = StateCleared
+	s.scanFinished = time.Now()
+	s.scanMutex.Unlock()
 
-	// Clear device data
+	// Clear device data, and the history of earlier scans with it
 	s.deviceMutex.Lock()
 	s.devices = make(map[string]scanner.Device)
+	s.history = make(map[string]scanner.Device)
 	s.deviceMutex.Unlock()
 
-	// Reset scan state
-	s.scanMutex.Lock()
-	s.scanActive = false
-	s.scanner = nil // Clear scanner instance
-	s.scanMutex.Unlock()
-
-	// Broadcast empty device list to all clients
-	s.BroadcastUpdate(map[string]interface{}{
-		"type":    "devices",
-		"devices": make(map[string]scanner.Device),
-		"total":   0,
-	})
-
-	// Send scan complete notification
-	s.BroadcastUpdate(map[string]interface{}{
-		"type":    "scan_complete",
-		"message": "Scan Data Cleared",
-		"status":  "CLEARED",
-	})
+	// Tell every client, not just the one that asked, that the results are gone
+	s.broadcastStatus()
 }
 
 // CompareIPs compares two IP addresses for sorting
 func CompareIPs(a, b string) int {
-	aOctets := strings.Split(a, ".")
-	bOctets := strings.Split(b, ".")
-
-	for i := 0; i < 4; i++ {
-		aNum, _ := strconv.Atoi(aOctets[i])
-		bNum, _ := strconv.Atoi(bOctets[i])
-		if aNum != bNum {
-			return aNum - bNum
-		}
-	}
-	return 0
+	return export.CompareIPs(a, b)
 }
 
 // SaveScan generates a CSV export of the scan data
 func (s *Server) SaveScan(w http.ResponseWriter) {
+	s.scanMutex.RLock()
+	info := s.scanInfo
+	s.scanMutex.RUnlock()
+	if info.Range == "" {
+		info.Version = strings.TrimPrefix(s.version, "v")
+	}
+
 	s.deviceMutex.RLock()
 	defer s.deviceMutex.RUnlock()
 
@@ -572,61 +1087,8 @@ func (s *Server) SaveScan(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=netventory-scan-"+time.Now().Format("2006-01-02-150405")+".csv")
 
-	// Create CSV writer
-	writer := csv.NewWriter(w)
-	defer writer.Flush()
-
-	// Write header with version and timestamp
-	writer.Write([]string{"NetVentory " + s.version})
-	writer.Write([]string{"https://github.com/RamboRogers/netventory"})
-	writer.Write([]string{"Scan Date:", time.Now().Format("2006-01-02 15:04:05")})
-	writer.Write([]string{}) // Empty line
-
-	// Write CSV headers
-	writer.Write([]string{
-		"IP Address",
-		"Hostname",
-		"MAC Address",
-		"Open Ports",
-		"mDNS Name",
-		"mDNS Services",
-	})
-
-	// Sort devices by IP for consistent output
-	var ips []string
-	for ip := range s.devices {
-		ips = append(ips, ip)
-	}
-	sort.Slice(ips, func(i, j int) bool {
-		return CompareIPs(ips[i], ips[j]) < 0
-	})
-
-	// Write device data
-	for _, ip := range ips {
-		device := s.devices[ip]
-		ports := make([]string, 0, len(device.OpenPorts))
-		for _, port := range device.OpenPorts {
-			ports = append(ports, fmt.Sprintf("%d", port))
-		}
-
-		// Format mDNS services
-		var mdnsServices string
-		if len(device.MDNSServices) > 0 {
-			services := make([]string, 0, len(device.MDNSServices))
-			for k, v := range device.MDNSServices {
-				services = append(services, fmt.Sprintf("%s: %s", k, v))
-			}
-			mdnsServices = strings.Join(services, "; ")
-		}
-
-		writer.Write([]string{
-			device.IPAddress,
-			strings.Join(device.Hostname, ", "),
-			device.MACAddress,
-			strings.Join(ports, ", "),
-			device.MDNSName,
-			mdnsServices,
-		})
+	if err := export.WriteCSV(w, s.redactor.Devices(s.filter.Apply(s.devices)), s.redactor.ScanInfo(info)); err != nil {
+		log.Printf("Error writing CSV export: %v", err)
 	}
 }
 
@@ -646,11 +1108,7 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 	}
 
 	// Get default gateway information
-	gatewayIP, err := gateway.DiscoverGateway()
-	if err != nil {
-		log.Printf("Error discovering gateway: %v", err)
-		gatewayIP = nil
-	}
+	gatewayIP := discoverGateway()
 
 	var networkInterfaces []views.Interface
 	for _, iface := range ifaces {
@@ -695,6 +1153,10 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 			ones, _ := ipNet.Mask.Size()
 			cidr := fmt.Sprintf("/%d", ones)
 
+			var vendor string
+			if len(iface.HardwareAddr) > 0 {
+				vendor = scanner.LookupVendor(iface.HardwareAddr.String())
+			}
 			networkInterfaces = append(networkInterfaces, views.Interface{
 				Name:         iface.Name,
 				FriendlyName: displayName,
@@ -702,6 +1164,7 @@ func getNetworkInterfaces() ([]views.Interface, error) {
 				SubnetMask:   ipNet.Mask.String(),
 				CIDR:         cidr,
 				MACAddress:   iface.HardwareAddr.String(),
+				Vendor:       vendor,
 				Gateway:      gateway,
 				IsUp:         isUp,
 				Priority:     getPriority(displayName), // Use display name for priority
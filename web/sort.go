@@ -0,0 +1,99 @@
+package web
+
+import (
+	"strings"
+
+	"github.com/ramborogers/netventory/export"
+	"github.com/ramborogers/netventory/scanner"
+)
+
+// sortKey holds the values the device table sorts by. They are computed here
+// so the web UI orders addresses exactly as the TUI does.
+type sortKey struct {
+	IP       int    `json:"ip"`       // Position of the address in CompareIPs order
+	Hostname string `json:"hostname"` // First hostname or mDNS name, lowercased
+	Vendor   string `json:"vendor"`   // MAC vendor, lowercased
+	Ports    int    `json:"ports"`    // Number of open ports
+}
+
+// sortKeys returns the sort key of every device, keyed by IP
+func sortKeys(devices map[string]scanner.Device) map[string]sortKey {
+	keys := make(map[string]sortKey, len(devices))
+	for rank, ip := range export.SortedIPs(devices) {
+		device := devices[ip]
+		name := device.MDNSName
+		if len(device.Hostname) > 0 {
+			name = device.Hostname[0]
+		}
+		keys[ip] = sortKey{
+			IP:       rank,
+			Hostname: strings.ToLower(name),
+			Vendor:   strings.ToLower(device.Vendor),
+			Ports:    len(device.OpenPorts),
+		}
+	}
+	return keys
+}
+
+// devicesUpdate returns the client message carrying the devices that pass
+// the filter and their sort keys
+func (s *Server) devicesUpdate(devices map[string]scanner.Device) map[string]interface{} {
+	devices, keys := s.clientDevices(s.filter.Apply(devices))
+	return map[string]interface{}{
+		"type":    "devices",
+		"devices": devices,
+		"sort":    keys,
+		"total":   len(devices),
+	}
+}
+
+// clientDevices returns devices as clients see them, with their sort keys.
+// With a redactor they are redacted and keyed and addressed by
+// Redactor.Tag, still ranked by their real addresses.
+func (s *Server) clientDevices(devices map[string]scanner.Device) (map[string]scanner.Device, map[string]sortKey) {
+	keys := sortKeys(devices)
+	if s.redactor == nil {
+		return devices, keys
+	}
+	shown := make(map[string]scanner.Device, len(devices))
+	shownKeys := make(map[string]sortKey, len(keys))
+	for ip, device := range devices {
+		tag := s.redactor.Tag(ip)
+		device = s.redactor.Device(device)
+		device.IPAddress = tag
+		shown[tag] = device
+		key := keys[ip]
+		key.Hostname = "" // Redacted with the names
+		shownKeys[tag] = key
+	}
+	return shown, shownKeys
+}
+
+// deviceIP returns the address of the listed device a client refers to as
+// shown, its Redactor.Tag when redacting
+func (s *Server) deviceIP(shown string) string {
+	if s.redactor == nil {
+		return shown
+	}
+	for ip := range s.snapshotDevices() {
+		if s.redactor.Tag(ip) == shown {
+			return ip
+		}
+	}
+	return shown
+}
+
+// clientDiff returns diff with its addresses as clients see them
+func (s *Server) clientDiff(diff export.Diff) export.Diff {
+	if s.redactor == nil {
+		return diff
+	}
+	tag := func(ips []string) []string {
+		tagged := make([]string, len(ips))
+		for i, ip := range ips {
+			tagged[i] = s.redactor.Tag(ip)
+		}
+		return tagged
+	}
+	return export.Diff{Added: tag(diff.Added), Removed: tag(diff.Removed), Changed: tag(diff.Changed)}
+}
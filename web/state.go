@@ -0,0 +1,64 @@
+package web
+
+import "time"
+
+// ScanState is where the web server's scan is in its lifecycle. Every change
+// is broadcast to clients as a status message.
+type ScanState string
+
+const (
+	StateIdle     ScanState = "idle"     // No scan has run yet
+	StateScanning ScanState = "scanning" // A scan is running
+	StateStopping ScanState = "stopping" // A stop was requested; workers are winding down
+	StateStopped  ScanState = "stopped"  // The scan was stopped; partial results are kept
+	StateComplete ScanState = "complete" // The scan finished; results are kept
+	StateAborted  ScanState = "aborted"  // The scanner gave up, e.g. the network went away; partial results are kept
+	StateCleared  ScanState = "cleared"  // Results were dumped
+)
+
+// Active reports whether a scan is running or winding down, so a new one
+// can't start yet
+func (st ScanState) Active() bool {
+	return st == StateScanning || st == StateStopping
+}
+
+// State returns the current scan state
+func (s *Server) State() ScanState {
+	s.scanMutex.RLock()
+	defer s.scanMutex.RUnlock()
+	return s.state
+}
+
+// statusUpdate returns the current scan state as a client message. The
+// caller must hold scanMutex.
+func (s *Server) statusUpdate() map[string]interface{} {
+	update := map[string]interface{}{
+		"type":  "status",
+		"state": s.state,
+		"range": s.redactor.Range(s.scanRange),
+	}
+	if !s.scanStarted.IsZero() {
+		update["started"] = s.scanStarted.Format(time.RFC3339)
+	}
+	if !s.scanFinished.IsZero() {
+		update["finished"] = s.scanFinished.Format(time.RFC3339)
+	}
+	if s.state == StateAborted && s.scanErr != nil {
+		update["error"] = s.scanErr.Error()
+	}
+	return update
+}
+
+// broadcastStatus sends the current scan state to all clients. Broadcasts
+// are serialized and read the state when sent, so the last message a client
+// gets always matches the server.
+func (s *Server) broadcastStatus() {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	s.scanMutex.RLock()
+	update := s.statusUpdate()
+	s.scanMutex.RUnlock()
+
+	s.BroadcastUpdate(update)
+}
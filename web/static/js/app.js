@@ -3,6 +3,10 @@ class NetVentoryApp {
         this.ws = null;
         this.currentScreen = 'interface-selection';
         this.devices = new Map();
+        this.warnings = new Map();  // IP -> warning messages received during the scan
+        this.sortKeys = new Map();  // IP -> sort key computed by the server
+        this.sortColumn = 'ip';
+        this.sortAscending = true;
         this.scanStartTime = null;
         this.scanActive = false;
         this.setupWebSocket();
@@ -15,8 +19,7 @@ class NetVentoryApp {
 
     setupWebSocket() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const authToken = new URLSearchParams(window.location.search).get('auth');
-        this.ws = new WebSocket(`${protocol}//${window.location.host}/ws?auth=${authToken}`);
+        this.ws = new WebSocket(`${protocol}//${window.location.host}/ws${this.authQuery()}`);
 
         this.ws.onmessage = (event) => {
             const data = JSON.parse(event.data);
@@ -102,6 +105,51 @@ class NetVentoryApp {
             this.saveScan();
         });
 
+        // Add host button, for known hosts the sweep missed
+        const addHostButton = document.createElement('button');
+        addHostButton.id = 'add-host';
+        addHostButton.textContent = 'Add Host';
+        addHostButton.classList.add('action-button', 'add-host', 'hidden');
+        actionButtons.appendChild(addHostButton);
+
+        addHostButton.addEventListener('click', () => {
+            const ip = prompt('IP address to add:');
+            if (ip === null) return;
+            if (!this.validateCIDR(ip.trim() + '/32')) {
+                this.showError('Invalid IP address');
+                return;
+            }
+            this.addHost(ip.trim());
+        });
+
+        // Resolve names button, for when DNS comes back after a scan
+        const resolveButton = document.createElement('button');
+        resolveButton.id = 'resolve-names';
+        resolveButton.textContent = 'Resolve Names';
+        resolveButton.classList.add('action-button', 'resolve-names', 'hidden');
+        actionButtons.appendChild(resolveButton);
+
+        resolveButton.addEventListener('click', () => {
+            this.resolveNames();
+        });
+
+        // Sort the device table by the clicked column; a second click reverses it
+        document.querySelectorAll('th[data-sort]').forEach(th => {
+            th.addEventListener('click', () => {
+                if (this.sortColumn === th.dataset.sort) {
+                    this.sortAscending = !this.sortAscending;
+                } else {
+                    this.sortColumn = th.dataset.sort;
+                    this.sortAscending = th.dataset.sort !== 'ports';  // Most ports first
+                }
+                document.querySelectorAll('th[data-sort]').forEach(other => {
+                    other.classList.remove('sorted-asc', 'sorted-desc');
+                });
+                th.classList.add(this.sortAscending ? 'sorted-asc' : 'sorted-desc');
+                this.updateDevices([]);
+            });
+        });
+
         // Delegate device row clicks
         document.getElementById('device-table').addEventListener('click', (e) => {
             const row = e.target.closest('tr');
@@ -119,24 +167,19 @@ class NetVentoryApp {
                 this.updateInterfaces(data.interfaces);
                 break;
             case 'devices':
-                // Update device list without affecting progress
+                // The server sends sort keys for the whole device set
+                if (data.sort) {
+                    this.sortKeys = new Map(Object.entries(data.sort));
+                }
+                // Update device list without affecting progress. The server
+                // sends every device passing its filter, so one that no
+                // longer passes drops out.
+                this.devices.clear();
                 if (Array.isArray(data.devices)) {
                     this.updateDevices(data.devices);
                 } else if (data.devices && typeof data.devices === 'object') {
                     this.updateDevices(Object.values(data.devices));
                 }
-
-                // If we have devices and we're not scanning, show the scan view with completed state
-                if (Object.keys(data.devices || {}).length > 0 && !this.scanActive) {
-                    this.showScreen('scanning-view');
-                    document.querySelector('.current-status').textContent = 'Previous scan results';
-                    document.querySelector('.progress').classList.add('complete');
-                    document.querySelector('.progress').style.width = '100%';
-                    document.querySelector('.progress-status').textContent = 'SCAN DONE';
-                    // Show dump and save scan buttons
-                    document.getElementById('dump-scan').classList.remove('hidden');
-                    document.getElementById('save-scan').classList.remove('hidden');
-                }
                 break;
             case 'progress':
                 console.log('Progress update:', data);  // Debug log
@@ -144,15 +187,55 @@ class NetVentoryApp {
                     this.updateProgress(data);
                 }
                 break;
-            case 'scan_complete':
-                this.handleScanComplete();
+            case 'status':
+                this.handleStatus(data);
                 break;
             case 'error':
                 this.showError(data.error);
                 break;
+            case 'schedule':
+                this.updateSchedule(data);
+                break;
+            case 'scan_diff':
+                this.lastDiff = data.diff;
+                break;
+            case 'device_warning':
+                this.addWarning(data.ip, data.message);
+                break;
+            case 'names_resolved':
+                document.querySelector('.current-status').textContent =
+                    `Resolved names again: ${data.changed} of ${data.total} devices changed`;
+                break;
         }
     }
 
+    addWarning(ip, message) {
+        const messages = this.warnings.get(ip) || [];
+        messages.push(message);
+        this.warnings.set(ip, messages);
+
+        // Badge the row now if the device is already listed
+        const row = document.querySelector(`#device-table tr[data-ip="${ip}"]`);
+        if (row) {
+            row.classList.add('device-warning');
+            row.title = messages.join('\n');
+        }
+    }
+
+    updateSchedule(data) {
+        const schedule = document.querySelector('.scan-schedule');
+        const last = new Date(data.last_scan).toLocaleTimeString();
+        const next = new Date(data.next_scan).toLocaleTimeString();
+        let text = `Last scan: ${last} • Next scan: ${next}`;
+        if (this.lastDiff) {
+            const diff = this.lastDiff;
+            const count = (list) => (list || []).length;
+            text += ` • Since previous: +${count(diff.added)} new, -${count(diff.removed)} gone, ${count(diff.changed)} changed`;
+        }
+        schedule.textContent = text;
+        schedule.classList.remove('hidden');
+    }
+
     showScreen(screenName) {
         document.querySelectorAll('main > div').forEach(div => div.classList.add('hidden'));
         document.querySelector(`.${screenName}`).classList.remove('hidden');
@@ -172,15 +255,11 @@ class NetVentoryApp {
             this.updateDevices(Array.from(this.devices.values()));
 
             // Update the stats display
-            const onlineDevices = Array.from(this.devices.values()).filter(d => d.OpenPorts && d.OpenPorts.length > 0).length;
-            document.querySelector('.discovered').textContent = `${onlineDevices} devices`;
-
-            if (!this.scanActive) {
-                document.querySelector('.current-status').textContent = 'Previous scan results';
-                document.querySelector('.progress').classList.add('complete');
-                document.querySelector('.progress').style.width = '100%';
-                document.querySelector('.progress-status').textContent = 'SCAN DONE';
-            }
+            // The devices listed, which the server has already filtered
+            const onlineDevices = this.devices.size;
+            document.querySelector('.discovered').textContent = data.truncated_at
+            ? `${onlineDevices} devices (results truncated at ${data.truncated_at})`
+            : `${onlineDevices} devices`;
         }
     }
 
@@ -190,7 +269,7 @@ class NetVentoryApp {
             <div class="interface-card" data-name="${iface.Name}">
                 <h3>${iface.FriendlyName}</h3>
                 <p>IP: ${iface.IPAddress}</p>
-                <p>MAC: ${iface.MACAddress}</p>
+                <p>MAC: ${iface.MACAddress}${iface.Vendor ? ` (${iface.Vendor})` : ''}</p>
                 <p>Gateway: ${iface.Gateway}</p>
             </div>
         `).join('');
@@ -199,7 +278,7 @@ class NetVentoryApp {
         container.querySelectorAll('.interface-card').forEach(card => {
             card.addEventListener('click', () => {
                 const selectedIface = interfaces.find(i => i.Name === card.dataset.name);
-                document.getElementById('cidr-range').value = selectedIface.IPAddress + selectedIface.CIDR;
+                document.getElementById('cidr-range').value = this.networkRange(selectedIface.IPAddress + selectedIface.CIDR);
                 this.showScreen('scan-confirmation');
             });
         });
@@ -219,19 +298,30 @@ class NetVentoryApp {
 
         const tbody = document.getElementById('device-table');
         const deviceList = Array.from(this.devices.values())
-            .sort((a, b) => this.compareIPs(a.IPAddress, b.IPAddress));
+            .sort((a, b) => this.compareDevices(a, b));
 
         console.log('Updating device table with', deviceList.length, 'devices');
 
         tbody.innerHTML = deviceList.map(device => `
-            <tr data-ip="${device.IPAddress}">
+            <tr data-ip="${device.IPAddress}"${this.warnings.has(device.IPAddress) ? ` class="device-warning" title="${this.escape(this.warnings.get(device.IPAddress).join('\n'))}"` : ''}>
                 <td>${device.IPAddress}</td>
-                <td>${device.Hostname ? device.Hostname.join(', ') : ''}</td>
+                <td>${device.Role ? `<span class="badge-role">${this.escape(device.Role)}</span> ` : ''}${this.isHypervisor(device) ? `<span class="badge-hypervisor">${this.escape(device.DeviceType)}</span> ` : ''}${device.Hostname ? this.escape(device.Hostname.join(', ')) : (this.isMystery(device) ? '<span class="badge-mystery">Unidentified</span>' : '')}</td>
+                <td>${this.escape(device.Vendor || '')}</td>
                 <td>${this.formatPortsWithUrls(device.IPAddress, device.OpenPorts)}</td>
             </tr>
         `).join('');
     }
 
+    isHypervisor(device) {
+        return ['Proxmox VE', 'VMware ESXi', 'VMware vCenter'].includes(device.DeviceType);
+    }
+
+    // A live host with no name or MAC address, worth a deep probe
+    isMystery(device) {
+        return device.Status === 'Up' && !(device.Hostname && device.Hostname.length > 0) &&
+            !device.MDNSName && !device.MACAddress;
+    }
+
     updateProgress(data) {
         if (!this.scanStartTime) {
             this.scanStartTime = new Date();
@@ -247,7 +337,8 @@ class NetVentoryApp {
             return;
         }
 
-        const onlineDevices = Array.from(this.devices.values()).filter(d => d.OpenPorts && d.OpenPorts.length > 0).length;
+        // The devices listed, which the server has already filtered
+        const onlineDevices = this.devices.size;
         const progress = total > 0 ? (completedScans / total) * 100 : 0;
 
         console.log(`Progress update - Scanned: ${completedScans}, Total: ${total}, Progress: ${progress.toFixed(2)}%, Online: ${onlineDevices}`);
@@ -262,22 +353,16 @@ class NetVentoryApp {
         // Update progress stats
         document.querySelector('.scanned').textContent = `${completedScans}/${total}`;
         document.querySelector('.rate').textContent = `${rate}/sec`;
-        document.querySelector('.discovered').textContent = `${onlineDevices} devices`;
+        document.querySelector('.discovered').textContent = data.truncated_at
+            ? `${onlineDevices} devices (results truncated at ${data.truncated_at})`
+            : `${onlineDevices} devices`;
         document.querySelector('.elapsed').textContent = this.formatElapsedTime(elapsed);
 
         // Update status text based on progress
-        if (progress >= 100) {
-            document.querySelector('.current-status').textContent = 'Scan Complete';
-            document.querySelector('.progress-status').textContent = 'SCAN DONE';
-            progressBar.classList.add('complete');
-            document.getElementById('stop-scan').classList.add('hidden');
-            document.getElementById('dump-scan').classList.remove('hidden');
-            document.getElementById('save-scan').classList.remove('hidden');
-            this.scanActive = false;
-        } else {
+        // The server's status message ends the scan; until then keep counting
+        if (this.scanActive) {
             document.querySelector('.current-status').textContent =
                 `Scanning: ${onlineDevices} devices found`;
-            document.querySelector('.progress-status').textContent = 'SCANNING';
         }
     }
 
@@ -287,6 +372,76 @@ class NetVentoryApp {
         return `${mins.toString().padStart(2, '0')}:${secs.toString().padStart(2, '0')}`;
     }
 
+    // handleStatus applies a scan state change from the server. The server is
+    // the only source of truth for which buttons show, so tabs and reconnects
+    // always agree.
+    handleStatus(data) {
+        if (data.started) {
+            this.scanStartTime = new Date(data.started);
+        }
+
+        switch (data.state) {
+            case 'scanning':
+                this.handleScanStarted(data.range);
+                break;
+            case 'stopping':
+                this.scanActive = false;
+                this.showButtons([]);
+                document.querySelector('.current-status').textContent = 'Stopping scan...';
+                document.querySelector('.progress-status').textContent = 'STOPPING';
+                break;
+            case 'stopped':
+                this.handleScanStopped();
+                break;
+            case 'complete':
+                this.handleScanComplete();
+                break;
+            case 'aborted':
+                this.handleScanAborted(data.error);
+                break;
+            case 'cleared':
+                this.clearScan();
+                break;
+            default:  // idle
+                this.scanActive = false;
+                this.showButtons([]);
+                break;
+        }
+    }
+
+    // showButtons shows the named action buttons and hides the rest
+    showButtons(ids) {
+        ['stop-scan', 'dump-scan', 'save-scan', 'add-host', 'resolve-names'].forEach(id => {
+            document.getElementById(id).classList.toggle('hidden', !ids.includes(id));
+        });
+    }
+
+    handleScanStarted(range) {
+        if (!this.scanActive) {
+            // A new scan, possibly started from another tab
+            this.devices.clear();
+            this.warnings.clear();
+            this.sortKeys.clear();
+            document.getElementById('device-table').innerHTML = '';
+            const progressBar = document.querySelector('.progress');
+            progressBar.style.width = '0%';
+            progressBar.classList.remove('complete');
+            document.querySelector('.current-status').textContent = range ? `Starting scan of ${range}...` : 'Starting scan...';
+        }
+        this.scanActive = true;
+        if (!this.scanStartTime) {
+            this.scanStartTime = new Date();
+        }
+        sessionStorage.setItem('scanActive', 'true');
+        sessionStorage.setItem('scanStartTime', this.scanStartTime.getTime().toString());
+
+        document.querySelector('.progress-status').textContent = 'SCANNING';
+        this.showButtons(['stop-scan']);
+        if (this.currentScreen !== 'device-details') {
+            this.showScreen('scanning-view');
+        }
+    }
+
     handleScanComplete() {
         // Update status text
         document.querySelector('.current-status').textContent = 'Scan Complete';
@@ -297,12 +452,32 @@ class NetVentoryApp {
         progressBar.classList.add('complete');
         progressBar.style.width = '100%';
 
-        // Hide stop scan button
-        document.getElementById('stop-scan').classList.add('hidden');
+        this.finishScan();
+    }
+
+    handleScanStopped() {
+        // Leave the progress bar where the scan stopped; the results are kept
+        document.querySelector('.current-status').textContent = 'Scan Stopped';
+        document.querySelector('.progress-status').textContent = 'STOPPED';
+
+        this.finishScan();
+    }
 
-        // Show dump and save scan buttons
-        document.getElementById('dump-scan').classList.remove('hidden');
-        document.getElementById('save-scan').classList.remove('hidden');
+    handleScanAborted(error) {
+        // The scanner gave up, so say why instead of reporting a finished scan
+        const reason = error ? error.charAt(0).toUpperCase() + error.slice(1) : 'Scan aborted';
+        document.querySelector('.current-status').textContent = `${reason} — scan aborted`;
+        document.querySelector('.progress-status').textContent = 'ABORTED';
+
+        this.finishScan();
+    }
+
+    finishScan() {
+        // Swap the stop button for dump, save, add host and resolve names
+        this.showButtons(['dump-scan', 'save-scan', 'add-host', 'resolve-names']);
+        if (this.currentScreen === 'interface-selection' || this.currentScreen === 'scan-confirmation') {
+            this.showScreen('scanning-view');
+        }
 
         // Update scan state
         this.scanActive = false;
@@ -317,36 +492,97 @@ class NetVentoryApp {
     }
 
     startScan(range) {
+        // The server answers with a scanning status, or an error if a scan
+        // is already running
         this.ws.send(JSON.stringify({
             type: 'start_scan',
             range: range
         }));
-        this.showScreen('scanning-view');
-        this.scanStartTime = new Date();
-        this.scanActive = true;
-        sessionStorage.setItem('scanActive', 'true');
-        sessionStorage.setItem('scanStartTime', this.scanStartTime.getTime().toString());
-
-        const progressBar = document.querySelector('.progress');
-        progressBar.style.width = '0%';
-        progressBar.classList.remove('complete');
-        document.querySelector('.progress-status').textContent = 'Scanning';
-        document.getElementById('stop-scan').classList.remove('hidden');
-        document.querySelector('.current-status').textContent = 'Starting scan...';
+        this.scanStartTime = null;
         document.querySelector('.current-status').style.color = 'var(--text-secondary)';
     }
 
     stopScan() {
         if (!this.scanActive) return;
 
+        // Hide the button right away so it can't be pressed twice; the
+        // stopping status follows
         this.ws.send(JSON.stringify({
             type: 'stop_scan'
         }));
-        this.scanActive = false;
-        sessionStorage.removeItem('scanActive');
-        sessionStorage.removeItem('scanStartTime');
-        document.getElementById('stop-scan').classList.add('hidden');
-        document.querySelector('.current-status').textContent = 'Scan stopped by user';
+        this.showButtons([]);
+    }
+
+    // escape makes a string the device supplied, such as a hostname or a
+    // type read from a banner, safe to put in HTML
+    escape(text) {
+        const div = document.createElement('div');
+        div.textContent = text;
+        return div.innerHTML.replace(/"/g, '&quot;');
+    }
+
+    // formatCertificate summarizes a certificate as the TUI does. Its names
+    // come from the device, so they are escaped.
+    formatCertificate(cert) {
+        const name = cert.Subject || (cert.DNSNames && cert.DNSNames[0]) || '(no subject)';
+        let text = `${name}, expires ${cert.NotAfter.slice(0, 10)}`;
+        if (cert.SelfSigned) {
+            text += ', self-signed';
+        }
+        return this.escape(text);
+    }
+
+    // formatVNC summarizes a VNC handshake as the TUI does, escaping the
+    // desktop name and refusal reason
+    formatVNC(vnc) {
+        let text = `RFB ${vnc.Version}`;
+        if (vnc.Server) {
+            text += ` (${vnc.Server})`;
+        }
+        const security = vnc.Security || [];
+        if (vnc.Refused) {
+            text += `, refused: ${vnc.Refused}`;
+        } else if (security.includes('None')) {
+            text += ', no auth';
+        } else {
+            text += `, auth: ${security.join(', ')}`;
+        }
+        if (vnc.Desktop) {
+            text += `, desktop "${vnc.Desktop}"`;
+        }
+        return this.escape(text);
+    }
+
+    // formatPrinter summarizes a printer's model and page count as the TUI
+    // does, escaping the model the printer reported
+    formatPrinter(printer) {
+        let text = printer.Model || 'Unknown model';
+        if (printer.PageCount > 0) {
+            text += `, ${printer.PageCount} pages`;
+        }
+        return this.escape(text);
+    }
+
+    // formatWebResponse summarizes a front page response as the TUI does,
+    // escaping the redirect target
+    formatWebResponse(page) {
+        let text = `${page.Status}`;
+        if (page.Location) {
+            text += ` → ${page.Location}`;
+        }
+        return this.escape(text);
+    }
+
+    // timeAgo formats how long ago a first or last seen time was, as the
+    // TUI does; Go's zero time means the device was never found up
+    timeAgo(value) {
+        const seen = new Date(value);
+        if (isNaN(seen) || seen.getUTCFullYear() <= 1) return '';
+        const seconds = Math.max(0, Math.floor((Date.now() - seen) / 1000));
+        if (seconds < 60) return `${seconds}s ago`;
+        if (seconds < 3600) return `${Math.floor(seconds / 60)}m ago`;
+        if (seconds < 86400) return `${Math.floor(seconds / 3600)}h ago`;
+        return `${Math.floor(seconds / 86400)}d ago`;
     }
 
     formatPortsWithUrls(ip, ports, detailed = false) {
@@ -401,6 +637,12 @@ class NetVentoryApp {
         const content = document.querySelector('.details-content');
         content.innerHTML = `
             <h2>Device Details</h2>
+            ${this.isMystery(device) ? `
+                <p class="mystery-hint">Unidentified: no hostname or MAC address was found. A deep probe tries more ports, every name lookup and longer timeouts.</p>
+            ` : ''}
+            ${device.Status === 'Up' ? `
+                <button class="action-button deep-probe">Deep Probe</button>
+            ` : ''}
             <div class="detail-grid">
                 <div class="detail-item">
                     <label>IP Address</label>
@@ -408,35 +650,178 @@ class NetVentoryApp {
                 </div>
                 <div class="detail-item">
                     <label>Hostname</label>
-                    <span class="detail-value">${device.Hostname ? device.Hostname.join(', ') : 'N/A'}</span>
+                    <span class="detail-value">${device.Hostname ? this.escape(device.Hostname.join(', ')) : 'N/A'}</span>
                 </div>
                 <div class="detail-item">
                     <label>MAC Address</label>
                     <span class="detail-value">${device.MACAddress || 'N/A'}</span>
                 </div>
+                ${device.Vendor ? `
+                    <div class="detail-item">
+                        <label>Vendor</label>
+                        <span class="detail-value">${device.RandomMAC ? '&#9888; ' : ''}${this.escape(device.Vendor)}</span>
+                    </div>
+                ` : ''}
+                ${device.Role ? `
+                    <div class="detail-item">
+                        <label>Role</label>
+                        <span class="detail-value badge-role">${this.escape(device.Role)}</span>
+                    </div>
+                ` : ''}
+                ${device.DeviceType ? `
+                    <div class="detail-item">
+                        <label>Device Type</label>
+                        <span class="detail-value${this.isHypervisor(device) ? ' badge-hypervisor' : ''}">${this.escape(device.DeviceType)}${device.Version ? ` ${this.escape(device.Version)}` : ''}</span>
+                    </div>
+                ` : ''}
+                ${device.Domain ? `
+                    <div class="detail-item">
+                        <label>Domain</label>
+                        <span class="detail-value">${this.escape(device.Domain)}</span>
+                    </div>
+                ` : ''}
+                ${this.timeAgo(device.FirstSeen) ? `
+                    <div class="detail-item">
+                        <label>First Seen</label>
+                        <span class="detail-value" title="${device.FirstSeen}">${this.timeAgo(device.FirstSeen)}</span>
+                    </div>
+                    <div class="detail-item">
+                        <label>Last Seen</label>
+                        <span class="detail-value" title="${device.LastSeen}">${this.timeAgo(device.LastSeen)}</span>
+                    </div>
+                ` : ''}
                 <div class="detail-item">
                     <label>Open Ports</label>
                     <span class="detail-value">${this.formatPortsWithUrls(device.IPAddress, device.OpenPorts, true)}</span>
                 </div>
+                ${device.ClosedPorts && device.ClosedPorts.length > 0 ? `
+                    <div class="detail-item">
+                        <label>Closed Ports</label>
+                        <span class="detail-value">${device.ClosedPorts.join(', ')}</span>
+                    </div>
+                ` : ''}
+                ${device.FilteredPorts && device.FilteredPorts.length > 0 ? `
+                    <div class="detail-item">
+                        <label>Filtered Ports</label>
+                        <span class="detail-value">${device.FilteredPorts.join(', ')}</span>
+                    </div>
+                ` : ''}
+                ${device.Web ? `
+                    <div class="detail-item">
+                        <label>Web${device.CaptivePortal ? ' (captive portal)' : ''}</label>
+                        <span class="detail-value">${Object.entries(device.Web).map(([port, page]) =>
+                            `${port}: ${this.formatWebResponse(page)}`).join('<br>')}</span>
+                    </div>
+                ` : ''}
+                ${device.VNC ? `
+                    <div class="detail-item">
+                        <label>VNC</label>
+                        <span class="detail-value">${this.formatVNC(device.VNC)}</span>
+                    </div>
+                ` : ''}
+                ${device.Printer ? `
+                    <div class="detail-item">
+                        <label>Printer</label>
+                        <span class="detail-value">${this.formatPrinter(device.Printer)}</span>
+                    </div>
+                ` : ''}
+                ${device.Banners ? `
+                    <div class="detail-item">
+                        <label>Banners</label>
+                        <span class="detail-value">${Object.entries(device.Banners).map(([port, banner]) =>
+                            `${port}: ${this.escape(banner)}`).join('<br>')}</span>
+                    </div>
+                ` : ''}
+                ${device.AnonymousFTP ? `
+                    <div class="detail-item">
+                        <label>Anonymous FTP</label>
+                        <span class="detail-value badge-finding">allowed</span>
+                    </div>
+                ` : ''}
+                ${device.Certificates ? `
+                    <div class="detail-item">
+                        <label>Certificates</label>
+                        <span class="detail-value">${Object.entries(device.Certificates).map(([port, cert]) =>
+                            `${port}: ${this.formatCertificate(cert)}`).join('<br>')}</span>
+                    </div>
+                ` : ''}
                 ${device.MDNSName ? `
                     <div class="detail-item">
                         <label>mDNS Name</label>
-                        <span class="detail-value">${device.MDNSName}</span>
+                        <span class="detail-value">${this.escape(device.MDNSName)}</span>
+                    </div>
+                ` : ''}
+                ${device.Notes && device.Notes.length > 0 ? `
+                    <div class="detail-item">
+                        <label>Notes</label>
+                        <span class="detail-value">${device.Notes.map(note => this.escape(note)).join('<br>')}</span>
+                    </div>
+                ` : ''}
+                ${device.Provenance ? `
+                    <div class="detail-item">
+                        <label>How we know</label>
+                        <span class="detail-value">${Object.entries(device.Provenance).map(([field, source]) =>
+                            `${this.escape(field)}: ${this.escape(source)}`).join('<br>')}</span>
                     </div>
                 ` : ''}
                 ${device.MDNSServices ? `
                     <div class="detail-item">
                         <label>mDNS Services</label>
                         <span class="detail-value">${Object.entries(device.MDNSServices).map(([k,v]) =>
-                            `${k}: ${v}`).join('<br>')}</span>
+                            `${this.escape(k)}: ${this.escape(v)}`).join('<br>')}</span>
                     </div>
                 ` : ''}
             </div>
         `;
 
+        const deepButton = content.querySelector('.deep-probe');
+        if (deepButton) {
+            deepButton.addEventListener('click', () => this.deepProbe(device.IPAddress));
+        }
+
         this.showScreen('device-details');
     }
 
+    // sortKey returns the server's sort key for a device, or one built the
+    // same way for devices restored from session storage
+    sortKey(device) {
+        const key = this.sortKeys.get(device.IPAddress);
+        if (key) return key;
+        const name = device.Hostname && device.Hostname.length > 0 ? device.Hostname[0] : (device.MDNSName || '');
+        return {
+            hostname: name.toLowerCase(),
+            vendor: (device.Vendor || '').toLowerCase(),
+            ports: device.OpenPorts ? device.OpenPorts.length : 0
+        };
+    }
+
+    // compareDevices orders devices by the selected column. Empty names and
+    // vendors sort last either way, and ties fall back to IP order.
+    compareDevices(a, b) {
+        const keyA = this.sortKey(a);
+        const keyB = this.sortKey(b);
+        const byIP = (keyA.ip !== undefined && keyB.ip !== undefined)
+            ? keyA.ip - keyB.ip
+            : this.compareIPs(a.IPAddress, b.IPAddress);
+        const direction = this.sortAscending ? 1 : -1;
+
+        switch (this.sortColumn) {
+            case 'hostname':
+            case 'vendor': {
+                const valueA = keyA[this.sortColumn];
+                const valueB = keyB[this.sortColumn];
+                if (valueA === valueB) return byIP;
+                if (!valueA) return 1;
+                if (!valueB) return -1;
+                return direction * valueA.localeCompare(valueB);
+            }
+            case 'ports':
+                return direction * (keyA.ports - keyB.ports) || byIP;
+            default:
+                return direction * byIP;
+        }
+    }
+
     compareIPs(a, b) {
         const aOctets = a.split('.').map(Number);
         const bOctets = b.split('.').map(Number);
@@ -474,14 +859,58 @@ class NetVentoryApp {
         });
     }
 
+    // networkRange clears the host bits of an IPv4 CIDR, so 192.168.1.50/24
+    // reads as the 192.168.1.0/24 that is scanned
+    networkRange(cidr) {
+        if (!this.validateCIDR(cidr)) return cidr;
+        const [ip, bits] = cidr.split('/');
+        const mask = bits === '0' ? 0 : (~0 << (32 - parseInt(bits, 10))) >>> 0;
+        const addr = ip.split('.').reduce((acc, octet) => ((acc << 8) | parseInt(octet, 10)) >>> 0, 0);
+        const network = (addr & mask) >>> 0;
+        return [24, 16, 8, 0].map(shift => (network >>> shift) & 255).join('.') + '/' + parseInt(bits, 10);
+    }
+
+    addHost(ip) {
+        // The server scans the host and broadcasts it with the other devices,
+        // even if it is down
+        this.ws.send(JSON.stringify({
+            type: 'add_host',
+            ip: ip
+        }));
+        document.querySelector('.current-status').textContent = `Scanning ${ip}...`;
+    }
+
+    deepProbe(ip) {
+        // The server probes the host in depth and broadcasts it with the
+        // other devices
+        this.ws.send(JSON.stringify({
+            type: 'deep_probe',
+            ip: ip
+        }));
+        document.querySelector('.current-status').textContent = `Deep probing ${ip}...`;
+    }
+
+    resolveNames() {
+        // The server resolves the hostnames of the listed devices again and
+        // broadcasts those that changed
+        this.ws.send(JSON.stringify({
+            type: 'resolve_names'
+        }));
+        document.querySelector('.current-status').textContent = 'Resolving names...';
+    }
+
     dumpScan() {
-        // Send dump request to server
+        // The server clears its results and broadcasts the cleared status
         this.ws.send(JSON.stringify({
             type: 'dump_scan'
         }));
+    }
 
+    clearScan() {
         // Clear all scan data
         this.devices.clear();
+        this.warnings.clear();
+        this.sortKeys.clear();
         this.scanActive = false;
         this.scanStartTime = null;
 
@@ -504,21 +933,23 @@ class NetVentoryApp {
         document.getElementById('device-table').innerHTML = '';
 
         // Hide buttons
-        document.getElementById('dump-scan').classList.add('hidden');
-        document.getElementById('save-scan').classList.add('hidden');
-        document.getElementById('stop-scan').classList.add('hidden');
+        this.showButtons([]);
         document.getElementById('return-to-scan')?.classList.add('hidden');
 
         // Return to interface selection
         this.showScreen('interface-selection');
     }
 
-    saveScan() {
-        // Get auth token from URL
+    // authQuery returns the ?auth= query from the page URL, or nothing when
+    // the page was opened without one and the auth cookie is doing the work
+    authQuery() {
         const authToken = new URLSearchParams(window.location.search).get('auth');
+        return authToken ? `?auth=${encodeURIComponent(authToken)}` : '';
+    }
 
+    saveScan() {
         // Create download URL with auth token
-        const downloadUrl = `/save?auth=${authToken}`;
+        const downloadUrl = `/save${this.authQuery()}`;
 
         // Create temporary link and trigger download
         const link = document.createElement('a');